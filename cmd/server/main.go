@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"datasciencehub/internal/app"
 )
 
 func main() {
+	configPath := flag.String("config", "", "path to the YAML config file (default $CONFIG_PATH or config.yaml)")
+	flag.Parse()
+
 	appCtx := app.NewAppContext()
+	appCtx.ConfigPath = *configPath
 	appCtx.Initialize()
 
 	server := &http.Server{
@@ -36,13 +40,15 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), appCtx.Config.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	appCtx.Close()
+
 	if err := appCtx.MongoClient.Disconnect(ctx); err != nil {
 		log.Fatalf("MongoDB disconnect error: %v", err)
 	}
@@ -1,45 +1,195 @@
 package app
 
 import (
+	"context"
+	"math/rand/v2"
 	"sync"
+	"time"
 
 	"github.com/dop251/goja"
+	"github.com/tetratelabs/wazero"
 
 	"github.com/gin-gonic/gin"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type AppContext struct {
+	ConfigPath  string
 	Config      ServerConfig
 	MongoClient *mongo.Client
 	Router      *gin.Engine
-	Plugins     map[string]*goja.Program
-	VMFactory   func() *goja.Runtime
+	Plugins     map[string]map[string]*compiledPlugin
+	VMFactory   func() *ScriptVM
+	// WasmRuntime compiles and runs wasm plugins.
+	WasmRuntime wazero.Runtime
+	// wasmModules holds the modules WasmRuntime compiled for them.
+	wasmModules *wasmModules
 	PluginsMux  sync.RWMutex
+	JobSlots    chan struct{}
+	ExecSlots   chan struct{}
+
+	// VMPools holds the reusable runtimes of each tenant. Scripts can
+	// change built-in prototypes, which reset does not undo, so runtimes
+	// are never shared between tenants.
+	VMPools    map[string]*sync.Pool
+	VMPoolsMux sync.Mutex
+
+	JobEvents    map[primitive.ObjectID]map[chan JobEvent]struct{}
+	JobEventsMux sync.Mutex
+
+	// JobCancels holds the cancel function of every async job running in
+	// this process.
+	JobCancels    map[primitive.ObjectID]context.CancelFunc
+	JobCancelsMux sync.Mutex
+
+	// ResultCache holds recent execute results; nil unless
+	// enable_result_cache is set.
+	ResultCache *resultCache
+
+	// Scheduler runs scheduled tasks; nil unless enable_scheduler is set.
+	Scheduler *taskScheduler
+
+	// Timeouts counts plugin runs and timeouts in this process.
+	Timeouts *timeoutCounters
+
+	// stopPluginWatch ends the plugin change stream; nil unless
+	// watch_plugins is set.
+	stopPluginWatch func()
+
+	// stopInputSweep ends the removal of expired jobs' inputs; nil unless
+	// job_ttl is set.
+	stopInputSweep func()
+
+	// tracer starts the spans of requests and plugin runs; it records
+	// nothing unless otlp_endpoint is set, when stopTracing flushes it.
+	tracer      trace.Tracer
+	stopTracing func()
+
+	StartedAt time.Time
 }
 
 func NewAppContext() *AppContext {
 	return &AppContext{
-		Plugins: make(map[string]*goja.Program),
+		Plugins:    make(map[string]map[string]*compiledPlugin),
+		VMPools:    make(map[string]*sync.Pool),
+		JobEvents:  make(map[primitive.ObjectID]map[chan JobEvent]struct{}),
+		JobCancels: make(map[primitive.ObjectID]context.CancelFunc),
+		Timeouts:   newTimeoutCounters(),
+		tracer:     noopTracer,
+		StartedAt:  time.Now(),
 	}
 }
 
 func (app *AppContext) Initialize() {
 	app.loadConfig()
+	gin.SetMode(app.Config.GinMode)
+	app.initTracing()
+	app.JobSlots = make(chan struct{}, app.Config.MaxParallel)
+	app.ExecSlots = make(chan struct{}, app.Config.MaxParallel)
+	if app.Config.EnableResultCache {
+		app.ResultCache = newResultCache(app.Config.ResultCacheSize, app.Config.ResultCacheTTL)
+	}
 	app.initMongoDB()
 	app.createIndexes()
+	app.migrate()
 	app.initVMFactory()
 	app.loadPlugins()
 	app.initRouter()
+	if app.Config.WatchPlugins {
+		app.startPluginWatch()
+	}
+	if app.Config.EnableScheduler {
+		app.startScheduler()
+	}
+	if app.Config.JobTTL > 0 {
+		app.startInputSweep()
+	}
+}
+
+// Close stops the background work started by Initialize: the scheduler,
+// whose runs in progress are interrupted, the plugin watch and the input
+// sweep. Spans not yet exported are flushed last.
+func (app *AppContext) Close() {
+	app.stopScheduler()
+	if app.stopPluginWatch != nil {
+		app.stopPluginWatch()
+	}
+	if app.stopInputSweep != nil {
+		app.stopInputSweep()
+	}
+	if app.WasmRuntime != nil {
+		app.WasmRuntime.Close(context.Background())
+	}
+	if app.stopTracing != nil {
+		app.stopTracing()
+	}
+}
+
+// ScriptVM is a goja runtime together with the per-execution state written
+// by the helpers installed into it.
+type ScriptVM struct {
+	*goja.Runtime
+	Logs *logBuffer
+
+	// baseline holds the globals present right after installGlobals; reset
+	// clears everything else.
+	baseline map[string]bool
+
+	// ctx is the context of the execution in progress, used by helpers that
+	// block in Go.
+	ctx     context.Context
+	fetcher *pluginFetcher
+
+	// random is the seeded source of the execution in progress, or nil.
+	random *rand.Rand
 }
 
 func (app *AppContext) initVMFactory() {
-	app.VMFactory = func() *goja.Runtime {
-		vm := goja.New()
-		vm.Set("import", nil)
-		vm.Set("load", nil)
-		vm.Set("require", nil)
+	var fetcher *pluginFetcher
+	if app.Config.AllowPluginNetwork {
+		fetcher = newPluginFetcher(app.Config.PluginNetworkHosts)
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range app.Config.SandboxAllowGlobals {
+		allowed[name] = true
+	}
+
+	app.initWasmRuntime()
+
+	app.VMFactory = func() *ScriptVM {
+		vm := &ScriptVM{Runtime: goja.New(), fetcher: fetcher}
+		vm.SetMaxCallStackSize(maxCallStackSize)
+		hardenRuntime(vm.Runtime, allowed)
+		vm.installGlobals()
+
+		vm.baseline = make(map[string]bool)
+		for _, key := range vm.GlobalObject().Keys() {
+			vm.baseline[key] = true
+		}
 		return vm
 	}
 }
+
+// installGlobals strips the loaders and binds the helpers every plugin can
+// use, replacing any earlier copies a script may have modified.
+func (vm *ScriptVM) installGlobals() {
+	vm.Set("import", nil)
+	vm.Set("load", nil)
+	vm.Set("require", nil)
+
+	// JSON and Math are ECMAScript built-ins and stay available.
+	installStats(vm.Runtime)
+	installCoerce(vm.Runtime)
+	installRandom(vm)
+
+	vm.Logs = &logBuffer{}
+	installConsole(vm.Runtime, vm.Logs)
+
+	if vm.fetcher != nil {
+		installFetch(vm, vm.fetcher)
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const executionsCollection = "executions"
+
+// Execution sources.
+const (
+	ExecutionSourceExecute = "execute"
+	ExecutionSourceTask    = "task"
+)
+
+// recordExecution writes the audit record of a plugin run. The caller comes
+// from ctx; runs without authentication are recorded without one. Failing to
+// write the record is logged but does not fail the run.
+func (app *AppContext) recordExecution(ctx context.Context, record Execution) {
+	if apiKey, ok := callerFromContext(ctx); ok {
+		record.Caller = callerName(apiKey)
+		record.Role = apiKey.Role
+	}
+	record.CreatedAt = time.Now()
+
+	// The request may already be finished, so its cancellation is ignored.
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection(executionsCollection)
+	if _, err := collection.InsertOne(writeCtx, record); err != nil {
+		log.Printf("Error recording execution of plugin %s: %v", record.Plugin, err)
+	}
+}
+
+// callerName identifies an API key in audit records without storing the key
+// itself: by its name, or by a hash prefix for unnamed keys.
+func callerName(apiKey APIKey) string {
+	if apiKey.Name != "" {
+		return apiKey.Name
+	}
+	sum := sha256.Sum256([]byte(apiKey.Key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// inputHash fingerprints an execution's input without storing it.
+func inputHash(input interface{}) string {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// executionRecord builds the audit record of a finished run of plugin.
+func executionRecord(plugin *compiledPlugin, source string, input interface{}, duration time.Duration, err error) Execution {
+	record := Execution{
+		Plugin:     plugin.Name,
+		Version:    plugin.Version,
+		Source:     source,
+		InputHash:  inputHash(input),
+		DurationMS: milliseconds(duration),
+		Success:    err == nil,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// listExecutions pages through audit records, filtered by plugin, caller and
+// creation time.
+func (app *AppContext) listExecutions(c *gin.Context) {
+	pg, err := parsePage(c, []string{"created_at", "plugin", "duration_ms"}, "-created_at")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := bson.M{}
+	if err := addCreatedAtRange(c, filter); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if plugin := c.Query("plugin"); plugin != "" {
+		filter["plugin"] = plugin
+	}
+	if caller := c.Query("caller"); caller != "" {
+		filter["caller"] = caller
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection(executionsCollection)
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := collection.Find(ctx, filter, pg.findOptions())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	executions := make([]Execution, 0)
+	if err = cursor.All(ctx, &executions); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"executions": executions,
+		"total":      total,
+		"limit":      pg.Limit,
+		"offset":     pg.Offset,
+	})
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallerName(t *testing.T) {
+	if got := callerName(APIKey{Name: "ci", Key: "secret"}); got != "ci" {
+		t.Errorf("named key recorded as %q", got)
+	}
+	got := callerName(APIKey{Key: "secret"})
+	if !strings.HasPrefix(got, "key:") || len(got) != len("key:")+16 || strings.Contains(got, "secret") {
+		t.Errorf("unnamed key recorded as %q, want a short hash", got)
+	}
+	if other := callerName(APIKey{Key: "other"}); other == got {
+		t.Error("different keys recorded alike")
+	}
+}
+
+func TestExecutionRecord(t *testing.T) {
+	plugin := &compiledPlugin{Name: "scale", Version: 4}
+	tests := []struct {
+		name        string
+		err         error
+		wantSuccess bool
+		wantError   string
+	}{
+		{"success", nil, true, ""},
+		{"failure", errors.New("boom"), false, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := executionRecord(plugin, ExecutionSourceExecute, map[string]interface{}{"a": 1}, 1500*time.Microsecond, tt.err)
+			if record.Plugin != "scale" || record.Version != 4 || record.Source != ExecutionSourceExecute {
+				t.Errorf("record = %+v, want plugin scale at version 4 run by execute", record)
+			}
+			if record.DurationMS != 1.5 {
+				t.Errorf("duration %v ms, want 1.5", record.DurationMS)
+			}
+			if record.Success != tt.wantSuccess || record.Error != tt.wantError {
+				t.Errorf("success %v with error %q, want %v with %q", record.Success, record.Error, tt.wantSuccess, tt.wantError)
+			}
+			if record.InputHash != inputHash(map[string]interface{}{"a": 1}) || record.InputHash == inputHash(map[string]interface{}{"a": 2}) {
+				t.Errorf("input hash %q does not fingerprint the input", record.InputHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles, from least to most privileged. Each role may do everything the
+// roles before it can.
+const (
+	RoleReader   = "reader"
+	RoleExecutor = "executor"
+	RoleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleReader:   1,
+	RoleExecutor: 2,
+	RoleAdmin:    3,
+}
+
+type APIKey struct {
+	Name string `yaml:"name" bson:"name"`
+	Key  string `yaml:"key" bson:"key"`
+	Role string `yaml:"role" bson:"role"`
+	// Tenant selects the database the key's requests work on; keys
+	// without one share the default database.
+	Tenant string `yaml:"tenant" bson:"tenant"`
+}
+
+// requestAPIKey reads the caller's key from X-API-Key or a bearer token.
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+func (app *AppContext) lookupAPIKey(key string) (APIKey, bool) {
+	for _, k := range app.Config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return k, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// requireRole rejects requests whose API key does not grant at least role.
+// Authentication is disabled when no API keys are configured.
+func (app *AppContext) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(app.Config.APIKeys) == 0 {
+			c.Next()
+			return
+		}
+
+		key := requestAPIKey(c)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing API key"})
+			return
+		}
+
+		apiKey, ok := app.lookupAPIKey(key)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+
+		if roleRank[apiKey.Role] < roleRank[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "requires " + role + " role"})
+			return
+		}
+
+		c.Set("api_key", apiKey)
+		ctx := context.WithValue(c.Request.Context(), apiKeyContextKey{}, apiKey)
+		c.Request = c.Request.WithContext(withTenant(ctx, apiKey.Tenant))
+		c.Next()
+	}
+}
+
+type apiKeyContextKey struct{}
+
+// callerFromContext returns the API key a request was authenticated with, for
+// code that only has the request's context.
+func callerFromContext(ctx context.Context) (APIKey, bool) {
+	apiKey, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return apiKey, ok
+}
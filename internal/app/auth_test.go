@@ -0,0 +1,71 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireRole(t *testing.T) {
+	keys := []APIKey{
+		{Name: "ro", Key: "reader-key", Role: RoleReader},
+		{Name: "exec", Key: "executor-key", Role: RoleExecutor},
+		{Name: "root", Key: "admin-key", Role: RoleAdmin},
+	}
+	tests := []struct {
+		name     string
+		keys     []APIKey
+		role     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{"auth disabled", nil, RoleAdmin, "", "", http.StatusOK},
+		{"missing key", keys, RoleReader, "", "", http.StatusUnauthorized},
+		{"invalid key", keys, RoleReader, "X-API-Key", "bogus", http.StatusUnauthorized},
+		{"reader reads", keys, RoleReader, "X-API-Key", "reader-key", http.StatusOK},
+		{"reader executes", keys, RoleExecutor, "X-API-Key", "reader-key", http.StatusForbidden},
+		{"executor executes", keys, RoleExecutor, "X-API-Key", "executor-key", http.StatusOK},
+		{"executor administers", keys, RoleAdmin, "X-API-Key", "executor-key", http.StatusForbidden},
+		{"admin reads", keys, RoleReader, "X-API-Key", "admin-key", http.StatusOK},
+		{"bearer token", keys, RoleAdmin, "Authorization", "Bearer admin-key", http.StatusOK},
+		{"other scheme", keys, RoleReader, "Authorization", "Basic admin-key", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{APIKeys: tt.keys}}
+			router := gin.New()
+			router.GET("/resource", app.requireRole(tt.role), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireRoleSetsCaller(t *testing.T) {
+	app := &AppContext{Config: ServerConfig{APIKeys: []APIKey{{Name: "acme", Key: "k", Role: RoleExecutor, Tenant: "acme"}}}}
+	var caller APIKey
+	var tenant string
+	router := gin.New()
+	router.GET("/resource", app.requireRole(RoleReader), func(c *gin.Context) {
+		caller, _ = callerFromContext(c.Request.Context())
+		tenant = tenantOf(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+	req.Header.Set("X-API-Key", "k")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if caller.Name != "acme" || tenant != "acme" {
+		t.Errorf("caller %q, tenant %q, want acme for both", caller.Name, tenant)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Binary inputs for plugins get a bucket of their own, next to job_inputs.
+const blobsBucket = "blobs"
+
+var (
+	errBlobNotFound  = errors.New("blob not found")
+	errBlobsTooLarge = errors.New("blobs too large")
+)
+
+func (app *AppContext) blobs(ctx context.Context) (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(
+		app.database(ctx),
+		options.GridFSBucket().SetName(blobsBucket),
+	)
+}
+
+// uploadBlob stores the raw request body in GridFS for plugins to read as an
+// ArrayBuffer. The body is streamed, so only max_request_bytes bounds it.
+func (app *AppContext) uploadBlob(c *gin.Context) {
+	bucket, err := app.blobs(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open blob bucket"})
+		return
+	}
+
+	name := c.DefaultQuery("name", fmt.Sprintf("blob-%d", time.Now().Unix()))
+	contentType := c.ContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{"content_type": contentType})
+	stream, err := bucket.OpenUploadStream(name, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store blob: " + err.Error()})
+		return
+	}
+	size, err := io.Copy(stream, c.Request.Body)
+	if err != nil {
+		stream.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store blob: " + err.Error()})
+		return
+	}
+	if err := stream.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store blob: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"blob_id":      stream.FileID,
+		"name":         name,
+		"size":         size,
+		"content_type": contentType,
+	})
+}
+
+// loadBlobs reads the blobs named by refs, a map from the name a plugin sees
+// to a blob ID. Together they may not exceed limit bytes (0 for no limit),
+// since each is held in memory for the run.
+func (app *AppContext) loadBlobs(ctx context.Context, refs map[string]string, limit int64) (map[string][]byte, error) {
+	blobs := make(map[string][]byte, len(refs))
+	if len(refs) == 0 {
+		return blobs, nil
+	}
+
+	bucket, err := app.blobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob bucket: %w", err)
+	}
+
+	var total int64
+	for name, ref := range refs {
+		id, err := primitive.ObjectIDFromHex(ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errBlobNotFound, ref)
+		}
+
+		stream, err := bucket.OpenDownloadStream(id)
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, fmt.Errorf("%w: %s", errBlobNotFound, ref)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		total += stream.GetFile().Length
+		if limit > 0 && total > limit {
+			stream.Close()
+			return nil, fmt.Errorf("%w: more than %d bytes", errBlobsTooLarge, limit)
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			stream.SetReadDeadline(deadline)
+		}
+		data, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob %s: %w", ref, err)
+		}
+		blobs[name] = data
+	}
+	return blobs, nil
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRunScriptBlobs(t *testing.T) {
+	source := `typeof blobs === "undefined" ? "none" : Object.keys(blobs).sort().map(function (name) {
+		var bytes = new Uint8Array(blobs[name]), sum = 0
+		for (var i = 0; i < bytes.length; i++) sum += bytes[i]
+		return name + ":" + bytes.byteLength + ":" + sum
+	}).join(",")`
+	tests := []struct {
+		name  string
+		blobs map[string][]byte
+		want  interface{}
+	}{
+		{"no blobs", nil, "none"},
+		{"empty set", map[string][]byte{}, ""},
+		{"bytes", map[string][]byte{"raw": {1, 2, 3, 250}}, "raw:4:256"},
+		{"several", map[string][]byte{"b": {}, "a": {7}}, "a:1:7,b:0:0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "bytes", source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{Blobs: tt.blobs})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if !reflect.DeepEqual(result.Value, tt.want) {
+				t.Errorf("result = %#v, want %#v", result.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBlobs(t *testing.T) {
+	app := newTestApp(t)
+	blobs, err := app.loadBlobs(context.Background(), nil, 1)
+	if err != nil || len(blobs) != 0 {
+		t.Errorf("loadBlobs = %v, %v, want no blobs", blobs, err)
+	}
+	if _, err := app.loadBlobs(context.Background(), map[string]string{"raw": "abc"}, 0); !errors.Is(err, errBlobNotFound) {
+		t.Errorf("err = %v, want %v", err, errBlobNotFound)
+	}
+}
+
+func TestExecutePluginUnknownBlob(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "bytes", "blobs.raw.byteLength")
+	router := gin.New()
+	router.POST("/plugins/:name/execute", app.executePlugin)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/bytes/execute", strings.NewReader(`{"blobs": {"raw": "abc"}}`)))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "blob not found: abc") {
+		t.Errorf("response %d %s, want 404 naming the blob", w.Code, w.Body.String())
+	}
+}
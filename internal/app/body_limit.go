@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unlimitedBodyRoutes stream their request bodies to GridFS instead of
+// holding them in memory, so MaxRequestBytes does not apply to them.
+var unlimitedBodyRoutes = map[string]bool{
+	"/api/v1/data/upload/stream": true,
+}
+
+// limitRequestBody rejects request bodies larger than MaxRequestBytes with
+// 413. Bodies that declare their length are refused up front; chunked bodies
+// fail once reading passes the limit, and the handler's error response is
+// then sent as 413 whatever status it chose.
+func (app *AppContext) limitRequestBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := app.Config.MaxRequestBytes
+		if limit <= 0 || unlimitedBodyRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit)}
+		c.Request.Body = body
+		c.Writer = &bodyLimitWriter{ResponseWriter: c.Writer, body: body}
+		c.Next()
+	}
+}
+
+// limitedBody remembers whether reading hit the size limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// bodyLimitWriter turns any response status into 413 once the request body
+// has exceeded the limit.
+type bodyLimitWriter struct {
+	gin.ResponseWriter
+	body *limitedBody
+}
+
+func (w *bodyLimitWriter) WriteHeader(code int) {
+	if w.body.exceeded {
+		code = http.StatusRequestEntityTooLarge
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitRequestBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int64
+		path     string
+		size     int
+		chunked  bool
+		wantCode int
+	}{
+		{"under the limit", 16, "/api/v1/data", 16, false, http.StatusOK},
+		{"declared too large", 16, "/api/v1/data", 17, false, http.StatusRequestEntityTooLarge},
+		{"chunked too large", 16, "/api/v1/data", 17, true, http.StatusRequestEntityTooLarge},
+		{"chunked under the limit", 16, "/api/v1/data", 10, true, http.StatusOK},
+		{"streaming route", 16, "/api/v1/data/upload/stream", 100, true, http.StatusOK},
+		{"no limit", 0, "/api/v1/data", 100, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{MaxRequestBytes: tt.limit}}
+			router := gin.New()
+			router.Use(app.limitRequestBody())
+			read := func(c *gin.Context) {
+				if _, err := io.ReadAll(c.Request.Body); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.Status(http.StatusOK)
+			}
+			router.POST("/api/v1/data", read)
+			router.POST("/api/v1/data/upload/stream", read)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			if tt.chunked {
+				// A chunked request does not declare its length
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
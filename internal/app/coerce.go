@@ -0,0 +1,120 @@
+package app
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// coerceDateLayouts are tried in order by coerce.toDate when no layout is
+// given. Layouts without a zone are read as UTC.
+var coerceDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// installCoerce binds the coerce helper object, which converts loosely typed
+// values such as CSV fields. Values that cannot be converted become NaN for
+// toNumber and null for toBool and toDate.
+func installCoerce(vm *goja.Runtime) {
+	coerce := vm.NewObject()
+	coerce.Set("toNumber", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(coerceNumber(call.Argument(0).Export()))
+	})
+	coerce.Set("toBool", func(call goja.FunctionCall) goja.Value {
+		if b, ok := coerceBool(call.Argument(0).Export()); ok {
+			return vm.ToValue(b)
+		}
+		return goja.Null()
+	})
+	coerce.Set("toDate", func(call goja.FunctionCall) goja.Value {
+		var layout string
+		if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+			layout = arg.String()
+		}
+		t, ok := coerceDate(call.Argument(0).Export(), layout)
+		if !ok {
+			return goja.Null()
+		}
+		date, err := vm.New(vm.Get("Date"), vm.ToValue(t.UnixMilli()))
+		if err != nil {
+			panic(err)
+		}
+		return date
+	})
+	vm.Set("coerce", coerce)
+}
+
+func coerceNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	default:
+		return math.NaN()
+	}
+}
+
+func coerceBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0 && !math.IsNaN(v), true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes", "y", "on", "1":
+			return true, true
+		case "false", "no", "n", "off", "0":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// coerceDate reads a date string, using layout (a Go time layout) when one
+// is given, or a number of milliseconds since the Unix epoch.
+func coerceDate(v interface{}, layout string) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.UnixMilli(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(int64(v)), true
+	case string:
+		v = strings.TrimSpace(v)
+		layouts := coerceDateLayouts
+		if layout != "" {
+			layouts = []string{layout}
+		}
+		for _, l := range layouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{`coerce.toNumber("3.14")`, 3.14},
+		{`coerce.toNumber(" -2e3 ")`, -2000.0},
+		{`coerce.toNumber(7)`, 7.0},
+		{`coerce.toNumber(true)`, 1.0},
+		{`isNaN(coerce.toNumber("3.14abc"))`, true},
+		{`isNaN(coerce.toNumber(null))`, true},
+		{`coerce.toBool("Yes")`, true},
+		{`coerce.toBool(" off ")`, false},
+		{`coerce.toBool("0")`, false},
+		{`coerce.toBool(2)`, true},
+		{`coerce.toBool(NaN)`, false},
+		{`coerce.toBool("maybe")`, nil},
+		{`coerce.toDate("2024-03-01").toISOString()`, "2024-03-01T00:00:00.000Z"},
+		{`coerce.toDate("2024-03-01 12:30:00").toISOString()`, "2024-03-01T12:30:00.000Z"},
+		{`coerce.toDate("2024-03-01T12:30:00+02:00").toISOString()`, "2024-03-01T10:30:00.000Z"},
+		{`coerce.toDate("01/03/2024", "02/01/2006").toISOString()`, "2024-03-01T00:00:00.000Z"},
+		{`coerce.toDate(0).toISOString()`, "1970-01-01T00:00:00.000Z"},
+		{`coerce.toDate("yesterday")`, nil},
+		{`coerce.toDate("2024-03-01", "02/01/2006")`, nil},
+		{`coerce.toDate(Infinity)`, nil},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			plugin := addTestPlugin(t, app, "coerce", tt.source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if got := normalizeJSON(result.Value); got != tt.want {
+				t.Errorf("%s = %#v, want %#v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,42 +4,140 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/yaml.v3"
 )
 
 type ServerConfig struct {
-	Port         string        `yaml:"port" bson:"port"`
-	MongoURI     string        `yaml:"mongo_uri" bson:"mongo_uri"`
-	DatabaseName string        `yaml:"database_name" bson:"database_name"`
-	JSTimeout    time.Duration `yaml:"js_timeout" bson:"js_timeout"`
-	MaxParallel  int           `yaml:"max_parallel" bson:"max_parallel"`
+	Port            string        `yaml:"port" bson:"port"`
+	GinMode         string        `yaml:"gin_mode" bson:"gin_mode"`
+	MongoURI        string        `yaml:"mongo_uri" bson:"mongo_uri"`
+	DatabaseName    string        `yaml:"database_name" bson:"database_name"`
+	JSTimeout       time.Duration `yaml:"js_timeout" bson:"js_timeout"`
+	MaxJSTimeout    time.Duration `yaml:"max_js_timeout" bson:"max_js_timeout"`
+	MaxParallel     int           `yaml:"max_parallel" bson:"max_parallel"`
+	QueueTimeout    time.Duration `yaml:"queue_timeout" bson:"queue_timeout"`
+	MaxHeapMB       int           `yaml:"max_heap_mb" bson:"max_heap_mb"`
+	MaxInlineBytes  int64         `yaml:"max_inline_bytes" bson:"max_inline_bytes"`
+	MaxOutputBytes  int64         `yaml:"max_output_bytes" bson:"max_output_bytes"`
+	CompressResults bool          `yaml:"compress_results" bson:"compress_results"`
+	MaxRequestBytes int64         `yaml:"max_request_bytes" bson:"max_request_bytes"`
+	APIKeys         []APIKey      `yaml:"api_keys" bson:"api_keys"`
+	MaxPoolSize     uint64        `yaml:"max_pool_size" bson:"max_pool_size"`
+	MinPoolSize     uint64        `yaml:"min_pool_size" bson:"min_pool_size"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" bson:"connect_timeout"`
+	JobTTL          time.Duration `yaml:"job_ttl" bson:"job_ttl"`
+	DBTimeout       time.Duration `yaml:"db_timeout" bson:"db_timeout"`
+	ProcessTimeout  time.Duration `yaml:"process_timeout" bson:"process_timeout"`
+	UploadTimeout   time.Duration `yaml:"upload_timeout" bson:"upload_timeout"`
+	ExportTimeout   time.Duration `yaml:"export_timeout" bson:"export_timeout"`
+	StartupTimeout  time.Duration `yaml:"startup_timeout" bson:"startup_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" bson:"shutdown_timeout"`
+	IdempotencyTTL  time.Duration `yaml:"idempotency_ttl" bson:"idempotency_ttl"`
+	RateLimit       float64       `yaml:"rate_limit" bson:"rate_limit"`
+	RateBurst       int           `yaml:"rate_burst" bson:"rate_burst"`
+
+	AllowPluginNetwork bool     `yaml:"allow_plugin_network" bson:"allow_plugin_network"`
+	PluginNetworkHosts []string `yaml:"plugin_network_hosts" bson:"plugin_network_hosts"`
+
+	SandboxAllowGlobals []string `yaml:"sandbox_allow_globals" bson:"sandbox_allow_globals"`
+
+	EnableResultCache bool          `yaml:"enable_result_cache" bson:"enable_result_cache"`
+	ResultCacheTTL    time.Duration `yaml:"result_cache_ttl" bson:"result_cache_ttl"`
+	ResultCacheSize   int           `yaml:"result_cache_size" bson:"result_cache_size"`
+
+	EnableScheduler bool `yaml:"enable_scheduler" bson:"enable_scheduler"`
+	WatchPlugins    bool `yaml:"watch_plugins" bson:"watch_plugins"`
+
+	WebhookSecret  string `yaml:"webhook_secret" bson:"webhook_secret"`
+	WebhookRetries int    `yaml:"webhook_retries" bson:"webhook_retries"`
+	// WebhookAllowPrivate lets callbacks reach loopback, private and other
+	// non-public addresses, e.g. for receivers on the same network.
+	WebhookAllowPrivate bool `yaml:"webhook_allow_private" bson:"webhook_allow_private"`
+
+	// TimeoutAlertRate is the share of a plugin's recent runs timing out
+	// at which a warning is logged; 0 disables the warning.
+	TimeoutAlertRate float64 `yaml:"timeout_alert_rate" bson:"timeout_alert_rate"`
+
+	// SecretsKey is the base64 AES-256 key secrets are sealed with; the
+	// secrets endpoints are unavailable without it.
+	SecretsKey string `yaml:"secrets_key" bson:"secrets_key"`
+
+	// OTLPEndpoint is the host:port of an OTLP/HTTP collector receiving
+	// trace spans; tracing is off without it.
+	OTLPEndpoint string `yaml:"otlp_endpoint" bson:"otlp_endpoint"`
+	OTLPInsecure bool   `yaml:"otlp_insecure" bson:"otlp_insecure"`
+}
+
+// configPath returns the config file to read: ConfigPath (the -config flag),
+// then CONFIG_PATH, then config.yaml in the working directory. explicit is
+// false for the default, which may be absent.
+func (app *AppContext) configPath() (path string, explicit bool) {
+	if app.ConfigPath != "" {
+		return app.ConfigPath, true
+	}
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path, true
+	}
+	return "config.yaml", false
 }
 
 func (app *AppContext) loadConfig() {
 	app.Config = ServerConfig{
-		Port:         "8080",
-		MongoURI:     "mongodb://localhost:27017",
-		DatabaseName: "scientific_data_processing",
-		JSTimeout:    5 * time.Second,
-		MaxParallel:  10,
+		Port:            "8080",
+		GinMode:         gin.ReleaseMode,
+		MongoURI:        "mongodb://localhost:27017",
+		DatabaseName:    "scientific_data_processing",
+		JSTimeout:       5 * time.Second,
+		MaxJSTimeout:    60 * time.Second,
+		MaxParallel:     10,
+		QueueTimeout:    10 * time.Second,
+		MaxInlineBytes:  8 << 20,
+		MaxOutputBytes:  16 << 20,
+		MaxRequestBytes: 64 << 20,
+		ConnectTimeout:  10 * time.Second,
+		IdempotencyTTL:  24 * time.Hour,
+		DBTimeout:       10 * time.Second,
+		ProcessTimeout:  30 * time.Second,
+		UploadTimeout:   2 * time.Minute,
+		ExportTimeout:   10 * time.Minute,
+		StartupTimeout:  30 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+
+		ResultCacheTTL:  5 * time.Minute,
+		ResultCacheSize: 1000,
+
+		EnableScheduler: true,
+		WebhookRetries:  3,
+
+		TimeoutAlertRate: 0.5,
 	}
 
-	if _, err := os.Stat("config.yaml"); err == nil {
-		data, err := os.ReadFile("config.yaml")
+	path, explicit := app.configPath()
+	if _, err := os.Stat(path); err == nil {
+		data, err := os.ReadFile(path)
 		if err != nil {
 			log.Fatalf("Error reading config file: %v", err)
 		}
 		err = yaml.Unmarshal(data, &app.Config)
 		if err != nil {
-			log.Fatalf("Error parsing config file: %v", err)
+			log.Fatalf("Error parsing config file %s: %v", path, err)
 		}
+	} else if explicit {
+		log.Fatalf("Error reading config file: %v", err)
 	}
 
 	if port := os.Getenv("SERVER_PORT"); port != "" {
 		app.Config.Port = port
 	}
+	if ginMode := os.Getenv("GIN_MODE"); ginMode != "" {
+		app.Config.GinMode = ginMode
+	}
 	if mongoURI := os.Getenv("MONGO_URI"); mongoURI != "" {
 		app.Config.MongoURI = mongoURI
 	}
@@ -51,6 +149,11 @@ func (app *AppContext) loadConfig() {
 			app.Config.JSTimeout = d
 		}
 	}
+	if maxTimeout := os.Getenv("MAX_JS_TIMEOUT"); maxTimeout != "" {
+		if d, err := time.ParseDuration(maxTimeout); err == nil {
+			app.Config.MaxJSTimeout = d
+		}
+	}
 	if maxParallel := os.Getenv("MAX_PARALLEL"); maxParallel != "" {
 		var val int
 		n, err := fmt.Sscanf(maxParallel, "%d", &val)
@@ -60,4 +163,325 @@ func (app *AppContext) loadConfig() {
 			}
 		}
 	}
+	if queueTimeout := os.Getenv("QUEUE_TIMEOUT"); queueTimeout != "" {
+		if d, err := time.ParseDuration(queueTimeout); err == nil {
+			app.Config.QueueTimeout = d
+		}
+	}
+	if maxHeap := os.Getenv("MAX_HEAP_MB"); maxHeap != "" {
+		var val int
+		n, err := fmt.Sscanf(maxHeap, "%d", &val)
+		if n == 1 && err == nil && val >= 0 {
+			app.Config.MaxHeapMB = val
+		}
+	}
+	if maxInline := os.Getenv("MAX_INLINE_BYTES"); maxInline != "" {
+		var val int64
+		n, err := fmt.Sscanf(maxInline, "%d", &val)
+		if n == 1 && err == nil && val >= 0 {
+			app.Config.MaxInlineBytes = val
+		}
+	}
+	if maxOutput := os.Getenv("MAX_OUTPUT_BYTES"); maxOutput != "" {
+		var val int64
+		n, err := fmt.Sscanf(maxOutput, "%d", &val)
+		if n == 1 && err == nil && val >= 0 {
+			app.Config.MaxOutputBytes = val
+		}
+	}
+	if compress := os.Getenv("COMPRESS_RESULTS"); compress != "" {
+		if b, err := strconv.ParseBool(compress); err == nil {
+			app.Config.CompressResults = b
+		}
+	}
+	if maxRequest := os.Getenv("MAX_REQUEST_BYTES"); maxRequest != "" {
+		var val int64
+		n, err := fmt.Sscanf(maxRequest, "%d", &val)
+		if n == 1 && err == nil && val >= 0 {
+			app.Config.MaxRequestBytes = val
+		}
+	}
+	if maxPool := os.Getenv("MONGO_MAX_POOL_SIZE"); maxPool != "" {
+		var val uint64
+		n, err := fmt.Sscanf(maxPool, "%d", &val)
+		if n == 1 && err == nil {
+			app.Config.MaxPoolSize = val
+		}
+	}
+	if minPool := os.Getenv("MONGO_MIN_POOL_SIZE"); minPool != "" {
+		var val uint64
+		n, err := fmt.Sscanf(minPool, "%d", &val)
+		if n == 1 && err == nil {
+			app.Config.MinPoolSize = val
+		}
+	}
+	if connectTimeout := os.Getenv("MONGO_CONNECT_TIMEOUT"); connectTimeout != "" {
+		if d, err := time.ParseDuration(connectTimeout); err == nil {
+			app.Config.ConnectTimeout = d
+		}
+	}
+	if jobTTL := os.Getenv("JOB_TTL"); jobTTL != "" {
+		if d, err := time.ParseDuration(jobTTL); err == nil {
+			app.Config.JobTTL = d
+		}
+	}
+	if dbTimeout := os.Getenv("DB_TIMEOUT"); dbTimeout != "" {
+		if d, err := time.ParseDuration(dbTimeout); err == nil {
+			app.Config.DBTimeout = d
+		}
+	}
+	if processTimeout := os.Getenv("PROCESS_TIMEOUT"); processTimeout != "" {
+		if d, err := time.ParseDuration(processTimeout); err == nil {
+			app.Config.ProcessTimeout = d
+		}
+	}
+	if uploadTimeout := os.Getenv("UPLOAD_TIMEOUT"); uploadTimeout != "" {
+		if d, err := time.ParseDuration(uploadTimeout); err == nil {
+			app.Config.UploadTimeout = d
+		}
+	}
+	if exportTimeout := os.Getenv("EXPORT_TIMEOUT"); exportTimeout != "" {
+		if d, err := time.ParseDuration(exportTimeout); err == nil {
+			app.Config.ExportTimeout = d
+		}
+	}
+	if startupTimeout := os.Getenv("STARTUP_TIMEOUT"); startupTimeout != "" {
+		if d, err := time.ParseDuration(startupTimeout); err == nil {
+			app.Config.StartupTimeout = d
+		}
+	}
+	if shutdownTimeout := os.Getenv("SHUTDOWN_TIMEOUT"); shutdownTimeout != "" {
+		if d, err := time.ParseDuration(shutdownTimeout); err == nil {
+			app.Config.ShutdownTimeout = d
+		}
+	}
+	if idempotencyTTL := os.Getenv("IDEMPOTENCY_TTL"); idempotencyTTL != "" {
+		if d, err := time.ParseDuration(idempotencyTTL); err == nil {
+			app.Config.IdempotencyTTL = d
+		}
+	}
+	if rateLimit := os.Getenv("RATE_LIMIT"); rateLimit != "" {
+		var val float64
+		n, err := fmt.Sscanf(rateLimit, "%g", &val)
+		if n == 1 && err == nil {
+			app.Config.RateLimit = val
+		}
+	}
+	if rateBurst := os.Getenv("RATE_BURST"); rateBurst != "" {
+		var val int
+		n, err := fmt.Sscanf(rateBurst, "%d", &val)
+		if n == 1 && err == nil {
+			app.Config.RateBurst = val
+		}
+	}
+	if allowNetwork := os.Getenv("ALLOW_PLUGIN_NETWORK"); allowNetwork != "" {
+		if b, err := strconv.ParseBool(allowNetwork); err == nil {
+			app.Config.AllowPluginNetwork = b
+		}
+	}
+	// PLUGIN_NETWORK_HOSTS is a comma-separated list of host names
+	if hosts := os.Getenv("PLUGIN_NETWORK_HOSTS"); hosts != "" {
+		app.Config.PluginNetworkHosts = strings.Split(hosts, ",")
+	}
+	// SANDBOX_ALLOW_GLOBALS is a comma-separated list of globals to re-enable
+	if allowGlobals := os.Getenv("SANDBOX_ALLOW_GLOBALS"); allowGlobals != "" {
+		app.Config.SandboxAllowGlobals = nil
+		for _, name := range strings.Split(allowGlobals, ",") {
+			app.Config.SandboxAllowGlobals = append(app.Config.SandboxAllowGlobals, strings.TrimSpace(name))
+		}
+	}
+	if enableCache := os.Getenv("ENABLE_RESULT_CACHE"); enableCache != "" {
+		if b, err := strconv.ParseBool(enableCache); err == nil {
+			app.Config.EnableResultCache = b
+		}
+	}
+	if cacheTTL := os.Getenv("RESULT_CACHE_TTL"); cacheTTL != "" {
+		if d, err := time.ParseDuration(cacheTTL); err == nil {
+			app.Config.ResultCacheTTL = d
+		}
+	}
+	if cacheSize := os.Getenv("RESULT_CACHE_SIZE"); cacheSize != "" {
+		var val int
+		n, err := fmt.Sscanf(cacheSize, "%d", &val)
+		if n == 1 && err == nil {
+			app.Config.ResultCacheSize = val
+		}
+	}
+	if enableScheduler := os.Getenv("ENABLE_SCHEDULER"); enableScheduler != "" {
+		if b, err := strconv.ParseBool(enableScheduler); err == nil {
+			app.Config.EnableScheduler = b
+		}
+	}
+	if watchPlugins := os.Getenv("WATCH_PLUGINS"); watchPlugins != "" {
+		if b, err := strconv.ParseBool(watchPlugins); err == nil {
+			app.Config.WatchPlugins = b
+		}
+	}
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		app.Config.WebhookSecret = secret
+	}
+	if retries := os.Getenv("WEBHOOK_RETRIES"); retries != "" {
+		var val int
+		n, err := fmt.Sscanf(retries, "%d", &val)
+		if n == 1 && err == nil {
+			app.Config.WebhookRetries = val
+		}
+	}
+	if allowPrivate := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); allowPrivate != "" {
+		if b, err := strconv.ParseBool(allowPrivate); err == nil {
+			app.Config.WebhookAllowPrivate = b
+		}
+	}
+	if alertRate := os.Getenv("TIMEOUT_ALERT_RATE"); alertRate != "" {
+		var val float64
+		n, err := fmt.Sscanf(alertRate, "%g", &val)
+		if n == 1 && err == nil {
+			app.Config.TimeoutAlertRate = val
+		}
+	}
+	if key := os.Getenv("SECRETS_KEY"); key != "" {
+		app.Config.SecretsKey = key
+	}
+	if endpoint := os.Getenv("OTLP_ENDPOINT"); endpoint != "" {
+		app.Config.OTLPEndpoint = endpoint
+	}
+	if insecure := os.Getenv("OTLP_INSECURE"); insecure != "" {
+		if b, err := strconv.ParseBool(insecure); err == nil {
+			app.Config.OTLPInsecure = b
+		}
+	}
+	// API_KEYS is a comma-separated list of key:role or key:role:tenant
+	// entries
+	if apiKeys := os.Getenv("API_KEYS"); apiKeys != "" {
+		app.Config.APIKeys = nil
+		for _, pair := range strings.Split(apiKeys, ",") {
+			key, rest, _ := strings.Cut(strings.TrimSpace(pair), ":")
+			role, tenant, _ := strings.Cut(rest, ":")
+			app.Config.APIKeys = append(app.Config.APIKeys, APIKey{Key: key, Role: role, Tenant: tenant})
+		}
+	}
+
+	if err := app.Config.validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(app.Config.APIKeys) == 0 {
+		log.Println("No API keys configured; authentication is disabled")
+	}
+}
+
+// validate reports the first setting that would otherwise only fail once the
+// server is running.
+func (cfg ServerConfig) validate() error {
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("port %q must be a number between 1 and 65535", cfg.Port)
+	}
+	switch cfg.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return fmt.Errorf("gin_mode must be %s, %s or %s, got %q", gin.DebugMode, gin.ReleaseMode, gin.TestMode, cfg.GinMode)
+	}
+	if cfg.MongoURI == "" {
+		return fmt.Errorf("mongo_uri must not be empty")
+	}
+	if err := options.Client().ApplyURI(cfg.MongoURI).Validate(); err != nil {
+		return fmt.Errorf("mongo_uri: %v", err)
+	}
+	if cfg.ConnectTimeout <= 0 {
+		return fmt.Errorf("connect_timeout must be positive, got %s", cfg.ConnectTimeout)
+	}
+	if cfg.MaxPoolSize > 0 && cfg.MinPoolSize > cfg.MaxPoolSize {
+		return fmt.Errorf("min_pool_size (%d) must not exceed max_pool_size (%d)", cfg.MinPoolSize, cfg.MaxPoolSize)
+	}
+	if cfg.DatabaseName == "" {
+		return fmt.Errorf("database_name must not be empty")
+	}
+	if cfg.JSTimeout <= 0 {
+		return fmt.Errorf("js_timeout must be positive, got %s", cfg.JSTimeout)
+	}
+	if cfg.MaxJSTimeout < 0 {
+		return fmt.Errorf("max_js_timeout must not be negative, got %s", cfg.MaxJSTimeout)
+	}
+	if cfg.JobTTL < 0 {
+		return fmt.Errorf("job_ttl must not be negative, got %s", cfg.JobTTL)
+	}
+	if cfg.DBTimeout <= 0 {
+		return fmt.Errorf("db_timeout must be positive, got %s", cfg.DBTimeout)
+	}
+	if cfg.ProcessTimeout <= 0 {
+		return fmt.Errorf("process_timeout must be positive, got %s", cfg.ProcessTimeout)
+	}
+	if cfg.UploadTimeout <= 0 {
+		return fmt.Errorf("upload_timeout must be positive, got %s", cfg.UploadTimeout)
+	}
+	if cfg.ExportTimeout <= 0 {
+		return fmt.Errorf("export_timeout must be positive, got %s", cfg.ExportTimeout)
+	}
+	if cfg.StartupTimeout <= 0 {
+		return fmt.Errorf("startup_timeout must be positive, got %s", cfg.StartupTimeout)
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown_timeout must be positive, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		return fmt.Errorf("idempotency_ttl must be positive, got %s", cfg.IdempotencyTTL)
+	}
+	if cfg.MaxParallel < 1 {
+		return fmt.Errorf("max_parallel must be at least 1, got %d", cfg.MaxParallel)
+	}
+	if cfg.QueueTimeout < 0 {
+		return fmt.Errorf("queue_timeout must not be negative, got %s", cfg.QueueTimeout)
+	}
+	if cfg.MaxHeapMB < 0 {
+		return fmt.Errorf("max_heap_mb must not be negative, got %d", cfg.MaxHeapMB)
+	}
+	if cfg.MaxInlineBytes < 0 {
+		return fmt.Errorf("max_inline_bytes must not be negative, got %d", cfg.MaxInlineBytes)
+	}
+	if cfg.MaxOutputBytes < 0 {
+		return fmt.Errorf("max_output_bytes must not be negative, got %d", cfg.MaxOutputBytes)
+	}
+	if cfg.MaxRequestBytes < 0 {
+		return fmt.Errorf("max_request_bytes must not be negative, got %d", cfg.MaxRequestBytes)
+	}
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative, got %g", cfg.RateLimit)
+	}
+	if cfg.RateBurst < 0 {
+		return fmt.Errorf("rate_burst must not be negative, got %d", cfg.RateBurst)
+	}
+	if cfg.WebhookRetries < 0 {
+		return fmt.Errorf("webhook_retries must not be negative, got %d", cfg.WebhookRetries)
+	}
+	if cfg.TimeoutAlertRate < 0 || cfg.TimeoutAlertRate > 1 {
+		return fmt.Errorf("timeout_alert_rate must be between 0 and 1, got %g", cfg.TimeoutAlertRate)
+	}
+	if cfg.SecretsKey != "" {
+		if _, err := cfg.secretsCipher(); err != nil {
+			return err
+		}
+	}
+	if cfg.AllowPluginNetwork && len(cfg.PluginNetworkHosts) == 0 {
+		return fmt.Errorf("allow_plugin_network needs at least one host in plugin_network_hosts")
+	}
+	if err := validateSandboxAllow(cfg.SandboxAllowGlobals); err != nil {
+		return err
+	}
+	if cfg.EnableResultCache && cfg.ResultCacheTTL <= 0 {
+		return fmt.Errorf("result_cache_ttl must be positive, got %s", cfg.ResultCacheTTL)
+	}
+	if cfg.EnableResultCache && cfg.ResultCacheSize < 1 {
+		return fmt.Errorf("result_cache_size must be at least 1, got %d", cfg.ResultCacheSize)
+	}
+	for i, k := range cfg.APIKeys {
+		if k.Key == "" {
+			return fmt.Errorf("API key %d has no key", i+1)
+		}
+		if _, ok := roleRank[k.Role]; !ok {
+			return fmt.Errorf("API key %d has unknown role %q", i+1, k.Role)
+		}
+		if err := cfg.validateTenant(k.Tenant); err != nil {
+			return fmt.Errorf("API key %d: %v", i+1, err)
+		}
+	}
+	return nil
 }
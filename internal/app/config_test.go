@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validConfig returns the settings loadConfig starts from, which validate
+// accepts.
+func validConfig() ServerConfig {
+	return ServerConfig{
+		Port:            "8080",
+		GinMode:         gin.ReleaseMode,
+		MongoURI:        "mongodb://localhost:27017",
+		DatabaseName:    "scientific_data_processing",
+		JSTimeout:       5 * time.Second,
+		MaxJSTimeout:    60 * time.Second,
+		MaxParallel:     10,
+		QueueTimeout:    10 * time.Second,
+		ConnectTimeout:  10 * time.Second,
+		IdempotencyTTL:  24 * time.Hour,
+		DBTimeout:       10 * time.Second,
+		ProcessTimeout:  30 * time.Second,
+		UploadTimeout:   2 * time.Minute,
+		ExportTimeout:   10 * time.Minute,
+		StartupTimeout:  30 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+		ResultCacheTTL:  5 * time.Minute,
+		ResultCacheSize: 1000,
+		WebhookRetries:  3,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *ServerConfig)
+		wantErr string
+	}{
+		{"defaults", func(cfg *ServerConfig) {}, ""},
+		{"port not a number", func(cfg *ServerConfig) { cfg.Port = "http" }, "port"},
+		{"port out of range", func(cfg *ServerConfig) { cfg.Port = "70000" }, "port"},
+		{"unknown gin mode", func(cfg *ServerConfig) { cfg.GinMode = "verbose" }, "gin_mode"},
+		{"empty mongo_uri", func(cfg *ServerConfig) { cfg.MongoURI = "" }, "mongo_uri"},
+		{"invalid mongo_uri", func(cfg *ServerConfig) { cfg.MongoURI = "http://localhost" }, "mongo_uri"},
+		{"pool sizes swapped", func(cfg *ServerConfig) { cfg.MinPoolSize, cfg.MaxPoolSize = 20, 10 }, "min_pool_size"},
+		{"empty database_name", func(cfg *ServerConfig) { cfg.DatabaseName = "" }, "database_name"},
+		{"zero js_timeout", func(cfg *ServerConfig) { cfg.JSTimeout = 0 }, "js_timeout"},
+		{"negative job_ttl", func(cfg *ServerConfig) { cfg.JobTTL = -time.Hour }, "job_ttl"},
+		{"zero db_timeout", func(cfg *ServerConfig) { cfg.DBTimeout = 0 }, "db_timeout"},
+		{"zero export_timeout", func(cfg *ServerConfig) { cfg.ExportTimeout = 0 }, "export_timeout"},
+		{"negative startup_timeout", func(cfg *ServerConfig) { cfg.StartupTimeout = -time.Second }, "startup_timeout"},
+		{"zero shutdown_timeout", func(cfg *ServerConfig) { cfg.ShutdownTimeout = 0 }, "shutdown_timeout"},
+		{"zero max_parallel", func(cfg *ServerConfig) { cfg.MaxParallel = 0 }, "max_parallel"},
+		{"negative max_heap_mb", func(cfg *ServerConfig) { cfg.MaxHeapMB = -1 }, "max_heap_mb"},
+		{"timeout_alert_rate above 1", func(cfg *ServerConfig) { cfg.TimeoutAlertRate = 1.5 }, "timeout_alert_rate"},
+		{"short secrets_key", func(cfg *ServerConfig) { cfg.SecretsKey = base64.StdEncoding.EncodeToString([]byte("short")) }, "32 bytes"},
+		{"secrets_key", func(cfg *ServerConfig) { cfg.SecretsKey = base64.StdEncoding.EncodeToString(make([]byte, 32)) }, ""},
+		{"network without hosts", func(cfg *ServerConfig) { cfg.AllowPluginNetwork = true }, "plugin_network_hosts"},
+		{"unknown sandbox global", func(cfg *ServerConfig) { cfg.SandboxAllowGlobals = []string{"process"} }, "sandbox_allow_globals"},
+		{"empty result cache", func(cfg *ServerConfig) { cfg.EnableResultCache, cfg.ResultCacheSize = true, 0 }, "result_cache_size"},
+		{"API key without key", func(cfg *ServerConfig) { cfg.APIKeys = []APIKey{{Role: RoleAdmin}} }, "has no key"},
+		{"API key with unknown role", func(cfg *ServerConfig) { cfg.APIKeys = []APIKey{{Key: "k", Role: "root"}} }, "unknown role"},
+		{"API key with invalid tenant", func(cfg *ServerConfig) { cfg.APIKeys = []APIKey{{Key: "k", Role: RoleAdmin, Tenant: "a/b"}} }, "tenant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+			err := cfg.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		flag, env    string
+		wantPath     string
+		wantExplicit bool
+	}{
+		{"default", "", "", "config.yaml", false},
+		{"CONFIG_PATH", "", "/etc/dsh.yaml", "/etc/dsh.yaml", true},
+		{"flag wins", "local.yaml", "/etc/dsh.yaml", "local.yaml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_PATH", tt.env)
+			app := &AppContext{ConfigPath: tt.flag}
+			if path, explicit := app.configPath(); path != tt.wantPath || explicit != tt.wantExplicit {
+				t.Errorf("configPath = %q, %v, want %q, %v", path, explicit, tt.wantPath, tt.wantExplicit)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte("port: \"9090\"\ndatabase_name: from_file\njs_timeout: 2s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_PATH", "")
+	t.Setenv("SERVER_PORT", "")
+	t.Setenv("JS_TIMEOUT", "")
+	t.Setenv("MAX_PARALLEL", "")
+	t.Setenv("DB_NAME", "from_env")
+
+	app := &AppContext{ConfigPath: path}
+	app.loadConfig()
+	if app.Config.Port != "9090" || app.Config.JSTimeout != 2*time.Second {
+		t.Errorf("port %q, js_timeout %s, want the file's 9090 and 2s", app.Config.Port, app.Config.JSTimeout)
+	}
+	if app.Config.DatabaseName != "from_env" {
+		t.Errorf("database_name %q, want DB_NAME to override the file", app.Config.DatabaseName)
+	}
+	if app.Config.MaxParallel != 10 {
+		t.Errorf("max_parallel %d, want the default 10 for settings the file leaves out", app.Config.MaxParallel)
+	}
+}
+
+func TestLoadConfigGinMode(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  string
+		want string
+	}{
+		{"default", "", "", gin.ReleaseMode},
+		{"from file", "gin_mode: debug\n", "", gin.DebugMode},
+		{"GIN_MODE overrides the file", "gin_mode: debug\n", gin.TestMode, gin.TestMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "server.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONFIG_PATH", "")
+			t.Setenv("GIN_MODE", tt.env)
+
+			app := &AppContext{ConfigPath: path}
+			app.loadConfig()
+			if app.Config.GinMode != tt.want {
+				t.Errorf("gin_mode = %q, want %q", app.Config.GinMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		timeout func(cfg *ServerConfig) *time.Duration
+	}{
+		{"db_timeout", http.MethodGet, "/stats", "", func(cfg *ServerConfig) *time.Duration { return &cfg.DBTimeout }},
+		{"db_timeout for a job", http.MethodGet, "/data/65f000000000000000000000", "", func(cfg *ServerConfig) *time.Duration { return &cfg.DBTimeout }},
+		{"process_timeout", http.MethodPost, "/data/process", `{"job_id": "65f000000000000000000000"}`, func(cfg *ServerConfig) *time.Duration { return &cfg.ProcessTimeout }},
+		{"upload_timeout", http.MethodPost, "/plugins", `{"name": "scale", "javascript": "input * 2"}`, func(cfg *ServerConfig) *time.Duration { return &cfg.UploadTimeout }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.MongoClient = newStalledClient(t)
+			// Only the setting under test is short, so the response shows
+			// which one bounds the request
+			app.Config.DBTimeout = time.Minute
+			app.Config.ProcessTimeout = time.Minute
+			app.Config.UploadTimeout = time.Minute
+			timeout := tt.timeout(&app.Config)
+			*timeout = 100 * time.Millisecond
+
+			router := gin.New()
+			router.GET("/stats", app.getStats)
+			router.GET("/data/:id", app.getJob)
+			router.POST("/data/process", app.processData)
+			router.POST("/plugins", app.uploadPlugin)
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			elapsed := time.Since(start)
+			if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), context.DeadlineExceeded.Error()) {
+				t.Errorf("response %d %s, want 500 with %q", w.Code, w.Body.String(), context.DeadlineExceeded)
+			}
+			if elapsed < *timeout || elapsed > 10**timeout {
+				t.Errorf("response after %s, want about %s", elapsed, *timeout)
+			}
+		})
+	}
+}
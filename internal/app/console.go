@@ -0,0 +1,81 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	maxLogEntries = 200
+	maxLogMessage = 2048
+)
+
+type LogEntry struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// logBuffer collects console output for a single execution. It keeps at most
+// maxLogEntries messages and only counts the ones it drops after that.
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	dropped int
+}
+
+func (b *logBuffer) append(level, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.entries) >= maxLogEntries {
+		b.dropped++
+		return
+	}
+	if len(message) > maxLogMessage {
+		message = message[:maxLogMessage] + "...(truncated)"
+	}
+	b.entries = append(b.entries, LogEntry{Level: level, Message: message})
+}
+
+func (b *logBuffer) Entries() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]LogEntry, len(b.entries), len(b.entries)+1)
+	copy(entries, b.entries)
+	if b.dropped > 0 {
+		entries = append(entries, LogEntry{
+			Level:   "warn",
+			Message: fmt.Sprintf("%d further log messages dropped", b.dropped),
+		})
+	}
+	return entries
+}
+
+func installConsole(vm *goja.Runtime, logs *logBuffer) {
+	console := vm.NewObject()
+	for _, level := range []string{"log", "warn", "error"} {
+		console.Set(level, func(call goja.FunctionCall) goja.Value {
+			parts := make([]string, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				parts[i] = formatLogArg(arg)
+			}
+			logs.append(level, strings.Join(parts, " "))
+			return goja.Undefined()
+		})
+	}
+	vm.Set("console", console)
+}
+
+func formatLogArg(arg goja.Value) string {
+	if _, isObject := arg.(*goja.Object); isObject {
+		if data, err := json.Marshal(arg.Export()); err == nil {
+			return string(data)
+		}
+	}
+	return arg.String()
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConsoleLogs(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []LogEntry
+	}{
+		{"levels", `console.log("a"); console.warn("b"); console.error("c")`, []LogEntry{
+			{Level: "log", Message: "a"},
+			{Level: "warn", Message: "b"},
+			{Level: "error", Message: "c"},
+		}},
+		{"several arguments", `console.log("n =", 3, true, null)`, []LogEntry{{Level: "log", Message: "n = 3 true null"}}},
+		{"objects as JSON", `console.log({a: [1, 2]}, [{b: "c"}])`, []LogEntry{{Level: "log", Message: `{"a":[1,2]} [{"b":"c"}]`}}},
+		{"no output", `1 + 1`, []LogEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "logger", tt.source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if !reflect.DeepEqual(result.Logs, tt.want) {
+				t.Errorf("logs = %v, want %v", result.Logs, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleLogsOnError(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "fails", `console.log("before"); throw new Error("boom")`)
+	result, err := app.runScript(context.Background(), plugin, scriptCall{})
+	if err == nil {
+		t.Fatal("runScript succeeded, want the thrown error")
+	}
+	if want := []LogEntry{{Level: "log", Message: "before"}}; !reflect.DeepEqual(result.Logs, want) {
+		t.Errorf("logs = %v, want %v", result.Logs, want)
+	}
+}
+
+func TestLogBufferLimits(t *testing.T) {
+	var logs logBuffer
+	logs.append("log", strings.Repeat("x", maxLogMessage+10))
+	for i := 1; i < maxLogEntries+5; i++ {
+		logs.append("log", "line")
+	}
+
+	entries := logs.Entries()
+	if len(entries) != maxLogEntries+1 {
+		t.Fatalf("%d entries, want %d and a note of the dropped ones", len(entries), maxLogEntries+1)
+	}
+	if first := entries[0].Message; len(first) != maxLogMessage+len("...(truncated)") || !strings.HasSuffix(first, "...(truncated)") {
+		t.Errorf("long message kept as %d bytes, want it truncated", len(first))
+	}
+	if last := entries[maxLogEntries]; last.Level != "warn" || last.Message != "5 further log messages dropped" {
+		t.Errorf("last entry = %+v, want the dropped count", last)
+	}
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 30s",
+		"@every soon",
+		"@fortnightly",
+	}
+	for _, expr := range tests {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"*/15 * * * *", "2024-01-01T10:07:00Z", "2024-01-01T10:15:00Z"},
+		{"0 * * * *", "2024-01-01T10:00:00Z", "2024-01-01T11:00:00Z"},
+		{"0 * * * *", "2024-01-01T10:59:59.9Z", "2024-01-01T11:00:00Z"},
+		{"5/20 * * * *", "2024-01-01T10:30:00Z", "2024-01-01T10:45:00Z"},
+		{"0,30 8-9 * * *", "2024-01-01T09:30:00Z", "2024-01-02T08:00:00Z"},
+		// Weekdays only: Friday evening waits for Monday
+		{"0 9 * * 1-5", "2024-01-05T10:00:00Z", "2024-01-08T09:00:00Z"},
+		// 7 is Sunday as well as 0
+		{"30 2 * * 7", "2024-01-06T12:00:00Z", "2024-01-07T02:30:00Z"},
+		// With both day fields restricted, either one matching is due
+		{"0 12 13 * 5", "2024-01-01T00:00:00Z", "2024-01-05T12:00:00Z"},
+		{"0 0 1 */3 *", "2024-02-10T00:00:00Z", "2024-04-01T00:00:00Z"},
+		{"@daily", "2024-02-28T23:59:30Z", "2024-02-29T00:00:00Z"},
+		{"@yearly", "2024-06-01T00:00:00Z", "2025-01-01T00:00:00Z"},
+		// Times in other zones are evaluated in UTC
+		{"0 0 * * *", "2024-01-01T23:30:00+02:00", "2024-01-02T00:00:00Z"},
+		// Intervals count from a fixed origin, not from the time given
+		{"@every 90m", "2024-01-01T10:00:30.5Z", "2024-01-01T10:30:00Z"},
+		{"@every 90m", "2024-01-01T10:30:00Z", "2024-01-01T12:00:00Z"},
+		{"@every 1h", "2024-01-01T10:59:59Z", "2024-01-01T11:00:00Z"},
+		// February 30th never comes
+		{"0 0 30 2 *", "2024-01-01T00:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		got := schedule.next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q after %s = %s, want never", tt.expr, tt.from, got)
+			}
+			continue
+		}
+		if want := at(tt.want); !got.Equal(want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, want)
+		}
+	}
+}
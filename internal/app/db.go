@@ -2,7 +2,9 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
@@ -11,22 +13,52 @@ import (
 )
 
 func (app *AppContext) initMongoDB() {
-	clientOptions := options.Client().ApplyURI(app.Config.MongoURI)
-	client, err := mongo.Connect(context.Background(), clientOptions)
+	client, err := connectMongo(app.Config)
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
+	app.MongoClient = client
+}
+
+// connectMongo connects and pings MongoDB, giving up after ConnectTimeout so
+// an unreachable server fails startup instead of hanging it.
+func connectMongo(cfg ServerConfig) (*mongo.Client, error) {
+	// Decode embedded documents as maps so stored inputs, results and fixtures
+	// reach plugins and JSON responses as plain objects.
+	clientOptions := options.Client().
+		ApplyURI(cfg.MongoURI).
+		SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true}).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ConnectTimeout).
+		SetMinPoolSize(cfg.MinPoolSize)
+	if cfg.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
 
-	err = client.Ping(context.Background(), nil)
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
+		return nil, err
 	}
 
-	app.MongoClient = client
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("no response within %s: %w", cfg.ConnectTimeout, err)
+	}
+
+	return client, nil
 }
 
+// createIndexes creates the indexes of every tenant's database.
 func (app *AppContext) createIndexes() {
-	db := app.MongoClient.Database(app.Config.DatabaseName)
+	for _, tenant := range app.Config.tenants() {
+		app.createTenantIndexes(app.tenantDatabase(tenant))
+	}
+}
+
+func (app *AppContext) createTenantIndexes(db *mongo.Database) {
 
 	// Plugins index
 	_, err := db.Collection("plugins").Indexes().CreateOne(
@@ -40,6 +72,17 @@ func (app *AppContext) createIndexes() {
 		log.Printf("Error creating plugin index: %v", err)
 	}
 
+	// Plugins tag filter; tags is an array, so this is a multikey index
+	_, err = db.Collection("plugins").Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.M{"tags": 1},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating plugin tags index: %v", err)
+	}
+
 	// Data jobs index
 	_, err = db.Collection("data_jobs").Indexes().CreateOne(
 		context.Background(),
@@ -50,4 +93,136 @@ func (app *AppContext) createIndexes() {
 	if err != nil {
 		log.Printf("Error creating job index: %v", err)
 	}
+
+	// Data jobs listing order
+	_, err = db.Collection("data_jobs").Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.M{"created_at": -1},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating job created_at index: %v", err)
+	}
+
+	// Data jobs status filter
+	_, err = db.Collection("data_jobs").Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating job status index: %v", err)
+	}
+
+	// Jobs are filtered by any label key, so every key under labels is indexed
+	_, err = db.Collection("data_jobs").Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.M{"labels.$**": 1},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating job labels index: %v", err)
+	}
+
+	// Audit records are listed newest first, optionally for one plugin
+	_, err = db.Collection(executionsCollection).Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{Keys: bson.M{"created_at": -1}},
+			{Keys: bson.D{{Key: "plugin", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating execution indexes: %v", err)
+	}
+
+	// Each scheduled run is claimed once, by the first instance to get to it
+	_, err = db.Collection(scheduledRunsCollection).Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "task", Value: 1}, {Key: "run_at", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.M{"claimed_at": 1},
+				Options: options.Index().SetExpireAfterSeconds(int32(scheduleClaimTTL / time.Second)),
+			},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating scheduled run indexes: %v", err)
+	}
+
+	// Stored tasks are fetched by name, newest first
+	_, err = db.Collection("tasks").Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating task index: %v", err)
+	}
+
+	// Idempotency keys are unique per endpoint and caller, and expire after
+	// idempotency_ttl
+	_, err = db.Collection(idempotencyKeysCollection).Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "scope", Value: 1}, {Key: "key", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.M{"expires_at": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating idempotency key indexes: %v", err)
+	}
+
+	// Secrets are looked up by name
+	_, err = db.Collection(secretsCollection).Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys:    bson.M{"name": 1},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating secret index: %v", err)
+	}
+
+	// Finished jobs carry expires_at when job_ttl is set; MongoDB deletes
+	// them once that time has passed
+	if app.Config.JobTTL > 0 {
+		_, err = db.Collection("data_jobs").Indexes().CreateOne(
+			context.Background(),
+			mongo.IndexModel{
+				Keys:    bson.M{"expires_at": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		)
+		if err != nil {
+			log.Printf("Error creating job expiry index: %v", err)
+		}
+
+		// The input sweep looks up which GridFS inputs jobs still use
+		_, err = db.Collection("data_jobs").Indexes().CreateOne(
+			context.Background(),
+			mongo.IndexModel{
+				Keys:    bson.M{"input_ref": 1},
+				Options: options.Index().SetSparse(true),
+			},
+		)
+		if err != nil {
+			log.Printf("Error creating job input_ref index: %v", err)
+		}
+	}
 }
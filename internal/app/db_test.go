@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestConnectMongoGivesUp(t *testing.T) {
+	cfg := validConfig()
+	cfg.MongoURI = "mongodb://127.0.0.1:1"
+	cfg.ConnectTimeout = 100 * time.Millisecond
+	cfg.MinPoolSize, cfg.MaxPoolSize = 1, 5
+
+	start := time.Now()
+	client, err := connectMongo(cfg)
+	if err == nil {
+		client.Disconnect(context.Background())
+		t.Fatal("connectMongo reached a closed port")
+	}
+	if !strings.Contains(err.Error(), "no response within 100ms") {
+		t.Errorf("err = %v, want it to name the connect timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s, want about connect_timeout", elapsed)
+	}
+}
+
+func TestCreateTenantIndexesJobTTL(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name   string
+		jobTTL time.Duration
+	}{
+		{"jobs kept forever", 0},
+		{"jobs expire", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			app.Config.JobTTL = tt.jobTTL
+			for i := 0; i < 20; i++ {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+			app.createTenantIndexes(app.database(context.Background()))
+
+			var expiry []bson.Raw
+			for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+				if started.CommandName != "createIndexes" || started.Command.Lookup("createIndexes").StringValue() != "data_jobs" {
+					continue
+				}
+				indexes, err := started.Command.Lookup("indexes").Array().Values()
+				if err != nil {
+					mt.Fatal(err)
+				}
+				for _, index := range indexes {
+					if _, err := index.Document().LookupErr("key", "expires_at"); err == nil {
+						expiry = append(expiry, index.Document())
+					}
+				}
+			}
+
+			if tt.jobTTL == 0 {
+				if len(expiry) > 0 {
+					mt.Errorf("created %v, want no job expiry index without a job_ttl", expiry)
+				}
+				return
+			}
+			if len(expiry) != 1 {
+				mt.Fatalf("created %d job expiry indexes, want 1", len(expiry))
+			}
+			if key := expiry[0].Lookup("key"); key.String() != `{"expires_at": {"$numberInt":"1"}}` {
+				mt.Errorf("key = %s, want expires_at ascending", key)
+			}
+			// Each job expires at its own expires_at
+			if after, ok := expiry[0].Lookup("expireAfterSeconds").AsInt64OK(); !ok || after != 0 {
+				mt.Errorf("expireAfterSeconds = %v, want 0", expiry[0].Lookup("expireAfterSeconds"))
+			}
+		})
+	}
+}
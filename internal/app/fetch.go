@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	fetchTimeout  = 10 * time.Second
+	fetchMaxBytes = 1 << 20
+)
+
+// pluginFetcher performs HTTP requests for plugins, restricted to an
+// allowlist of hosts.
+type pluginFetcher struct {
+	client *http.Client
+	hosts  map[string]bool
+}
+
+func newPluginFetcher(hosts []string) *pluginFetcher {
+	f := &pluginFetcher{hosts: make(map[string]bool)}
+	for _, host := range hosts {
+		f.hosts[strings.ToLower(strings.TrimSpace(host))] = true
+	}
+	f.client = &http.Client{
+		Timeout: fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+func (f *pluginFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("fetch: unsupported scheme %q", u.Scheme)
+	}
+	if !f.hosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("fetch: host %s is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+type fetchOptions struct {
+	Method  string
+	Headers map[string]string
+	Body    string
+}
+
+// fetchOptionsFrom reads the optional method, headers and body properties of
+// fetch's second argument.
+func fetchOptionsFrom(vm *goja.Runtime, arg goja.Value) fetchOptions {
+	var opts fetchOptions
+	if goja.IsUndefined(arg) || goja.IsNull(arg) {
+		return opts
+	}
+	obj := arg.ToObject(vm)
+	if v := obj.Get("method"); v != nil && !goja.IsUndefined(v) {
+		opts.Method = v.String()
+	}
+	if v := obj.Get("body"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+		opts.Body = v.String()
+	}
+	if v := obj.Get("headers"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+		headers := v.ToObject(vm)
+		opts.Headers = make(map[string]string)
+		for _, name := range headers.Keys() {
+			opts.Headers[name] = headers.Get(name).String()
+		}
+	}
+	return opts
+}
+
+// fetch runs one request and returns {status, headers, body} for the plugin.
+// Bodies are read as text and may be at most fetchMaxBytes long.
+func (f *pluginFetcher) fetch(ctx context.Context, rawURL string, opts fetchOptions) (map[string]interface{}, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(opts.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, fetchMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	if len(data) > fetchMaxBytes {
+		return nil, fmt.Errorf("fetch: response body exceeds %d bytes", fetchMaxBytes)
+	}
+
+	headers := make(map[string]interface{}, len(resp.Header))
+	for name, values := range resp.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	return map[string]interface{}{
+		"status":  resp.StatusCode,
+		"headers": headers,
+		"body":    string(data),
+	}, nil
+}
+
+// installFetch binds fetch(url, opts). Unlike the browser API it is
+// synchronous and returns the response object directly. Requests use the
+// context of the execution in progress, so they end with it.
+func installFetch(vm *ScriptVM, f *pluginFetcher) {
+	vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		opts := fetchOptionsFrom(vm.Runtime, call.Argument(1))
+
+		ctx := vm.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		resp, err := f.fetch(ctx, call.Argument(0).String(), opts)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(resp)
+	})
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPluginFetcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(r.Header.Get("X-Test") + ":" + string(body)))
+		case "/redirect":
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		case "/large":
+			w.Write(make([]byte, fetchMaxBytes+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	// The allowlist names hosts, so the stub's port does not matter and
+	// localhost reaches it under a host that is not allowed
+	f := newPluginFetcher([]string{" 127.0.0.1 "})
+	other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name       string
+		url        string
+		opts       fetchOptions
+		wantStatus int
+		wantBody   string
+		wantErr    string
+	}{
+		{"get", srv.URL + "/echo", fetchOptions{}, 200, ":", ""},
+		{"post with headers", srv.URL + "/echo", fetchOptions{Method: "post", Headers: map[string]string{"X-Test": "t"}, Body: "data"}, 200, "t:data", ""},
+		{"error status", srv.URL + "/missing", fetchOptions{}, 404, "404 page not found\n", ""},
+		{"allowed redirect", srv.URL + "/redirect?to=/echo", fetchOptions{}, 200, ":", ""},
+		{"host not allowed", other + "/echo", fetchOptions{}, 0, "", "host localhost is not allowed"},
+		{"redirect to a host not allowed", srv.URL + "/redirect?to=" + other + "/echo", fetchOptions{}, 0, "", "host localhost is not allowed"},
+		{"unsupported scheme", "file:///etc/passwd", fetchOptions{}, 0, "", "unsupported scheme"},
+		{"body too large", srv.URL + "/large", fetchOptions{}, 0, "", "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := f.fetch(context.Background(), tt.url, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if resp["status"] != tt.wantStatus || resp["body"] != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", resp["status"], resp["body"], tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPluginFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"value": 42}`))
+	}))
+	defer srv.Close()
+
+	app := newTestApp(t)
+	newVM := app.VMFactory
+	app.VMFactory = func() *ScriptVM {
+		vm := newVM()
+		vm.fetcher = newPluginFetcher([]string{"127.0.0.1"})
+		installFetch(vm, vm.fetcher)
+		vm.baseline["fetch"] = true
+		return vm
+	}
+	plugin := addTestPlugin(t, app, "fetcher", `var resp = fetch(input); ({status: resp.status, type: resp.headers["content-type"], value: JSON.parse(resp.body).value})`)
+
+	result, err := app.runScript(context.Background(), plugin, scriptCall{Input: srv.URL})
+	if err != nil {
+		t.Fatalf("runScript: %v", err)
+	}
+	got := normalizeJSON(result.Value).(map[string]interface{})
+	if got["status"] != 200.0 || got["type"] != "application/json" || got["value"] != 42.0 {
+		t.Errorf("result = %v", got)
+	}
+}
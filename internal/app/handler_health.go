@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"datasciencehub/internal/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// health reports that the process is up and serving requests.
+func (app *AppContext) health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ready reports whether the server can reach MongoDB.
+func (app *AppContext) ready(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := app.MongoClient.Ping(ctx, nil); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database unreachable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// getVersion reports which build of the server is running.
+func (app *AppContext) getVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":    version.Version,
+		"commit":     version.Commit,
+		"build_date": version.BuildDate,
+	})
+}
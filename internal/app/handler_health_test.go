@@ -0,0 +1,55 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"datasciencehub/internal/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthProbes(t *testing.T) {
+	// The test app's MongoDB is unreachable, so the server is up but not
+	// ready.
+	app := newTestApp(t)
+	router := gin.New()
+	router.GET("/health", app.health)
+	router.GET("/ready", app.ready)
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/health", http.StatusOK, `{"status":"ok"}`},
+		{"/ready", http.StatusServiceUnavailable, `"error":"database unreachable"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s = %d %s, want %d with %s", tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	saved := []string{version.Version, version.Commit, version.BuildDate}
+	t.Cleanup(func() { version.Version, version.Commit, version.BuildDate = saved[0], saved[1], saved[2] })
+	version.Version, version.Commit, version.BuildDate = "v1.2.0", "abc1234", "2024-03-01T00:00:00Z"
+
+	router := gin.New()
+	router.GET("/version", (&AppContext{}).getVersion)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	want := `{"build_date":"2024-03-01T00:00:00Z","commit":"abc1234","version":"v1.2.0"}`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("version = %d %s, want %s", w.Code, w.Body.String(), want)
+	}
+}
@@ -2,59 +2,202 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"gopkg.in/yaml.v3"
 )
 
 func (app *AppContext) uploadData(c *gin.Context) {
-	var inputData interface{}
-	if err := c.ShouldBindJSON(&inputData); err != nil {
+	claim, handled := app.claimIdempotencyKey(c)
+	if handled {
+		return
+	}
+	defer claim.release()
+
+	labels, err := queryLabels(c)
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	raw, inputData, err := readUpload(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
 	defer cancel()
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
+	collection := app.database(ctx).Collection("data_jobs")
 	job := DataJob{
 		Name:        fmt.Sprintf("Job-%d", time.Now().Unix()),
 		Description: "Uploaded data job",
-		InputData:   inputData,
-		Status:      "uploaded",
+		Status:      JobStatusUploaded,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		Labels:      labels,
+	}
+
+	if err := app.setJobInput(ctx, &job, raw, inputData); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 
 	result, err := collection.InsertOne(ctx, job)
 	if err != nil {
+		app.deleteJobInput(ctx, job.InputRef)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	claim.respond(c, 201, gin.H{"id": result.InsertedID, "message": "Data uploaded successfully"})
+}
+
+// uploadDataStream stores a multipart "file" field holding JSON directly in
+// GridFS, for inputs too large to buffer in memory. Optional name and
+// description fields must come before the file.
+func (app *AppContext) uploadDataStream(c *gin.Context) {
+	claim, handled := app.claimIdempotencyKey(c)
+	if handled {
+		return
+	}
+	defer claim.release()
+
+	labels, err := queryLabels(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	job := DataJob{
+		Name:        fmt.Sprintf("Job-%d", time.Now().Unix()),
+		Description: "Streamed data job",
+		Status:      JobStatusUploaded,
+		Labels:      labels,
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			c.JSON(400, gin.H{"error": "missing file field"})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch part.FormName() {
+		case "name", "description":
+			value, err := io.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			if part.FormName() == "name" {
+				job.Name = string(value)
+			} else {
+				job.Description = string(value)
+			}
+			continue
+		case "file":
+		default:
+			continue
+		}
+
+		id, err := app.streamJobInput(c.Request.Context(), job.Name+".json", part)
+		if errors.Is(err, errInvalidJSONInput) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		job.InputRef = &id
+		break
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	collection := app.database(ctx).Collection("data_jobs")
+	result, err := collection.InsertOne(ctx, job)
+	if err != nil {
+		app.deleteJobInput(ctx, job.InputRef)
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(201, gin.H{"id": result.InsertedID, "message": "Data uploaded successfully"})
+	claim.respond(c, 201, gin.H{"id": result.InsertedID, "message": "Data uploaded successfully"})
 }
 
 func (app *AppContext) processData(c *gin.Context) {
 	var request struct {
-		JobID   string `json:"job_id"`
-		Plugins []struct {
-			Name   string                 `json:"name"`
-			Params map[string]interface{} `json:"params"`
-		} `json:"plugins"`
+		JobID       string       `json:"job_id"`
+		Plugins     []pluginCall `json:"plugins"`
+		CallbackURL string       `json:"callback_url"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	if request.CallbackURL != "" {
+		if err := app.checkCallbackURL(request.CallbackURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claim, handled := app.claimIdempotencyKey(c)
+	if handled {
+		return
+	}
+	defer claim.release()
+
+	async, err := strconv.ParseBool(c.DefaultQuery("async", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "async must be true or false"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	if dryRun && async {
+		c.JSON(400, gin.H{"error": "dry_run cannot be combined with async"})
+		return
+	}
+	allowMissing, err := strconv.ParseBool(c.DefaultQuery("allow_missing", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "allow_missing must be true or false"})
+		return
+	}
+	// Unless asked otherwise, a chain only runs when every plugin exists
+	if !allowMissing {
+		if missing := app.missingPlugins(c.Request.Context(), request.Plugins); len(missing) > 0 {
+			c.JSON(400, gin.H{"error": "plugins not found", "missing": missing})
+			return
+		}
+	}
 
 	objID, err := primitive.ObjectIDFromHex(request.JobID)
 	if err != nil {
@@ -62,121 +205,229 @@ func (app *AppContext) processData(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.ProcessTimeout)
 	defer cancel()
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
+	collection := app.database(ctx).Collection("data_jobs")
 	var job DataJob
 	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job)
-	if err != nil {
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		c.JSON(404, gin.H{"error": "job not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
-	results := make(map[string]interface{})
-	data := job.InputData
-
-	for _, plugin := range request.Plugins {
-		app.PluginsMux.RLock()
-		script, exists := app.Plugins[plugin.Name]
-		app.PluginsMux.RUnlock()
+	if err := app.resolveJobInput(ctx, &job); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
-		if !exists {
-			results[plugin.Name] = gin.H{"error": "plugin not found"}
-			continue
+	if request.CallbackURL != "" && !dryRun {
+		update := bson.M{"$set": bson.M{"callback_url": request.CallbackURL}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": objID}, update); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
 		}
+	}
 
-		output, err := app.runScript(script, data, plugin.Params)
-		if err != nil {
-			results[plugin.Name] = gin.H{"error": err.Error()}
-			continue
+	if async {
+		update := bson.M{
+			"$set": bson.M{
+				"status":     JobStatusProcessing,
+				"updated_at": time.Now(),
+			},
 		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": objID}, update); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		app.publishJobEvent(objID, statusEvent(JobStatusProcessing))
+		jobCtx := app.registerJob(ctx, objID)
+		go app.processJobAsync(jobCtx, objID, job.InputData, request.Plugins)
+
+		claim.respond(c, 202, gin.H{"message": "Data processing started", "job_id": objID, "status": JobStatusProcessing})
+		return
+	}
 
-		results[plugin.Name] = output
-		data = output
+	if dryRun {
+		// The nil ID has no event subscribers, so the job's stream stays quiet
+		results, failed := app.runPluginChain(ctx, primitive.NilObjectID, job.InputData, request.Plugins)
+		status := JobStatusProcessed
+		if failed {
+			status = JobStatusFailed
+		}
+		claim.respond(c, 200, gin.H{"message": "Dry run completed", "dry_run": true, "status": status, "results": results})
+		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"status":     "processed",
-			"results":    results,
-			"updated_at": time.Now(),
-		},
+	results, failed := app.runPluginChain(ctx, objID, job.InputData, request.Plugins)
+
+	status := JobStatusProcessed
+	if failed {
+		status = JobStatusFailed
 	}
+	update := app.jobResultUpdate(status, results)
 
 	_, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	app.publishJobEvent(objID, statusEvent(status))
+	app.notifyJob(ctx, objID)
 
-	c.JSON(200, gin.H{"message": "Data processed successfully", "results": results})
+	claim.respond(c, 200, gin.H{"message": "Data processed successfully", "status": status, "results": results})
 }
 
-func (app *AppContext) processYamlTask(c *gin.Context) {
+// readTaskFile parses the TaskDefinition uploaded in the yaml_file form
+// field. Errors are reported to the client before returning false.
+func readTaskFile(c *gin.Context) (TaskDefinition, bool) {
+	var task TaskDefinition
+
 	file, err := c.FormFile("yaml_file")
 	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
-		return
+		return task, false
 	}
 
 	yamlFile, err := file.Open()
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		return task, false
 	}
 	defer yamlFile.Close()
 
 	yamlData, err := io.ReadAll(yamlFile)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
+		return task, false
+	}
+
+	if err := yaml.Unmarshal(yamlData, &task); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return task, false
+	}
+	return task, true
+}
+
+func (app *AppContext) validateYamlTask(c *gin.Context) {
+	task, ok := readTaskFile(c)
+	if !ok {
+		return
+	}
+
+	problems := app.validateTask(c.Request.Context(), task)
+	c.JSON(200, gin.H{"valid": len(problems) == 0, "problems": problems})
+}
+
+func (app *AppContext) processYamlTask(c *gin.Context) {
+	task, ok := readTaskFile(c)
+	if !ok {
 		return
 	}
 
+	app.submitTask(c, task, "YAML task processed successfully")
+}
+
+// processTask runs a TaskDefinition sent as a JSON body, the same way
+// processYamlTask runs an uploaded YAML file.
+func (app *AppContext) processTask(c *gin.Context) {
 	var task TaskDefinition
-	if err := yaml.Unmarshal(yamlData, &task); err != nil {
+	if err := c.ShouldBindJSON(&task); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	app.submitTask(c, task, "Task processed successfully")
+}
+
+// submitTask stores a newly submitted task, runs it and responds with the
+// resulting job.
+func (app *AppContext) submitTask(c *gin.Context, task TaskDefinition, message string) {
+	if _, err := task.errorPolicy(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := task.schedule(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if task.CallbackURL != "" {
+		if err := app.checkCallbackURL(task.CallbackURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := checkLabels(task.Labels); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
 	defer cancel()
 
-	taskCollection := app.MongoClient.Database(app.Config.DatabaseName).Collection("tasks")
-	_, err = taskCollection.InsertOne(ctx, task)
+	task.ID = primitive.NilObjectID
+	task.CreatedAt = time.Now()
+	taskCollection := app.database(ctx).Collection("tasks")
+	_, err := taskCollection.InsertOne(ctx, task)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	results := make(map[string]interface{})
-	var wg sync.WaitGroup
-	var mutex sync.Mutex
-
-	sem := make(chan struct{}, app.Config.MaxParallel)
+	run, ok := app.executeTask(c, task)
+	if !ok {
+		return
+	}
 
-	processStep := func(_ int, step map[string]interface{}, data interface{}) (interface{}, error) {
-		pluginName, ok := step["plugin"].(string)
-		if !ok {
-			return nil, fmt.Errorf("plugin name not specified in step")
-		}
+	c.JSON(200, gin.H{
+		"message": message,
+		"job_id":  run.JobID,
+		"status":  run.Status,
+		"results": run.Results,
+	})
+}
 
-		params, ok := step["params"].(map[string]interface{})
-		if !ok {
-			params = make(map[string]interface{})
-		}
+// taskRun is the outcome of executeTask.
+type taskRun struct {
+	JobID   interface{}
+	Status  string
+	Results map[string]interface{}
+}
 
-		app.PluginsMux.RLock()
-		script, exists := app.Plugins[pluginName]
-		app.PluginsMux.RUnlock()
+// executeTask runs a task through runTaskJob. Errors that prevent the run are
+// reported to the client before returning false.
+func (app *AppContext) executeTask(c *gin.Context, task TaskDefinition) (taskRun, bool) {
+	run, err := app.runTaskJob(c.Request.Context(), task)
+	var rejected *taskRejection
+	switch {
+	case errors.As(err, &rejected):
+		c.JSON(rejected.Status, gin.H{"error": rejected.Error()})
+		return taskRun{}, false
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+		return taskRun{}, false
+	}
+	return run, true
+}
 
-		if !exists {
-			return nil, fmt.Errorf("plugin %s not found", pluginName)
-		}
+// taskRejection is an error caused by the task itself rather than the
+// server, with the status a handler answers it with.
+type taskRejection struct {
+	Status int
+	Err    error
+}
 
-		return app.runScript(script, data, params)
-	}
+func (e *taskRejection) Error() string { return e.Err.Error() }
+func (e *taskRejection) Unwrap() error { return e.Err }
 
+// runTaskJob runs every step of a task and records the outcome as a new data
+// job. A task whose steps fail still produces a job, with status failed.
+func (app *AppContext) runTaskJob(ctx context.Context, task TaskDefinition) (taskRun, error) {
 	// Get inputData from first step if exists and references job_id
 	var inputData interface{}
 	if len(task.Steps) > 0 {
@@ -184,19 +435,21 @@ func (app *AppContext) processYamlTask(c *gin.Context) {
 			if jobID, ok := inputRef["job_id"].(string); ok {
 				objID, err := primitive.ObjectIDFromHex(jobID)
 				if err != nil {
-					c.JSON(400, gin.H{"error": "invalid job ID in input reference"})
-					return
+					return taskRun{}, &taskRejection{400, errors.New("invalid job ID in input reference")}
 				}
 
-				ctxJob, cancelJob := context.WithTimeout(c.Request.Context(), 10*time.Second)
+				ctxJob, cancelJob := context.WithTimeout(ctx, app.Config.DBTimeout)
 				defer cancelJob()
 
-				jobCollection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
+				jobCollection := app.database(ctx).Collection("data_jobs")
 				var job DataJob
 				err = jobCollection.FindOne(ctxJob, bson.M{"_id": objID}).Decode(&job)
 				if err != nil {
-					c.JSON(404, gin.H{"error": "referenced job not found"})
-					return
+					return taskRun{}, &taskRejection{404, errors.New("referenced job not found")}
+				}
+
+				if err := app.resolveJobInput(ctx, &job); err != nil {
+					return taskRun{}, err
 				}
 
 				inputData = job.InputData
@@ -204,98 +457,132 @@ func (app *AppContext) processYamlTask(c *gin.Context) {
 		}
 	}
 
-	currentData := inputData
-	if task.Parallel {
-		for i, step := range task.Steps {
-			wg.Add(1)
-			go func(stepNum int, step map[string]interface{}) {
-				defer wg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
-
-				stepName := fmt.Sprintf("step_%d", stepNum)
-				if name, ok := step["name"].(string); ok {
-					stepName = name
-				}
-
-				result, err := processStep(stepNum, step, inputData)
-				if err != nil {
-					mutex.Lock()
-					results[stepName] = gin.H{"error": err.Error()}
-					mutex.Unlock()
-					return
-				}
-
-				mutex.Lock()
-				results[stepName] = result
-				mutex.Unlock()
-			}(i, step)
-		}
-		wg.Wait()
-	} else {
-		for i, step := range task.Steps {
-			stepName := fmt.Sprintf("step_%d", i)
-			if name, ok := step["name"].(string); ok {
-				stepName = name
-			}
-
-			result, err := processStep(i, step, currentData)
-			if err != nil {
-				results[stepName] = gin.H{"error": err.Error()}
-				break
-			}
-
-			results[stepName] = result
-			currentData = result
-		}
+	status := JobStatusProcessed
+	results, err := app.runTask(ctx, task, inputData)
+	var stepsErr *taskStepsError
+	switch {
+	case errors.As(err, &stepsErr):
+		status = JobStatusFailed
+	case err != nil:
+		return taskRun{}, &taskRejection{400, err}
 	}
 
-	jobCtx, cancelJob := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	jobCtx, cancelJob := context.WithTimeout(ctx, app.Config.DBTimeout)
 	defer cancelJob()
 
-	jobCollection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
+	jobCollection := app.database(ctx).Collection("data_jobs")
 	job := DataJob{
 		Name:        task.Name,
 		Description: task.Description,
 		InputData:   inputData,
-		Status:      "processed",
-		Results:     results,
+		Status:      status,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		ExpiresAt:   app.jobExpiry(time.Now()),
+		CallbackURL: task.CallbackURL,
+		Labels:      task.Labels,
 	}
+	job.Results, job.ResultsEncoding = app.encodeResults(results)
 
 	result, err := jobCollection.InsertOne(jobCtx, job)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		return taskRun{}, err
+	}
+	if job.CallbackURL != "" {
+		app.notifyJob(ctx, result.InsertedID.(primitive.ObjectID))
 	}
 
-	c.JSON(200, gin.H{
-		"message": "YAML task processed successfully",
-		"job_id":  result.InsertedID,
-		"results": results,
-	})
+	return taskRun{JobID: result.InsertedID, Status: status, Results: results}, nil
 }
 
 func (app *AppContext) listJobs(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	pg, err := parsePage(c, []string{"created_at", "updated_at", "name", "status"}, "-created_at")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := jobFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
 	defer cancel()
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
-	cursor, err := collection.Find(ctx, bson.M{})
+	collection := app.database(ctx).Collection("data_jobs")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := collection.Find(ctx, filter, pg.findOptions())
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var jobs []DataJob
+	jobs := make([]DataJob, 0)
 	if err = cursor.All(ctx, &jobs); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range jobs {
+		if err := decodeJobResults(&jobs[i]); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	c.JSON(200, jobs)
+	c.JSON(200, gin.H{
+		"jobs":   jobs,
+		"total":  total,
+		"limit":  pg.Limit,
+		"offset": pg.Offset,
+	})
+}
+
+// jobFilter builds the listJobs query from the status, created_after,
+// created_before and label query parameters. Timestamps are RFC3339.
+func jobFilter(c *gin.Context) (bson.M, error) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if err := addCreatedAtRange(c, filter); err != nil {
+		return nil, err
+	}
+	if err := addLabelFilter(c, filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// addCreatedAtRange restricts filter to the created_after and created_before
+// query parameters, given as RFC3339 timestamps.
+func addCreatedAtRange(c *gin.Context, filter bson.M) error {
+	createdAt := bson.M{}
+	if raw := c.Query("created_after"); raw != "" {
+		after, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return fmt.Errorf("created_after must be an RFC3339 timestamp")
+		}
+		createdAt["$gte"] = after
+	}
+	if raw := c.Query("created_before"); raw != "" {
+		before, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return fmt.Errorf("created_before must be an RFC3339 timestamp")
+		}
+		createdAt["$lt"] = before
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	return nil
 }
 
 func (app *AppContext) getJob(c *gin.Context) {
@@ -306,16 +593,71 @@ func (app *AppContext) getJob(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
 	defer cancel()
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("data_jobs")
+	collection := app.database(ctx).Collection("data_jobs")
 	var job DataJob
 	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job)
-	if err != nil {
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		c.JSON(404, gin.H{"error": "job not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := app.resolveJobInput(ctx, &job); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if err := decodeJobResults(&job); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(200, job)
 }
+
+// compareJobs diffs the results of two jobs, reporting what changed from job
+// a to job b.
+func (app *AppContext) compareJobs(c *gin.Context) {
+	ids := make([]primitive.ObjectID, 2)
+	for i, param := range []string{"a", "b"} {
+		objID, err := primitive.ObjectIDFromHex(c.Query(param))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid job ID in " + param})
+			return
+		}
+		ids[i] = objID
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+	results := make([]interface{}, 2)
+	for i, objID := range ids {
+		var job DataJob
+		if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job); err != nil {
+			c.JSON(404, gin.H{"error": "job not found", "job_id": objID})
+			return
+		}
+		if err := decodeJobResults(&job); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		results[i] = normalizeJSON(job.Results)
+	}
+
+	diff := diffJSON(results[0], results[1])
+	c.JSON(200, gin.H{
+		"a":         ids[0],
+		"b":         ids[1],
+		"identical": len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0,
+		"added":     diff.Added,
+		"removed":   diff.Removed,
+		"changed":   diff.Changed,
+	})
+}
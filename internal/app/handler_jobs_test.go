@@ -0,0 +1,325 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+func TestJobFilter(t *testing.T) {
+	after := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query   string
+		want    bson.M
+		wantErr string
+	}{
+		{"", bson.M{}, ""},
+		{"status=completed", bson.M{"status": "completed"}, ""},
+		{"created_after=2024-03-01T00:00:00Z", bson.M{"created_at": bson.M{"$gte": after}}, ""},
+		{"created_before=2024-04-01T12:00:00Z", bson.M{"created_at": bson.M{"$lt": before}}, ""},
+		{
+			"status=failed&created_after=2024-03-01T00:00:00Z&created_before=2024-04-01T12:00:00Z",
+			bson.M{"status": "failed", "created_at": bson.M{"$gte": after, "$lt": before}},
+			"",
+		},
+		{"created_after=2024-03-01", nil, "created_after must be an RFC3339 timestamp"},
+		{"created_before=yesterday", nil, "created_before must be an RFC3339 timestamp"},
+		{"label=experiment:42", bson.M{"labels.experiment": "42"}, ""},
+		{"label=experiment", bson.M{"labels.experiment": bson.M{"$exists": true}}, ""},
+		{
+			"status=completed&label=experiment:42&label=url:http://x",
+			bson.M{"status": "completed", "labels.experiment": "42", "labels.url": "http://x"},
+			"",
+		},
+		{"label=a.b:1", nil, `label key "a.b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := jobFilter(queryContext(tt.query))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jobFilter: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jobFilter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskDefinitionFormats(t *testing.T) {
+	yamlTask := `
+name: nightly
+vars:
+  factor: 2
+parallel: true
+on_error: continue
+steps:
+  - name: scale
+    plugin: scale
+    params:
+      factor: ${var.factor}
+  - name: sum
+    plugin: sum
+    depends_on: [scale]
+    retries: 1
+`
+	jsonTask := `{
+		"name": "nightly",
+		"vars": {"factor": 2},
+		"parallel": true,
+		"on_error": "continue",
+		"steps": [
+			{"name": "scale", "plugin": "scale", "params": {"factor": "${var.factor}"}},
+			{"name": "sum", "plugin": "sum", "depends_on": ["scale"], "retries": 1}
+		]
+	}`
+
+	var fromYAML, fromJSON TaskDefinition
+	if err := yaml.Unmarshal([]byte(yamlTask), &fromYAML); err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	if err := json.Unmarshal([]byte(jsonTask), &fromJSON); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if got, want := normalizeJSON(fromJSON), normalizeJSON(fromYAML); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON task = %v, want the YAML task %v", got, want)
+	}
+}
+
+func TestProcessDataRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		body     string
+		wantBody string
+	}{
+		{"bad dry_run flag", "?dry_run=maybe", `{"job_id": "65f000000000000000000000"}`, "dry_run must be true or false"},
+		{"dry run in the background", "?dry_run=true&async=true", `{"job_id": "65f000000000000000000000"}`, "dry_run cannot be combined with async"},
+		{"bad async flag", "?async=later", `{"job_id": "65f000000000000000000000"}`, "async must be true or false"},
+		{"invalid job ID", "?dry_run=true", `{"job_id": "abc"}`, "invalid job ID"},
+		{"bad allow_missing flag", "?allow_missing=sometimes", `{"job_id": "abc"}`, "allow_missing must be true or false"},
+		{"missing plugins", "", `{"job_id": "abc", "plugins": [{"name": "scale"}]}`, `"missing":["scale"]`},
+		{"missing plugins allowed", "?allow_missing=true", `{"job_id": "abc", "plugins": [{"name": "scale"}]}`, "invalid job ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			router := gin.New()
+			router.POST("/data/process", app.processData)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/data/process"+tt.query, strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// writeStreamUpload writes a multipart upload to w whose file field holds a
+// JSON array of about size bytes, generated as it is written.
+func writeStreamUpload(w *io.PipeWriter, form *multipart.Writer, size int) {
+	row := []byte(`"` + strings.Repeat("abcdefghijklmnop", 256) + `",`)
+	block := bytes.Repeat(row, (64<<10)/len(row))
+	err := func() error {
+		if err := form.WriteField("name", "large"); err != nil {
+			return err
+		}
+		part, err := form.CreateFormFile("file", "large.json")
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write([]byte("[")); err != nil {
+			return err
+		}
+		for written := 0; written < size; written += len(block) {
+			if _, err := part.Write(block); err != nil {
+				return err
+			}
+		}
+		if _, err := part.Write([]byte("null]")); err != nil {
+			return err
+		}
+		return form.Close()
+	}()
+	w.CloseWithError(err)
+}
+
+func TestUploadDataStream(t *testing.T) {
+	// The test's monitor tallies the commands as they start and drops the
+	// recorded events, which would otherwise hold every chunk written
+	var mt *mtest.T
+	var chunkBytes int
+	var inputRef, chunksOf primitive.ObjectID
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, started *event.CommandStartedEvent) {
+			switch {
+			case started.CommandName == "insert" && started.Command.Lookup("insert").StringValue() == "job_inputs.chunks":
+				docs, _ := started.Command.Lookup("documents").Array().Values()
+				for _, doc := range docs {
+					chunksOf = doc.Document().Lookup("files_id").ObjectID()
+					_, data := doc.Document().Lookup("data").Binary()
+					chunkBytes += len(data)
+				}
+			case started.CommandName == "insert" && started.Command.Lookup("insert").StringValue() == "data_jobs":
+				inputRef, _ = started.Command.Lookup("documents", "0", "input_ref").ObjectIDOK()
+			}
+			mt.ClearEvents()
+		},
+	}
+	opts := mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor))
+	mtest.New(t, opts).Run("streamed to GridFS", func(t *mtest.T) {
+		mt = t
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		router := gin.New()
+		router.POST("/data/upload/stream", app.uploadDataStream)
+		// Collect often enough that the heap stays close to what is live
+		defer debug.SetGCPercent(debug.SetGCPercent(10))
+
+		// upload streams size bytes of JSON and returns how far the heap
+		// grew on the way
+		upload := func(size int) int64 {
+			chunkBytes, inputRef, chunksOf = 0, primitive.NilObjectID, primitive.NilObjectID
+			// The bucket finds a stored file, so it creates no indexes;
+			// every write after that succeeds
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}}))
+			for i := 0; i < size/gridfs.UploadBufferSize+3; i++ {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+
+			pr, pw := io.Pipe()
+			form := multipart.NewWriter(pw)
+			go writeStreamUpload(pw, form, size)
+			req := httptest.NewRequest(http.MethodPost, "/data/upload/stream", pr)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			runtime.GC()
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			baseline := stats.HeapAlloc
+			peak := baseline
+			done := make(chan struct{})
+			sampled := make(chan struct{})
+			go func() {
+				defer close(sampled)
+				var stats runtime.MemStats
+				for {
+					runtime.ReadMemStats(&stats)
+					peak = max(peak, stats.HeapAlloc)
+					select {
+					case <-done:
+						return
+					case <-time.After(5 * time.Millisecond):
+					}
+				}
+			}()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			close(done)
+			<-sampled
+
+			if w.Code != http.StatusCreated {
+				mt.Fatalf("response %d %s, want 201", w.Code, w.Body.String())
+			}
+			if inputRef.IsZero() || inputRef != chunksOf {
+				mt.Errorf("job input_ref = %s, want the stored file %s", inputRef.Hex(), chunksOf.Hex())
+			}
+			if chunkBytes < size {
+				mt.Errorf("stored %d bytes, want the %d byte input", chunkBytes, size)
+			}
+			return int64(peak - baseline)
+		}
+
+		// Writing a batch of chunks costs the same whatever the input's
+		// size; the rest of the input never sits in memory
+		const small, large = 32 << 20, 160 << 20
+		smallGrowth := upload(small)
+		largeGrowth := upload(large)
+		if largeGrowth-smallGrowth > (large-small)/4 {
+			mt.Errorf("heap grew by %d MiB for %d MiB of input and %d MiB for %d MiB, want it not to follow the input",
+				smallGrowth>>20, small>>20, largeGrowth>>20, large>>20)
+		}
+	})
+}
+
+func TestUploadDataStreamRejects(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		wantBody string
+	}{
+		{"missing file field", map[string]string{"name": "job"}, "missing file field"},
+		{"invalid JSON", map[string]string{"file": `{"rows": [1, 2}`}, "input data is not valid JSON"},
+		{"more than one value", map[string]string{"file": `[1] [2]`}, "input data is not valid JSON"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}}))
+			for i := 0; i < 4; i++ {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+			}
+			router := gin.New()
+			router.POST("/data/upload/stream", app.uploadDataStream)
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			for name, value := range tt.fields {
+				if name == "file" {
+					part, err := form.CreateFormFile("file", "input.json")
+					if err != nil {
+						mt.Fatal(err)
+					}
+					part.Write([]byte(value))
+					continue
+				}
+				form.WriteField(name, value)
+			}
+			form.Close()
+			req := httptest.NewRequest(http.MethodPost, "/data/upload/stream", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantBody) {
+				mt.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantBody)
+			}
+			// No job is created for a rejected upload
+			for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+				if started.CommandName == "insert" && started.Command.Lookup("insert").StringValue() == "data_jobs" {
+					mt.Error("inserted a job")
+				}
+			}
+		})
+	}
+}
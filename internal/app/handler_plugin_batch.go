@@ -0,0 +1,96 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type batchItemResult struct {
+	Result     interface{}      `json:"result,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Exception  *scriptException `json:"exception,omitempty"`
+	Logs       []LogEntry       `json:"logs"`
+	Violations []string         `json:"violations,omitempty"`
+}
+
+// executePluginBatch runs a plugin once per input with shared params. At most
+// MaxParallel inputs run at once; results keep the order of the inputs and
+// failures are reported per item.
+func (app *AppContext) executePluginBatch(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	var input struct {
+		Inputs  []interface{}          `json:"inputs"`
+		Params  map[string]interface{} `json:"params"`
+		Timeout interface{}            `json:"timeout"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Inputs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "inputs must be an array"})
+		return
+	}
+
+	timeout, err := durationValue("timeout", input.Timeout)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	script, exists := app.lookupPlugin(c.Request.Context(), name)
+
+	if !exists {
+		app.respondPluginMissing(c, name)
+		return
+	}
+
+	results := make([]batchItemResult, len(input.Inputs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := min(max(app.Config.MaxParallel, 1), len(input.Inputs))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if violations := script.validateInput(input.Inputs[i]); len(violations) > 0 {
+					results[i] = batchItemResult{Error: "input does not match the plugin's input_schema", Violations: violations}
+					continue
+				}
+
+				output, err := app.runScript(c.Request.Context(), script, scriptCall{Input: input.Inputs[i], Params: input.Params, Timeout: timeout})
+				results[i] = batchItemResult{Result: output.Value, Logs: output.Logs}
+				if err != nil {
+					results[i].Error = err.Error()
+					results[i].Exception = exceptionOf(err)
+				}
+			}
+		}()
+	}
+
+	for i := range input.Inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
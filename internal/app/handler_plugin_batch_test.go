@@ -0,0 +1,84 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExecutePluginBatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		plugin        string
+		body          string
+		wantCode      int
+		wantResults   []interface{}
+		wantErrors    []bool
+		wantSucceeded int
+	}{
+		{
+			"results in input order",
+			"scale",
+			`{"inputs": [1, 2, 3, 4, 5], "params": {"factor": 10}}`,
+			http.StatusOK,
+			[]interface{}{10.0, 20.0, 30.0, 40.0, 50.0},
+			[]bool{false, false, false, false, false},
+			5,
+		},
+		{
+			"failures per item",
+			"scale",
+			`{"inputs": [1, -1, 2], "params": {"factor": 2}}`,
+			http.StatusOK,
+			[]interface{}{2.0, nil, 4.0},
+			[]bool{false, true, false},
+			2,
+		},
+		{"no inputs", "scale", `{"inputs": []}`, http.StatusOK, []interface{}{}, []bool{}, 0},
+		{"inputs missing", "scale", `{"params": {}}`, http.StatusBadRequest, nil, nil, 0},
+		{"bad timeout", "scale", `{"inputs": [1], "timeout": "soon"}`, http.StatusBadRequest, nil, nil, 0},
+		{"unknown plugin", "missing", `{"inputs": [1]}`, http.StatusNotFound, nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			addTestPlugin(t, app, "scale", `if (input < 0) throw new Error("negative input"); input * params.factor`)
+			router := gin.New()
+			router.POST("/plugins/:name/batch", app.executePluginBatch)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/"+tt.plugin+"/batch", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Results   []batchItemResult `json:"results"`
+				Succeeded int               `json:"succeeded"`
+				Failed    int               `json:"failed"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			results := make([]interface{}, len(body.Results))
+			errs := make([]bool, len(body.Results))
+			for i, result := range body.Results {
+				results[i], errs[i] = result.Result, result.Error != ""
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) || !reflect.DeepEqual(errs, tt.wantErrors) {
+				t.Errorf("results %v with errors %v, want %v with %v", results, errs, tt.wantResults, tt.wantErrors)
+			}
+			if body.Succeeded != tt.wantSucceeded || body.Failed != len(body.Results)-tt.wantSucceeded {
+				t.Errorf("succeeded %d, failed %d, want %d succeeded", body.Succeeded, body.Failed, tt.wantSucceeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBenchmarkIterations = 10
+	maxBenchmarkIterations     = 100
+)
+
+// benchmarkPlugin runs a plugin repeatedly on the same input, one run after
+// another, and reports how long the runs took in milliseconds. Timings
+// include taking a runtime from the pool and exporting the result, as they
+// do for execute. The benchmark stops at the first failing run.
+func (app *AppContext) benchmarkPlugin(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	var input struct {
+		Data       interface{}            `json:"data"`
+		Params     map[string]interface{} `json:"params"`
+		Iterations int                    `json:"iterations"`
+		Timeout    interface{}            `json:"timeout"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case input.Iterations == 0:
+		input.Iterations = defaultBenchmarkIterations
+	case input.Iterations < 0 || input.Iterations > maxBenchmarkIterations:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("iterations must be between 1 and %d", maxBenchmarkIterations)})
+		return
+	}
+
+	timeout, err := durationValue("timeout", input.Timeout)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	script, exists := app.lookupPlugin(c.Request.Context(), name)
+
+	if !exists {
+		app.respondPluginMissing(c, name)
+		return
+	}
+
+	if violations := script.validateInput(input.Data); len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input does not match the plugin's input_schema", "violations": violations})
+		return
+	}
+
+	durations := make([]time.Duration, 0, input.Iterations)
+	for i := 0; i < input.Iterations; i++ {
+		start := time.Now()
+		output, err := app.runScript(c.Request.Context(), script, scriptCall{Input: input.Data, Params: input.Params, Timeout: timeout})
+		if err != nil {
+			body := scriptFailure(err)
+			body["iteration"] = i + 1
+			body["logs"] = output.Logs
+			c.JSON(scriptErrorStatus(err), body)
+			return
+		}
+		durations = append(durations, time.Since(start))
+	}
+
+	slices.Sort(durations)
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	p95 := durations[int(math.Ceil(0.95*float64(len(durations))))-1]
+
+	c.JSON(http.StatusOK, gin.H{
+		"iterations": len(durations),
+		"min_ms":     milliseconds(durations[0]),
+		"max_ms":     milliseconds(durations[len(durations)-1]),
+		"mean_ms":    milliseconds(total / time.Duration(len(durations))),
+		"p95_ms":     milliseconds(p95),
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBenchmarkPlugin(t *testing.T) {
+	tests := []struct {
+		name           string
+		plugin         string
+		body           string
+		wantCode       int
+		wantIterations float64
+		wantBody       string
+	}{
+		{"default iterations", "count", `{"data": 1}`, http.StatusOK, defaultBenchmarkIterations, ""},
+		{"chosen iterations", "count", `{"data": 1, "iterations": 3}`, http.StatusOK, 3, ""},
+		{"too many iterations", "count", `{"iterations": 101}`, http.StatusBadRequest, 0, "iterations must be between 1 and 100"},
+		{"negative iterations", "count", `{"iterations": -1}`, http.StatusBadRequest, 0, "iterations must be between 1 and 100"},
+		{"stops at the first failure", "flaky", `{"iterations": 5}`, http.StatusInternalServerError, 0, `"iteration":3`},
+		{"unknown plugin", "missing", `{}`, http.StatusNotFound, 0, "plugin not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			countAttempts(app)
+			addTestPlugin(t, app, "count", "input + 1")
+			addTestPlugin(t, app, "flaky", `if (attempt() == 3) throw new Error("third run"); 1`)
+			router := gin.New()
+			router.POST("/plugins/:name/benchmark", app.benchmarkPlugin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/"+tt.plugin+"/benchmark", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var report map[string]float64
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report["iterations"] != tt.wantIterations {
+				t.Errorf("iterations %v, want %v", report["iterations"], tt.wantIterations)
+			}
+			if !(report["min_ms"] <= report["mean_ms"] && report["mean_ms"] <= report["max_ms"] && report["p95_ms"] <= report["max_ms"]) {
+				t.Errorf("timings out of order: %v", report)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportPlugins streams a zip of the newest source of every plugin, as
+// <name>.js or <name>.wasm, followed by a manifest.json with their metadata, in the layout
+// importPlugins reads. Plugins are read one at a time, so the archive is
+// never held in memory. An error once streaming has begun can only cut the
+// archive short, which leaves it without its central directory and so
+// unreadable.
+func (app *AppContext) exportPlugins(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.ExportTimeout)
+	defer cancel()
+
+	db := app.database(ctx)
+	bucket, err := gridfs.NewBucket(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := db.Collection("plugins").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="plugins.zip"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	manifest := make(map[string]pluginManifestEntry)
+	for cursor.Next(ctx) {
+		var plugin Plugin
+		if err := cursor.Decode(&plugin); err != nil {
+			log.Printf("Plugin export aborted: %v", err)
+			return
+		}
+
+		ext, ok := pluginExtensions[plugin.Runtime]
+		if !ok {
+			ext = pluginExtensions[RuntimeJavaScript]
+		}
+		file := plugin.Name + ext
+		if err := exportPluginSource(ctx, zw, bucket, plugin, file); err != nil {
+			if errors.Is(err, gridfs.ErrFileNotFound) {
+				log.Printf("Plugin export skipped %s: no source stored", plugin.Name)
+				continue
+			}
+			log.Printf("Plugin export aborted at %s: %v", plugin.Name, err)
+			return
+		}
+		manifest[file] = pluginManifestEntry{
+			Name:          plugin.Name,
+			Description:   plugin.Description,
+			Runtime:       plugin.Runtime,
+			Tags:          plugin.Tags,
+			Dependencies:  plugin.Dependencies,
+			Secrets:       plugin.Secrets,
+			DefaultParams: plugin.DefaultParams,
+			InputSchema:   plugin.InputSchema,
+			Tests:         plugin.Tests,
+			Version:       plugin.Version,
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Plugin export aborted: %v", err)
+		return
+	}
+
+	w, err := zw.Create(pluginManifestName)
+	if err == nil {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(manifest)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		log.Printf("Plugin export aborted: %v", err)
+	}
+}
+
+// exportPluginSource copies the source of a plugin's current version into
+// the archive as file.
+func exportPluginSource(ctx context.Context, zw *zip.Writer, bucket *gridfs.Bucket, plugin Plugin, file string) error {
+	stored, err := findPluginSource(ctx, bucket, plugin.Name, plugin.Version)
+	if err != nil {
+		return err
+	}
+	stream, err := bucket.OpenDownloadStream(stored.ID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     file,
+		Method:   zip.Deflate,
+		Modified: stored.UploadDate,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, stream)
+	return err
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestExportImportPlugins(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("round trip", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		app.Config.ExportTimeout = app.Config.DBTimeout
+		app.Config.UploadTimeout = app.Config.DBTimeout
+		router := gin.New()
+		router.GET("/plugins/export", app.exportPlugins)
+		router.POST("/plugins/import", app.importPlugins)
+
+		sources := map[string]string{"scale": "input * params.factor", "shift": "input + 1"}
+		want := map[string]pluginManifestEntry{
+			"scale.js": {
+				Name:          "scale",
+				Description:   "multiplies its input",
+				Tags:          []string{"math"},
+				DefaultParams: map[string]interface{}{"factor": float64(2)},
+				Version:       4,
+			},
+			"shift.js": {Name: "shift", Version: 1},
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch,
+			bson.D{
+				{Key: "name", Value: "scale"},
+				{Key: "description", Value: "multiplies its input"},
+				{Key: "version", Value: 4},
+				{Key: "enabled", Value: true},
+				{Key: "tags", Value: bson.A{"math"}},
+				{Key: "default_params", Value: bson.D{{Key: "factor", Value: 2}}},
+			},
+			bson.D{{Key: "name", Value: "shift"}, {Key: "version", Value: 1}, {Key: "enabled", Value: true}},
+		))
+		mt.AddMockResponses(storedFileResponses("scale", sources["scale"], 4)...)
+		mt.AddMockResponses(storedFileResponses("shift", sources["shift"], 1)...)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins/export", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+			mt.Fatalf("export: %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		archive := w.Body.Bytes()
+
+		files, manifest, err := readPluginArchive(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			mt.Fatalf("readPluginArchive: %v", err)
+		}
+		exported := make(map[string]string)
+		for _, file := range files {
+			exported[file.Path] = string(file.Source)
+		}
+		if wantFiles := map[string]string{"scale.js": sources["scale"], "shift.js": sources["shift"]}; !reflect.DeepEqual(exported, wantFiles) {
+			mt.Errorf("files = %v, want %v", exported, wantFiles)
+		}
+		if !reflect.DeepEqual(manifest, want) {
+			mt.Errorf("manifest = %+v, want %+v", manifest, want)
+		}
+
+		// Importing the archive stores every plugin with its metadata again
+		mt.ClearEvents()
+		scale := uploadResponses(bson.D{{Key: "name", Value: "scale"}, {Key: "version", Value: 5}, {Key: "enabled", Value: true}})
+		shift := uploadResponses(bson.D{{Key: "name", Value: "shift"}, {Key: "version", Value: 2}, {Key: "enabled", Value: true}})
+		// The bucket checks for stored files before its first write only
+		mt.AddMockResponses(scale...)
+		mt.AddMockResponses(shift[0], shift[2], shift[3])
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", "plugins.zip")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		part.Write(archive)
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/plugins/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var result struct {
+			Imported int `json:"imported"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK || result.Imported != 2 {
+			mt.Fatalf("import: %d %s", w.Code, w.Body.String())
+		}
+
+		for _, name := range []string{"scale", "shift"} {
+			var stored pluginManifestEntry
+			var chunk []byte
+			for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+				if started.CommandName == "findAndModify" {
+					var update struct {
+						Set bson.M `bson:"$set"`
+					}
+					if err := bson.Unmarshal(started.Command.Lookup("update").Document(), &update); err != nil {
+						mt.Fatal(err)
+					}
+					raw, _ := json.Marshal(normalizeJSON(update.Set))
+					if err := json.Unmarshal(raw, &stored); err != nil {
+						mt.Fatal(err)
+					}
+				}
+				if started.CommandName == "insert" && started.Command.Lookup("insert").StringValue() == "fs.chunks" {
+					_, chunk = started.Command.Lookup("documents", "0", "data").Binary()
+					break
+				}
+			}
+			// The store assigns the version, and uploads fill in the
+			// default runtime
+			entry := want[name+".js"]
+			entry.Version, entry.Runtime = 0, RuntimeJavaScript
+			if !reflect.DeepEqual(stored, entry) {
+				mt.Errorf("imported %s metadata = %+v, want %+v", name, stored, entry)
+			}
+			if string(chunk) != sources[name] {
+				mt.Errorf("imported %s source = %q, want %q", name, chunk, sources[name])
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// pluginImportResult reports what happened to one file of an imported
+// archive.
+type pluginImportResult struct {
+	File     string   `json:"file"`
+	Plugin   string   `json:"plugin,omitempty"`
+	Imported bool     `json:"imported"`
+	Version  int      `json:"version,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// importPlugins uploads every .js and .wasm file of a zip or tar.gz archive
+// as a plugin. Every file is checked as an upload would be before any is stored,
+// and files that fail are reported without stopping the others. Dependencies
+// may name other plugins in the same archive.
+func (app *AppContext) importPlugins(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	archive, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer archive.Close()
+
+	files, manifest, err := readPluginArchive(archive, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]pluginImportResult, len(files))
+	uploads := make([]pluginUpload, len(files))
+	pending := make(map[string]*compiledPlugin)
+	seen := make(map[string]bool)
+	for i, file := range files {
+		entry := manifest[file.Path]
+		uploads[i] = pluginUpload{
+			Name:          strings.TrimSpace(entry.Name),
+			Description:   entry.Description,
+			Runtime:       entry.Runtime,
+			Tests:         entry.Tests,
+			InputSchema:   entry.InputSchema,
+			Tags:          entry.Tags,
+			Dependencies:  entry.Dependencies,
+			Secrets:       entry.Secrets,
+			DefaultParams: entry.DefaultParams,
+		}
+		ext := path.Ext(file.Path)
+		if ext == pluginExtensions[RuntimeWasm] {
+			uploads[i].Wasm = file.Source
+			if uploads[i].Runtime == "" {
+				uploads[i].Runtime = RuntimeWasm
+			}
+		} else {
+			uploads[i].JavaScript = string(file.Source)
+		}
+		if uploads[i].Name == "" {
+			uploads[i].Name = strings.TrimSuffix(path.Base(file.Path), ext)
+		}
+		results[i] = pluginImportResult{File: file.Path, Plugin: uploads[i].Name}
+
+		switch {
+		case file.Err != nil:
+			results[i].Error = file.Err.Error()
+		case seen[uploads[i].Name]:
+			results[i].Error = "another file in the archive has the same plugin name"
+		default:
+			// Registered before any file is checked, so that dependencies
+			// may name files later in the archive
+			program, err := app.compileUpload(&uploads[i])
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			pending[uploads[i].Name] = program
+		}
+		seen[uploads[i].Name] = true
+	}
+
+	// A file failing may break files depending on it, so check until no
+	// more fail
+	programs := make([]*compiledPlugin, len(files))
+	for changed := true; changed; {
+		changed = false
+		for i := range files {
+			if results[i].Error != "" {
+				continue
+			}
+			// Each round compiles the file again, replacing its program
+			key := uploads[i].Name
+			previous := pending[key]
+			program, warnings, err := app.preparePlugin(c.Request.Context(), &uploads[i], pending)
+			delete(pending, key)
+			previous.release()
+			programs[i] = nil
+			if err != nil {
+				results[i].Error = err.Error()
+				changed = true
+				continue
+			}
+			programs[i] = program
+			pending[program.Name] = program
+			results[i].Warnings = warnings
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.UploadTimeout)
+	defer cancel()
+
+	bucket, err := gridfs.NewBucket(app.database(ctx))
+	if err != nil {
+		for _, program := range programs {
+			program.release()
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
+		return
+	}
+
+	imported := 0
+	for i := range files {
+		if results[i].Error != "" {
+			continue
+		}
+		plugin, err := app.storePlugin(ctx, bucket, uploads[i], programs[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Imported = true
+		results[i].Version = plugin.Version
+		imported++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported": imported,
+		"failed":   len(files) - imported,
+		"results":  results,
+	})
+}
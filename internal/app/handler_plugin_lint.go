@@ -0,0 +1,51 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// lintStoredPlugin checks the newest stored source of a plugin: whether it
+// declares a process entrypoint, with how many parameters, and which
+// sandboxed globals it reaches for. Only JavaScript plugins can be linted.
+func (app *AppContext) lintStoredPlugin(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	bucket, err := gridfs.NewBucket(app.database(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
+		return
+	}
+
+	source, err := readPluginSource(c.Request.Context(), bucket, name, 0)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read plugin content"})
+		return
+	}
+
+	if strings.HasPrefix(source, string(wasmMagic)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wasm plugins cannot be linted"})
+		return
+	}
+
+	entry, err := pluginEntrypoint(name, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JavaScript: " + err.Error()})
+		return
+	}
+	warnings, err := lintPlugin(name, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JavaScript: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entrypoint": entry, "warnings": warnings})
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type pluginTestResult struct {
+	Name      string           `json:"name"`
+	Passed    bool             `json:"passed"`
+	Expected  interface{}      `json:"expected"`
+	Actual    interface{}      `json:"actual,omitempty"`
+	Diff      *jsonDiff        `json:"diff,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Exception *scriptException `json:"exception,omitempty"`
+	Logs      []LogEntry       `json:"logs,omitempty"`
+}
+
+// testPlugin runs every stored fixture of a plugin and reports which ones
+// produced their expected output.
+func (app *AppContext) testPlugin(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.ProcessTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("plugins")
+	var plugin Plugin
+	if err := collection.FindOne(ctx, bson.M{"name": name}).Decode(&plugin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+		return
+	}
+	if !plugin.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "plugin " + name + " is disabled"})
+		return
+	}
+
+	script, exists := app.lookupPlugin(ctx, name)
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plugin not loaded"})
+		return
+	}
+
+	results, passed := app.runPluginTests(ctx, script, plugin.Tests)
+	c.JSON(http.StatusOK, gin.H{
+		"plugin":  name,
+		"version": plugin.Version,
+		"passed":  passed,
+		"failed":  len(results) - passed,
+		"results": results,
+	})
+}
+
+// runPluginTests runs each fixture against script and returns the results in
+// order with the number that passed. A fixture whose output differs from the
+// expected one carries the diff from expected to actual.
+func (app *AppContext) runPluginTests(ctx context.Context, script *compiledPlugin, tests []PluginTest) ([]pluginTestResult, int) {
+	results := make([]pluginTestResult, 0, len(tests))
+	passed := 0
+	for i, test := range tests {
+		result := pluginTestResult{Name: test.Name, Expected: normalizeJSON(test.Expected)}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("test_%d", i+1)
+		}
+
+		output, err := app.runScript(ctx, script, scriptCall{Input: test.Input, Params: test.Params})
+		result.Logs = output.Logs
+		if err != nil {
+			result.Error = err.Error()
+			result.Exception = exceptionOf(err)
+		} else {
+			result.Actual = normalizeJSON(output.Value)
+			result.Passed = reflect.DeepEqual(result.Expected, result.Actual)
+			if !result.Passed {
+				diff := diffJSON(result.Expected, result.Actual)
+				result.Diff = &diff
+			}
+		}
+
+		if result.Passed {
+			passed++
+		}
+		results = append(results, result)
+	}
+	return results, passed
+}
+
+// normalizeJSON round-trips v through JSON so that values decoded from BSON,
+// YAML or a goja export compare equal when they describe the same data.
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
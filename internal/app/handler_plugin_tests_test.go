@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunPluginTests(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "scale", `if (params.fail) throw new Error("boom"); ({values: input.map(x => x * params.factor), unit: "m"})`)
+	fixtures := []PluginTest{
+		{Name: "doubles", Input: []interface{}{1, 2}, Params: map[string]interface{}{"factor": 2},
+			Expected: map[string]interface{}{"values": []interface{}{2, 4}, "unit": "m"}},
+		{Input: []interface{}{1, 2}, Params: map[string]interface{}{"factor": 3},
+			Expected: map[string]interface{}{"values": []interface{}{3, 5}, "scale": 3}},
+		{Name: "throws", Params: map[string]interface{}{"fail": true}, Expected: nil},
+	}
+
+	results, passed := app.runPluginTests(context.Background(), plugin, fixtures)
+	if passed != 1 || len(results) != 3 {
+		t.Fatalf("passed %d of %d fixtures, want 1 of 3", passed, len(results))
+	}
+
+	if r := results[0]; !r.Passed || r.Diff != nil || r.Error != "" {
+		t.Errorf("doubles = %+v, want passed without a diff", r)
+	}
+
+	r := results[1]
+	if r.Name != "test_2" || r.Passed {
+		t.Errorf("second fixture = %+v, want test_2 failed", r)
+	}
+	want := jsonDiff{
+		Added:   []jsonValue{{Path: "unit", Value: "m"}},
+		Removed: []jsonValue{{Path: "scale", Value: 3.0}},
+		Changed: []jsonChange{{Path: "values[1]", A: 5.0, B: 6.0}},
+	}
+	if r.Diff == nil || !reflect.DeepEqual(*r.Diff, want) {
+		t.Errorf("diff = %+v, want %+v", r.Diff, want)
+	}
+
+	if r := results[2]; r.Passed || r.Error == "" || r.Diff != nil {
+		t.Errorf("throws = %+v, want an error and no diff", r)
+	}
+}
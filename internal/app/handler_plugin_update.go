@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// updatePlugin changes a plugin's description, tags or enabled flag without
+// uploading its source again, so no new version is created. Fields left out
+// of the body keep their stored value. A disabled plugin is dropped from the
+// cache, so it cannot run until it is enabled again; its source and versions
+// are kept.
+func (app *AppContext) updatePlugin(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	var input struct {
+		Description *string   `json:"description"`
+		Tags        *[]string `json:"tags"`
+		Enabled     *bool     `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields := bson.M{}
+	if input.Description != nil {
+		fields["description"] = *input.Description
+	}
+	if input.Tags != nil {
+		fields["tags"] = normalizeTags(*input.Tags)
+	}
+	if input.Enabled != nil {
+		fields["enabled"] = *input.Enabled
+	}
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update: set description, tags or enabled"})
+		return
+	}
+	fields["updated_at"] = time.Now()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var plugin Plugin
+	collection := app.database(ctx).Collection("plugins")
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"name": name}, bson.M{"$set": fields}, opts).Decode(&plugin); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Enabled != nil {
+		if err := app.reloadPlugin(ctx, name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload plugin: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, plugin)
+}
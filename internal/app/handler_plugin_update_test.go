@@ -0,0 +1,40 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdatePluginRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"empty body", `{}`, http.StatusBadRequest, "nothing to update"},
+		{"unknown fields only", `{"javascript": "input"}`, http.StatusBadRequest, "nothing to update"},
+		{"tags not a list", `{"tags": "raster"}`, http.StatusBadRequest, "cannot unmarshal"},
+		{"enabled not a bool", `{"enabled": "no"}`, http.StatusBadRequest, "cannot unmarshal"},
+		// Valid updates reach the database, which is unreachable here
+		{"description", `{"description": "Scales values"}`, http.StatusInternalServerError, "error"},
+		{"tags", `{"tags": ["raster"]}`, http.StatusInternalServerError, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			router := gin.New()
+			router.PATCH("/plugins/:name", app.updatePlugin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/plugins/scale", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
@@ -3,134 +3,210 @@ package app
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dop251/goja"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func (app *AppContext) uploadPlugin(c *gin.Context) {
-	var input struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
-		JavaScript  string `json:"javascript" binding:"required"`
-	}
-
+	var input pluginUpload
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate JavaScript before storing
-	if _, err := goja.Compile("", input.JavaScript, false); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid JavaScript: " + err.Error(),
-		})
+	program, warnings, err := app.preparePlugin(c.Request.Context(), &input, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.UploadTimeout)
 	defer cancel()
 
 	// Create GridFS bucket
-	bucket, err := gridfs.NewBucket(app.MongoClient.Database(app.Config.DatabaseName))
+	bucket, err := gridfs.NewBucket(app.database(ctx))
 	if err != nil {
+		program.release()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
 		return
 	}
 
-	// Delete existing file if it exists (GridFS allows multiple files with same name)
-	if err := bucket.Delete(strings.TrimSpace(input.Name)); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clean existing plugin"})
+	plugin, err := app.storePlugin(ctx, bucket, input, program)
+	if errors.Is(err, errPluginUploadConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Upload to GridFS
-	uploadStream, err := bucket.OpenUploadStream(strings.TrimSpace(input.Name))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create upload stream"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer uploadStream.Close()
 
-	if _, err := uploadStream.Write([]byte(input.JavaScript)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write plugin content"})
-		return
-	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "plugin uploaded/updated successfully",
+		"version":  plugin.Version,
+		"warnings": warnings,
+	})
+}
 
-	// Store metadata in plugins collection
-	plugin := Plugin{
-		Name:        strings.TrimSpace(input.Name),
-		Description: input.Description,
+func (app *AppContext) listPlugins(c *gin.Context) {
+	pg, err := parsePage(c, []string{"name", "version", "created_at", "updated_at"}, "name")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("plugins")
-	filter := bson.M{"name": plugin.Name}
-	update := bson.M{"$set": plugin}
-	opts := options.Update().SetUpsert(true)
+	filter := pluginFilter(c)
 
-	if _, err := collection.UpdateOne(ctx, filter, update, opts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update plugin metadata"})
-		return
-	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
 
-	// Cache the compiled script
-	program, err := goja.Compile("", input.JavaScript, false)
+	collection := app.database(ctx).Collection("plugins")
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JavaScript after upload: " + err.Error()})
+		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	app.PluginsMux.Lock()
-	app.Plugins[plugin.Name] = program
-	app.PluginsMux.Unlock()
-
-	c.JSON(http.StatusCreated, gin.H{"message": "plugin uploaded/updated successfully"})
-}
-func (app *AppContext) listPlugins(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
-	defer cancel()
-
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("plugins")
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, filter, pg.findOptions())
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var plugins []Plugin
+	plugins := make([]Plugin, 0)
 	if err = cursor.All(ctx, &plugins); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, plugins)
+	c.JSON(200, gin.H{
+		"plugins": plugins,
+		"total":   total,
+		"limit":   pg.Limit,
+		"offset":  pg.Offset,
+	})
+}
+
+// pluginFilter builds the listPlugins query from the name and description
+// query parameters, matched as case-insensitive substrings, and tag. A
+// repeated tag parameter matches plugins carrying all of the tags.
+func pluginFilter(c *gin.Context) bson.M {
+	filter := bson.M{}
+	if name := c.Query("name"); name != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(name), "$options": "i"}
+	}
+	if description := c.Query("description"); description != "" {
+		filter["description"] = bson.M{"$regex": regexp.QuoteMeta(description), "$options": "i"}
+	}
+	if tags := normalizeTags(c.QueryArray("tag")); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+	return filter
+}
+
+// normalizeTags lower-cases and trims tags, dropping empty and duplicate
+// ones, so that filtering is case-insensitive.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// normalizeDependencies trims plugin names, dropping empty and duplicate ones
+// while keeping the order they were listed in.
+func normalizeDependencies(names []string) []string {
+	seen := make(map[string]bool)
+	deps := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		deps = append(deps, name)
+	}
+	return deps
+}
+
+// getPluginMetadata returns a plugin's stored document without its source.
+func (app *AppContext) getPluginMetadata(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("plugins")
+	var plugin Plugin
+	if err := collection.FindOne(ctx, bson.M{"name": name}).Decode(&plugin); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plugin)
 }
 
 func (app *AppContext) getPlugin(c *gin.Context) {
-	name := c.Param("name")
+	name := strings.TrimSpace(c.Param("name"))
+
+	version := 0
+	if raw := c.Query("version"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+			return
+		}
+		version = v
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
 
-	bucket, err := gridfs.NewBucket(app.MongoClient.Database(app.Config.DatabaseName))
+	bucket, err := gridfs.NewBucket(app.database(ctx))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
 		return
 	}
 
-	downloadStream, err := bucket.OpenDownloadStreamByName(strings.TrimSpace(name))
+	file, err := findPluginFile(ctx, bucket, name, version)
 	if err != nil {
-		if err == gridfs.ErrFileNotFound {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up plugin"})
+		return
+	}
+
+	downloadStream, err := bucket.OpenDownloadStream(file.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open download stream"})
 		return
 	}
@@ -142,15 +218,83 @@ func (app *AppContext) getPlugin(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"content": fileBuffer.String()})
+	writePluginSource(c, fileBuffer.Bytes(), fileVersion(file))
+}
+
+// writePluginSource answers getPlugin with a version's source, or with 304
+// Not Modified when the request's If-None-Match lists its ETag.
+func writePluginSource(c *gin.Context, content []byte, version int) {
+	etag := pluginETag(content, version)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// A wasm module is returned base64 encoded, as it is uploaded
+	if bytes.HasPrefix(content, wasmMagic) {
+		c.JSON(http.StatusOK, gin.H{"wasm": content, "version": version})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"content": string(content), "version": version})
 }
+
+// pluginETag identifies the response getPlugin gives for a plugin version's
+// source, so clients polling it can skip unchanged content.
+func pluginETag(content []byte, version int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00", version)
+	h.Write(content)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 asks for that header.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *AppContext) listPluginVersions(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	bucket, err := gridfs.NewBucket(app.database(ctx))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
+		return
+	}
+
+	versions, err := listPluginVersions(ctx, bucket, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"name": name, "versions": versions})
+}
+
+// deletePlugin removes a plugin's metadata and every stored version of its
+// source, so that uploading the name again starts a fresh history at
+// version 1.
 func (app *AppContext) deletePlugin(c *gin.Context) {
-	name := c.Param("name")
+	name := strings.TrimSpace(c.Param("name"))
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
 	defer cancel()
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("plugins")
+	collection := app.database(ctx).Collection("plugins")
 
 	_, err := collection.DeleteOne(ctx, bson.M{"name": name})
 	if err != nil {
@@ -158,40 +302,137 @@ func (app *AppContext) deletePlugin(c *gin.Context) {
 		return
 	}
 
-	app.PluginsMux.Lock()
-	delete(app.Plugins, name)
-	app.PluginsMux.Unlock()
+	bucket, err := gridfs.NewBucket(app.database(ctx))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create GridFS bucket"})
+		return
+	}
+	if err := deletePluginFiles(ctx, bucket, name); err != nil {
+		c.JSON(500, gin.H{"error": "plugin deleted, but not all of its stored versions: " + err.Error()})
+		return
+	}
+
+	app.uncachePlugin(tenantOf(ctx), name)
 
 	c.JSON(200, gin.H{"message": "plugin deleted"})
 }
 
 func (app *AppContext) executePlugin(c *gin.Context) {
-	name := c.Param("name")
+	name := strings.TrimSpace(c.Param("name"))
 
 	var input struct {
-		Data   interface{}            `json:"data"`
-		Params map[string]interface{} `json:"params"`
+		Data    interface{}            `json:"data"`
+		Inputs  map[string]interface{} `json:"inputs"`
+		Blobs   map[string]string      `json:"blobs"`
+		Params  map[string]interface{} `json:"params"`
+		Timeout interface{}            `json:"timeout"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Inputs == nil {
+		input.Inputs = map[string]interface{}{}
+	}
+	// Runs without named inputs or blobs keep hashing and caching on data
+	// alone. Blobs are immutable, so their IDs stand in for their content.
+	audited := input.Data
+	if len(input.Inputs) > 0 || len(input.Blobs) > 0 {
+		parts := map[string]interface{}{"data": input.Data}
+		if len(input.Inputs) > 0 {
+			parts["inputs"] = input.Inputs
+		}
+		if len(input.Blobs) > 0 {
+			parts["blobs"] = input.Blobs
+		}
+		audited = parts
+	}
+
+	timeout, err := durationValue("timeout", input.Timeout)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	app.PluginsMux.RLock()
-	script, exists := app.Plugins[name]
-	app.PluginsMux.RUnlock()
+	script, exists := app.lookupPlugin(c.Request.Context(), name)
 
 	if !exists {
-		c.JSON(404, gin.H{"error": "plugin not found"})
+		app.respondPluginMissing(c, name)
 		return
 	}
 
-	output, err := app.runScript(script, input.Data, input.Params)
-	if err != nil {
+	if violations := script.validateInput(input.Data); len(violations) > 0 {
+		c.JSON(400, gin.H{"error": "input does not match the plugin's input_schema", "violations": violations})
+		return
+	}
+
+	// Results of plugins with secrets, or that fetch, read the clock or draw
+	// unseeded random numbers, are not cached, as they may change between
+	// runs
+	var cacheKey string
+	useCache := app.ResultCache != nil && app.cacheable(script, input.Params)
+	if app.ResultCache != nil && !useCache {
+		c.Header("X-Result-Cache", "bypass")
+	}
+	if useCache {
+		cacheKey, err = app.resultCacheKey(script, audited, input.Params)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if output, ok := app.ResultCache.get(cacheKey); ok {
+			record := executionRecord(script, ExecutionSourceExecute, audited, 0, nil)
+			record.Cached = true
+			app.recordExecution(c.Request.Context(), record)
+			c.Header("X-Result-Cache", "hit")
+			c.JSON(200, gin.H{"result": output.Value, "logs": output.Logs})
+			return
+		}
+	}
+
+	blobs, err := app.loadBlobs(c.Request.Context(), input.Blobs, int64(app.Config.MaxHeapMB)<<20)
+	switch {
+	case errors.Is(err, errBlobNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errBlobsTooLarge):
+		c.JSON(413, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"result": output})
+	start := time.Now()
+	output, err := app.runScript(c.Request.Context(), script, scriptCall{
+		Input:   input.Data,
+		Params:  input.Params,
+		Timeout: timeout,
+		Globals: map[string]interface{}{"inputs": input.Inputs},
+		Blobs:   blobs,
+	})
+	app.recordExecution(c.Request.Context(), executionRecord(script, ExecutionSourceExecute, audited, time.Since(start), err))
+	if err != nil {
+		body := scriptFailure(err)
+		body["logs"] = output.Logs
+		c.JSON(scriptErrorStatus(err), body)
+		return
+	}
+
+	if useCache {
+		app.ResultCache.put(cacheKey, output)
+		c.Header("X-Result-Cache", "miss")
+	}
+	c.JSON(200, gin.H{"result": output.Value, "logs": output.Logs})
+}
+
+func (app *AppContext) reloadPluginsHandler(c *gin.Context) {
+	report, err := app.reloadPlugins(tenantOf(c.Request.Context()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loaded": report.Loaded, "failed": report.Failed})
 }
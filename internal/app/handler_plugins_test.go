@@ -0,0 +1,352 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPluginSourceETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	source := map[int][]byte{1: []byte("input + 1"), 2: []byte("input + 2")}
+	router := gin.New()
+	router.GET("/plugins/:version", func(c *gin.Context) {
+		version := 1
+		if c.Param("version") == "2" {
+			version = 2
+		}
+		writePluginSource(c, source[version], version)
+	})
+	get := func(version, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/plugins/"+version, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request = %d with ETag %q", first.Code, etag)
+	}
+	other := get("2", "").Header().Get("ETag")
+	if other == etag {
+		t.Fatalf("versions 1 and 2 share the ETag %s", etag)
+	}
+
+	tests := []struct {
+		name        string
+		version     string
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{"matching", "1", etag, http.StatusNotModified},
+		{"weak match", "1", "W/" + etag, http.StatusNotModified},
+		{"in a list", "1", `"stale", ` + etag, http.StatusNotModified},
+		{"any", "1", "*", http.StatusNotModified},
+		{"not matching", "1", `"stale"`, http.StatusOK},
+		{"another version's", "1", other, http.StatusOK},
+		{"changed version", "2", etag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.version, tt.ifNoneMatch)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("no ETag in the response")
+			}
+			if tt.wantCode == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with body %q", w.Body)
+			}
+			if tt.wantCode == http.StatusOK && w.Body.Len() == 0 {
+				t.Error("200 without the source")
+			}
+		})
+	}
+}
+
+func TestPluginFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bson.M
+	}{
+		{"", bson.M{}},
+		{"name=Stat", bson.M{"name": bson.M{"$regex": "Stat", "$options": "i"}}},
+		{"description=a.b%2B", bson.M{"description": bson.M{"$regex": `a\.b\+`, "$options": "i"}}},
+		{
+			"name=clean&description=rows",
+			bson.M{
+				"name":        bson.M{"$regex": "clean", "$options": "i"},
+				"description": bson.M{"$regex": "rows", "$options": "i"},
+			},
+		},
+		{"tag=Stats", bson.M{"tags": bson.M{"$all": []string{"stats"}}}},
+		{"tag=stats&tag=%20csv&tag=&tag=CSV", bson.M{"tags": bson.M{"$all": []string{"csv", "stats"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := pluginFilter(queryContext(tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pluginFilter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{" Stats ", "csv", "STATS", "", "  "}, []string{"csv", "stats"}},
+		{[]string{"b", "a"}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := normalizeTags(tt.tags); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestExecutePluginNamedInputs(t *testing.T) {
+	app := newTestApp(t)
+	app.ResultCache = newResultCache(10, time.Minute)
+	addTestPlugin(t, app, "join", `({data: input, names: Object.keys(inputs).sort(), sum: (inputs.a || 0) + (inputs.b || 0)})`)
+	router := gin.New()
+	router.POST("/plugins/:name/execute", app.executePlugin)
+
+	// Requests run in order on one cache, so named inputs must be part of
+	// the cache key
+	tests := []struct {
+		body      string
+		want      map[string]interface{}
+		wantCache string
+	}{
+		{`{"data": 1}`, map[string]interface{}{"data": 1.0, "names": []interface{}{}, "sum": 0.0}, "miss"},
+		{`{"data": 1, "inputs": {"a": 2, "b": 3}}`, map[string]interface{}{"data": 1.0, "names": []interface{}{"a", "b"}, "sum": 5.0}, "miss"},
+		{`{"data": 1, "inputs": {"b": 3, "a": 2}}`, map[string]interface{}{"data": 1.0, "names": []interface{}{"a", "b"}, "sum": 5.0}, "hit"},
+		{`{"data": 1, "inputs": {"a": 4}}`, map[string]interface{}{"data": 1.0, "names": []interface{}{"a"}, "sum": 4.0}, "miss"},
+		{`{"data": 1, "inputs": {}}`, map[string]interface{}{"data": 1.0, "names": []interface{}{}, "sum": 0.0}, "hit"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/join/execute", strings.NewReader(tt.body)))
+		var body struct {
+			Result map[string]interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", tt.body, w.Code, w.Body.String())
+		}
+		if !reflect.DeepEqual(body.Result, tt.want) {
+			t.Errorf("%s: result %v, want %v", tt.body, body.Result, tt.want)
+		}
+		if cache := w.Header().Get("X-Result-Cache"); cache != tt.wantCache {
+			t.Errorf("%s: cache %s, want %s", tt.body, cache, tt.wantCache)
+		}
+	}
+}
+
+func TestGetPluginMetadata(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		response bson.D
+		wantCode int
+		wantBody string
+	}{
+		{
+			"stored plugin",
+			mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch, bson.D{
+				{Key: "name", Value: "scale"},
+				{Key: "description", Value: "doubles its input"},
+				{Key: "version", Value: 3},
+				{Key: "enabled", Value: true},
+				{Key: "tags", Value: bson.A{"math"}},
+				{Key: "created_at", Value: created},
+				{Key: "updated_at", Value: updated},
+			}),
+			http.StatusOK,
+			"",
+		},
+		{
+			"unknown plugin",
+			mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch),
+			http.StatusNotFound,
+			"plugin not found",
+		},
+		{
+			"database error",
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"}),
+			http.StatusInternalServerError,
+			"bad value",
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(tt.response)
+			router := gin.New()
+			router.GET("/plugins/:name/metadata", app.getPluginMetadata)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins/scale/metadata", nil))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				mt.Fatalf("response %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var plugin Plugin
+			if err := json.Unmarshal(w.Body.Bytes(), &plugin); err != nil {
+				mt.Fatal(err)
+			}
+			if plugin.Version != 3 || plugin.Description != "doubles its input" || !reflect.DeepEqual(plugin.Tags, []string{"math"}) {
+				mt.Errorf("metadata = %+v, want the stored version, description and tags", plugin)
+			}
+			if !plugin.CreatedAt.Equal(created) || !plugin.UpdatedAt.Equal(updated) {
+				mt.Errorf("timestamps %v, %v, want %v, %v", plugin.CreatedAt, plugin.UpdatedAt, created, updated)
+			}
+		})
+	}
+}
+
+func TestListPluginsSort(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		query    string
+		wantSort bson.D
+		wantErr  string
+	}{
+		{"default", "", bson.D{{Key: "name", Value: int32(1)}}, ""},
+		{"name", "sort=name", bson.D{{Key: "name", Value: int32(1)}}, ""},
+		{"name descending", "sort=-name", bson.D{{Key: "name", Value: int32(-1)}}, ""},
+		{"created_at", "sort=created_at", bson.D{{Key: "created_at", Value: int32(1)}}, ""},
+		{"updated_at descending", "sort=-updated_at", bson.D{{Key: "updated_at", Value: int32(-1)}}, ""},
+		{"unsortable field", "sort=description", nil, "sort must be one of"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch),
+			)
+			router := gin.New()
+			router.GET("/plugins", app.listPlugins)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plugins?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+					mt.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantErr)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				mt.Fatalf("response %d %s", w.Code, w.Body.String())
+			}
+
+			mt.GetStartedEvent() // the count
+			find := mt.GetStartedEvent()
+			if find == nil || find.CommandName != "find" {
+				mt.Fatalf("started %v, want find", find)
+			}
+			var sort bson.D
+			if err := bson.Unmarshal(find.Command.Lookup("sort").Document(), &sort); err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(sort, tt.wantSort) {
+				mt.Errorf("sort = %v, want %v", sort, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestPluginHandlersTrimName(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		handler func(app *AppContext) gin.HandlerFunc
+		body    string
+	}{
+		{"execute", "/plugins/:name/execute", func(app *AppContext) gin.HandlerFunc { return app.executePlugin }, `{"data": 1}`},
+		{"execute-batch", "/plugins/:name/execute-batch", func(app *AppContext) gin.HandlerFunc { return app.executePluginBatch }, `{"inputs": [1]}`},
+		{"benchmark", "/plugins/:name/benchmark", func(app *AppContext) gin.HandlerFunc { return app.benchmarkPlugin }, `{"data": 1, "iterations": 1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			addTestPlugin(t, app, "scale", "input * 2")
+			router := gin.New()
+			router.POST(tt.route, tt.handler(app))
+
+			path := strings.Replace(tt.route, ":name", "%20scale%20", 1)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(tt.body)))
+			if w.Code != http.StatusOK {
+				t.Errorf("response %d %s, want the padded name to find scale", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeletePluginTrimsName(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("padded name", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		addTestPlugin(mt.T, app, "scale", "input * 2")
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch),
+		)
+		router := gin.New()
+		router.DELETE("/plugins/:name", app.deletePlugin)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/plugins/%20scale%20", nil))
+		if w.Code != http.StatusOK {
+			mt.Fatalf("response %d %s", w.Code, w.Body.String())
+		}
+		for _, want := range []struct{ command, key, field string }{
+			{"delete", "deletes", "name"},
+			{"find", "", "filename"},
+		} {
+			started := mt.GetStartedEvent()
+			if started == nil || started.CommandName != want.command {
+				mt.Fatalf("started %v, want %s", started, want.command)
+			}
+			filter := started.Command.Lookup("filter")
+			if want.key != "" {
+				filter = started.Command.Lookup(want.key, "0", "q")
+			}
+			if got := filter.Document().Lookup(want.field).StringValue(); got != "scale" {
+				mt.Errorf("%s of %q, want the trimmed name", want.command, got)
+			}
+		}
+		if _, ok := app.Plugins[""]["scale"]; ok {
+			mt.Error("scale is still cached")
+		}
+	})
+}
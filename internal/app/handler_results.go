@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// exportResultsCSV writes the tabular part of a job's results as CSV. With
+// several steps in the results, ?step= picks the one to export; otherwise the
+// only array-of-objects result is used.
+func (app *AppContext) exportResultsCSV(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+	var job DataJob
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job); err != nil {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+	if err := decodeJobResults(&job); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := tabularResults(normalizeJSON(job.Results), c.Query("step"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	columns := csvColumns(rows)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%s-results.csv"`, objID.Hex()))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvValue(row[column])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+}
+
+// tabularResults picks an array of objects out of a job's results.
+func tabularResults(results interface{}, step string) ([]map[string]interface{}, error) {
+	if byStep, ok := results.(map[string]interface{}); ok {
+		if step != "" {
+			result, ok := byStep[step]
+			if !ok {
+				return nil, fmt.Errorf("job has no results for step %s", step)
+			}
+			return asRows(result)
+		}
+
+		var found []map[string]interface{}
+		matches := 0
+		for _, result := range byStep {
+			if rows, err := asRows(result); err == nil {
+				found = rows
+				matches++
+			}
+		}
+		switch matches {
+		case 0:
+			return nil, fmt.Errorf("results are not an array of objects")
+		case 1:
+			return found, nil
+		default:
+			return nil, fmt.Errorf("several steps have tabular results; choose one with ?step=")
+		}
+	}
+	return asRows(results)
+}
+
+func asRows(v interface{}) ([]map[string]interface{}, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("results are not an array of objects")
+	}
+	rows := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("results are not an array of objects")
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// csvColumns returns the union of all row keys in sorted order.
+func csvColumns(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTabularResults(t *testing.T) {
+	rows := []interface{}{map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": "x"}}
+	want := []map[string]interface{}{{"a": 1.0}, {"b": "x"}}
+	tests := []struct {
+		name    string
+		results interface{}
+		step    string
+		want    []map[string]interface{}
+		wantErr string
+	}{
+		{"array of objects", rows, "", want, ""},
+		{"only tabular step", map[string]interface{}{"count": 2.0, "rows": rows}, "", want, ""},
+		{"chosen step", map[string]interface{}{"rows": rows, "more": rows}, "rows", want, ""},
+		{"several tabular steps", map[string]interface{}{"rows": rows, "more": rows}, "", nil, "choose one with ?step="},
+		{"unknown step", map[string]interface{}{"rows": rows}, "other", nil, "no results for step other"},
+		{"chosen step not tabular", map[string]interface{}{"count": 2.0}, "count", nil, "not an array of objects"},
+		{"no tabular step", map[string]interface{}{"count": 2.0}, "", nil, "not an array of objects"},
+		{"array of numbers", []interface{}{1.0, 2.0}, "", nil, "not an array of objects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tabularResults(tt.results, tt.step)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tabularResults: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tabularResults = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVColumnsAndValues(t *testing.T) {
+	rows := []map[string]interface{}{{"b": 1.0, "a": nil}, {"c": true, "a": "x"}}
+	if got, want := csvColumns(rows), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("csvColumns = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"text", "text"},
+		{2.0, "2"},
+		{0.1, "0.1"},
+		{1e21, "1000000000000000000000"},
+		{false, "false"},
+		{[]interface{}{1.0, "a"}, `[1,"a"]`},
+		{map[string]interface{}{"k": 1.0}, `{"k":1}`},
+	}
+	for _, tt := range tests {
+		if got := csvValue(tt.value); got != tt.want {
+			t.Errorf("csvValue(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
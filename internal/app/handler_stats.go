@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// getStats summarizes the server for dashboards: jobs by status, the number
+// of plugins, how long plugin runs take on average according to the audit
+// records, which plugins timed out in this process, and how long it has been
+// up. Stored counts are computed by MongoDB; no documents are loaded.
+func (app *AppContext) getStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	db := app.database(ctx)
+
+	byStatus, totalJobs, err := jobStatusCounts(ctx, db.Collection("data_jobs"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	plugins, err := db.Collection("plugins").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	runs, avgMS, err := executionDurations(ctx, db.Collection(executionsCollection))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": gin.H{
+			"total":     totalJobs,
+			"by_status": byStatus,
+		},
+		"plugins": plugins,
+		"executions": gin.H{
+			"total":           runs,
+			"avg_duration_ms": avgMS,
+		},
+		"timeouts":       app.timeoutStats(tenantOf(ctx)),
+		"started_at":     app.StartedAt,
+		"uptime_seconds": int64(time.Since(app.StartedAt).Seconds()),
+	})
+}
+
+// jobStatusCounts counts jobs grouped by status.
+func jobStatusCounts(ctx context.Context, collection *mongo.Collection) (map[string]int64, int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, 0, err
+	}
+
+	counts := make(map[string]int64, len(groups))
+	var total int64
+	for _, g := range groups {
+		counts[g.Status] = g.Count
+		total += g.Count
+	}
+	return counts, total, nil
+}
+
+// executionDurations counts the audited plugin runs and averages their
+// duration. Results served from the result cache took no time to run and
+// are left out.
+func executionDurations(ctx context.Context, collection *mongo.Collection) (int64, float64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"cached": bson.M{"$ne": true}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"count": bson.M{"$sum": 1},
+			"avg":   bson.M{"$avg": "$duration_ms"},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, 0, err
+	}
+	var totals []struct {
+		Count int64   `bson:"count"`
+		Avg   float64 `bson:"avg"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, 0, err
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil
+	}
+	return totals[0].Count, totals[0].Avg, nil
+}
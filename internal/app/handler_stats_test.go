@@ -0,0 +1,123 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetStats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		wantCode  int
+		want      string
+	}{
+		{
+			"seeded data",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "datasciencehub_test.data_jobs", mtest.FirstBatch,
+					bson.D{{Key: "_id", Value: JobStatusProcessed}, {Key: "count", Value: 5}},
+					bson.D{{Key: "_id", Value: JobStatusFailed}, {Key: "count", Value: 2}},
+					bson.D{{Key: "_id", Value: JobStatusUploaded}, {Key: "count", Value: 1}},
+				),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch, bson.D{{Key: "n", Value: 3}}),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.executions", mtest.FirstBatch,
+					bson.D{{Key: "_id", Value: nil}, {Key: "count", Value: 4}, {Key: "avg", Value: 12.5}},
+				),
+			},
+			http.StatusOK,
+			`{"jobs": {"total": 8, "by_status": {"processed": 5, "failed": 2, "uploaded": 1}},
+				"plugins": 3, "executions": {"total": 4, "avg_duration_ms": 12.5}, "timeouts": [],
+				"uptime_seconds": 90}`,
+		},
+		{
+			"empty database",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "datasciencehub_test.data_jobs", mtest.FirstBatch),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.executions", mtest.FirstBatch),
+			},
+			http.StatusOK,
+			`{"jobs": {"total": 0, "by_status": {}}, "plugins": 0,
+				"executions": {"total": 0, "avg_duration_ms": 0}, "timeouts": [], "uptime_seconds": 90}`,
+		},
+		{
+			"database error",
+			[]bson.D{mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"})},
+			http.StatusInternalServerError,
+			`{"error": "bad value"}`,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			app.StartedAt = time.Now().Add(-90 * time.Second)
+			mt.AddMockResponses(tt.responses...)
+			router := gin.New()
+			router.GET("/stats", app.getStats)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+			if w.Code != tt.wantCode {
+				mt.Fatalf("response %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			var got, want map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				mt.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				mt.Fatal(err)
+			}
+			if started, ok := got["started_at"].(string); ok {
+				if parsed, err := time.Parse(time.RFC3339Nano, started); err != nil || !parsed.Equal(app.StartedAt) {
+					mt.Errorf("started_at = %q, want %v", started, app.StartedAt)
+				}
+				delete(got, "started_at")
+			} else if tt.wantCode == http.StatusOK {
+				mt.Error("no started_at")
+			}
+			if !reflect.DeepEqual(got, want) {
+				mt.Errorf("body = %s, want %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStatsAggregates(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("counts in the database", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "datasciencehub_test.data_jobs", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "datasciencehub_test.executions", mtest.FirstBatch),
+		)
+		router := gin.New()
+		router.GET("/stats", app.getStats)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		// Every count is an aggregation, so no documents are loaded
+		for _, collection := range []string{"data_jobs", "plugins", "executions"} {
+			started := mt.GetStartedEvent()
+			if started == nil || started.CommandName != "aggregate" || started.Command.Lookup("aggregate").StringValue() != collection {
+				mt.Fatalf("started %v, want an aggregate of %s", started, collection)
+			}
+		}
+		if started := mt.GetStartedEvent(); started != nil {
+			mt.Errorf("started %s after the aggregations", started.CommandName)
+		}
+	})
+}
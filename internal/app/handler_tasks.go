@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listTasks returns the task definitions stored by /data/process/yaml. Every
+// submission is kept, so a task run several times appears once per run.
+func (app *AppContext) listTasks(c *gin.Context) {
+	pg, err := parsePage(c, []string{"name", "created_at"}, "-created_at")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := bson.M{}
+	if name := c.Query("name"); name != "" {
+		filter["name"] = name
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("tasks")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := collection.Find(ctx, filter, pg.findOptions())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tasks := make([]TaskDefinition, 0)
+	if err = cursor.All(ctx, &tasks); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"tasks":  tasks,
+		"total":  total,
+		"limit":  pg.Limit,
+		"offset": pg.Offset,
+	})
+}
+
+// getTask returns the most recently stored definition of the named task.
+func (app *AppContext) getTask(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	task, err := app.findTask(ctx, c.Param("name"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(404, gin.H{"error": "task not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, task)
+}
+
+// findTask loads the newest stored task with the given name. Tasks stored
+// before created_at was recorded are ordered by their ID instead.
+func (app *AppContext) findTask(ctx context.Context, name string) (TaskDefinition, error) {
+	var task TaskDefinition
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	collection := app.database(ctx).Collection("tasks")
+	if err := collection.FindOne(ctx, bson.M{"name": name}, opts).Decode(&task); err != nil {
+		return task, err
+	}
+	task.normalize()
+	return task, nil
+}
+
+// normalize converts the nested step options and vars of a task decoded from
+// BSON documents and arrays back to the plain maps and slices a parsed YAML
+// task holds.
+func (task *TaskDefinition) normalize() {
+	for i, step := range task.Steps {
+		if plain, ok := normalizeJSON(step).(map[string]interface{}); ok {
+			task.Steps[i] = plain
+		}
+	}
+	if plain, ok := normalizeJSON(task.Vars).(map[string]interface{}); ok {
+		task.Vars = plain
+	}
+}
+
+// runStoredTask runs the latest stored definition of a task again. The
+// optional job_id in the body replaces the first step's input job.
+func (app *AppContext) runStoredTask(c *gin.Context) {
+	var request struct {
+		JobID string `json:"job_id"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	task, err := app.findTask(ctx, c.Param("name"))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(404, gin.H{"error": "task not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.JobID != "" {
+		if len(task.Steps) == 0 {
+			c.JSON(400, gin.H{"error": "task has no steps"})
+			return
+		}
+		task = task.withInputJob(request.JobID)
+	}
+
+	run, ok := app.executeTask(c, task)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Task processed successfully",
+		"job_id":  run.JobID,
+		"status":  run.Status,
+		"results": run.Results,
+	})
+}
+
+// withInputJob returns a copy of the task whose first step reads its input
+// from the given job. The stored definition is left unchanged.
+func (task TaskDefinition) withInputJob(jobID string) TaskDefinition {
+	steps := slices.Clone(task.Steps)
+	first := maps.Clone(steps[0])
+	input, _ := first["input"].(map[string]interface{})
+	input = maps.Clone(input)
+	if input == nil {
+		input = make(map[string]interface{})
+	}
+	input["job_id"] = jobID
+	first["input"] = input
+	steps[0] = first
+
+	task.Steps = steps
+	return task
+}
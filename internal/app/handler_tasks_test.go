@@ -0,0 +1,348 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// storedTask is a task document as /data/process/yaml stores it.
+func storedTask(jobID string) bson.D {
+	return bson.D{
+		{Key: "name", Value: "pipeline"},
+		{Key: "description", Value: "doubles a job"},
+		{Key: "vars", Value: bson.D{{Key: "factor", Value: 2}}},
+		{Key: "steps", Value: bson.A{
+			bson.D{
+				{Key: "plugin", Value: "double"},
+				{Key: "params", Value: bson.D{{Key: "keep", Value: bson.A{"a", "b"}}}},
+				{Key: "input", Value: bson.D{{Key: "job_id", Value: jobID}}},
+			},
+		}},
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		response bson.D
+		wantCode int
+		wantBody string
+	}{
+		{
+			"stored task",
+			mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, storedTask("65f000000000000000000001")),
+			http.StatusOK,
+			`{"id": "000000000000000000000000", "name": "pipeline", "description": "doubles a job",
+				"vars": {"factor": 2}, "steps": [{"plugin": "double", "params": {"keep": ["a", "b"]}, "input": {"job_id": "65f000000000000000000001"}}],
+				"parallel": false, "on_error": "", "created_at": "0001-01-01T00:00:00Z"}`,
+		},
+		{
+			"unknown task",
+			mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch),
+			http.StatusNotFound,
+			`{"error": "task not found"}`,
+		},
+		{
+			"database error",
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"}),
+			http.StatusInternalServerError,
+			`{"error": "bad value"}`,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(tt.response)
+			router := gin.New()
+			router.GET("/tasks/:name", app.getTask)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/pipeline", nil))
+			if w.Code != tt.wantCode {
+				mt.Fatalf("response %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				mt.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.wantBody), &want); err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				mt.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+
+			started := mt.GetStartedEvent()
+			if started == nil || started.CommandName != "find" {
+				mt.Fatalf("started %v, want find", started)
+			}
+			var sort bson.D
+			if err := bson.Unmarshal(started.Command.Lookup("sort").Document(), &sort); err != nil {
+				mt.Fatal(err)
+			}
+			wantSort := bson.D{{Key: "created_at", Value: int32(-1)}, {Key: "_id", Value: int32(-1)}}
+			if !reflect.DeepEqual(sort, wantSort) {
+				mt.Errorf("sort = %v, want the newest definition first", sort)
+			}
+		})
+	}
+}
+
+func TestFindTaskNormalizes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("nested documents", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, storedTask("65f000000000000000000001")))
+
+		task, err := app.findTask(context.Background(), "pipeline")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		// The engine reads step options as the maps a parsed YAML task
+		// holds, not the documents BSON decodes them to
+		wantSteps := []map[string]interface{}{
+			{
+				"plugin": "double",
+				"params": map[string]interface{}{"keep": []interface{}{"a", "b"}},
+				"input":  map[string]interface{}{"job_id": "65f000000000000000000001"},
+			},
+		}
+		if !reflect.DeepEqual(task.Steps, wantSteps) {
+			mt.Errorf("steps = %#v, want %#v", task.Steps, wantSteps)
+		}
+		if wantVars := map[string]interface{}{"factor": float64(2)}; !reflect.DeepEqual(task.Vars, wantVars) {
+			mt.Errorf("vars = %#v, want %#v", task.Vars, wantVars)
+		}
+	})
+}
+
+func TestListTasks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter bson.M
+		wantSort   bson.D
+		wantErr    string
+	}{
+		{"default", "", bson.M{}, bson.D{{Key: "created_at", Value: int32(-1)}}, ""},
+		{"by name", "name=pipeline&sort=name", bson.M{"name": "pipeline"}, bson.D{{Key: "name", Value: int32(1)}}, ""},
+		{"unsortable field", "sort=steps", nil, nil, "sort must be one of"},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, storedTask("65f000000000000000000001")),
+			)
+			router := gin.New()
+			router.GET("/tasks", app.listTasks)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+					mt.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantErr)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				mt.Fatalf("response %d %s", w.Code, w.Body.String())
+			}
+			var body struct {
+				Tasks []TaskDefinition `json:"tasks"`
+				Total int64            `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				mt.Fatal(err)
+			}
+			if body.Total != 1 || len(body.Tasks) != 1 || body.Tasks[0].Name != "pipeline" {
+				mt.Errorf("body = %s, want the stored task and a total of 1", w.Body.String())
+			}
+
+			mt.GetStartedEvent() // the count
+			find := mt.GetStartedEvent()
+			if find == nil || find.CommandName != "find" {
+				mt.Fatalf("started %v, want find", find)
+			}
+			var filter bson.M
+			if err := bson.Unmarshal(find.Command.Lookup("filter").Document(), &filter); err != nil {
+				mt.Fatal(err)
+			}
+			var sort bson.D
+			if err := bson.Unmarshal(find.Command.Lookup("sort").Document(), &sort); err != nil {
+				mt.Fatal(err)
+			}
+			if !reflect.DeepEqual(filter, tt.wantFilter) || !reflect.DeepEqual(sort, tt.wantSort) {
+				mt.Errorf("filter %v, sort %v, want %v, %v", filter, sort, tt.wantFilter, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestRunStoredTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("twice with different inputs", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		addTestPlugin(mt.T, app, "double", "input * 2")
+		router := gin.New()
+		router.POST("/tasks/:name/run", app.runStoredTask)
+
+		stored := "65f000000000000000000001"
+		runs := []struct {
+			jobID string
+			input int
+			want  float64
+		}{
+			{"65f000000000000000000002", 5, 10},
+			{"65f000000000000000000003", 7, 14},
+		}
+		for _, run := range runs {
+			jobID, _ := primitive.ObjectIDFromHex(run.jobID)
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, storedTask(stored)),
+				mtest.CreateCursorResponse(0, "datasciencehub_test.data_jobs", mtest.FirstBatch, bson.D{
+					{Key: "_id", Value: jobID},
+					{Key: "input_data", Value: run.input},
+				}),
+				// the step's execution record, then the new job
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			)
+
+			w := httptest.NewRecorder()
+			body := strings.NewReader(`{"job_id": "` + run.jobID + `"}`)
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tasks/pipeline/run", body))
+			if w.Code != http.StatusOK {
+				mt.Fatalf("run with %s: %d %s", run.jobID, w.Code, w.Body.String())
+			}
+			var response struct {
+				JobID   string                 `json:"job_id"`
+				Results map[string]interface{} `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				mt.Fatal(err)
+			}
+			if response.JobID == "" || response.Results["step_0"] != run.want {
+				mt.Errorf("run with %s: %s, want a new job and step_0 = %v", run.jobID, w.Body.String(), run.want)
+			}
+
+			mt.GetStartedEvent() // the task
+			find := mt.GetStartedEvent()
+			if find == nil || find.CommandName != "find" {
+				mt.Fatalf("started %v, want the input job's find", find)
+			}
+			if got := find.Command.Lookup("filter", "_id").ObjectID(); got != jobID {
+				mt.Errorf("input read from job %s, want %s in place of the stored %s", got.Hex(), run.jobID, stored)
+			}
+			mt.ClearEvents()
+		}
+	})
+}
+
+func TestRunStoredTaskRejects(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		body     string
+		response bson.D
+		wantCode int
+		wantErr  string
+	}{
+		{"malformed body", `{"job_id": 1}`, nil, http.StatusBadRequest, "job_id"},
+		{"unknown task", "", mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch), http.StatusNotFound, "task not found"},
+		{
+			"job_id for a task without steps",
+			`{"job_id": "65f000000000000000000002"}`,
+			mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, bson.D{{Key: "name", Value: "pipeline"}}),
+			http.StatusBadRequest,
+			"task has no steps",
+		},
+		{
+			"invalid job_id",
+			`{"job_id": "not-an-id"}`,
+			mtest.CreateCursorResponse(0, "datasciencehub_test.tasks", mtest.FirstBatch, storedTask("65f000000000000000000001")),
+			http.StatusBadRequest,
+			"invalid job ID",
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			if tt.response != nil {
+				mt.AddMockResponses(tt.response)
+			}
+			router := gin.New()
+			router.POST("/tasks/:name/run", app.runStoredTask)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tasks/pipeline/run", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantErr) {
+				mt.Errorf("response %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithInputJob(t *testing.T) {
+	tests := []struct {
+		name  string
+		first map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{
+			"replaces the job",
+			map[string]interface{}{"plugin": "double", "input": map[string]interface{}{"job_id": "old"}},
+			map[string]interface{}{"plugin": "double", "input": map[string]interface{}{"job_id": "new"}},
+		},
+		{
+			"keeps other input options",
+			map[string]interface{}{"plugin": "double", "input": map[string]interface{}{"job_id": "old", "path": "values"}},
+			map[string]interface{}{"plugin": "double", "input": map[string]interface{}{"job_id": "new", "path": "values"}},
+		},
+		{
+			"adds an input",
+			map[string]interface{}{"plugin": "double"},
+			map[string]interface{}{"plugin": "double", "input": map[string]interface{}{"job_id": "new"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := TaskDefinition{Steps: []map[string]interface{}{tt.first, {"plugin": "inc"}}}
+			before := normalizeJSON(stored.Steps)
+
+			task := stored.withInputJob("new")
+			if !reflect.DeepEqual(task.Steps[0], tt.want) {
+				t.Errorf("first step = %v, want %v", task.Steps[0], tt.want)
+			}
+			if !reflect.DeepEqual(task.Steps[1], stored.Steps[1]) {
+				t.Errorf("second step = %v, want it unchanged", task.Steps[1])
+			}
+			if after := normalizeJSON(stored.Steps); !reflect.DeepEqual(after, before) {
+				t.Errorf("stored steps = %v, want them unchanged", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newTestApp returns an app with the default limits and script runtimes.
+// Its MongoDB client points at a closed port, so the writes that only
+// record what happened, such as audit records, fail fast and are logged.
+func newTestApp(t testing.TB) *AppContext {
+	t.Helper()
+	app := NewAppContext()
+	app.Config = ServerConfig{
+		DatabaseName:   "datasciencehub_test",
+		JSTimeout:      5 * time.Second,
+		MaxJSTimeout:   60 * time.Second,
+		MaxParallel:    2,
+		QueueTimeout:   time.Second,
+		MaxInlineBytes: 8 << 20,
+		MaxOutputBytes: 16 << 20,
+		DBTimeout:      time.Second,
+	}
+	app.ExecSlots = make(chan struct{}, app.Config.MaxParallel)
+
+	opts := options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50 * time.Millisecond)
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.MongoClient = client
+
+	app.initVMFactory()
+	t.Cleanup(func() {
+		app.Close()
+		client.Disconnect(context.Background())
+	})
+	return app
+}
+
+// addTestPlugin compiles a JavaScript plugin into the default tenant's
+// cache.
+func addTestPlugin(t testing.TB, app *AppContext, name, source string) *compiledPlugin {
+	t.Helper()
+	plugin, err := compilePlugin(name, source)
+	if err != nil {
+		t.Fatalf("compile %s: %v", name, err)
+	}
+	app.cachePlugin(plugin)
+	return plugin
+}
+
+// newStalledClient returns a MongoDB client whose server accepts
+// connections and never answers, so every operation blocks until its
+// context is done.
+func newStalledClient(t testing.TB) *mongo.Client {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	opts := options.Client().
+		ApplyURI("mongodb://" + listener.Addr().String() + "/?directConnection=true").
+		SetServerSelectionTimeout(time.Minute)
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		client.Disconnect(context.Background())
+	})
+	return client
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const idempotencyKeysCollection = "idempotency_keys"
+
+// idempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key header. Response is empty while the request is running.
+type idempotencyRecord struct {
+	Scope     string    `bson:"scope"`
+	Key       string    `bson:"key"`
+	Status    int       `bson:"status"`
+	Response  bson.M    `bson:"response,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// idempotencyClaim is held by the request that first used a key.
+type idempotencyClaim struct {
+	// db is the database of the caller's tenant, where the key was claimed.
+	db    *mongo.Database
+	scope string
+	key   string
+	done  bool
+	// timeout bounds storing and releasing the claim, as db_timeout does
+	// for requests.
+	timeout time.Duration
+}
+
+// idempotencyScope keeps keys from different endpoints and API keys apart.
+func idempotencyScope(c *gin.Context) string {
+	scope := c.Request.Method + " " + c.FullPath()
+	if apiKey, ok := c.Get("api_key"); ok {
+		sum := sha256.Sum256([]byte(apiKey.(APIKey).Key))
+		scope += " " + hex.EncodeToString(sum[:8])
+	}
+	return scope
+}
+
+// claimIdempotencyKey reserves the request's Idempotency-Key. It returns a
+// nil claim when the header is absent. When the key was used before, the
+// stored response (or 409 while the first request is still running) has
+// already been written and handled is true.
+func (app *AppContext) claimIdempotencyKey(c *gin.Context) (claim *idempotencyClaim, handled bool) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	now := time.Now()
+	record := idempotencyRecord{
+		Scope:     idempotencyScope(c),
+		Key:       key,
+		CreatedAt: now,
+		ExpiresAt: now.Add(app.Config.IdempotencyTTL),
+	}
+
+	collection := app.database(ctx).Collection(idempotencyKeysCollection)
+	_, err := collection.InsertOne(ctx, record)
+	if err == nil {
+		return &idempotencyClaim{db: app.database(ctx), scope: record.Scope, key: key, timeout: app.Config.DBTimeout}, false
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, true
+	}
+
+	var existing idempotencyRecord
+	err = collection.FindOne(ctx, bson.M{"scope": record.Scope, "key": key}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key just failed; retry"})
+		return nil, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, true
+	}
+	replayIdempotencyRecord(c, existing)
+	return nil, true
+}
+
+// replayIdempotencyRecord answers a request reusing a key with the response
+// stored for it, or 409 while the first request is still running.
+func replayIdempotencyRecord(c *gin.Context, existing idempotencyRecord) {
+	if existing.Status == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.JSON(existing.Status, existing.Response)
+}
+
+// respond writes the response and stores it for later requests with the same
+// key. It is a plain c.JSON for a nil claim.
+func (claim *idempotencyClaim) respond(c *gin.Context, status int, response gin.H) {
+	if claim != nil {
+		claim.done = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), claim.timeout)
+		defer cancel()
+
+		collection := claim.db.Collection(idempotencyKeysCollection)
+		update := bson.M{"$set": bson.M{"status": status, "response": response}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"scope": claim.scope, "key": claim.key}, update); err != nil {
+			log.Printf("Error storing response for idempotency key %s: %v", claim.key, err)
+		}
+	}
+	c.JSON(status, response)
+}
+
+// release frees the key again unless a response was stored, so that a
+// request which failed can be retried with the same key. Call it deferred.
+func (claim *idempotencyClaim) release() {
+	if claim == nil || claim.done {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), claim.timeout)
+	defer cancel()
+
+	collection := claim.db.Collection(idempotencyKeysCollection)
+	if _, err := collection.DeleteOne(ctx, bson.M{"scope": claim.scope, "key": claim.key}); err != nil {
+		log.Printf("Error releasing idempotency key %s: %v", claim.key, err)
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIdempotencyScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scopeOf := func(method, path, apiKey string) string {
+		var scope string
+		router := gin.New()
+		handler := func(c *gin.Context) {
+			if apiKey != "" {
+				c.Set("api_key", APIKey{Key: apiKey})
+			}
+			scope = idempotencyScope(c)
+		}
+		router.POST("/data/jobs/:id/process", handler)
+		router.PUT("/data/jobs/:id/process", handler)
+		router.POST("/tasks", handler)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		return scope
+	}
+
+	base := scopeOf(http.MethodPost, "/data/jobs/1/process", "secret-key")
+	if strings.Contains(base, "secret-key") {
+		t.Errorf("scope %q holds the API key", base)
+	}
+	tests := []struct {
+		name              string
+		method, path, key string
+		same              bool
+	}{
+		{"same route, other job", http.MethodPost, "/data/jobs/2/process", "secret-key", true},
+		{"other method", http.MethodPut, "/data/jobs/1/process", "secret-key", false},
+		{"other route", http.MethodPost, "/tasks", "secret-key", false},
+		{"other API key", http.MethodPost, "/data/jobs/1/process", "other-key", false},
+		{"no API key", http.MethodPost, "/data/jobs/1/process", "", false},
+	}
+	for _, tt := range tests {
+		if got := scopeOf(tt.method, tt.path, tt.key); (got == base) != tt.same {
+			t.Errorf("%s: scope %q, base %q, want same = %v", tt.name, got, base, tt.same)
+		}
+	}
+}
+
+func TestReplayIdempotencyRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		record       idempotencyRecord
+		wantStatus   int
+		wantBody     string
+		wantReplayed bool
+	}{
+		{"in progress", idempotencyRecord{Key: "k"}, http.StatusConflict, "still in progress", false},
+		{"stored", idempotencyRecord{Key: "k", Status: http.StatusAccepted, Response: bson.M{"job_id": "abc"}}, http.StatusAccepted, `{"job_id":"abc"}`, true},
+		{"stored failure", idempotencyRecord{Key: "k", Status: http.StatusBadRequest, Response: bson.M{"error": "bad"}}, http.StatusBadRequest, `{"error":"bad"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			replayIdempotencyRecord(c, tt.record)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("Idempotent-Replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+		})
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := newTestApp(t)
+
+	tests := []struct {
+		name        string
+		key         string
+		wantHandled bool
+		wantClaim   bool
+		wantStatus  int
+	}{
+		// Without a key the request runs as usual and respond is a plain
+		// c.JSON
+		{"no key", "", false, false, http.StatusCreated},
+		// A key that cannot be claimed fails the request before it runs
+		{"database down", "retry-1", true, false, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claim *idempotencyClaim
+			var handled bool
+			router := gin.New()
+			router.POST("/tasks", func(c *gin.Context) {
+				claim, handled = app.claimIdempotencyKey(c)
+				if handled {
+					return
+				}
+				defer claim.release()
+				claim.respond(c, http.StatusCreated, gin.H{"ok": true})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/tasks", nil)
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if handled != tt.wantHandled || (claim != nil) != tt.wantClaim {
+				t.Errorf("claim = %v, handled = %v", claim, handled)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Header().Get("Idempotent-Replayed") != "" {
+				t.Error("response marked as replayed")
+			}
+		})
+	}
+}
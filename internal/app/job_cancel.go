@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// registerJob returns the context an async job runs under and remembers how
+// to cancel it. The job keeps the values of parent, such as its tenant, but
+// outlives its cancellation.
+func (app *AppContext) registerJob(parent context.Context, jobID primitive.ObjectID) context.Context {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+
+	app.JobCancelsMux.Lock()
+	app.JobCancels[jobID] = cancel
+	app.JobCancelsMux.Unlock()
+
+	return ctx
+}
+
+func (app *AppContext) unregisterJob(jobID primitive.ObjectID) {
+	app.JobCancelsMux.Lock()
+	cancel, ok := app.JobCancels[jobID]
+	delete(app.JobCancels, jobID)
+	app.JobCancelsMux.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// cancelJob stops a job that is being processed. The running plugin is
+// interrupted and the job is marked cancelled; results gathered so far are
+// kept. A job stuck in processing after a restart is marked cancelled too.
+func (app *AppContext) cancelJob(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+
+	now := time.Now()
+	fields := bson.M{"status": JobStatusCancelled, "updated_at": now}
+	if expiresAt := app.jobExpiry(now); expiresAt != nil {
+		fields["expires_at"] = *expiresAt
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": objID, "status": JobStatusProcessing}, bson.M{"$set": fields})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		var job DataJob
+		err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "job is " + job.Status + ", not processing", "status": job.Status})
+		return
+	}
+
+	app.JobCancelsMux.Lock()
+	if cancelRun, ok := app.JobCancels[objID]; ok {
+		cancelRun()
+	}
+	app.JobCancelsMux.Unlock()
+
+	app.publishJobEvent(objID, statusEvent(JobStatusCancelled))
+	app.notifyJob(ctx, objID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "job cancelled", "job_id": objID, "status": JobStatusCancelled})
+}
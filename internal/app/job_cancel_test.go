@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRegisterJob(t *testing.T) {
+	app := NewAppContext()
+	jobID := primitive.NewObjectID()
+
+	parent, cancelParent := context.WithCancel(withTenant(context.Background(), "acme"))
+	ctx := app.registerJob(parent, jobID)
+
+	// The job outlives the request that started it
+	cancelParent()
+	if ctx.Err() != nil {
+		t.Fatal("job cancelled with the request that started it")
+	}
+	if tenantOf(ctx) != "acme" {
+		t.Errorf("job tenant %q, want the request's", tenantOf(ctx))
+	}
+
+	app.unregisterJob(jobID)
+	if ctx.Err() == nil {
+		t.Error("job context still live after unregisterJob")
+	}
+	if len(app.JobCancels) != 0 {
+		t.Errorf("%d jobs still registered", len(app.JobCancels))
+	}
+}
+
+func TestCancelledJobInterruptsPlugin(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "spin", "while (true) {}")
+	addTestPlugin(t, app, "inc", "input + 1")
+	jobID := primitive.NewObjectID()
+	ctx := app.registerJob(context.Background(), jobID)
+	defer app.unregisterJob(jobID)
+
+	time.AfterFunc(50*time.Millisecond, func() {
+		app.JobCancelsMux.Lock()
+		app.JobCancels[jobID]()
+		app.JobCancelsMux.Unlock()
+	})
+
+	start := time.Now()
+	results, failed := app.runPluginChain(ctx, jobID, 1, []pluginCall{{Name: "spin"}, {Name: "inc"}})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("chain stopped %s after the cancellation", elapsed)
+	}
+	if !failed {
+		t.Error("cancelled chain reported success")
+	}
+	if _, ran := results["inc"]; ran {
+		t.Error("plugin after the interrupted one still ran")
+	}
+}
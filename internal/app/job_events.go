@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// jobEventBuffer is how many events a slow subscriber may fall behind before
+// further events are dropped for it.
+const jobEventBuffer = 32
+
+// JobEvent is a progress notification for a job: either a status change or
+// the completion of one plugin step.
+type JobEvent struct {
+	Type   string `json:"type"`
+	Status string `json:"status,omitempty"`
+	Step   string `json:"step,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func statusEvent(status string) JobEvent {
+	return JobEvent{Type: "status", Status: status}
+}
+
+func stepEvent(step string, err error) JobEvent {
+	event := JobEvent{Type: "step", Step: step}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
+
+func jobFinished(status string) bool {
+	return status == JobStatusProcessed || status == JobStatusFailed || status == JobStatusCancelled
+}
+
+// subscribeJob registers a channel that receives the job's events until the
+// returned function is called.
+func (app *AppContext) subscribeJob(jobID primitive.ObjectID) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, jobEventBuffer)
+
+	app.JobEventsMux.Lock()
+	if app.JobEvents[jobID] == nil {
+		app.JobEvents[jobID] = make(map[chan JobEvent]struct{})
+	}
+	app.JobEvents[jobID][ch] = struct{}{}
+	app.JobEventsMux.Unlock()
+
+	return ch, func() {
+		app.JobEventsMux.Lock()
+		delete(app.JobEvents[jobID], ch)
+		if len(app.JobEvents[jobID]) == 0 {
+			delete(app.JobEvents, jobID)
+		}
+		app.JobEventsMux.Unlock()
+	}
+}
+
+// publishJobEvent delivers an event to the job's subscribers without
+// blocking; subscribers with a full buffer miss the event.
+func (app *AppContext) publishJobEvent(jobID primitive.ObjectID, event JobEvent) {
+	app.JobEventsMux.Lock()
+	defer app.JobEventsMux.Unlock()
+
+	for ch := range app.JobEvents[jobID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// streamJobEvents sends a job's events as Server-Sent Events. The stream
+// starts with the current status and ends once the job has finished or the
+// client disconnects.
+func (app *AppContext) streamJobEvents(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	// Subscribe before reading the status so no change is missed in between.
+	events, unsubscribe := app.subscribeJob(objID)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+	var job DataJob
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&job); err != nil {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	c.SSEvent("status", statusEvent(job.Status))
+	c.Writer.Flush()
+	if jobFinished(job.Status) {
+		return
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			c.SSEvent(event.Type, event)
+			c.Writer.Flush()
+			if event.Type == "status" && jobFinished(event.Status) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestJobEvents(t *testing.T) {
+	app := NewAppContext()
+	job, other := primitive.NewObjectID(), primitive.NewObjectID()
+
+	first, unsubscribeFirst := app.subscribeJob(job)
+	second, unsubscribeSecond := app.subscribeJob(job)
+	defer unsubscribeSecond()
+
+	app.publishJobEvent(job, statusEvent(JobStatusProcessing))
+	app.publishJobEvent(other, statusEvent(JobStatusFailed))
+	app.publishJobEvent(job, stepEvent("clean", errors.New("boom")))
+
+	want := []JobEvent{
+		{Type: "status", Status: JobStatusProcessing},
+		{Type: "step", Step: "clean", Error: "boom"},
+	}
+	for name, events := range map[string]<-chan JobEvent{"first": first, "second": second} {
+		for _, w := range want {
+			if got := <-events; got != w {
+				t.Errorf("%s subscriber got %+v, want %+v", name, got, w)
+			}
+		}
+		if len(events) != 0 {
+			t.Errorf("%s subscriber got another job's event", name)
+		}
+	}
+
+	unsubscribeFirst()
+	app.publishJobEvent(job, stepEvent("sum", nil))
+	if len(first) != 0 {
+		t.Error("unsubscribed channel still receives events")
+	}
+	if got := <-second; got != (JobEvent{Type: "step", Step: "sum"}) {
+		t.Errorf("second subscriber got %+v", got)
+	}
+
+	unsubscribeSecond()
+	if len(app.JobEvents) != 0 {
+		t.Errorf("%d jobs still have subscribers", len(app.JobEvents))
+	}
+}
+
+func TestJobEventsSlowSubscriber(t *testing.T) {
+	app := NewAppContext()
+	job := primitive.NewObjectID()
+	events, unsubscribe := app.subscribeJob(job)
+	defer unsubscribe()
+
+	// Publishing never blocks on a subscriber that stopped reading
+	for i := 0; i < jobEventBuffer+10; i++ {
+		app.publishJobEvent(job, stepEvent("step", nil))
+	}
+	if len(events) != jobEventBuffer {
+		t.Errorf("%d events buffered, want %d", len(events), jobEventBuffer)
+	}
+}
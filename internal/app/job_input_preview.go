@@ -0,0 +1,145 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultPreviewLimit is how many records of an array input
+	// previewJobInput shows without ?limit=.
+	defaultPreviewLimit = 10
+	// previewBytes is how much of the JSON of an input that is not an array
+	// previewJobInput shows.
+	previewBytes = 4096
+)
+
+// previewJobInput shows the start of a job's input without sending all of
+// it: the first ?limit= records of an array, or the first previewBytes of
+// the JSON of anything else. Input stored in GridFS is only read as far as
+// the preview needs.
+func (app *AppContext) previewJobInput(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	limit := defaultPreviewLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			c.JSON(400, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(limit, maxPageLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+	opts := options.FindOne().SetProjection(bson.M{"input_data": 1, "input_ref": 1})
+	var job DataJob
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&job); err != nil {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+
+	var input io.Reader
+	if job.InputRef != nil {
+		bucket, err := app.jobInputs(ctx)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to open input bucket"})
+			return
+		}
+		stream, err := bucket.OpenDownloadStream(*job.InputRef)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("failed to load input data %s: %v", job.InputRef.Hex(), err)})
+			return
+		}
+		defer stream.Close()
+		input = stream
+	} else {
+		raw, err := json.Marshal(normalizeJSON(job.InputData))
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		input = bytes.NewReader(raw)
+	}
+
+	items, preview, truncated, err := previewJSON(input, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to read input data: %v", err)})
+		return
+	}
+	if items != nil {
+		c.JSON(200, gin.H{"job_id": objID, "limit": limit, "items": items, "truncated": truncated})
+		return
+	}
+	c.JSON(200, gin.H{"job_id": objID, "preview": preview, "truncated": truncated})
+}
+
+// previewJSON reads the start of the JSON value in r. For an array it
+// returns up to limit of its elements, otherwise up to previewBytes of its
+// text; truncated reports whether anything was left out.
+func previewJSON(r io.Reader, limit int) (items []interface{}, preview string, truncated bool, err error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, "", false, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			br.UnreadByte()
+			break
+		}
+	}
+
+	if first, _ := br.Peek(1); first[0] != '[' {
+		buf := make([]byte, previewBytes+1)
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, "", false, err
+		}
+		if n <= previewBytes {
+			return nil, strings.TrimRight(string(buf[:n]), " \t\r\n"), false, nil
+		}
+		// Cut before the rune the limit falls in.
+		n = previewBytes
+		for n > 0 && !utf8.RuneStart(buf[n]) {
+			n--
+		}
+		return nil, string(buf[:n]), true, nil
+	}
+
+	dec := json.NewDecoder(br)
+	if _, err := dec.Token(); err != nil {
+		return nil, "", false, err
+	}
+	items = make([]interface{}, 0, min(limit, defaultPreviewLimit))
+	for dec.More() {
+		if len(items) == limit {
+			return items, "", true, nil
+		}
+		var item interface{}
+		if err := dec.Decode(&item); err != nil {
+			return nil, "", false, err
+		}
+		items = append(items, item)
+	}
+	return items, "", false, nil
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPreviewJSON(t *testing.T) {
+	long := `"` + strings.Repeat("a", 5000) + `"`
+	// é straddles the previewBytes cut, so the preview ends before it
+	straddling := `"` + strings.Repeat("a", previewBytes-2) + "é" + strings.Repeat("b", 10) + `"`
+
+	tests := []struct {
+		name          string
+		input         string
+		limit         int
+		wantItems     []interface{}
+		wantPreview   string
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{"array under the limit", "[1, 2]", 10, []interface{}{1.0, 2.0}, "", false, false},
+		{"array at the limit", "[1, 2, 3]", 3, []interface{}{1.0, 2.0, 3.0}, "", false, false},
+		{"array over the limit", `[{"a": 1}, 2, 3]`, 2, []interface{}{map[string]interface{}{"a": 1.0}, 2.0}, "", true, false},
+		{"empty array", " \n[]", 10, []interface{}{}, "", false, false},
+		{"object", "\n {\"a\": 1} \n", 10, nil, `{"a": 1}`, false, false},
+		{"long value", long, 10, nil, long[:previewBytes], true, false},
+		{"cut inside a rune", straddling, 10, nil, straddling[:previewBytes-1], true, false},
+		{"malformed array", "[1, ", 10, nil, "", false, true},
+		{"empty", "  ", 10, nil, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, preview, truncated, err := previewJSON(strings.NewReader(tt.input), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(items, tt.wantItems) {
+				t.Errorf("items = %v, want %v", items, tt.wantItems)
+			}
+			if preview != tt.wantPreview {
+				t.Errorf("preview = %.40q (%d bytes), want %.40q (%d bytes)", preview, len(preview), tt.wantPreview, len(tt.wantPreview))
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestPreviewJobInputRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{"invalid job ID", "/data/jobs/abc/input", "invalid job ID"},
+		{"limit not a number", "/data/jobs/65f000000000000000000000/input?limit=all", "limit must be a positive integer"},
+		{"zero limit", "/data/jobs/65f000000000000000000000/input?limit=0", "limit must be a positive integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			router := gin.New()
+			router.GET("/data/jobs/:id/input", app.previewJobInput)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// inputSweepInterval is how often sweepJobInputs runs.
+	inputSweepInterval = 10 * time.Minute
+	// inputSweepGrace spares input files younger than this: uploads store
+	// the input before inserting the job that references it.
+	inputSweepGrace = time.Hour
+	// inputSweepBatch is how many files are checked against data_jobs at a
+	// time.
+	inputSweepBatch = 500
+)
+
+// startInputSweep removes job inputs stored in GridFS once their job is
+// gone, as it is when the TTL monitor expires it, until Close is called.
+func (app *AppContext) startInputSweep() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(inputSweepInterval)
+		defer ticker.Stop()
+		for {
+			for _, tenant := range app.Config.tenants() {
+				tenantCtx := withTenant(ctx, tenant)
+				removed, err := app.sweepJobInputs(tenantCtx, time.Now().Add(-inputSweepGrace))
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Job input sweep%s failed: %v", tenantSuffix(tenant), err)
+				}
+				if removed > 0 {
+					log.Printf("Job input sweep%s removed %d orphaned inputs", tenantSuffix(tenant), removed)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	app.stopInputSweep = func() {
+		cancel()
+		<-done
+	}
+}
+
+// sweepJobInputs deletes the input files of ctx's tenant uploaded before
+// cutoff that no job references any more, and returns how many it deleted.
+func (app *AppContext) sweepJobInputs(ctx context.Context, cutoff time.Time) (int, error) {
+	bucket, err := app.jobInputs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := options.GridFSFind().SetSort(bson.M{"uploadDate": 1})
+	cursor, err := bucket.FindContext(ctx, bson.M{"uploadDate": bson.M{"$lt": cutoff}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	removed := 0
+	batch := make([]interface{}, 0, inputSweepBatch)
+	flush := func() error {
+		n, err := app.deleteOrphanedInputs(ctx, bucket, batch)
+		removed += n
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var file gridfs.File
+		if err := cursor.Decode(&file); err != nil {
+			return removed, err
+		}
+		batch = append(batch, file.ID)
+		if len(batch) == inputSweepBatch {
+			if err := flush(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return removed, err
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// deleteOrphanedInputs deletes the input files among ids that no job
+// references.
+func (app *AppContext) deleteOrphanedInputs(ctx context.Context, bucket *gridfs.Bucket, ids []interface{}) (int, error) {
+	referenced, err := app.database(ctx).Collection("data_jobs").Distinct(ctx, "input_ref", bson.M{"input_ref": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	inUse := make(map[interface{}]bool, len(referenced))
+	for _, id := range referenced {
+		inUse[id] = true
+	}
+
+	removed := 0
+	for _, id := range ids {
+		if inUse[id] {
+			continue
+		}
+		if err := bucket.DeleteContext(ctx, id); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSweepJobInputs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	referenced, orphaned := primitive.NewObjectID(), primitive.NewObjectID()
+	inputFile := func(id primitive.ObjectID) bson.D {
+		return bson.D{
+			{Key: "_id", Value: id},
+			{Key: "length", Value: 10},
+			{Key: "chunkSize", Value: 255 * 1024},
+			{Key: "uploadDate", Value: time.Now().Add(-2 * inputSweepGrace)},
+			{Key: "filename", Value: "input.json"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		responses   []bson.D
+		wantChecked []primitive.ObjectID
+		wantDeleted []primitive.ObjectID
+	}{
+		{
+			"referenced input kept",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, inputFile(referenced), inputFile(orphaned)),
+				mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{referenced}}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			},
+			[]primitive.ObjectID{referenced, orphaned},
+			[]primitive.ObjectID{orphaned},
+		},
+		{
+			"every input referenced",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, inputFile(referenced)),
+				mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{referenced}}),
+			},
+			[]primitive.ObjectID{referenced},
+			nil,
+		},
+		{
+			"no inputs past the grace period",
+			[]bson.D{mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch)},
+			nil,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			mt.AddMockResponses(tt.responses...)
+
+			cutoff := time.Now().Add(-inputSweepGrace)
+			removed, err := app.sweepJobInputs(context.Background(), cutoff)
+			if err != nil {
+				mt.Fatalf("sweepJobInputs: %v", err)
+			}
+			if removed != len(tt.wantDeleted) {
+				mt.Errorf("removed = %d, want %d", removed, len(tt.wantDeleted))
+			}
+
+			// Inputs younger than the cutoff are never looked at
+			find := mt.GetStartedEvent()
+			if find == nil || find.CommandName != "find" {
+				mt.Fatalf("started %v, want the find of old inputs", find)
+			}
+			if before := find.Command.Lookup("filter", "uploadDate", "$lt").Time(); !before.Equal(cutoff.Truncate(time.Millisecond)) {
+				mt.Errorf("uploadDate before %s, want the cutoff %s", before, cutoff)
+			}
+
+			var checked, deleted []primitive.ObjectID
+			for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+				switch {
+				case started.CommandName == "distinct":
+					values, err := started.Command.Lookup("query", "input_ref", "$in").Array().Values()
+					if err != nil {
+						mt.Fatal(err)
+					}
+					for _, value := range values {
+						checked = append(checked, value.ObjectID())
+					}
+				case started.CommandName == "delete" && started.Command.Lookup("delete").StringValue() == "job_inputs.files":
+					deleted = append(deleted, started.Command.Lookup("deletes", "0", "q", "_id").ObjectID())
+				}
+			}
+			if !reflect.DeepEqual(checked, tt.wantChecked) {
+				mt.Errorf("checked %v against data_jobs, want %v", checked, tt.wantChecked)
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				mt.Errorf("deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job inputs live in their own bucket so they never collide with plugin
+// sources, which use the default "fs" bucket.
+const jobInputsBucket = "job_inputs"
+
+func (app *AppContext) jobInputs(ctx context.Context) (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(
+		app.database(ctx),
+		options.GridFSBucket().SetName(jobInputsBucket),
+	)
+}
+
+// setJobInput attaches raw JSON input to job. Payloads larger than
+// MaxInlineBytes are written to GridFS and only referenced from the job.
+func (app *AppContext) setJobInput(ctx context.Context, job *DataJob, raw []byte, parsed interface{}) error {
+	if app.Config.MaxInlineBytes <= 0 || int64(len(raw)) <= app.Config.MaxInlineBytes {
+		job.InputData = parsed
+		return nil
+	}
+
+	bucket, err := app.jobInputs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open input bucket: %w", err)
+	}
+
+	id, err := bucket.UploadFromStream(job.Name+".json", bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("failed to store input data: %w", err)
+	}
+
+	job.InputData = nil
+	job.InputRef = &id
+	return nil
+}
+
+// streamJobInput writes JSON read from r straight to GridFS, checking that it
+// holds exactly one JSON value as it goes. Only the chunk being written and
+// the token being checked are held in memory.
+func (app *AppContext) streamJobInput(ctx context.Context, filename string, r io.Reader) (primitive.ObjectID, error) {
+	bucket, err := app.jobInputs(ctx)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to open input bucket: %w", err)
+	}
+
+	// The validator reads everything the upload reads. Closing the pipe with
+	// its error makes the upload fail on its next read.
+	pr, pw := io.Pipe()
+	checked := make(chan error, 1)
+	go func() {
+		err := checkJSONStream(pr)
+		pr.CloseWithError(err)
+		checked <- err
+	}()
+
+	id, err := bucket.UploadFromStream(filename, io.TeeReader(r, pw))
+	if err != nil {
+		pw.CloseWithError(errInputUploadFailed)
+	} else {
+		pw.Close()
+	}
+
+	switch checkErr := <-checked; {
+	case checkErr != nil && !errors.Is(checkErr, errInputUploadFailed):
+		if err == nil {
+			bucket.Delete(id)
+		}
+		return primitive.NilObjectID, fmt.Errorf("%w: %w", errInvalidJSONInput, checkErr)
+	case err != nil:
+		return primitive.NilObjectID, fmt.Errorf("failed to store input data: %w", err)
+	}
+	return id, nil
+}
+
+var (
+	errInvalidJSONInput  = errors.New("input data is not valid JSON")
+	errInputUploadFailed = errors.New("input upload failed")
+)
+
+// checkJSONStream reads r to the end, failing unless it holds exactly one
+// JSON value.
+func checkJSONStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	depth, values := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if depth == 0 && values == 1 {
+			return fmt.Errorf("unexpected data after the first JSON value")
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			values++
+		}
+	}
+	if depth != 0 {
+		return io.ErrUnexpectedEOF
+	}
+	if values == 0 {
+		return fmt.Errorf("no JSON value")
+	}
+	return nil
+}
+
+// resolveJobInput loads input data stored in GridFS back into job.InputData.
+// Jobs with inline input are left untouched.
+func (app *AppContext) resolveJobInput(ctx context.Context, job *DataJob) error {
+	if job.InputRef == nil {
+		return nil
+	}
+
+	bucket, err := app.jobInputs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open input bucket: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStream(*job.InputRef, &buf); err != nil {
+		return fmt.Errorf("failed to load input data %s: %w", job.InputRef.Hex(), err)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		return fmt.Errorf("stored input data %s is not valid JSON: %w", job.InputRef.Hex(), err)
+	}
+	job.InputData = data
+	return nil
+}
+
+// deleteJobInput removes GridFS input referenced by a job, if any.
+func (app *AppContext) deleteJobInput(ctx context.Context, ref *primitive.ObjectID) error {
+	if ref == nil {
+		return nil
+	}
+	bucket, err := app.jobInputs(ctx)
+	if err != nil {
+		return err
+	}
+	return bucket.Delete(*ref)
+}
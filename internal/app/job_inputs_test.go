@@ -0,0 +1,251 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSetJobInput(t *testing.T) {
+	raw := []byte(`{"values":[1,2,3]}`)
+	parsed := map[string]interface{}{"values": []interface{}{1.0, 2.0, 3.0}}
+	tests := []struct {
+		name      string
+		maxInline int64
+		wantErr   string
+	}{
+		{"under the limit", int64(len(raw)) + 1, ""},
+		{"at the limit", int64(len(raw)), ""},
+		{"no limit", 0, ""},
+		// Larger input goes to GridFS, which the test app cannot reach
+		{"over the limit", int64(len(raw)) - 1, "failed to store input data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.Config.MaxInlineBytes = tt.maxInline
+			job := DataJob{Name: "job"}
+			err := app.setJobInput(context.Background(), &job, raw, parsed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				if job.InputData != nil || job.InputRef != nil {
+					t.Errorf("job input = %v, ref %v, want neither set", job.InputData, job.InputRef)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setJobInput: %v", err)
+			}
+			if !reflect.DeepEqual(job.InputData, parsed) || job.InputRef != nil {
+				t.Errorf("job input = %v, ref %v, want it inline", job.InputData, job.InputRef)
+			}
+		})
+	}
+}
+
+func TestResolveJobInputInline(t *testing.T) {
+	app := newTestApp(t)
+	job := DataJob{InputData: []interface{}{1.0}}
+	if err := app.resolveJobInput(context.Background(), &job); err != nil {
+		t.Fatalf("resolveJobInput: %v", err)
+	}
+	if !reflect.DeepEqual(job.InputData, []interface{}{1.0}) {
+		t.Errorf("input = %v, want it untouched", job.InputData)
+	}
+}
+
+func TestCheckJSONStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"object", `{"rows": [1, {"a": [2]}]}`, false},
+		{"array with whitespace", " [1, 2, 3]\n", false},
+		{"scalar", "42", false},
+		{"empty", "", true},
+		{"truncated", `{"rows": [1, 2`, true},
+		{"two values", `{"a": 1} {"b": 2}`, true},
+		{"trailing garbage", `[1] x`, true},
+		{"malformed", `{"a": }`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJSONStream(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkJSONStream = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// largeJobInput returns a JSON object over the 16MB document limit, so it
+// can only be kept in GridFS.
+func largeJobInput() (raw []byte, parsed map[string]interface{}) {
+	text := strings.Repeat("0123456789abcdef", (17<<20)/16)
+	raw, _ = json.Marshal(map[string]interface{}{"text": text})
+	return raw, map[string]interface{}{"text": text}
+}
+
+// storedInputResponses answers a download of raw stored as file id in the
+// job input bucket: the file document, then its chunks over two batches.
+func storedInputResponses(id primitive.ObjectID, raw []byte) []bson.D {
+	file := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "filename", Value: "job.json"},
+		{Key: "length", Value: int64(len(raw))},
+		{Key: "chunkSize", Value: gridfs.DefaultChunkSize},
+		{Key: "uploadDate", Value: time.Now()},
+	}
+	var chunks []bson.D
+	for n := 0; n*int(gridfs.DefaultChunkSize) < len(raw); n++ {
+		data := raw[n*int(gridfs.DefaultChunkSize):]
+		if len(data) > int(gridfs.DefaultChunkSize) {
+			data = data[:gridfs.DefaultChunkSize]
+		}
+		chunks = append(chunks, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "files_id", Value: id},
+			{Key: "n", Value: int32(n)},
+			{Key: "data", Value: primitive.Binary{Data: data}},
+		})
+	}
+	half := len(chunks) / 2
+	return []bson.D{
+		mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, file),
+		mtest.CreateCursorResponse(1, "datasciencehub_test.job_inputs.chunks", mtest.FirstBatch, chunks[:half]...),
+		mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.chunks", mtest.NextBatch, chunks[half:]...),
+	}
+}
+
+func TestJobInputRoundTrip(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("larger than a document", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		raw, parsed := largeJobInput()
+
+		// The bucket finds a stored file, so it creates no indexes. The
+		// stream writes a batch of chunks for every 16MiB it buffers, then
+		// the rest and the file document.
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "datasciencehub_test.job_inputs.files", mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		job := DataJob{Name: "job"}
+		if err := app.setJobInput(context.Background(), &job, raw, parsed); err != nil {
+			mt.Fatalf("setJobInput: %v", err)
+		}
+		if job.InputRef == nil || job.InputData != nil {
+			mt.Fatalf("job input = %T, ref %v, want only a reference", job.InputData, job.InputRef)
+		}
+
+		var stored []byte
+		for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+			if started.CommandName != "insert" || started.Command.Lookup("insert").StringValue() != "job_inputs.chunks" {
+				continue
+			}
+			docs, err := started.Command.Lookup("documents").Array().Values()
+			if err != nil {
+				mt.Fatal(err)
+			}
+			for _, doc := range docs {
+				if files, ok := doc.Document().Lookup("files_id").ObjectIDOK(); !ok || files != *job.InputRef {
+					mt.Fatalf("chunk of %v, want %s", doc.Document().Lookup("files_id"), job.InputRef.Hex())
+				}
+				_, data := doc.Document().Lookup("data").Binary()
+				stored = append(stored, data...)
+			}
+		}
+		if !bytes.Equal(stored, raw) {
+			mt.Fatalf("stored %d bytes, want the %d byte input", len(stored), len(raw))
+		}
+
+		mt.AddMockResponses(storedInputResponses(*job.InputRef, stored)...)
+		if err := app.resolveJobInput(context.Background(), &job); err != nil {
+			mt.Fatalf("resolveJobInput: %v", err)
+		}
+		if !reflect.DeepEqual(job.InputData, map[string]interface{}(parsed)) {
+			mt.Error("resolved input differs from the stored input")
+		}
+	})
+}
+
+func TestHandlersResolveInputRef(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	raw, _ := largeJobInput()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		after  []bson.D
+		want   string
+	}{
+		{
+			"get job",
+			http.MethodGet, "/data/65f000000000000000000000", "",
+			nil,
+			`"InputData":{"text":"0123456789abcdef`,
+		},
+		{
+			"dry run",
+			http.MethodPost, "/data/process?dry_run=true", `{"job_id": "65f000000000000000000000", "plugins": [{"name": "size"}]}`,
+			// The plugin's audit record
+			[]bson.D{mtest.CreateSuccessResponse()},
+			fmt.Sprintf(`"results":{"size":%d}`, len(raw)-len(`{"text":""}`)),
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			// Reading the input back takes a while under the race detector
+			app.Config.DBTimeout = time.Minute
+			app.Config.ProcessTimeout = app.Config.DBTimeout
+			addTestPlugin(mt.T, app, "size", "input.text.length")
+			jobID, _ := primitive.ObjectIDFromHex("65f000000000000000000000")
+			ref := primitive.NewObjectID()
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.data_jobs", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: jobID},
+				{Key: "name", Value: "job"},
+				{Key: "input_ref", Value: ref},
+				{Key: "status", Value: JobStatusUploaded},
+			}))
+			mt.AddMockResponses(storedInputResponses(ref, raw)...)
+			mt.AddMockResponses(tt.after...)
+			router := gin.New()
+			router.GET("/data/:id", app.getJob)
+			router.POST("/data/process", app.processData)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+				body := w.Body.String()
+				if len(body) > 200 {
+					body = body[:200]
+				}
+				mt.Errorf("response %d %s, want 200 with %s", w.Code, body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	maxJobLabels     = 20
+	maxLabelValueLen = 256
+)
+
+// labelKeyPattern keeps label keys usable as MongoDB field names under
+// labels.
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// checkLabels validates the labels attached to a job.
+func checkLabels(labels map[string]string) error {
+	if len(labels) > maxJobLabels {
+		return fmt.Errorf("a job may have at most %d labels, got %d", maxJobLabels, len(labels))
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("label key %q may only contain letters, digits, _ and -, up to 64 of them", key)
+		}
+		if len(value) > maxLabelValueLen {
+			return fmt.Errorf("label %s is longer than %d bytes", key, maxLabelValueLen)
+		}
+	}
+	return nil
+}
+
+// splitLabel splits a key:value label parameter. The value may itself
+// contain colons; without one, ok is false and key is the whole parameter.
+func splitLabel(param string) (key, value string, ok bool) {
+	key, value, ok = strings.Cut(param, ":")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+// queryLabels reads the labels of an upload from repeated label=key:value
+// query parameters.
+func queryLabels(c *gin.Context) (map[string]string, error) {
+	params := c.QueryArray("label")
+	if len(params) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(params))
+	for _, param := range params {
+		key, value, ok := splitLabel(param)
+		if !ok {
+			return nil, fmt.Errorf("label %q must be given as key:value", param)
+		}
+		labels[key] = value
+	}
+	if err := checkLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// addLabelFilter restricts filter to the jobs carrying every label query
+// parameter: key:value matches the value, a bare key any value.
+func addLabelFilter(c *gin.Context, filter bson.M) error {
+	for _, param := range c.QueryArray("label") {
+		key, value, ok := splitLabel(param)
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("label key %q may only contain letters, digits, _ and -", key)
+		}
+		if ok {
+			filter["labels."+key] = value
+		} else {
+			filter["labels."+key] = bson.M{"$exists": true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestQueryLabels(t *testing.T) {
+	tooMany := make([]string, maxJobLabels+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("label=k%d:v", i)
+	}
+
+	tests := []struct {
+		query   string
+		want    map[string]string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{"label=experiment:42", map[string]string{"experiment": "42"}, ""},
+		{"label=+experiment+:+42+&label=source:s3://bucket/a", map[string]string{"experiment": "42", "source": "s3://bucket/a"}, ""},
+		{"label=empty:", map[string]string{"empty": ""}, ""},
+		{"label=experiment", nil, "must be given as key:value"},
+		{"label=a.b:1", nil, `label key "a.b"`},
+		{"label=k:" + strings.Repeat("v", maxLabelValueLen+1), nil, "longer than 256 bytes"},
+		{strings.Join(tooMany, "&"), nil, "at most 20 labels"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%.40s", tt.query), func(t *testing.T) {
+			got, err := queryLabels(queryContext(tt.query))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queryLabels: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryLabels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListJobsByLabel(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("label value", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		ns := "datasciencehub_test.data_jobs"
+		job := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: "run"},
+			{Key: "status", Value: "completed"},
+			{Key: "labels", Value: bson.D{{Key: "experiment", Value: "42"}}},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, job),
+		)
+		router := gin.New()
+		router.GET("/data/jobs", app.listJobs)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/jobs?label=experiment:42", nil))
+		var body struct {
+			Jobs  []DataJob `json:"jobs"`
+			Total int64     `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			mt.Fatalf("response %d %s", w.Code, w.Body.String())
+		}
+		if body.Total != 1 || len(body.Jobs) != 1 || body.Jobs[0].Labels["experiment"] != "42" {
+			mt.Errorf("jobs = %+v, total %d, want the labeled job", body.Jobs, body.Total)
+		}
+
+		// Both the count and the page are restricted to the label value
+		for _, command := range []string{"aggregate", "find"} {
+			event := mt.GetStartedEvent()
+			if event == nil || event.CommandName != command {
+				mt.Fatalf("started %v, want %s", event, command)
+			}
+			filter := event.Command.Lookup("filter")
+			if command == "aggregate" {
+				filter = event.Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match")
+			}
+			if value, err := filter.Document().LookupErr("labels.experiment"); err != nil || value.StringValue() != "42" {
+				mt.Errorf("%s filter = %s, want labels.experiment 42", command, filter)
+			}
+		}
+	})
+}
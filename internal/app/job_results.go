@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resultsEncodingGzip marks job results stored as gzipped JSON in a binary
+// field.
+const resultsEncodingGzip = "gzip"
+
+// resultUpdate returns the update storing a job's results. Plain results
+// unset the encoding, so that results replacing compressed ones, as a job
+// processed again stores them, are not read as compressed.
+func (app *AppContext) resultUpdate(results interface{}) bson.M {
+	stored, encoding := app.encodeResults(results)
+	if encoding == "" {
+		return bson.M{
+			"$set":   bson.M{"results": stored},
+			"$unset": bson.M{"results_encoding": ""},
+		}
+	}
+	return bson.M{"$set": bson.M{"results": stored, "results_encoding": encoding}}
+}
+
+// encodeResults returns results as they are stored and their encoding. With
+// compress_results set, results are stored as gzipped JSON whenever that is
+// smaller; otherwise, or when they cannot be encoded, they are stored as
+// they are, with no encoding.
+func (app *AppContext) encodeResults(results interface{}) (interface{}, string) {
+	if !app.Config.CompressResults || results == nil {
+		return results, ""
+	}
+
+	raw, err := json.Marshal(results)
+	if err != nil {
+		log.Printf("Storing results uncompressed: %v", err)
+		return results, ""
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		log.Printf("Storing results uncompressed: %v", err)
+		return results, ""
+	}
+	if buf.Len() >= len(raw) {
+		return results, ""
+	}
+	return primitive.Binary{Data: buf.Bytes()}, resultsEncodingGzip
+}
+
+// decodeJobResults decompresses results stored by encodeResults back into
+// job.Results. Jobs with plain results are left untouched.
+func decodeJobResults(job *DataJob) error {
+	if job.ResultsEncoding == "" {
+		return nil
+	}
+	if job.ResultsEncoding != resultsEncodingGzip {
+		return fmt.Errorf("job %s has results in unknown encoding %q", job.ID.Hex(), job.ResultsEncoding)
+	}
+
+	var data []byte
+	switch v := job.Results.(type) {
+	case primitive.Binary:
+		data = v.Data
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("job %s has compressed results that are not binary", job.ID.Hex())
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress results of job %s: %w", job.ID.Hex(), err)
+	}
+	var results interface{}
+	if err := json.NewDecoder(zr).Decode(&results); err != nil {
+		return fmt.Errorf("failed to decompress results of job %s: %w", job.ID.Hex(), err)
+	}
+
+	job.Results = results
+	job.ResultsEncoding = ""
+	return nil
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// applyUpdate applies the $set and $unset of update to a stored job the way
+// MongoDB would, and reads the job back.
+func applyUpdate(t *testing.T, job DataJob, update bson.M) DataJob {
+	t.Helper()
+	raw, err := bson.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range update {
+		switch key {
+		case "$set":
+			for field, v := range value.(bson.M) {
+				doc[field] = v
+			}
+		case "$unset":
+			for field := range value.(bson.M) {
+				delete(doc, field)
+			}
+		default:
+			t.Fatalf("unexpected operator %s", key)
+		}
+	}
+	if raw, err = bson.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	var stored DataJob
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestResultUpdateRoundTrip(t *testing.T) {
+	// Repetitive enough for gzip to pay off
+	rows := make([]interface{}, 200)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"value": float64(i % 3), "label": "sample"}
+	}
+	compressed := map[string]interface{}{"normalize": rows}
+	plain := map[string]interface{}{"normalize": []interface{}{float64(1), float64(2)}}
+
+	tests := []struct {
+		name         string
+		compress     []bool
+		results      []interface{}
+		wantEncoding []string
+	}{
+		{"plain", []bool{false}, []interface{}{plain}, []string{""}},
+		{"compressed", []bool{true}, []interface{}{compressed}, []string{resultsEncodingGzip}},
+		{"compressed then plain", []bool{true, false}, []interface{}{compressed, plain}, []string{resultsEncodingGzip, ""}},
+		{"plain then compressed", []bool{false, true}, []interface{}{plain, compressed}, []string{"", resultsEncodingGzip}},
+		{"too small to compress", []bool{true, true}, []interface{}{compressed, plain}, []string{resultsEncodingGzip, ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{}
+			job := DataJob{ID: primitive.NewObjectID(), Status: JobStatusProcessing}
+			for i, results := range tt.results {
+				app.Config.CompressResults = tt.compress[i]
+				job = applyUpdate(t, job, app.jobResultUpdate(JobStatusProcessed, results))
+				if job.ResultsEncoding != tt.wantEncoding[i] {
+					t.Fatalf("update %d: stored encoding %q, want %q", i, job.ResultsEncoding, tt.wantEncoding[i])
+				}
+
+				decoded := job
+				if err := decodeJobResults(&decoded); err != nil {
+					t.Fatalf("update %d: decodeJobResults: %v", i, err)
+				}
+				if got := normalizeStored(decoded.Results); !reflect.DeepEqual(got, results) {
+					t.Fatalf("update %d: results = %#v, want %#v", i, got, results)
+				}
+				if decoded.ResultsEncoding != "" {
+					t.Errorf("update %d: decoded encoding %q", i, decoded.ResultsEncoding)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeResults(t *testing.T) {
+	large := make([]interface{}, 100)
+	for i := range large {
+		large[i] = "the same value"
+	}
+	tests := []struct {
+		name         string
+		compress     bool
+		results      interface{}
+		wantEncoding string
+	}{
+		{"disabled", false, large, ""},
+		{"nil", true, nil, ""},
+		{"smaller plain", true, map[string]interface{}{"a": 1}, ""},
+		{"not JSON", true, math.Inf(1), ""},
+		{"compressed", true, large, resultsEncodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{CompressResults: tt.compress}}
+			stored, encoding := app.encodeResults(tt.results)
+			if encoding != tt.wantEncoding {
+				t.Fatalf("encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if encoding == "" {
+				if !reflect.DeepEqual(stored, tt.results) {
+					t.Errorf("stored %#v, want the results as they are", stored)
+				}
+				return
+			}
+			job := DataJob{Results: stored, ResultsEncoding: encoding}
+			if err := decodeJobResults(&job); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(job.Results, tt.results) {
+				t.Errorf("decoded %#v, want %#v", job.Results, tt.results)
+			}
+		})
+	}
+}
+
+func TestDecodeJobResultsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		job  DataJob
+	}{
+		{"unknown encoding", DataJob{Results: primitive.Binary{}, ResultsEncoding: "zstd"}},
+		{"not binary", DataJob{Results: "text", ResultsEncoding: resultsEncodingGzip}},
+		{"not gzip", DataJob{Results: primitive.Binary{Data: []byte("text")}, ResultsEncoding: resultsEncodingGzip}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := decodeJobResults(&tt.job); err == nil {
+				t.Fatal("decodeJobResults succeeded")
+			}
+		})
+	}
+}
+
+// normalizeStored converts the documents and arrays bson decodes plain
+// results into, and its number types, to what JSON decoding gives.
+func normalizeStored(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = normalizeStored(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = normalizeStored(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = normalizeStored(value)
+		}
+		return m
+	case bson.A:
+		return normalizeStored([]interface{}(v))
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = normalizeStored(value)
+		}
+		return s
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return v
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// searchFieldSegment is one dot-separated segment of a search field path: an
+// object key or an array index. Operators and other MongoDB syntax are
+// refused.
+var searchFieldSegment = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// maxSearchDepth bounds the number of segments in a search field path.
+const maxSearchDepth = 16
+
+// searchRoots maps the in query parameter of searchJobs to the job field
+// searched.
+var searchRoots = map[string]string{
+	"input":   "input_data",
+	"results": "results",
+}
+
+// searchJobs finds the jobs whose input or results hold value at a field
+// path, e.g. ?in=results&field=normalize.summary.max&value=1. The path is
+// given in MongoDB dot notation, so a numeric segment also matches an array
+// index and a path through an array matches any of its elements. The value
+// is parsed as JSON when it can be, and matched as a string otherwise. The
+// listJobs filters and pagination apply as well.
+//
+// Only what is stored on the job document is searched: inputs kept in
+// GridFS and results stored compressed never match.
+func (app *AppContext) searchJobs(c *gin.Context) {
+	root, ok := searchRoots[c.DefaultQuery("in", "input")]
+	if !ok {
+		c.JSON(400, gin.H{"error": "in must be input or results"})
+		return
+	}
+	path, err := searchPath(c.Query("field"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	raw, ok := c.GetQuery("value")
+	if !ok {
+		c.JSON(400, gin.H{"error": "value is required"})
+		return
+	}
+
+	pg, err := parsePage(c, []string{"created_at", "updated_at", "name", "status"}, "-created_at")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := jobFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	filter[root+"."+path] = searchValue(raw)
+	if root == "results" {
+		filter["results_encoding"] = bson.M{"$exists": false}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	cursor, err := collection.Find(ctx, filter, pg.findOptions())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]DataJob, 0)
+	if err = cursor.All(ctx, &jobs); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// Searching the input can match jobs whose results are compressed
+	for i := range jobs {
+		if err := decodeJobResults(&jobs[i]); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"jobs":   jobs,
+		"total":  total,
+		"limit":  pg.Limit,
+		"offset": pg.Offset,
+	})
+}
+
+// searchPath checks a search field path, given as dot-separated object keys
+// and array indexes.
+func searchPath(field string) (string, error) {
+	if field == "" {
+		return "", fmt.Errorf("field is required")
+	}
+	segments := strings.Split(field, ".")
+	if len(segments) > maxSearchDepth {
+		return "", fmt.Errorf("field may have at most %d segments", maxSearchDepth)
+	}
+	for _, segment := range segments {
+		if !searchFieldSegment.MatchString(segment) {
+			return "", fmt.Errorf("field segment %q may only contain letters, digits, _ and -, up to 64 of them", segment)
+		}
+	}
+	return field, nil
+}
+
+// searchValue parses a search value as a JSON scalar, so that value=42 finds
+// the number and value="42" the string. null matches only fields set to
+// null, not missing ones. Anything else, including objects and arrays, is
+// matched as the string it was given as.
+func searchValue(raw string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	switch v.(type) {
+	case nil:
+		return bson.M{"$type": "null"}
+	case map[string]interface{}, []interface{}:
+		return raw
+	}
+	return v
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSearchPath(t *testing.T) {
+	tests := []struct {
+		field   string
+		wantErr string
+	}{
+		{"max", ""},
+		{"normalize.summary.max", ""},
+		{"rows.0.value", ""},
+		{"", "field is required"},
+		{"a..b", `field segment ""`},
+		{"a.$gt", `field segment "$gt"`},
+		{"a b", `field segment "a b"`},
+		{strings.Repeat("a.", maxSearchDepth) + "a", "at most 16 segments"},
+	}
+	for _, tt := range tests {
+		path, err := searchPath(tt.field)
+		if tt.wantErr == "" {
+			if err != nil || path != tt.field {
+				t.Errorf("searchPath(%q) = %q, %v", tt.field, path, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("searchPath(%q) err = %v, want it to mention %q", tt.field, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSearchValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want interface{}
+	}{
+		{"42", 42.0},
+		{`"42"`, "42"},
+		{"true", true},
+		{"null", bson.M{"$type": "null"}},
+		{"done", "done"},
+		{`{"a": 1}`, `{"a": 1}`},
+		{"[1, 2]", "[1, 2]"},
+	}
+	for _, tt := range tests {
+		if got := searchValue(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchValue(%s) = %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSearchJobsRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantBody string
+	}{
+		{"unknown root", "in=labels&field=a&value=1", "in must be input or results"},
+		{"no field", "value=1", "field is required"},
+		{"operator in field", "field=a.%24where&value=1", `field segment \"$where\"`},
+		{"no value", "field=a", "value is required"},
+		{"bad label", "field=a&value=1&label=a.b:1", `label key \"a.b\"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			router := gin.New()
+			router.GET("/data/jobs/search", app.searchJobs)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/jobs/search?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("response %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSearchJobsNestedField(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter bson.M
+	}{
+		{
+			"input",
+			"field=site.depth.max&value=12.5",
+			bson.M{"input_data.site.depth.max": 12.5},
+		},
+		{
+			"results",
+			"in=results&field=normalize.summary.unit&value=m&status=completed",
+			bson.M{"results.normalize.summary.unit": "m", "results_encoding": bson.M{"$exists": false}, "status": "completed"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			ns := "datasciencehub_test.data_jobs"
+			job := bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "name", Value: "survey"}}
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+				mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, job),
+			)
+			router := gin.New()
+			router.GET("/data/jobs/search", app.searchJobs)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/jobs/search?"+tt.query, nil))
+			var body struct {
+				Jobs  []DataJob `json:"jobs"`
+				Total int64     `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+				mt.Fatalf("response %d %s", w.Code, w.Body.String())
+			}
+			if body.Total != 1 || len(body.Jobs) != 1 || body.Jobs[0].Name != "survey" {
+				mt.Errorf("jobs = %+v, total %d, want the matching job", body.Jobs, body.Total)
+			}
+
+			mt.GetStartedEvent() // the count
+			find := mt.GetStartedEvent()
+			if find == nil || find.CommandName != "find" {
+				mt.Fatalf("started %v, want find", find)
+			}
+			var filter bson.M
+			if err := bson.Unmarshal(find.Command.Lookup("filter").Document(), &filter); err != nil {
+				mt.Fatal(err)
+			}
+			if got, want := normalizeJSON(filter), normalizeJSON(tt.wantFilter); !reflect.DeepEqual(got, want) {
+				mt.Errorf("filter = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// jobResultUpdate returns the update recording a job's final status and
+// results, compressed as resultUpdate describes. With JobTTL set it also schedules the job for deletion.
+func (app *AppContext) jobResultUpdate(status string, results interface{}) bson.M {
+	now := time.Now()
+	update := app.resultUpdate(results)
+	fields := update["$set"].(bson.M)
+	fields["status"] = status
+	fields["updated_at"] = now
+	if expiresAt := app.jobExpiry(now); expiresAt != nil {
+		fields["expires_at"] = *expiresAt
+	}
+	return update
+}
+
+// jobExpiry returns when a job finishing at finishedAt should be purged, or
+// nil when jobs are kept forever.
+func (app *AppContext) jobExpiry(finishedAt time.Time) *time.Time {
+	if app.Config.JobTTL <= 0 {
+		return nil
+	}
+	expiresAt := finishedAt.Add(app.Config.JobTTL)
+	return &expiresAt
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestJobResultUpdateExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		jobTTL time.Duration
+	}{
+		{"kept forever", 0},
+		{"expires", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{JobTTL: tt.jobTTL}}
+			fields := app.jobResultUpdate(JobStatusProcessed, map[string]interface{}{"a": 1.0})["$set"].(bson.M)
+
+			if fields["status"] != JobStatusProcessed {
+				t.Errorf("status = %v, want %s", fields["status"], JobStatusProcessed)
+			}
+			updatedAt := fields["updated_at"].(time.Time)
+			expiresAt, expires := fields["expires_at"].(time.Time)
+			if expires != (tt.jobTTL > 0) {
+				t.Fatalf("expires_at = %v, want it set only with a job_ttl", fields["expires_at"])
+			}
+			if expires && !expiresAt.Equal(updatedAt.Add(tt.jobTTL)) {
+				t.Errorf("expires_at = %s, want job_ttl after updated_at %s", expiresAt, updatedAt)
+			}
+		})
+	}
+}
+
+func TestProcessJobAsyncExpiry(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name   string
+		jobTTL time.Duration
+	}{
+		{"kept forever", 0},
+		{"expires", time.Hour},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			app.JobSlots = make(chan struct{}, 1)
+			app.Config.JobTTL = tt.jobTTL
+			addTestPlugin(mt.T, app, "double", "input * 2")
+			// The audit record, then the results; no job matches, so no
+			// webhook lookup follows
+			mt.AddMockResponses(
+				mtest.CreateSuccessResponse(),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			)
+
+			jobID := primitive.NewObjectID()
+			before := time.Now()
+			app.processJobAsync(context.Background(), jobID, 2.0, []pluginCall{{Name: "double"}})
+			after := time.Now()
+
+			var update bson.Raw
+			for started := mt.GetStartedEvent(); started != nil; started = mt.GetStartedEvent() {
+				if started.CommandName == "update" {
+					update = started.Command.Lookup("updates", "0", "u", "$set").Document()
+				}
+			}
+			if update == nil {
+				mt.Fatal("no results update")
+			}
+			finished := update.Lookup("updated_at").Time()
+			if finished.Before(before.Truncate(time.Millisecond)) || finished.After(after) {
+				mt.Errorf("updated_at = %s, want between %s and %s", finished, before, after)
+			}
+			expiresAt, err := update.LookupErr("expires_at")
+			if tt.jobTTL == 0 {
+				if err == nil {
+					mt.Errorf("expires_at = %s, want none without a job_ttl", expiresAt)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatal("no expires_at")
+			}
+			if got := expiresAt.Time(); !got.Equal(finished.Add(tt.jobTTL)) {
+				mt.Errorf("expires_at = %s, want job_ttl after completion at %s", got, finished)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type pluginCall struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// missingPlugins returns the names in a chain that match no loaded plugin,
+// each once, in chain order.
+func (app *AppContext) missingPlugins(ctx context.Context, plugins []pluginCall) []string {
+	app.PluginsMux.RLock()
+	defer app.PluginsMux.RUnlock()
+
+	loaded := app.Plugins[tenantOf(ctx)]
+	missing := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, plugin := range plugins {
+		if _, ok := loaded[plugin.Name]; !ok && !seen[plugin.Name] {
+			seen[plugin.Name] = true
+			missing = append(missing, plugin.Name)
+		}
+	}
+	return missing
+}
+
+// runPluginChain feeds input through each plugin in order, passing every
+// successful output on to the next plugin. Failed plugins are recorded in the
+// results and reported through failed. Each finished plugin is published as a
+// step event for jobID.
+//
+// Besides input, every plugin sees a context global holding the chain's
+// original input, the outputs of the plugins that succeeded so far by name
+// (steps) and its own params.
+func (app *AppContext) runPluginChain(ctx context.Context, jobID primitive.ObjectID, input interface{}, plugins []pluginCall) (results map[string]interface{}, failed bool) {
+	results = make(map[string]interface{})
+	outputs := make(map[string]interface{})
+	data := input
+
+	for _, plugin := range plugins {
+		if ctx.Err() != nil {
+			// Cancelled: the plugins left would only be interrupted at once.
+			return results, true
+		}
+
+		script, exists := app.lookupPlugin(ctx, plugin.Name)
+
+		if !exists {
+			results[plugin.Name] = gin.H{"error": "plugin not found"}
+			failed = true
+			app.publishJobEvent(jobID, stepEvent(plugin.Name, errors.New("plugin not found")))
+			continue
+		}
+
+		chain := map[string]interface{}{
+			"input":  input,
+			"steps":  maps.Clone(outputs),
+			"params": plugin.Params,
+		}
+		output, err := func() (output scriptResult, err error) {
+			defer recoverAsError("job "+jobID.Hex()+" plugin "+plugin.Name, &err)
+			return app.runScript(ctx, script, scriptCall{
+				Input:   data,
+				Params:  plugin.Params,
+				Globals: map[string]interface{}{"context": chain},
+			})
+		}()
+		app.publishJobEvent(jobID, stepEvent(plugin.Name, err))
+		if err != nil {
+			results[plugin.Name] = scriptFailure(err)
+			failed = true
+			continue
+		}
+
+		results[plugin.Name] = output.Value
+		outputs[plugin.Name] = output.Value
+		data = output.Value
+	}
+
+	return results, failed
+}
+
+// processJobAsync runs a plugin chain outside the request that started it.
+// JobSlots bounds how many chains run at once across all requests. ctx is
+// cancelled by cancelJob; the job's status has then already been set to
+// cancelled, and only the results gathered so far are saved.
+func (app *AppContext) processJobAsync(ctx context.Context, jobID primitive.ObjectID, input interface{}, plugins []pluginCall) {
+	defer app.unregisterJob(jobID)
+
+	select {
+	case app.JobSlots <- struct{}{}:
+		defer func() { <-app.JobSlots }()
+	case <-ctx.Done():
+		return
+	}
+
+	results, failed := app.runPluginChain(ctx, jobID, input, plugins)
+
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.Config.DBTimeout)
+	defer cancel()
+
+	collection := app.database(ctx).Collection("data_jobs")
+
+	if ctx.Err() != nil {
+		update := app.resultUpdate(results)
+		if _, err := collection.UpdateOne(saveCtx, bson.M{"_id": jobID}, update); err != nil {
+			log.Printf("Error saving partial results for cancelled job %s: %v", jobID.Hex(), err)
+		}
+		return
+	}
+
+	status := JobStatusProcessed
+	if failed {
+		status = JobStatusFailed
+	}
+
+	// Only a job still processing is updated, so a cancellation that raced
+	// with the last plugin keeps its status.
+	filter := bson.M{"_id": jobID, "status": JobStatusProcessing}
+	update := app.jobResultUpdate(status, results)
+	saved, err := collection.UpdateOne(saveCtx, filter, update)
+	if err != nil {
+		log.Printf("Error saving results for job %s: %v", jobID.Hex(), err)
+	}
+	app.publishJobEvent(jobID, statusEvent(status))
+	// A cancelled job was already notified by cancelJob
+	if err == nil && saved.MatchedCount > 0 {
+		app.notifyJob(ctx, jobID)
+	}
+}
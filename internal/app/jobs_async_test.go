@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRunPluginChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		chain      []string
+		want       map[string]interface{}
+		wantErrors []string
+	}{
+		{
+			"outputs feed the next plugin",
+			[]string{"double", "inc"},
+			map[string]interface{}{"double": 4.0, "inc": 5.0},
+			nil,
+		},
+		{
+			"missing plugin",
+			[]string{"double", "missing", "inc"},
+			map[string]interface{}{"double": 4.0, "inc": 5.0},
+			[]string{"missing"},
+		},
+		{
+			"failed plugin passes its input on",
+			[]string{"fail", "inc"},
+			map[string]interface{}{"inc": 3.0},
+			[]string{"fail"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			addTestPlugin(t, app, "double", "input * 2")
+			addTestPlugin(t, app, "inc", "input + 1")
+			addTestPlugin(t, app, "fail", `throw new Error("bad input")`)
+
+			calls := make([]pluginCall, len(tt.chain))
+			for i, name := range tt.chain {
+				calls[i] = pluginCall{Name: name}
+			}
+			results, failed := app.runPluginChain(context.Background(), primitive.NewObjectID(), 2, calls)
+			if failed != (len(tt.wantErrors) > 0) {
+				t.Errorf("failed = %v, want %v", failed, len(tt.wantErrors) > 0)
+			}
+			for _, name := range tt.wantErrors {
+				failure, _ := normalizeJSON(results[name]).(map[string]interface{})
+				if _, ok := failure["error"]; !ok {
+					t.Errorf("result of %s = %v, want an error", name, results[name])
+				}
+				delete(results, name)
+			}
+			if got := normalizeJSON(results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingPlugins(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "double", "input * 2")
+	addTestPlugin(t, app, "inc", "input + 1")
+
+	tests := []struct {
+		name  string
+		chain []string
+		want  []string
+	}{
+		{"empty chain", nil, []string{}},
+		{"all loaded", []string{"double", "inc", "double"}, []string{}},
+		{"in chain order", []string{"scale", "double", "clip"}, []string{"scale", "clip"}},
+		{"each once", []string{"clip", "inc", "clip"}, []string{"clip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := make([]pluginCall, len(tt.chain))
+			for i, name := range tt.chain {
+				calls[i] = pluginCall{Name: name}
+			}
+			if got := app.missingPlugins(context.Background(), calls); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingPlugins = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPluginChainCancelled(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "inc", "input + 1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, failed := app.runPluginChain(ctx, primitive.NewObjectID(), 1, []pluginCall{{Name: "inc"}})
+	if !failed || len(results) != 0 {
+		t.Errorf("results = %v, failed = %v, want no plugin run", results, failed)
+	}
+}
+
+func TestRunPluginChainContext(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "double", "input * 2")
+	addTestPlugin(t, app, "fail", `throw new Error("boom")`)
+	addTestPlugin(t, app, "report", `({input: context.input, steps: context.steps, params: context.params})`)
+
+	calls := []pluginCall{{Name: "double"}, {Name: "fail"}, {Name: "report", Params: map[string]interface{}{"k": "v"}}}
+	results, _ := app.runPluginChain(context.Background(), primitive.NewObjectID(), 3, calls)
+
+	// Only plugins that succeeded appear among the steps
+	want := map[string]interface{}{
+		"input":  3.0,
+		"steps":  map[string]interface{}{"double": 6.0},
+		"params": map[string]interface{}{"k": "v"},
+	}
+	if got := normalizeJSON(results["report"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("context = %v, want %v", got, want)
+	}
+}
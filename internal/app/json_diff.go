@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// jsonValue is a value added or removed between two JSON documents. Path
+// names it with dots between object keys and [i] for array indexes; the root
+// is the empty path.
+type jsonValue struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// jsonChange is a value present in both documents that differs.
+type jsonChange struct {
+	Path string      `json:"path"`
+	A    interface{} `json:"a"`
+	B    interface{} `json:"b"`
+}
+
+// jsonDiff lists what changed from a to b: values only in b are added,
+// values only in a removed, and values present in both but different
+// changed. Objects and arrays are compared member by member, so a change
+// deep inside a result is reported at its own path.
+type jsonDiff struct {
+	Added   []jsonValue  `json:"added"`
+	Removed []jsonValue  `json:"removed"`
+	Changed []jsonChange `json:"changed"`
+}
+
+// diffJSON compares two values decoded from JSON. Values from BSON or goja
+// should go through normalizeJSON first.
+func diffJSON(a, b interface{}) jsonDiff {
+	diff := jsonDiff{Added: []jsonValue{}, Removed: []jsonValue{}, Changed: []jsonChange{}}
+	diff.compare("", a, b)
+	return diff
+}
+
+func (d *jsonDiff) compare(path string, a, b interface{}) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			d.compareObjects(path, a, b)
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			d.compareArrays(path, a, b)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		d.Changed = append(d.Changed, jsonChange{Path: path, A: a, B: b})
+	}
+}
+
+func (d *jsonDiff) compareObjects(path string, a, b map[string]interface{}) {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		av, inA := a[key]
+		bv, inB := b[key]
+		switch {
+		case !inA:
+			d.Added = append(d.Added, jsonValue{Path: child, Value: bv})
+		case !inB:
+			d.Removed = append(d.Removed, jsonValue{Path: child, Value: av})
+		default:
+			d.compare(child, av, bv)
+		}
+	}
+}
+
+func (d *jsonDiff) compareArrays(path string, a, b []interface{}) {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		child := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(a):
+			d.Added = append(d.Added, jsonValue{Path: child, Value: b[i]})
+		case i >= len(b):
+			d.Removed = append(d.Removed, jsonValue{Path: child, Value: a[i]})
+		default:
+			d.compare(child, a[i], b[i])
+		}
+	}
+}
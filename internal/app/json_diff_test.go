@@ -0,0 +1,68 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	obj := func(pairs ...interface{}) map[string]interface{} {
+		m := make(map[string]interface{})
+		for i := 0; i < len(pairs); i += 2 {
+			m[pairs[i].(string)] = pairs[i+1]
+		}
+		return m
+	}
+	arr := func(items ...interface{}) []interface{} { return items }
+
+	tests := []struct {
+		name string
+		a, b interface{}
+		want jsonDiff
+	}{
+		{"identical", obj("x", 1.0, "y", arr("a")), obj("x", 1.0, "y", arr("a")), jsonDiff{}},
+		{"scalar root", 1.0, 2.0, jsonDiff{Changed: []jsonChange{{Path: "", A: 1.0, B: 2.0}}}},
+		{"type change", obj("x", 1.0), obj("x", "1"), jsonDiff{Changed: []jsonChange{{Path: "x", A: 1.0, B: "1"}}}},
+		{"object becomes array", obj("x", obj()), obj("x", arr()), jsonDiff{Changed: []jsonChange{{Path: "x", A: obj(), B: arr()}}}},
+		{
+			"keys added, removed and changed in order",
+			obj("b", 1.0, "c", true, "d", nil),
+			obj("a", "new", "b", 2.0, "d", nil),
+			jsonDiff{
+				Added:   []jsonValue{{Path: "a", Value: "new"}},
+				Removed: []jsonValue{{Path: "c", Value: true}},
+				Changed: []jsonChange{{Path: "b", A: 1.0, B: 2.0}},
+			},
+		},
+		{
+			"nested paths",
+			obj("rows", arr(obj("v", 1.0), obj("v", 2.0))),
+			obj("rows", arr(obj("v", 1.0), obj("v", 3.0, "w", 0.0))),
+			jsonDiff{
+				Added:   []jsonValue{{Path: "rows[1].w", Value: 0.0}},
+				Changed: []jsonChange{{Path: "rows[1].v", A: 2.0, B: 3.0}},
+			},
+		},
+		{
+			"array grows",
+			arr(1.0), arr(1.0, 2.0, 3.0),
+			jsonDiff{Added: []jsonValue{{Path: "[1]", Value: 2.0}, {Path: "[2]", Value: 3.0}}},
+		},
+		{
+			"array shrinks",
+			obj("x", arr(1.0, 2.0)), obj("x", arr(1.0)),
+			jsonDiff{Removed: []jsonValue{{Path: "x[1]", Value: 2.0}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := jsonDiff{Added: []jsonValue{}, Removed: []jsonValue{}, Changed: []jsonChange{}}
+			want.Added = append(want.Added, tt.want.Added...)
+			want.Removed = append(want.Removed, tt.want.Removed...)
+			want.Changed = append(want.Changed, tt.want.Changed...)
+			if got := diffJSON(tt.a, tt.b); !reflect.DeepEqual(got, want) {
+				t.Errorf("diffJSON = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// migrate brings documents written by older versions of the server up to
+// date, in every tenant's database. Each step only touches documents that
+// still need it.
+func (app *AppContext) migrate() {
+	for _, tenant := range app.Config.tenants() {
+		db := app.tenantDatabase(tenant)
+		backfillPluginTimestamps(db, app.Config.StartupTimeout)
+		backfillPluginRuntimes(db, app.Config.StartupTimeout)
+		backfillPluginEnabled(db, app.Config.StartupTimeout)
+	}
+}
+
+// backfillPluginTimestamps dates plugins uploaded before created_at and
+// updated_at were recorded, using their oldest and newest GridFS revision.
+func backfillPluginTimestamps(db *mongo.Database, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	bucket, err := gridfs.NewBucket(db)
+	if err != nil {
+		log.Printf("Error backfilling plugin timestamps: %v", err)
+		return
+	}
+
+	collection := db.Collection("plugins")
+	cursor, err := collection.Find(ctx, bson.M{"created_at": bson.M{"$exists": false}})
+	if err != nil {
+		log.Printf("Error backfilling plugin timestamps: %v", err)
+		return
+	}
+	var plugins []Plugin
+	if err := cursor.All(ctx, &plugins); err != nil {
+		log.Printf("Error backfilling plugin timestamps: %v", err)
+		return
+	}
+
+	for _, plugin := range plugins {
+		createdAt, updatedAt := time.Now(), time.Now()
+		versions, err := listPluginVersions(ctx, bucket, plugin.Name)
+		if err != nil {
+			log.Printf("Error reading versions of plugin %s: %v", plugin.Name, err)
+			continue
+		}
+		if len(versions) > 0 {
+			createdAt = versions[0].UploadedAt
+			updatedAt = versions[len(versions)-1].UploadedAt
+		}
+
+		update := bson.M{"$set": bson.M{"created_at": createdAt, "updated_at": updatedAt}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": plugin.ID}, update); err != nil {
+			log.Printf("Error backfilling timestamps of plugin %s: %v", plugin.Name, err)
+		}
+	}
+	if len(plugins) > 0 {
+		log.Printf("Backfilled timestamps of %d plugins", len(plugins))
+	}
+}
+
+// backfillPluginRuntimes marks plugins uploaded before plugins had a runtime
+// as javascript, the only runtime there was.
+func backfillPluginRuntimes(db *mongo.Database, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	filter := bson.M{"runtime": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"runtime": RuntimeJavaScript}}
+	result, err := db.Collection("plugins").UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Printf("Error backfilling plugin runtimes: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Backfilled runtime of %d plugins", result.ModifiedCount)
+	}
+}
+
+// backfillPluginEnabled enables plugins uploaded before plugins could be
+// disabled.
+func backfillPluginEnabled(db *mongo.Database, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	filter := bson.M{"enabled": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"enabled": true}}
+	result, err := db.Collection("plugins").UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Printf("Error backfilling plugin enabled flags: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Enabled %d plugins stored before plugins could be disabled", result.ModifiedCount)
+	}
+}
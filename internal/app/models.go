@@ -7,25 +7,85 @@ import (
 )
 
 type Plugin struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	Name        string             `bson:"name"`
-	Description string             `bson:"description"`
+	ID            primitive.ObjectID     `bson:"_id,omitempty"`
+	Name          string                 `bson:"name"`
+	Description   string                 `bson:"description"`
+	Version       int                    `bson:"version"`
+	Runtime       string                 `bson:"runtime,omitempty"`
+	Enabled       bool                   `bson:"enabled"`
+	Tags          []string               `bson:"tags,omitempty"`
+	Tests         []PluginTest           `bson:"tests,omitempty"`
+	InputSchema   map[string]interface{} `bson:"input_schema,omitempty"`
+	Dependencies  []string               `bson:"dependencies,omitempty"`
+	Secrets       []string               `bson:"secrets,omitempty"`
+	DefaultParams map[string]interface{} `bson:"default_params,omitempty"`
+	CreatedAt     time.Time              `bson:"created_at"`
+	UpdatedAt     time.Time              `bson:"updated_at"`
 }
 
+// PluginTest is a stored example run: the plugin is expected to produce
+// Expected when executed with Input and Params.
+type PluginTest struct {
+	Name     string                 `json:"name" bson:"name"`
+	Input    interface{}            `json:"input" bson:"input"`
+	Params   map[string]interface{} `json:"params" bson:"params"`
+	Expected interface{}            `json:"expected" bson:"expected"`
+}
+
+const (
+	JobStatusUploaded   = "uploaded"
+	JobStatusProcessing = "processing"
+	JobStatusProcessed  = "processed"
+	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
+)
+
 type DataJob struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	Name        string             `bson:"name"`
-	Description string             `bson:"description"`
-	InputData   interface{}        `bson:"input_data"`
-	Status      string             `bson:"status"`
-	Results     interface{}        `bson:"results"`
-	CreatedAt   time.Time          `bson:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty"`
+	Name        string              `bson:"name"`
+	Description string              `bson:"description"`
+	InputData   interface{}         `bson:"input_data"`
+	InputRef    *primitive.ObjectID `bson:"input_ref,omitempty"`
+	Status      string              `bson:"status"`
+	Results     interface{}         `bson:"results"`
+	CreatedAt   time.Time           `bson:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at"`
+	ExpiresAt   *time.Time          `bson:"expires_at,omitempty"`
+	CallbackURL string              `bson:"callback_url,omitempty"`
+	Labels      map[string]string   `bson:"labels,omitempty"`
+
+	// ResultsEncoding is "gzip" while Results holds compressed JSON; see
+	// decodeJobResults.
+	ResultsEncoding string `json:"-" bson:"results_encoding,omitempty"`
+}
+
+// Execution is the audit record of one plugin run.
+type Execution struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Plugin     string             `bson:"plugin"`
+	Version    int                `bson:"version"`
+	Source     string             `bson:"source"`
+	Task       string             `bson:"task,omitempty"`
+	Caller     string             `bson:"caller,omitempty"`
+	Role       string             `bson:"role,omitempty"`
+	InputHash  string             `bson:"input_hash"`
+	DurationMS float64            `bson:"duration_ms"`
+	Cached     bool               `bson:"cached,omitempty"`
+	Success    bool               `bson:"success"`
+	Error      string             `bson:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
 }
 
 type TaskDefinition struct {
-	Name        string                   `yaml:"name" bson:"name"`
-	Description string                   `yaml:"description" bson:"description"`
-	Steps       []map[string]interface{} `yaml:"steps" bson:"steps"`
-	Parallel    bool                     `yaml:"parallel" bson:"parallel"`
+	ID          primitive.ObjectID       `json:"id" yaml:"-" bson:"_id,omitempty"`
+	Name        string                   `json:"name" yaml:"name" bson:"name"`
+	Description string                   `json:"description" yaml:"description" bson:"description"`
+	Vars        map[string]interface{}   `json:"vars" yaml:"vars" bson:"vars"`
+	Steps       []map[string]interface{} `json:"steps" yaml:"steps" bson:"steps"`
+	Parallel    bool                     `json:"parallel" yaml:"parallel" bson:"parallel"`
+	OnError     string                   `json:"on_error" yaml:"on_error" bson:"on_error"`
+	Schedule    string                   `json:"schedule,omitempty" yaml:"schedule" bson:"schedule,omitempty"`
+	CallbackURL string                   `json:"callback_url,omitempty" yaml:"callback_url" bson:"callback_url,omitempty"`
+	Labels      map[string]string        `json:"labels,omitempty" yaml:"labels" bson:"labels,omitempty"`
+	CreatedAt   time.Time                `json:"created_at" yaml:"-" bson:"created_at"`
 }
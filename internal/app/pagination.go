@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+type page struct {
+	Limit  int64
+	Offset int64
+	Sort   bson.D
+}
+
+// parsePage reads the limit, offset and sort query parameters. sort names a
+// field from sortable, prefixed with "-" for descending order.
+func parsePage(c *gin.Context, sortable []string, defaultSort string) (page, error) {
+	p := page{Limit: defaultPageLimit}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 {
+			return p, fmt.Errorf("limit must be a positive integer")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		p.Limit = limit
+	}
+
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || offset < 0 {
+			return p, fmt.Errorf("offset must be a non-negative integer")
+		}
+		p.Offset = offset
+	}
+
+	sortKey := c.DefaultQuery("sort", defaultSort)
+	field, order := strings.TrimPrefix(sortKey, "-"), 1
+	if strings.HasPrefix(sortKey, "-") {
+		order = -1
+	}
+	allowed := false
+	for _, s := range sortable {
+		if s == field {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return p, fmt.Errorf("sort must be one of %s (prefix with - for descending)", strings.Join(sortable, ", "))
+	}
+	p.Sort = bson.D{{Key: field, Value: order}}
+
+	return p, nil
+}
+
+func (p page) findOptions() *options.FindOptions {
+	return options.Find().SetSkip(p.Offset).SetLimit(p.Limit).SetSort(p.Sort)
+}
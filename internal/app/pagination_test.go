@@ -0,0 +1,56 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// queryContext returns a gin context for a GET request with query.
+func queryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	return c
+}
+
+func TestParsePage(t *testing.T) {
+	sortable := []string{"created_at", "name"}
+	tests := []struct {
+		query   string
+		want    page
+		wantErr string
+	}{
+		{"", page{Limit: defaultPageLimit, Sort: bson.D{{Key: "created_at", Value: -1}}}, ""},
+		{"limit=10&offset=20", page{Limit: 10, Offset: 20, Sort: bson.D{{Key: "created_at", Value: -1}}}, ""},
+		{"limit=100000", page{Limit: maxPageLimit, Sort: bson.D{{Key: "created_at", Value: -1}}}, ""},
+		{"sort=name", page{Limit: defaultPageLimit, Sort: bson.D{{Key: "name", Value: 1}}}, ""},
+		{"sort=-name", page{Limit: defaultPageLimit, Sort: bson.D{{Key: "name", Value: -1}}}, ""},
+		{"limit=0", page{}, "limit"},
+		{"limit=ten", page{}, "limit"},
+		{"offset=-1", page{}, "offset"},
+		{"sort=status", page{}, "sort must be one of created_at, name"},
+		{"sort=--name", page{}, "sort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := parsePage(queryContext(tt.query), sortable, "-created_at")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePage: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// pluginManifestName is the archive member describing the plugins in it.
+	pluginManifestName = "manifest.json"
+	// maxArchiveFileBytes caps each extracted member, so a small compressed
+	// archive cannot expand into an arbitrarily large one.
+	maxArchiveFileBytes = 8 << 20
+)
+
+// pluginManifestEntry is the metadata of one plugin in an archive's
+// manifest, keyed by the path of its .js or .wasm file. Name defaults to the
+// file name without the extension, and Runtime to wasm for .wasm files. Version is written by exports for reference; imports
+// ignore it and store the next version.
+type pluginManifestEntry struct {
+	Name          string                 `json:"name,omitempty"`
+	Description   string                 `json:"description,omitempty"`
+	Runtime       string                 `json:"runtime,omitempty"`
+	Tags          []string               `json:"tags,omitempty"`
+	Dependencies  []string               `json:"dependencies,omitempty"`
+	Secrets       []string               `json:"secrets,omitempty"`
+	DefaultParams map[string]interface{} `json:"default_params,omitempty"`
+	InputSchema   map[string]interface{} `json:"input_schema,omitempty"`
+	Tests         []PluginTest           `json:"tests,omitempty"`
+	Version       int                    `json:"version,omitempty"`
+}
+
+// archiveFile is a .js or .wasm member of a plugin archive.
+type archiveFile struct {
+	Path   string
+	Source []byte
+	Err    error
+}
+
+// readPluginArchive extracts the .js and .wasm files and the manifest from a zip or
+// gzipped tar archive, telling them apart by their leading bytes. Files that
+// cannot be read are returned with Err set; other members are ignored.
+func readPluginArchive(r io.ReaderAt, size int64) ([]archiveFile, map[string]pluginManifestEntry, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, nil, errors.New("archive is empty or unreadable")
+	}
+
+	var files []archiveFile
+	var manifest []byte
+	visit := func(name string, open func() (io.ReadCloser, error)) error {
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		isManifest := name == pluginManifestName
+		if !isManifest && (!isPluginFile(name) || skippedArchivePath(name)) {
+			return nil
+		}
+
+		data, err := readArchiveMember(open)
+		if isManifest {
+			if err != nil {
+				return fmt.Errorf("%s: %w", pluginManifestName, err)
+			}
+			manifest = data
+			return nil
+		}
+		files = append(files, archiveFile{Path: name, Source: data, Err: err})
+		return nil
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if err := visit(f.Name, f.Open); err != nil {
+				return nil, nil, err
+			}
+		}
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip archive: %w", err)
+		}
+		defer gz.Close()
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid tar archive: %w", err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+			if err := visit(hdr.Name, open); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		return nil, nil, errors.New("archive must be a zip or tar.gz file")
+	}
+
+	entries := make(map[string]pluginManifestEntry)
+	if manifest != nil {
+		if err := json.Unmarshal(manifest, &entries); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", pluginManifestName, err)
+		}
+	}
+	return files, entries, nil
+}
+
+// pluginExtensions are the file extensions of plugin sources in an archive,
+// by runtime.
+var pluginExtensions = map[string]string{
+	RuntimeJavaScript: ".js",
+	RuntimeWasm:       ".wasm",
+}
+
+// isPluginFile reports whether an archive member is a plugin source.
+func isPluginFile(name string) bool {
+	ext := path.Ext(name)
+	return ext == pluginExtensions[RuntimeJavaScript] || ext == pluginExtensions[RuntimeWasm]
+}
+
+// skippedArchivePath reports whether a member is archiver noise, such as
+// macOS resource forks, rather than a plugin.
+func skippedArchivePath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+func readArchiveMember(open func() (io.ReadCloser, error)) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxArchiveFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArchiveFileBytes {
+		return nil, fmt.Errorf("larger than %d bytes", maxArchiveFileBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type archiveMember struct {
+	name, content string
+}
+
+func zipArchive(t *testing.T, members []archiveMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(m.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, members []archiveMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(m.name, "/") {
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(m.content)); err != nil && hdr.Size > 0 {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadPluginArchive(t *testing.T) {
+	members := []archiveMember{
+		{"lib/", ""},
+		{"lib/normalize.js", "input.map(x => x / params.factor)"},
+		{"./center.js", "input"},
+		{"scale.wasm", "\x00asm\x01\x00\x00\x00"},
+		{"README.md", "# plugins"},
+		{".hidden.js", "input"},
+		{"__MACOSX/lib/._normalize.js", "fork"},
+		{"too_large.js", strings.Repeat(" ", maxArchiveFileBytes+1)},
+		{pluginManifestName, `{"lib/normalize.js": {"name": "normalize-v2", "tags": ["scaling"]}}`},
+	}
+	wantPaths := []string{"lib/normalize.js", "center.js", "scale.wasm", "too_large.js"}
+
+	for format, archive := range map[string][]byte{
+		"zip":    zipArchive(t, members),
+		"tar.gz": tarGzArchive(t, members),
+	} {
+		t.Run(format, func(t *testing.T) {
+			files, manifest, err := readPluginArchive(bytes.NewReader(archive), int64(len(archive)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := make([]string, len(files))
+			for i, f := range files {
+				paths[i] = f.Path
+			}
+			if !reflect.DeepEqual(paths, wantPaths) {
+				t.Fatalf("files = %v, want %v", paths, wantPaths)
+			}
+			if string(files[0].Source) != members[1].content || files[0].Err != nil {
+				t.Errorf("%s = %q, %v", files[0].Path, files[0].Source, files[0].Err)
+			}
+			if !bytes.Equal(files[2].Source, []byte(members[3].content)) {
+				t.Errorf("%s = %q", files[2].Path, files[2].Source)
+			}
+			if files[3].Err == nil {
+				t.Errorf("%s read without an error", files[3].Path)
+			}
+
+			entry := manifest["lib/normalize.js"]
+			if entry.Name != "normalize-v2" || !reflect.DeepEqual(entry.Tags, []string{"scaling"}) {
+				t.Errorf("manifest entry = %+v", entry)
+			}
+		})
+	}
+}
+
+func TestReadPluginArchiveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr string
+	}{
+		{"empty", nil, "empty"},
+		{"not an archive", []byte("just some text"), "must be a zip or tar.gz"},
+		{"truncated zip", zipArchive(t, []archiveMember{{"a.js", "input"}})[:20], "invalid zip"},
+		{"truncated gzip", []byte{0x1f, 0x8b, 0, 0}, "invalid gzip"},
+		{"bad manifest", zipArchive(t, []archiveMember{{pluginManifestName, "["}}), pluginManifestName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readPluginArchive(bytes.NewReader(tt.archive), int64(len(tt.archive)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
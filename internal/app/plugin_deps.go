@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pluginDependencies returns the cached plugins that plugin depends on,
+// directly or through other dependencies, in the order their scripts run:
+// each after its own dependencies. Dependencies are looked up among the
+// plugins of plugin's own tenant.
+func (app *AppContext) pluginDependencies(plugin *compiledPlugin) ([]*compiledPlugin, error) {
+	if len(plugin.Dependencies) == 0 {
+		return nil, nil
+	}
+
+	app.PluginsMux.RLock()
+	defer app.PluginsMux.RUnlock()
+	return resolveDependencies(plugin, func(name string) (*compiledPlugin, bool) {
+		dep, ok := app.Plugins[plugin.Tenant][name]
+		return dep, ok
+	})
+}
+
+// resolveDependencies orders the transitive dependencies of plugin, looking
+// each one up by name. Only JavaScript plugins can be dependencies. A plugin
+// reached again while its own dependencies are
+// still being resolved is a cycle.
+func resolveDependencies(plugin *compiledPlugin, lookup func(name string) (*compiledPlugin, bool)) ([]*compiledPlugin, error) {
+	var order []*compiledPlugin
+	done := make(map[string]bool)
+	var path []string
+
+	var visit func(p *compiledPlugin) error
+	visit = func(p *compiledPlugin) error {
+		path = append(path, p.Name)
+		defer func() { path = path[:len(path)-1] }()
+
+		for _, name := range p.Dependencies {
+			for _, ancestor := range path {
+				if ancestor == name {
+					return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+				}
+			}
+			if done[name] {
+				continue
+			}
+			dep, ok := lookup(name)
+			if !ok {
+				return fmt.Errorf("dependency %s of plugin %s not found", name, p.Name)
+			}
+			if dep.Runtime == RuntimeWasm {
+				return fmt.Errorf("dependency %s of plugin %s is a wasm plugin, whose code cannot be shared", name, p.Name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+			done[name] = true
+			order = append(order, dep)
+		}
+		return nil
+	}
+
+	if err := visit(plugin); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
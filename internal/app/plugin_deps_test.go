@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		deps    map[string][]string
+		wasm    []string
+		want    []string
+		wantErr string
+	}{
+		{"none", map[string][]string{"main": nil}, nil, nil, ""},
+		{"chain", map[string][]string{"main": {"a"}, "a": {"b"}, "b": nil}, nil, []string{"b", "a"}, ""},
+		{
+			"diamond, shared dependency once",
+			map[string][]string{"main": {"a", "b"}, "a": {"c"}, "b": {"c"}, "c": nil},
+			nil,
+			[]string{"c", "a", "b"},
+			"",
+		},
+		{"missing", map[string][]string{"main": {"a"}, "a": {"gone"}}, nil, nil, "dependency gone of plugin a not found"},
+		{"cycle", map[string][]string{"main": {"a"}, "a": {"b"}, "b": {"a"}}, nil, nil, "dependency cycle: main -> a -> b -> a"},
+		{"self", map[string][]string{"main": {"main"}}, nil, nil, "dependency cycle: main -> main"},
+		{"wasm", map[string][]string{"main": {"w"}, "w": nil}, []string{"w"}, nil, "is a wasm plugin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins := make(map[string]*compiledPlugin)
+			for name, deps := range tt.deps {
+				plugins[name] = &compiledPlugin{Name: name, Dependencies: deps, Runtime: RuntimeJavaScript}
+			}
+			for _, name := range tt.wasm {
+				plugins[name].Runtime = RuntimeWasm
+			}
+			lookup := func(name string) (*compiledPlugin, bool) {
+				p, ok := plugins[name]
+				return p, ok
+			}
+
+			order, err := resolveDependencies(plugins["main"], lookup)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveDependencies: %v", err)
+			}
+			var names []string
+			for _, p := range order {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("order = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunScriptWithDependencies(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "units", "var KM = 1000")
+	convert := addTestPlugin(t, app, "convert", "function toMeters(km) { return km * KM }")
+	convert.Dependencies = []string{"units"}
+	main := addTestPlugin(t, app, "main", "toMeters(input)")
+	main.Dependencies = []string{"convert"}
+
+	result, err := app.runScript(context.Background(), main, scriptCall{Input: 3})
+	if err != nil {
+		t.Fatalf("runScript: %v", err)
+	}
+	if result.Value != int64(3000) {
+		t.Errorf("result = %v, want 3000", result.Value)
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pluginDisabled reports whether name is a stored plugin of ctx's tenant that
+// has been disabled, telling apart a plugin that is not loaded on purpose
+// from one that does not exist.
+func (app *AppContext) pluginDisabled(ctx context.Context, name string) bool {
+	filter := bson.M{"name": name, "enabled": false}
+	n, err := app.database(ctx).Collection("plugins").CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return err == nil && n > 0
+}
+
+// respondPluginMissing answers a request for a plugin that is not loaded:
+// 409 when it is disabled, 404 otherwise.
+func (app *AppContext) respondPluginMissing(c *gin.Context, name string) {
+	if app.pluginDisabled(c.Request.Context(), name) {
+		c.JSON(http.StatusConflict, gin.H{"error": "plugin " + name + " is disabled"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "plugin not found"})
+}
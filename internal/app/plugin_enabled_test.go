@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondPluginMissing(t *testing.T) {
+	// The database cannot tell whether the plugin was disabled, so a plugin
+	// that is not loaded is reported as not found
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"execute", "/plugins/gone/execute", `{"data": 1}`},
+		{"batch", "/plugins/gone/execute-batch", `{"inputs": [1]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			router := gin.New()
+			router.POST("/plugins/:name/execute", app.executePlugin)
+			router.POST("/plugins/:name/execute-batch", app.executePluginBatch)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "plugin not found") {
+				t.Errorf("response %d %s, want 404", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRunTaskPluginNotLoaded(t *testing.T) {
+	app := newTaskTestApp(t)
+	task := TaskDefinition{Steps: []map[string]interface{}{taskStep("a", "gone")}}
+
+	results, err := app.runTask(context.Background(), task, 1)
+	checkTaskResults(t, results, err, map[string]interface{}{"a": failed("plugin gone not found")}, []string{"a"})
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// entrypointName is the function a plugin may declare instead of ending with
+// its result: runScript calls process(input, params) after the script ran and
+// returns what it returns.
+const entrypointName = "process"
+
+// entrypoint describes a plugin's top-level process function. Arity counts
+// the parameters before the first default or rest parameter, like a
+// function's length in JavaScript.
+type entrypoint struct {
+	Found bool `json:"found"`
+	Arity int  `json:"arity"`
+}
+
+// findEntrypoint looks for a top-level process function, either declared
+// with function or bound with var, let or const to a function or arrow
+// function expression. Like JavaScript, the last definition wins.
+func findEntrypoint(program *ast.Program) entrypoint {
+	var found entrypoint
+	for _, stmt := range program.Body {
+		switch stmt := stmt.(type) {
+		case *ast.FunctionDeclaration:
+			if stmt.Function.Name != nil && stmt.Function.Name.Name.String() == entrypointName {
+				found = entrypoint{Found: true, Arity: arity(stmt.Function.ParameterList)}
+			}
+		case *ast.VariableStatement:
+			found = boundEntrypoint(stmt.List, found)
+		case *ast.LexicalDeclaration:
+			found = boundEntrypoint(stmt.List, found)
+		}
+	}
+	return found
+}
+
+// boundEntrypoint returns the entrypoint defined by a list of bindings such
+// as var process = function (input, params) {...}, or found when there is
+// none.
+func boundEntrypoint(bindings []*ast.Binding, found entrypoint) entrypoint {
+	for _, binding := range bindings {
+		target, ok := binding.Target.(*ast.Identifier)
+		if !ok || target.Name.String() != entrypointName {
+			continue
+		}
+		switch fn := binding.Initializer.(type) {
+		case *ast.FunctionLiteral:
+			found = entrypoint{Found: true, Arity: arity(fn.ParameterList)}
+		case *ast.ArrowFunctionLiteral:
+			found = entrypoint{Found: true, Arity: arity(fn.ParameterList)}
+		}
+	}
+	return found
+}
+
+// arity counts the parameters before the first default or rest parameter.
+func arity(params *ast.ParameterList) int {
+	n := 0
+	for _, param := range params.List {
+		if param.Initializer != nil {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// pluginEntrypoint parses source and reports its entrypoint.
+func pluginEntrypoint(name, source string) (entrypoint, error) {
+	program, err := parser.ParseFile(nil, name, source, 0)
+	if err != nil {
+		return entrypoint{}, err
+	}
+	return findEntrypoint(program), nil
+}
+
+// callEntrypoint calls the process function a plugin declared with the
+// run's input and params globals.
+func (vm *ScriptVM) callEntrypoint() (goja.Value, error) {
+	process, ok := goja.AssertFunction(vm.Get(entrypointName))
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function", entrypointName)
+	}
+	return process(goja.Undefined(), vm.Get("input"), vm.Get("params"))
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPluginEntrypoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   entrypoint
+	}{
+		{"bare script", "input * 2", entrypoint{}},
+		{"declared", "function process(input, params) { return input }", entrypoint{Found: true, Arity: 2}},
+		{"no parameters", "function process() { return 1 }", entrypoint{Found: true, Arity: 0}},
+		{"default parameter", "function process(input, params = {}) { return input }", entrypoint{Found: true, Arity: 1}},
+		{"rest parameter", "function process(input, ...rest) { return input }", entrypoint{Found: true, Arity: 1}},
+		{"last definition wins", "function process(a) {}\nfunction process(a, b, c) {}", entrypoint{Found: true, Arity: 3}},
+		{"other function", "function transform(input) { return input }", entrypoint{}},
+		{"nested", "function outer() { function process(input) {} }", entrypoint{}},
+		{"var function", "var process = function (input, params) { return input }", entrypoint{Found: true, Arity: 2}},
+		{"const arrow", "const process = (input) => input", entrypoint{Found: true, Arity: 1}},
+		{"let among bindings", "let scale = 2, process = (input, params) => input * scale", entrypoint{Found: true, Arity: 2}},
+		{"bound to a value", "var process = 1", entrypoint{}},
+		{"rebound", "function process(a) {}\nvar process = (a, b) => a", entrypoint{Found: true, Arity: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pluginEntrypoint("plugin", tt.source)
+			if err != nil {
+				t.Fatalf("pluginEntrypoint: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("entrypoint = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginEntrypointSyntaxError(t *testing.T) {
+	if _, err := pluginEntrypoint("plugin", "function process( {"); err == nil {
+		t.Fatal("want a syntax error")
+	}
+}
+
+func TestRunScriptEntrypoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   interface{}
+	}{
+		{"last expression", "input * params.scale", int64(6)},
+		{"process", "function process(input, params) { return input * params.scale }", int64(6)},
+		{"process without return", "function process(input) {}", nil},
+		{"process over last expression", "function process(input) { return input + 1 }\ninput * 100", int64(4)},
+		{"trailing console.log", "function process(input, params) { return input * params.scale }\nconsole.log('loaded')", int64(6)},
+		{"arrow process", "const process = (input, params) => input * params.scale\nconsole.log('loaded')", int64(6)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "plugin", tt.source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{Input: 3, Params: map[string]interface{}{"scale": 2}})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if !reflect.DeepEqual(result.Value, tt.want) {
+				t.Errorf("result = %#v, want %#v", result.Value, tt.want)
+			}
+		})
+	}
+}
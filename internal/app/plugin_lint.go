@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+)
+
+// sandboxedGlobals are names plugin authors commonly reach for that the
+// runtime does not provide.
+var sandboxedGlobals = map[string]bool{
+	"require": true,
+	"import":  true,
+	"load":    true,
+	"process": true,
+}
+
+var (
+	identifierType = reflect.TypeOf((*ast.Identifier)(nil))
+	sourceFileType = reflect.TypeOf((*file.File)(nil))
+)
+
+// lintPlugin reports references to sandboxed globals that the script does not
+// declare itself. The script must already compile.
+func lintPlugin(name, source string) ([]string, error) {
+	program, err := parser.ParseFile(nil, name, source, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool)
+	var refs []*ast.Identifier
+	walkIdentifiers(reflect.ValueOf(program), false, func(id *ast.Identifier, declaration bool) {
+		if declaration {
+			declared[id.Name.String()] = true
+		} else if sandboxedGlobals[id.Name.String()] {
+			refs = append(refs, id)
+		}
+	})
+
+	warnings := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, id := range refs {
+		ref := id.Name.String()
+		if declared[ref] {
+			continue
+		}
+		pos := program.File.Position(int(id.Idx))
+		warning := fmt.Sprintf("line %d: %s is not available in the plugin sandbox", pos.Line, ref)
+		if !seen[warning] {
+			seen[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
+
+// walkIdentifiers calls visit for every identifier in an AST node. Identifiers
+// that introduce a binding (variable, parameter, function or class names) are
+// reported as declarations; labels and meta properties are skipped.
+func walkIdentifiers(v reflect.Value, declaration bool, visit func(id *ast.Identifier, declaration bool)) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkIdentifiers(v.Elem(), declaration, visit)
+		}
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == sourceFileType {
+			return
+		}
+		if v.Type() == identifierType {
+			visit(v.Interface().(*ast.Identifier), declaration)
+			return
+		}
+		walkIdentifiers(v.Elem(), declaration, visit)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkIdentifiers(v.Index(i), declaration, visit)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			switch t.Field(i).Name {
+			case "Label", "Meta", "Property":
+				continue
+			case "Target", "Parameter", "Name":
+				walkIdentifiers(v.Field(i), true, visit)
+			default:
+				walkIdentifiers(v.Field(i), false, visit)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintPlugin(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"clean", "input.map(function (x) { return x * 2 })", []string{}},
+		{"require", "var lodash = require('lodash')\nlodash.sum(input)", []string{"line 1: require is not available in the plugin sandbox"}},
+		{
+			"several globals, each line once",
+			"process.env.HOME\nload('x'); load('y')\nprocess.exit()",
+			[]string{
+				"line 1: process is not available in the plugin sandbox",
+				"line 2: load is not available in the plugin sandbox",
+				"line 3: process is not available in the plugin sandbox",
+			},
+		},
+		{"declared variable", "var process = function (x) { return x }\nprocess(input)", []string{}},
+		{"declared function", "function load(x) { return x }\nload(input)", []string{}},
+		{"parameter", "[1].map(function (require) { return require })", []string{}},
+		{"property names", "var o = {require: 1}; o.process + o.require", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lintPlugin("plugin.js", tt.source)
+			if err != nil {
+				t.Fatalf("lintPlugin: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintPlugin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintPluginSyntaxError(t *testing.T) {
+	if _, err := lintPlugin("plugin.js", "function ("); err == nil {
+		t.Error("lintPlugin accepted a script that does not parse")
+	}
+}
@@ -0,0 +1,25 @@
+package app
+
+// withDefaultParams returns params over the plugin's default params: a key
+// the caller sets, even to null, replaces the default, and the keys it
+// leaves out keep theirs. Defaults are merged by top-level key only.
+func (p *compiledPlugin) withDefaultParams(params map[string]interface{}) map[string]interface{} {
+	if len(p.DefaultParams) == 0 {
+		return params
+	}
+	merged := make(map[string]interface{}, len(p.DefaultParams)+len(params))
+	for key, value := range p.DefaultParams {
+		merged[key] = value
+	}
+	for key, value := range params {
+		merged[key] = value
+	}
+	return merged
+}
+
+// defaultParams converts default params decoded from MongoDB to plain JSON
+// values, so runs get a copy of them like any other params.
+func defaultParams(params map[string]interface{}) map[string]interface{} {
+	normalized, _ := normalizeJSON(params).(map[string]interface{})
+	return normalized
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWithDefaultParams(t *testing.T) {
+	defaults := map[string]interface{}{"scale": 2.0, "unit": "m"}
+	tests := []struct {
+		name     string
+		defaults map[string]interface{}
+		params   map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{"no defaults", nil, map[string]interface{}{"scale": 3.0}, map[string]interface{}{"scale": 3.0}},
+		{"param omitted", defaults, nil, map[string]interface{}{"scale": 2.0, "unit": "m"}},
+		{"param overridden", defaults, map[string]interface{}{"scale": 3.0}, map[string]interface{}{"scale": 3.0, "unit": "m"}},
+		{"overridden with null", defaults, map[string]interface{}{"unit": nil}, map[string]interface{}{"scale": 2.0, "unit": nil}},
+		{"extra param", defaults, map[string]interface{}{"offset": 1.0}, map[string]interface{}{"scale": 2.0, "unit": "m", "offset": 1.0}},
+		{
+			"merged by top-level key",
+			map[string]interface{}{"range": map[string]interface{}{"min": 0.0, "max": 1.0}},
+			map[string]interface{}{"range": map[string]interface{}{"max": 5.0}},
+			map[string]interface{}{"range": map[string]interface{}{"max": 5.0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := &compiledPlugin{DefaultParams: tt.defaults}
+			before := normalizeJSON(tt.defaults)
+			if got := plugin.withDefaultParams(tt.params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withDefaultParams = %v, want %v", got, tt.want)
+			}
+			if after := normalizeJSON(plugin.DefaultParams); !reflect.DeepEqual(after, before) {
+				t.Errorf("defaults changed to %v", after)
+			}
+		})
+	}
+}
+
+func TestDefaultParams(t *testing.T) {
+	stored := map[string]interface{}{"scale": int32(2), "bands": bson.A{"r", "g"}, "range": bson.M{"max": 1.5}}
+	want := map[string]interface{}{"scale": 2.0, "bands": []interface{}{"r", "g"}, "range": map[string]interface{}{"max": 1.5}}
+	if got := defaultParams(stored); !reflect.DeepEqual(got, want) {
+		t.Errorf("defaultParams = %#v, want %#v", got, want)
+	}
+}
+
+func TestExecutePluginDefaultParams(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"default applied", `{"data": 3}`, `"result":6`},
+		{"caller overrides", `{"data": 3, "params": {"scale": 10}}`, `"result":30`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "scale", "input * params.scale")
+			plugin.DefaultParams = map[string]interface{}{"scale": 2.0}
+			router := gin.New()
+			router.POST("/plugins/:name/execute", app.executePlugin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/scale/execute", strings.NewReader(tt.body)))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response %d %s, want %s", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTaskDefaultParams(t *testing.T) {
+	app := newTaskTestApp(t)
+	plugin := addTestPlugin(t, app, "scale", "input * params.scale")
+	plugin.DefaultParams = map[string]interface{}{"scale": 2.0}
+	task := TaskDefinition{Steps: []map[string]interface{}{
+		taskStep("a", "scale"),
+		taskStep("b", "scale", "params", map[string]interface{}{"scale": 10}),
+	}}
+
+	results, err := app.runTask(context.Background(), task, 3)
+	checkTaskResults(t, results, err, map[string]interface{}{"a": 6.0, "b": 60.0}, nil)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja/ast"
+)
+
+// impureHelpers are the globals whose results can differ between runs on the
+// same input and params. The random ones repeat under params.seed.
+var impureHelpers = map[string]bool{
+	"fetch":  true,
+	"Date":   true,
+	"random": true,
+	"uuid":   true,
+}
+
+// seededHelpers are the impure helpers that seedRandom makes repeatable.
+var seededHelpers = map[string]bool{
+	"random":      true,
+	"uuid":        true,
+	"Math.random": true,
+}
+
+// impureGlobals lists the impure helpers a script reads, and Math.random,
+// skipping names the script declares itself.
+func impureGlobals(program *ast.Program) []string {
+	declared := make(map[string]bool)
+	used := make(map[string]bool)
+	walkIdentifiers(reflect.ValueOf(program), false, func(id *ast.Identifier, declaration bool) {
+		name := id.Name.String()
+		if declaration {
+			declared[name] = true
+		} else if impureHelpers[name] {
+			used[name] = true
+		}
+	})
+
+	names := make([]string, 0)
+	for name := range used {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	if !declared["Math"] && readsMathRandom(reflect.ValueOf(program)) {
+		names = append(names, "Math.random")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readsMathRandom reports whether an AST node contains Math.random.
+func readsMathRandom(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface:
+		return !v.IsNil() && readsMathRandom(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == sourceFileType {
+			return false
+		}
+		if dot, ok := v.Interface().(*ast.DotExpression); ok {
+			if left, ok := dot.Left.(*ast.Identifier); ok && left.Name.String() == "Math" && dot.Identifier.Name.String() == "random" {
+				return true
+			}
+		}
+		return readsMathRandom(v.Elem())
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if readsMathRandom(v.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if readsMathRandom(v.Field(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheable reports whether a run of plugin with params may be answered from
+// the result cache: neither the plugin nor its dependencies may read
+// secrets or impure helpers, except random ones made repeatable by an
+// integer params.seed.
+func (app *AppContext) cacheable(plugin *compiledPlugin, params map[string]interface{}) bool {
+	deps, err := app.pluginDependencies(plugin)
+	if err != nil {
+		return false
+	}
+	_, seeded := randomSeed(plugin.withDefaultParams(params)["seed"])
+	for _, p := range append(deps, plugin) {
+		if len(p.Secrets) > 0 {
+			return false
+		}
+		for _, name := range p.Impure {
+			if !seeded || !seededHelpers[name] {
+				return false
+			}
+		}
+	}
+	return true
+}
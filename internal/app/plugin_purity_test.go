@@ -0,0 +1,72 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImpureGlobals(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"input * 2", []string{}},
+		{"new Date().getTime()", []string{"Date"}},
+		{"Math.random() + random()", []string{"Math.random", "random"}},
+		{"fetch('https://example.com'); uuid()", []string{"fetch", "uuid"}},
+		{"Math.max(1, 2)", []string{}},
+		{"function random() { return 4 } random()", []string{}},
+		{"var Math = {random: function () { return 4 }}; Math.random()", []string{}},
+		{"var o = {Date: 1}; o.Date", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			plugin, err := compilePlugin("p", tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plugin.Impure, tt.want) {
+				t.Errorf("impure = %q, want %q", plugin.Impure, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		secrets []string
+		params  map[string]interface{}
+		want    bool
+	}{
+		{"pure", "input * 2", nil, nil, true},
+		{"reads the clock", "Date.now()", nil, nil, false},
+		{"unseeded random", "random()", nil, nil, false},
+		{"seeded random", "random()", nil, map[string]interface{}{"seed": 42}, true},
+		{"seeded Math.random", "Math.random()", nil, map[string]interface{}{"seed": 42}, true},
+		{"non-integer seed", "random()", nil, map[string]interface{}{"seed": "x"}, false},
+		{"seed cannot repeat fetch", "fetch('https://example.com')", nil, map[string]interface{}{"seed": 42}, false},
+		{"reads secrets", "input", []string{"API_TOKEN"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "p", tt.source)
+			plugin.Secrets = tt.secrets
+			if got := app.cacheable(plugin, tt.params); got != tt.want {
+				t.Errorf("cacheable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheableImpureDependency(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "clock", "function now() { return Date.now() }")
+	plugin := addTestPlugin(t, app, "stamp", "now()")
+	plugin.Dependencies = []string{"clock"}
+	if app.cacheable(plugin, nil) {
+		t.Error("plugin depending on an impure helper is cacheable")
+	}
+}
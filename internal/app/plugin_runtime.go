@@ -0,0 +1,22 @@
+package app
+
+import "fmt"
+
+// Runtimes a plugin can be written for: JavaScript, run by goja, and
+// WebAssembly modules, run by wazero (see runWasm).
+const (
+	RuntimeJavaScript = "javascript"
+	RuntimeWasm       = "wasm"
+)
+
+// pluginRuntime checks a plugin's runtime, defaulting an empty one to
+// javascript.
+func pluginRuntime(runtime string) (string, error) {
+	switch runtime {
+	case "", RuntimeJavaScript:
+		return RuntimeJavaScript, nil
+	case RuntimeWasm:
+		return RuntimeWasm, nil
+	}
+	return "", fmt.Errorf("unknown runtime %q (supported: %s, %s)", runtime, RuntimeJavaScript, RuntimeWasm)
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPreparePluginRuntime(t *testing.T) {
+	tests := []struct {
+		name        string
+		runtime     string
+		wantRuntime string
+		wantErr     string
+	}{
+		{"missing", "", RuntimeJavaScript, ""},
+		{"javascript", RuntimeJavaScript, RuntimeJavaScript, ""},
+		{"unknown", "python", "", `invalid runtime: unknown runtime "python"`},
+		{"wrong case", "JavaScript", "", "invalid runtime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			upload := pluginUpload{Name: "echo", Runtime: tt.runtime, JavaScript: "input"}
+			_, _, err := app.preparePlugin(context.Background(), &upload, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preparePlugin: %v", err)
+			}
+			if upload.Runtime != tt.wantRuntime {
+				t.Errorf("runtime = %q, want %q", upload.Runtime, tt.wantRuntime)
+			}
+		})
+	}
+}
+
+func TestLoadPluginUnknownRuntime(t *testing.T) {
+	app := newTestApp(t)
+	// The runtime is checked before the source is read
+	if _, err := app.loadPlugin(context.Background(), nil, Plugin{Name: "echo", Runtime: "python"}); err == nil || !strings.Contains(err.Error(), "unknown runtime") {
+		t.Errorf("err = %v, want an unknown runtime", err)
+	}
+}
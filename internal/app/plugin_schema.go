@@ -0,0 +1,61 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// compileInputSchema compiles a plugin's JSON Schema for its input. A nil
+// schema accepts any input.
+func compileInputSchema(name string, schema map[string]interface{}) (*jsonschema.Schema, error) {
+	if schema == nil {
+		return nil, nil
+	}
+
+	url := "plugin:///" + name + "/input_schema.json"
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, normalizeJSON(schema)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// validateInput checks input against a plugin's input schema and returns one
+// message per violation, each prefixed with the JSON pointer of the offending
+// value.
+func (plugin *compiledPlugin) validateInput(input interface{}) []string {
+	if plugin.InputSchema == nil {
+		return nil
+	}
+
+	err := plugin.InputSchema.Validate(normalizeJSON(input))
+	if err == nil {
+		return nil
+	}
+
+	var invalid *jsonschema.ValidationError
+	if !errors.As(err, &invalid) {
+		return []string{err.Error()}
+	}
+
+	violations := make([]string, 0)
+	collectViolations(*invalid.DetailedOutput(), &violations)
+	sort.Strings(violations)
+	return violations
+}
+
+func collectViolations(unit jsonschema.OutputUnit, violations *[]string) {
+	if unit.Error != nil && len(unit.Errors) == 0 {
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		*violations = append(*violations, fmt.Sprintf("%s: %s", location, unit.Error))
+	}
+	for _, child := range unit.Errors {
+		collectViolations(child, violations)
+	}
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateInput(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"values"},
+		"properties": map[string]interface{}{
+			"values": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "number"}},
+			"unit":   map[string]interface{}{"enum": []interface{}{"m", "s"}},
+		},
+	}
+	compiled, err := compileInputSchema("stats", schema)
+	if err != nil {
+		t.Fatalf("compileInputSchema: %v", err)
+	}
+	plugin := &compiledPlugin{InputSchema: compiled}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  []string
+	}{
+		{"valid", map[string]interface{}{"values": []interface{}{1, 2.5}, "unit": "m"}, nil},
+		{"typed Go values", map[string]interface{}{"values": []float64{1, 2}}, nil},
+		{"wrong type", []interface{}{1}, []string{"/: got array, want object"}},
+		{"missing property", map[string]interface{}{}, []string{"/: missing property 'values'"}},
+		{
+			"several violations",
+			map[string]interface{}{"values": []interface{}{1, "two", true}, "unit": "kg"},
+			[]string{
+				"/unit: value must be one of 'm', 's'",
+				"/values/1: got string, want number",
+				"/values/2: got boolean, want number",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plugin.validateInput(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateInput = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileInputSchema(t *testing.T) {
+	if schema, err := compileInputSchema("any", nil); schema != nil || err != nil {
+		t.Errorf("nil schema compiled to %v, %v, want no schema", schema, err)
+	}
+	if (&compiledPlugin{}).validateInput("anything") != nil {
+		t.Error("a plugin without a schema rejected its input")
+	}
+	if _, err := compileInputSchema("bad", map[string]interface{}{"type": 5}); err == nil {
+		t.Error("compileInputSchema accepted a schema with a numeric type")
+	}
+}
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errPluginUploadConflict is returned for an upload that raced another upload
+// creating the same plugin and lost.
+var errPluginUploadConflict = errors.New("plugin was created by a concurrent upload; upload again to store a new version")
+
+// pluginUpload is a plugin's source and metadata as uploaded: JavaScript for
+// the javascript runtime, a base64 encoded module in Wasm for the wasm one.
+// Nil Tests, InputSchema, Tags, Dependencies, Secrets or DefaultParams keep
+// what is stored; an empty Runtime means javascript.
+type pluginUpload struct {
+	Name          string                 `json:"name" binding:"required"`
+	Description   string                 `json:"description"`
+	Runtime       string                 `json:"runtime"`
+	JavaScript    string                 `json:"javascript"`
+	Wasm          []byte                 `json:"wasm"`
+	Tests         []PluginTest           `json:"tests"`
+	InputSchema   map[string]interface{} `json:"input_schema"`
+	Tags          []string               `json:"tags"`
+	Dependencies  []string               `json:"dependencies"`
+	Secrets       []string               `json:"secrets"`
+	DefaultParams map[string]interface{} `json:"default_params"`
+}
+
+// preparePlugin checks an upload before anything is stored: the runtime must
+// be known, the script must compile for it, the input schema must compile,
+// and the dependencies must resolve. pending holds other plugins being
+// uploaded alongside this one, which dependencies may name in place of
+// cached plugins. It trims upload.Name, fills in the default runtime and
+// returns the compiled program, which belongs to the tenant of ctx, with the
+// lint warnings. A program that fails the later checks is released.
+func (app *AppContext) preparePlugin(ctx context.Context, upload *pluginUpload, pending map[string]*compiledPlugin) (_ *compiledPlugin, _ []string, err error) {
+	// Validate the source before storing
+	program, err := app.compileUpload(upload)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			program.release()
+		}
+	}()
+
+	if _, err := compileInputSchema(upload.Name, upload.InputSchema); err != nil {
+		return nil, nil, errors.New("invalid input_schema: " + err.Error())
+	}
+
+	if upload.Secrets != nil {
+		upload.Secrets = normalizeDependencies(upload.Secrets)
+		if err := checkSecretNames(upload.Secrets); err != nil {
+			return nil, nil, errors.New("invalid secrets: " + err.Error())
+		}
+	}
+
+	warnings := []string{}
+	if upload.Runtime == RuntimeJavaScript {
+		if warnings, err = lintPlugin(upload.Name, upload.JavaScript); err != nil {
+			return nil, nil, errors.New("invalid JavaScript: " + err.Error())
+		}
+	}
+
+	// Check the dependencies resolve, counting this upload in place of the
+	// cached plugin. Without a new list the stored one is kept.
+	upload.Name = strings.TrimSpace(upload.Name)
+	name := upload.Name
+	program.Name = name
+	program.Tenant = tenantOf(ctx)
+	app.PluginsMux.RLock()
+	plugins := app.Plugins[program.Tenant]
+	if upload.Dependencies != nil {
+		program.Dependencies = normalizeDependencies(upload.Dependencies)
+	} else if cached, ok := plugins[name]; ok {
+		program.Dependencies = cached.Dependencies
+	}
+	_, err = resolveDependencies(program, func(dep string) (*compiledPlugin, bool) {
+		if dep == name {
+			return program, true
+		}
+		if p, ok := pending[dep]; ok {
+			return p, true
+		}
+		p, ok := plugins[dep]
+		return p, ok
+	})
+	app.PluginsMux.RUnlock()
+	if err != nil {
+		return nil, nil, errors.New("invalid dependencies: " + err.Error())
+	}
+
+	return program, warnings, nil
+}
+
+// compileUpload checks an upload's runtime, filling in the default, and
+// compiles its source for it. Wasm plugins can neither depend on other
+// plugins nor read secrets, so their stored lists are cleared.
+func (app *AppContext) compileUpload(upload *pluginUpload) (*compiledPlugin, error) {
+	runtime, err := pluginRuntime(upload.Runtime)
+	if err != nil {
+		return nil, errors.New("invalid runtime: " + err.Error())
+	}
+	upload.Runtime = runtime
+
+	if runtime == RuntimeWasm {
+		switch {
+		case len(upload.Wasm) == 0:
+			return nil, errors.New("wasm is required for the wasm runtime")
+		case upload.JavaScript != "":
+			return nil, errors.New("javascript cannot be given for the wasm runtime")
+		case len(upload.Dependencies) > 0:
+			return nil, errors.New("wasm plugins cannot have dependencies")
+		case len(upload.Secrets) > 0:
+			return nil, errors.New("wasm plugins cannot read secrets")
+		}
+		upload.Dependencies = []string{}
+		upload.Secrets = []string{}
+		program, err := app.compileWasmPlugin(upload.Name, upload.Wasm)
+		if err != nil {
+			return nil, errors.New("invalid wasm: " + err.Error())
+		}
+		return program, nil
+	}
+
+	switch {
+	case upload.JavaScript == "":
+		return nil, errors.New("javascript is required")
+	case len(upload.Wasm) > 0:
+		return nil, errors.New("wasm can only be given for the wasm runtime")
+	}
+	program, err := compilePlugin(upload.Name, upload.JavaScript)
+	if err != nil {
+		return nil, errors.New("invalid JavaScript: " + err.Error())
+	}
+	return program, nil
+}
+
+// source returns the content stored for an upload.
+func (upload *pluginUpload) source() []byte {
+	if upload.Runtime == RuntimeWasm {
+		return upload.Wasm
+	}
+	return []byte(upload.JavaScript)
+}
+
+// storePlugin saves a prepared upload as the plugin's next version: the
+// metadata in the plugins collection, the source in GridFS. The compiled
+// program is then cached with the stored schema and dependencies, unless the
+// plugin is disabled; a program left uncached is released. New plugins start
+// enabled.
+func (app *AppContext) storePlugin(ctx context.Context, bucket *gridfs.Bucket, upload pluginUpload, program *compiledPlugin) (plugin Plugin, err error) {
+	cached := false
+	defer func() {
+		if !cached {
+			program.release()
+		}
+	}()
+
+	// Store metadata in plugins collection, claiming the next version number
+	collection := app.database(ctx).Collection("plugins")
+	filter := bson.M{"name": upload.Name}
+	fields := bson.M{"name": upload.Name, "description": upload.Description, "runtime": upload.Runtime}
+	if upload.Tests != nil {
+		fields["tests"] = upload.Tests
+	}
+	if upload.InputSchema != nil {
+		fields["input_schema"] = upload.InputSchema
+	}
+	if upload.Tags != nil {
+		fields["tags"] = normalizeTags(upload.Tags)
+	}
+	if upload.Dependencies != nil {
+		fields["dependencies"] = program.Dependencies
+	}
+	if upload.Secrets != nil {
+		fields["secrets"] = upload.Secrets
+	}
+	if upload.DefaultParams != nil {
+		fields["default_params"] = upload.DefaultParams
+	}
+	now := time.Now()
+	fields["updated_at"] = now
+	update := bson.M{
+		"$set":         fields,
+		"$setOnInsert": bson.M{"created_at": now, "enabled": true},
+		"$inc":         bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&plugin); err != nil {
+		// Two uploads of a new name can both try to insert it; the unique
+		// name index lets one through and fails the other.
+		if mongo.IsDuplicateKeyError(err) {
+			return plugin, errPluginUploadConflict
+		}
+		return plugin, fmt.Errorf("failed to update plugin metadata: %w", err)
+	}
+
+	// Upload to GridFS; earlier versions are kept alongside it. The file
+	// records the version, which is what sources are read back by, so
+	// concurrent uploads finishing out of order still match their metadata.
+	uploadOpts := options.GridFSUpload().SetMetadata(bson.M{"version": plugin.Version})
+	if _, err := bucket.UploadFromStream(upload.Name, bytes.NewReader(upload.source()), uploadOpts); err != nil {
+		app.unclaimPluginVersion(ctx, collection, plugin)
+		return plugin, fmt.Errorf("failed to write plugin content: %w", err)
+	}
+
+	// Cache the compiled script with the stored schema and dependencies,
+	// which may come from an earlier upload
+	program.InputSchema, err = compileInputSchema(upload.Name, plugin.InputSchema)
+	if err != nil {
+		return plugin, errors.New("invalid stored input_schema: " + err.Error())
+	}
+	program.Version = plugin.Version
+	program.Dependencies = plugin.Dependencies
+	program.Secrets = plugin.Secrets
+	program.DefaultParams = defaultParams(plugin.DefaultParams)
+
+	// A disabled plugin stays out of the cache until it is enabled again
+	if plugin.Enabled {
+		app.cachePlugin(program)
+		cached = true
+	}
+
+	return plugin, nil
+}
+
+// unclaimPluginVersion gives back the version an upload claimed when its
+// source could not be written, so the metadata does not name a version
+// without a source. A plugin the upload created is removed again. Nothing
+// changes once another upload has claimed a later version; the other
+// metadata the upload set is kept.
+func (app *AppContext) unclaimPluginVersion(ctx context.Context, collection *mongo.Collection, plugin Plugin) {
+	// The upload may have failed because its context ended
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.Config.DBTimeout)
+	defer cancel()
+
+	// created_at and updated_at only match on the upsert inserting the plugin
+	filter := bson.M{"_id": plugin.ID, "version": plugin.Version}
+	var err error
+	if plugin.CreatedAt.Equal(plugin.UpdatedAt) {
+		_, err = collection.DeleteOne(ctx, filter)
+	} else {
+		_, err = collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"version": -1}})
+	}
+	if err != nil {
+		log.Printf("Error releasing version %d of plugin %s: %v", plugin.Version, plugin.Name, err)
+	}
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUploadPluginMetadataErrors(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		err      mtest.CommandError
+		wantCode int
+		wantBody string
+	}{
+		{
+			// Another upload inserted the new name first, and the unique name
+			// index failed this one's upsert
+			"lost the race to create the plugin",
+			mtest.CommandError{Code: 11000, Message: "E11000 duplicate key error collection: plugins index: name_1"},
+			http.StatusConflict,
+			"created by a concurrent upload",
+		},
+		{
+			"other error",
+			mtest.CommandError{Code: 2, Message: "bad value"},
+			http.StatusInternalServerError,
+			"failed to update plugin metadata",
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			app.Config.UploadTimeout = app.Config.DBTimeout
+			mt.AddMockResponses(mtest.CreateCommandErrorResponse(tt.err))
+			router := gin.New()
+			router.POST("/plugins", app.uploadPlugin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins", strings.NewReader(`{"name": "scale", "javascript": "input * 2"}`)))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				mt.Errorf("response %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			// The upload that failed leaves no program cached
+			if _, ok := app.Plugins[""]["scale"]; ok {
+				mt.Error("scale was cached")
+			}
+		})
+	}
+}
+
+// uploadResponses mocks the commands one upload sends: the metadata upsert
+// returning plugin, the bucket's check for stored files, which finding one
+// skips creating its indexes, and the writes of the chunk and the file.
+func uploadResponses(plugin bson.D) []bson.D {
+	return []bson.D{
+		mtest.CreateSuccessResponse(bson.E{Key: "value", Value: plugin}),
+		mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch, bson.D{{Key: "_id", Value: primitive.NewObjectID()}}),
+		mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+	}
+}
+
+func TestUploadPluginTimestamps(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("upload then re-upload", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		app.Config.UploadTimeout = app.Config.DBTimeout
+		router := gin.New()
+		router.POST("/plugins", app.uploadPlugin)
+
+		var updatedAt []time.Time
+		for version := 1; version <= 2; version++ {
+			mt.AddMockResponses(uploadResponses(bson.D{
+				{Key: "name", Value: "scale"},
+				{Key: "version", Value: version},
+				{Key: "enabled", Value: true},
+			})...)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins", strings.NewReader(`{"name": "scale", "javascript": "input * 2"}`)))
+			if w.Code != http.StatusCreated {
+				mt.Fatalf("upload %d: %d %s", version, w.Code, w.Body.String())
+			}
+
+			started := mt.GetStartedEvent()
+			if started == nil || started.CommandName != "findAndModify" {
+				mt.Fatalf("started %v, want findAndModify", started)
+			}
+			var update struct {
+				Set         bson.M `bson:"$set"`
+				SetOnInsert bson.M `bson:"$setOnInsert"`
+			}
+			if err := bson.Unmarshal(started.Command.Lookup("update").Document(), &update); err != nil {
+				mt.Fatal(err)
+			}
+			// created_at is written only by the upsert inserting the plugin,
+			// so re-uploads keep the first one
+			if _, ok := update.Set["created_at"]; ok {
+				mt.Errorf("upload %d sets created_at on every upsert", version)
+			}
+			if created, ok := update.SetOnInsert["created_at"].(primitive.DateTime); !ok || created.Time().IsZero() {
+				mt.Fatalf("upload %d: $setOnInsert.created_at = %v, want a time", version, update.SetOnInsert["created_at"])
+			}
+			updated, ok := update.Set["updated_at"].(primitive.DateTime)
+			if !ok || updated.Time().IsZero() {
+				mt.Fatalf("upload %d: $set.updated_at = %v, want a time", version, update.Set["updated_at"])
+			}
+			updatedAt = append(updatedAt, updated.Time())
+			mt.ClearEvents()
+
+			// Stored times have millisecond precision
+			time.Sleep(2 * time.Millisecond)
+		}
+		if !updatedAt[1].After(updatedAt[0]) {
+			mt.Errorf("updated_at %v then %v, want it to advance", updatedAt[0], updatedAt[1])
+		}
+	})
+}
+
+func TestUploadPluginUnclaimsVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		updatedAt   time.Time
+		wantCommand string
+		wantUpdate  string
+	}{
+		{"existing plugin", created.Add(time.Hour), "update", `{"$inc": {"version": {"$numberInt":"-1"}}}`},
+		{"plugin the upload created", created, "delete", ""},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			app := newTestApp(mt.T)
+			app.MongoClient = mt.Client
+			app.Config.UploadTimeout = app.Config.DBTimeout
+			mt.AddMockResponses(
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+					{Key: "_id", Value: id},
+					{Key: "name", Value: "scale"},
+					{Key: "version", Value: 4},
+					{Key: "enabled", Value: true},
+					{Key: "created_at", Value: created},
+					{Key: "updated_at", Value: tt.updatedAt},
+				}}),
+				// The source cannot be written
+				mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			)
+			router := gin.New()
+			router.POST("/plugins", app.uploadPlugin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins", strings.NewReader(`{"name": "scale", "javascript": "input * 2"}`)))
+			if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "failed to write plugin content") {
+				mt.Fatalf("response %d %s, want 500", w.Code, w.Body.String())
+			}
+			if _, ok := app.Plugins[""]["scale"]; ok {
+				mt.Error("scale was cached")
+			}
+
+			mt.GetStartedEvent() // the claim
+			mt.GetStartedEvent() // the bucket's check for files
+			started := mt.GetStartedEvent()
+			if started == nil || started.CommandName != tt.wantCommand {
+				mt.Fatalf("started %v, want %s", started, tt.wantCommand)
+			}
+			key := "updates"
+			if tt.wantCommand == "delete" {
+				key = "deletes"
+			}
+			// Only while no later upload has claimed another version
+			filter := started.Command.Lookup(key, "0", "q").Document()
+			if filter.Lookup("_id").ObjectID() != id || filter.Lookup("version").AsInt64() != 4 {
+				mt.Errorf("filter = %s, want version 4 of the plugin", filter)
+			}
+			if tt.wantUpdate != "" {
+				if update := started.Command.Lookup(key, "0", "u").Document().String(); update != tt.wantUpdate {
+					mt.Errorf("update = %s, want %s", update, tt.wantUpdate)
+				}
+			}
+		})
+	}
+}
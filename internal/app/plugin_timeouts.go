@@ -0,0 +1,117 @@
+package app
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// timeoutWindow is how many of a plugin's latest runs its recent timeout
+// rate is computed over. No alert is raised before a plugin has run that
+// many times.
+const timeoutWindow = 20
+
+// pluginTimeouts counts a plugin's runs and timeouts since the server
+// started.
+type pluginTimeouts struct {
+	Plugin   string `json:"plugin"`
+	Runs     int64  `json:"runs"`
+	Timeouts int64  `json:"timeouts"`
+	// RecentRate is the share of the latest timeoutWindow runs that timed
+	// out.
+	RecentRate float64 `json:"recent_rate"`
+
+	// recent holds whether each of the latest runs timed out, run n at
+	// n % timeoutWindow.
+	recent         [timeoutWindow]bool
+	recentTimeouts int
+	alerting       bool
+}
+
+// timeoutCounters holds the pluginTimeouts of every plugin run in this
+// process, by tenant and plugin name.
+type timeoutCounters struct {
+	mu      sync.Mutex
+	plugins map[string]map[string]*pluginTimeouts
+}
+
+func newTimeoutCounters() *timeoutCounters {
+	return &timeoutCounters{plugins: make(map[string]map[string]*pluginTimeouts)}
+}
+
+// recordRun counts a run of plugin. When timeout_alert_rate is set, a
+// warning is logged once the share of its latest runs that timed out
+// reaches it, and again when the plugin recovers.
+func (app *AppContext) recordRun(plugin *compiledPlugin, timedOut bool) {
+	t := app.Timeouts
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byName, ok := t.plugins[plugin.Tenant]
+	if !ok {
+		byName = make(map[string]*pluginTimeouts)
+		t.plugins[plugin.Tenant] = byName
+	}
+	p, ok := byName[plugin.Name]
+	if !ok {
+		p = &pluginTimeouts{Plugin: plugin.Name}
+		byName[plugin.Name] = p
+	}
+
+	slot := p.Runs % timeoutWindow
+	if p.recent[slot] {
+		p.recentTimeouts--
+	}
+	p.recent[slot] = timedOut
+	if timedOut {
+		p.recentTimeouts++
+		p.Timeouts++
+	}
+	p.Runs++
+	p.RecentRate = float64(p.recentTimeouts) / float64(min(p.Runs, timeoutWindow))
+
+	threshold := app.Config.TimeoutAlertRate
+	if threshold <= 0 || p.Runs < timeoutWindow {
+		return
+	}
+	switch {
+	case p.RecentRate >= threshold && !p.alerting:
+		p.alerting = true
+		slog.Warn("plugin timeout rate above threshold",
+			"plugin", plugin.Name, "version", plugin.Version, "tenant", plugin.Tenant,
+			"recent_rate", p.RecentRate, "threshold", threshold,
+			"window", timeoutWindow, "timeouts", p.Timeouts, "runs", p.Runs)
+	case p.RecentRate < threshold && p.alerting:
+		p.alerting = false
+		slog.Info("plugin timeout rate back below threshold",
+			"plugin", plugin.Name, "version", plugin.Version, "tenant", plugin.Tenant,
+			"recent_rate", p.RecentRate, "threshold", threshold)
+	}
+}
+
+// timeoutStats lists the plugins of a tenant that timed out at least once,
+// most timeouts first.
+func (app *AppContext) timeoutStats(tenant string) []pluginTimeouts {
+	t := app.Timeouts
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]pluginTimeouts, 0)
+	for _, p := range t.plugins[tenant] {
+		if p.Timeouts > 0 {
+			stats = append(stats, pluginTimeouts{
+				Plugin:     p.Plugin,
+				Runs:       p.Runs,
+				Timeouts:   p.Timeouts,
+				RecentRate: p.RecentRate,
+			})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Timeouts != stats[j].Timeouts {
+			return stats[i].Timeouts > stats[j].Timeouts
+		}
+		return stats[i].Plugin < stats[j].Plugin
+	})
+	return stats
+}
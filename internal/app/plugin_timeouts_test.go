@@ -0,0 +1,55 @@
+package app
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRecordRunAlerts(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	app := &AppContext{Config: ServerConfig{TimeoutAlertRate: 0.5}, Timeouts: newTimeoutCounters()}
+	plugin := &compiledPlugin{Name: "slow", Version: 3, Tenant: "acme"}
+
+	// Timeouts below the window's size raise nothing
+	for i := 0; i < timeoutWindow-1; i++ {
+		app.recordRun(plugin, true)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("alert before %d runs: %s", timeoutWindow, logs.String())
+	}
+
+	// The alert is logged once, with its fields
+	app.recordRun(plugin, true)
+	app.recordRun(plugin, true)
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1:\n%s", len(lines), logs.String())
+	}
+	for _, field := range []string{"level=WARN", "plugin=slow", "version=3", "tenant=acme", "recent_rate=1", "threshold=0.5", "window=20", "timeouts=20", "runs=20"} {
+		if !strings.Contains(lines[0], field) {
+			t.Errorf("alert %q has no %s", lines[0], field)
+		}
+	}
+
+	// Recovering is logged once the recent rate drops below the threshold
+	logs.Reset()
+	for i := 0; i < timeoutWindow/2+1; i++ {
+		app.recordRun(plugin, false)
+	}
+	if got := logs.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "level=INFO") || !strings.Contains(got, "recent_rate=0.45") {
+		t.Errorf("recovery logged %q", got)
+	}
+
+	stats := app.timeoutStats("acme")
+	if len(stats) != 1 || stats[0].Runs != 32 || stats[0].Timeouts != 21 {
+		t.Errorf("timeoutStats = %+v", stats)
+	}
+	if other := app.timeoutStats(""); len(other) != 0 {
+		t.Errorf("default tenant stats = %+v, want none", other)
+	}
+}
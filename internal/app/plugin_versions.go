@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PluginVersion describes one stored revision of a plugin's source.
+type PluginVersion struct {
+	Version    int       `json:"version"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// fileVersion reads the version recorded on a plugin's GridFS file. Files
+// uploaded before versioning existed report version 0.
+func fileVersion(file gridfs.File) int {
+	if v, ok := file.Metadata.Lookup("version").AsInt64OK(); ok {
+		return int(v)
+	}
+	return 0
+}
+
+// findPluginFile returns the GridFS file holding the given version of a
+// plugin, or the newest upload when version is 0.
+func findPluginFile(ctx context.Context, bucket *gridfs.Bucket, name string, version int) (gridfs.File, error) {
+	filter := bson.M{"filename": name}
+	if version > 0 {
+		filter["metadata.version"] = version
+	}
+	opts := options.GridFSFind().
+		SetSort(bson.D{{Key: "uploadDate", Value: -1}}).
+		SetLimit(1)
+
+	var file gridfs.File
+	cursor, err := bucket.FindContext(ctx, filter, opts)
+	if err != nil {
+		return file, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return file, err
+		}
+		return file, gridfs.ErrFileNotFound
+	}
+	err = cursor.Decode(&file)
+	return file, err
+}
+
+// findPluginSource returns the GridFS file holding the source of the given
+// version of a plugin, like findPluginFile. Sources uploaded before files
+// recorded their version stand for whatever version the plugin has, so
+// when no file has the version, the newest file is used if it has none.
+func findPluginSource(ctx context.Context, bucket *gridfs.Bucket, name string, version int) (gridfs.File, error) {
+	file, err := findPluginFile(ctx, bucket, name, version)
+	if version == 0 || !errors.Is(err, gridfs.ErrFileNotFound) {
+		return file, err
+	}
+	newest, err := findPluginFile(ctx, bucket, name, 0)
+	if err != nil {
+		return newest, err
+	}
+	if fileVersion(newest) != 0 {
+		return newest, gridfs.ErrFileNotFound
+	}
+	return newest, nil
+}
+
+// deletePluginFiles removes every stored revision of a plugin's source,
+// chunks included.
+func deletePluginFiles(ctx context.Context, bucket *gridfs.Bucket, name string) error {
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": name})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file gridfs.File
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// listPluginVersions returns every stored revision of a plugin, oldest first.
+func listPluginVersions(ctx context.Context, bucket *gridfs.Bucket, name string) ([]PluginVersion, error) {
+	opts := options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: 1}})
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": name}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := make([]PluginVersion, 0)
+	for cursor.Next(ctx) {
+		var file gridfs.File
+		if err := cursor.Decode(&file); err != nil {
+			return nil, err
+		}
+		versions = append(versions, PluginVersion{
+			Version:    fileVersion(file),
+			Size:       file.Length,
+			UploadedAt: file.UploadDate,
+		})
+	}
+	return versions, cursor.Err()
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestFileVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata bson.M
+		want     int
+	}{
+		{"no metadata", nil, 0},
+		{"stored before versioning", bson.M{"runtime": RuntimeJavaScript}, 0},
+		{"int32", bson.M{"version": int32(3)}, 3},
+		{"int64", bson.M{"version": int64(12)}, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file gridfs.File
+			if tt.metadata != nil {
+				raw, err := bson.Marshal(tt.metadata)
+				if err != nil {
+					t.Fatal(err)
+				}
+				file.Metadata = raw
+			}
+			if got := fileVersion(file); got != tt.want {
+				t.Errorf("fileVersion = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pluginFilesCollection is where the default GridFS bucket, which holds
+// plugin sources, records each uploaded file.
+const pluginFilesCollection = "fs.files"
+
+// maxWatchBackoff caps the wait between attempts to reopen a failed change
+// stream.
+const maxWatchBackoff = time.Minute
+
+// pluginChange is the part of a change stream event watchPlugins reads.
+type pluginChange struct {
+	OperationType string `bson:"operationType"`
+	Ns            struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument bson.M `bson:"fullDocument"`
+}
+
+// startPluginWatch keeps Plugins in step with changes other instances make to
+// the stored plugins until Close is called.
+func (app *AppContext) startPluginWatch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.watchPlugins(ctx)
+	}()
+	app.stopPluginWatch = func() {
+		cancel()
+		<-done
+	}
+}
+
+// watchPlugins follows a change stream on the plugins collection and the
+// plugin GridFS files of every tenant's database, reloading each plugin that
+// changes. Uploads touch both, and the source is written last, so a plugin
+// may be reloaded twice. When the stream fails it is reopened where it left
+// off; if that is no longer possible, every plugin is reloaded to catch up
+// on missed changes.
+func (app *AppContext) watchPlugins(ctx context.Context) {
+	databases := make(bson.A, 0)
+	for _, tenant := range app.Config.tenants() {
+		databases = append(databases, app.Config.tenantDatabaseName(tenant))
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"ns.db":   bson.M{"$in": databases},
+			"ns.coll": bson.M{"$in": bson.A{"plugins", pluginFilesCollection}},
+		}}},
+	}
+
+	var resumeToken bson.Raw
+	missed := false
+	backoff := time.Second
+	for ctx.Err() == nil {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+		stream, err := app.MongoClient.Watch(ctx, pipeline, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Plugin watch: failed to open change stream (watch_plugins requires a replica set): %v", err)
+			resumeToken = nil
+			missed = true
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxWatchBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		if missed {
+			for _, tenant := range app.Config.tenants() {
+				if report, err := app.reloadPlugins(tenant); err != nil {
+					log.Printf("Plugin watch: failed to reload plugins%s: %v", tenantSuffix(tenant), err)
+				} else {
+					log.Printf("Plugin watch: reloaded %d plugins%s (%d failed)", report.Loaded, tenantSuffix(tenant), len(report.Failed))
+				}
+			}
+			missed = false
+		}
+
+		for stream.Next(ctx) {
+			var change pluginChange
+			if err := stream.Decode(&change); err != nil {
+				log.Printf("Plugin watch: failed to decode change: %v", err)
+			} else {
+				app.applyPluginChange(ctx, change)
+			}
+			resumeToken = stream.ResumeToken()
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			log.Printf("Plugin watch: change stream failed: %v", err)
+		}
+		stream.Close(context.Background())
+	}
+}
+
+// applyPluginChange reloads the plugin a change is about. Deleted metadata
+// carries no name, so deletions drop every cached plugin of the tenant no
+// longer stored.
+func (app *AppContext) applyPluginChange(ctx context.Context, change pluginChange) {
+	tenant, ok := app.databaseTenant(change.Ns.DB)
+	if !ok {
+		return
+	}
+	ctx = withTenant(ctx, tenant)
+
+	var name string
+	switch change.OperationType {
+	case "insert", "update", "replace":
+		field := "name"
+		if change.Ns.Coll == pluginFilesCollection {
+			field = "filename"
+		}
+		name, _ = change.FullDocument[field].(string)
+	case "delete":
+		if change.Ns.Coll == "plugins" {
+			app.prunePlugins(ctx)
+		}
+		return
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return
+	}
+
+	if err := app.reloadPlugin(ctx, name); err != nil {
+		log.Printf("Plugin watch: failed to reload plugin %s: %v", name, err)
+	}
+}
+
+// reloadPlugin recompiles one plugin of ctx's tenant into Plugins, or
+// removes it when it is no longer stored or has been disabled. A plugin that
+// fails to load keeps its cached program.
+func (app *AppContext) reloadPlugin(ctx context.Context, name string) error {
+	db := app.database(ctx)
+
+	var plugin Plugin
+	err := db.Collection("plugins").FindOne(ctx, bson.M{"name": name}).Decode(&plugin)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		app.uncachePlugin(tenantOf(ctx), name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !plugin.Enabled {
+		app.uncachePlugin(tenantOf(ctx), name)
+		return nil
+	}
+
+	bucket, err := gridfs.NewBucket(db)
+	if err != nil {
+		return err
+	}
+	script, err := app.loadPlugin(ctx, bucket, plugin)
+	if err != nil {
+		return err
+	}
+
+	script.Tenant = tenantOf(ctx)
+	app.cachePlugin(script)
+	return nil
+}
+
+// prunePlugins removes the cached plugins of ctx's tenant whose metadata has
+// been deleted.
+func (app *AppContext) prunePlugins(ctx context.Context) {
+	names, err := app.database(ctx).Collection("plugins").Distinct(ctx, "name", bson.M{})
+	if err != nil {
+		log.Printf("Plugin watch: failed to list plugins: %v", err)
+		return
+	}
+	stored := make(map[string]bool, len(names))
+	for _, name := range names {
+		if s, ok := name.(string); ok {
+			stored[strings.TrimSpace(s)] = true
+		}
+	}
+
+	app.PluginsMux.Lock()
+	defer app.PluginsMux.Unlock()
+	cached := app.Plugins[tenantOf(ctx)]
+	for name, plugin := range cached {
+		if !stored[name] {
+			plugin.release()
+			delete(cached, name)
+		}
+	}
+}
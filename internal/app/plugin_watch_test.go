@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApplyPluginChangeKeepsCache(t *testing.T) {
+	change := func(op, db, coll string, doc bson.M) pluginChange {
+		var c pluginChange
+		c.OperationType, c.Ns.DB, c.Ns.Coll, c.FullDocument = op, db, coll, doc
+		return c
+	}
+
+	// None of these changes can be applied, so the cached plugin stays
+	tests := []struct {
+		name   string
+		change pluginChange
+	}{
+		{"other database", change("delete", "elsewhere", "plugins", nil)},
+		{"no name", change("update", "datasciencehub_test", "plugins", bson.M{"name": "  "})},
+		{"unhandled operation", change("drop", "datasciencehub_test", "plugins", nil)},
+		{"metadata not readable", change("update", "datasciencehub_test", "plugins", bson.M{"name": "echo"})},
+		{"source not readable", change("insert", "datasciencehub_test", pluginFilesCollection, bson.M{"filename": "echo"})},
+		{"stored names not readable", change("delete", "datasciencehub_test", "plugins", nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			cached := addTestPlugin(t, app, "echo", "input")
+
+			app.applyPluginChange(context.Background(), tt.change)
+			if got := app.Plugins[""]["echo"]; got != cached {
+				t.Errorf("cached plugin = %v, want it kept", got)
+			}
+		})
+	}
+}
+
+func TestStopPluginWatch(t *testing.T) {
+	app := newTestApp(t)
+	app.startPluginWatch()
+
+	// The stream cannot be opened, so the watch is waiting to retry
+	time.Sleep(100 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		app.stopPluginWatch()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the plugin watch did not stop")
+	}
+	app.stopPluginWatch = nil
+}
@@ -3,64 +3,286 @@ package app
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
+	jsast "github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func (app *AppContext) loadPlugins() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// compiledPlugin is a plugin program ready to run: a goja Program for
+// JavaScript plugins, a compiled Module for wasm ones, which the plugin holds
+// until it is released. Reusable is false when the
+// script declares top-level let, const or class bindings, which goja refuses
+// to declare a second time in the same runtime. Dependencies name the plugins
+// whose scripts run first in the same runtime. Entrypoint is true when the
+// script declares a process function to call for the result. Tenant is the
+// tenant whose database the plugin is stored in. Secrets name the secrets
+// bound into its runs, and DefaultParams fill in the params callers leave
+// out. Impure lists the helpers it reads that keep its results from being
+// cached (see impureGlobals).
+type compiledPlugin struct {
+	Name          string
+	Tenant        string
+	Version       int
+	Runtime       string
+	Program       *goja.Program
+	Module        *wasmModule
+	Reusable      bool
+	Entrypoint    bool
+	InputSchema   *jsonschema.Schema
+	Dependencies  []string
+	Secrets       []string
+	DefaultParams map[string]interface{}
+	Impure        []string
+}
 
-	collection := app.MongoClient.Database(app.Config.DatabaseName).Collection("plugins")
-	cursor, err := collection.Find(ctx, bson.M{})
+func compilePlugin(name, source string) (*compiledPlugin, error) {
+	prg, err := parser.ParseFile(nil, name, source, 0)
 	if err != nil {
-		log.Printf("Error loading plugins: %v", err)
-		return
-	}
-	defer cursor.Close(ctx)
-	bucket, _ := gridfs.NewBucket(app.MongoClient.Database(app.Config.DatabaseName))
-	for cursor.Next(ctx) {
-		var plugin Plugin
-		if err := cursor.Decode(&plugin); err != nil {
-			log.Printf("Error decoding plugin: %v", err)
-			continue
-		}
-		filter := bson.M{"filename": strings.TrimSpace(plugin.Name)}
-		_, err := bucket.Find(filter)
+		return nil, err
+	}
+	program, err := goja.CompileAST(prg, false)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			log.Printf("Error loading plugin script from Gridfs: %v", err)
-			continue
-			// handle error
+	reusable := true
+	for _, stmt := range prg.Body {
+		switch stmt.(type) {
+		case *jsast.LexicalDeclaration, *jsast.ClassDeclaration:
+			reusable = false
 		}
-		downloadStream, err := bucket.OpenDownloadStreamByName(strings.TrimSpace(plugin.Name), &options.NameOptions{})
-		if err != nil {
-			log.Printf("Error loading plugin script from Gridfs: %v", err)
-			continue
-		}
-		fileBuffer := bytes.NewBuffer(nil)
-		if _, err := io.Copy(fileBuffer, downloadStream); err != nil {
-			// handle error
-		}
-		io.Copy(fileBuffer, downloadStream)
+	}
+	return &compiledPlugin{
+		Name:       name,
+		Runtime:    RuntimeJavaScript,
+		Program:    program,
+		Reusable:   reusable,
+		Entrypoint: findEntrypoint(prg).Found,
+		Impure:     impureGlobals(prg),
+	}, nil
+}
 
-		pluginAsScript := fileBuffer.String()
+type pluginLoadReport struct {
+	Loaded int               `json:"loaded"`
+	Failed map[string]string `json:"failed"`
+}
 
-		script, err := goja.Compile("", pluginAsScript, false)
+// loadPlugins loads the plugins of every tenant.
+func (app *AppContext) loadPlugins() {
+	for _, tenant := range app.Config.tenants() {
+		start := time.Now()
+		report, err := app.reloadPlugins(tenant)
 		if err != nil {
-			log.Printf("Error compiling plugin %s: %v", pluginAsScript, err)
+			log.Printf("Error loading plugins%s: %v", tenantSuffix(tenant), err)
 			continue
 		}
+		log.Printf("Loaded %d plugins%s (%d failed) in %s", report.Loaded, tenantSuffix(tenant), len(report.Failed), time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// reloadPlugins compiles every enabled plugin stored for tenant into a fresh
+// map and swaps it in at once. Executions already running keep the program they
+// started with. Sources are read and compiled by up to MaxParallel workers.
+func (app *AppContext) reloadPlugins(tenant string) (pluginLoadReport, error) {
+	var report pluginLoadReport
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.StartupTimeout)
+	defer cancel()
+
+	db := app.tenantDatabase(tenant)
+	bucket, err := gridfs.NewBucket(db)
+	if err != nil {
+		return report, err
+	}
+
+	cursor, err := db.Collection("plugins").Find(ctx, bson.M{"enabled": bson.M{"$ne": false}})
+	if err != nil {
+		return report, err
+	}
+	var stored []Plugin
+	if err := cursor.All(ctx, &stored); err != nil {
+		return report, err
+	}
+
+	plugins, report := loadStoredPlugins(stored, app.Config.MaxParallel, func(plugin Plugin) (*compiledPlugin, error) {
+		return app.loadPlugin(ctx, bucket, plugin)
+	})
+	for _, script := range plugins {
+		script.Tenant = tenant
+	}
+
+	app.PluginsMux.Lock()
+	old := app.Plugins[tenant]
+	app.Plugins[tenant] = plugins
+	app.PluginsMux.Unlock()
+	for _, plugin := range old {
+		plugin.release()
+	}
+
+	return report, nil
+}
+
+// loadStoredPlugins calls load on every stored plugin, up to workers at a
+// time, and collects the programs by trimmed name along with why the others
+// failed.
+func loadStoredPlugins(stored []Plugin, workers int, load func(Plugin) (*compiledPlugin, error)) (map[string]*compiledPlugin, pluginLoadReport) {
+	plugins := make(map[string]*compiledPlugin)
+	report := pluginLoadReport{Failed: make(map[string]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan Plugin)
+
+	for w := 0; w < min(max(workers, 1), len(stored)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for plugin := range queue {
+				name := strings.TrimSpace(plugin.Name)
+				script, err := load(plugin)
+
+				mu.Lock()
+				if err != nil {
+					report.Failed[name] = err.Error()
+				} else {
+					plugins[name].release()
+					plugins[name] = script
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, plugin := range stored {
+		queue <- plugin
+	}
+	close(queue)
+	wg.Wait()
+
+	report.Loaded = len(plugins)
+	return plugins, report
+}
+
+// lookupPlugin returns the cached plugin called name of the tenant ctx
+// belongs to. Plugins is keyed by tenant, then by plugin name.
+func (app *AppContext) lookupPlugin(ctx context.Context, name string) (*compiledPlugin, bool) {
+	app.PluginsMux.RLock()
+	defer app.PluginsMux.RUnlock()
+	plugin, ok := app.Plugins[tenantOf(ctx)][name]
+	return plugin, ok
+}
+
+// cachePlugin caches plugin under its tenant and name, replacing and
+// releasing the program cached before.
+func (app *AppContext) cachePlugin(plugin *compiledPlugin) {
+	app.PluginsMux.Lock()
+	defer app.PluginsMux.Unlock()
+	if app.Plugins[plugin.Tenant] == nil {
+		app.Plugins[plugin.Tenant] = make(map[string]*compiledPlugin)
+	}
+	if old := app.Plugins[plugin.Tenant][plugin.Name]; old != plugin {
+		old.release()
+	}
+	app.Plugins[plugin.Tenant][plugin.Name] = plugin
+}
+
+// uncachePlugin drops and releases a tenant's cached plugin.
+func (app *AppContext) uncachePlugin(tenant, name string) {
+	app.PluginsMux.Lock()
+	defer app.PluginsMux.Unlock()
+	app.Plugins[tenant][name].release()
+	delete(app.Plugins[tenant], name)
+}
+
+// release lets go of a program that is no longer cached or about to be: a
+// wasm plugin's module is closed once no other plugin or run holds it.
+// JavaScript programs need no releasing. A nil plugin is ignored.
+func (plugin *compiledPlugin) release() {
+	if plugin != nil && plugin.Module != nil {
+		plugin.Module.release()
+	}
+}
+
+// loadPlugin reads and compiles one stored plugin, logging why it failed.
+// The source is the revision uploaded as the plugin's current version.
+func (app *AppContext) loadPlugin(ctx context.Context, bucket *gridfs.Bucket, plugin Plugin) (*compiledPlugin, error) {
+	name := strings.TrimSpace(plugin.Name)
+
+	runtime, err := pluginRuntime(plugin.Runtime)
+	if err != nil {
+		log.Printf("Skipping plugin %s: %v", name, err)
+		return nil, err
+	}
+
+	source, err := readPluginSource(ctx, bucket, name, plugin.Version)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		log.Printf("Skipping plugin %s: no source stored in GridFS", name)
+		return nil, errors.New("no source stored")
+	}
+	if err != nil {
+		log.Printf("Error loading plugin %s from GridFS: %v", name, err)
+		return nil, err
+	}
+
+	var script *compiledPlugin
+	if runtime == RuntimeWasm {
+		script, err = app.compileWasmPlugin(name, []byte(source))
+	} else {
+		script, err = compilePlugin(name, source)
+	}
+	if err != nil {
+		log.Printf("Error compiling plugin %s: %v", name, err)
+		return nil, err
+	}
+
+	script.InputSchema, err = compileInputSchema(name, plugin.InputSchema)
+	if err != nil {
+		script.release()
+		log.Printf("Error compiling input schema of plugin %s: %v", name, err)
+		return nil, fmt.Errorf("input_schema: %w", err)
+	}
+	script.Version = plugin.Version
+	script.Dependencies = plugin.Dependencies
+	script.Secrets = plugin.Secrets
+	script.DefaultParams = defaultParams(plugin.DefaultParams)
+	return script, nil
+}
+
+// tenantSuffix names a tenant in log messages; the default tenant goes
+// unnamed.
+func tenantSuffix(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return " for tenant " + tenant
+}
+
+// readPluginSource returns the revision of a plugin's source uploaded as the
+// given version, or the newest one when version is 0. GridFS keeps every
+// upload under the same filename, so other revisions are ignored.
+func readPluginSource(ctx context.Context, bucket *gridfs.Bucket, name string, version int) (string, error) {
+	file, err := findPluginSource(ctx, bucket, name, version)
+	if err != nil {
+		return "", err
+	}
+	stream, err := bucket.OpenDownloadStream(file.ID)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
 
-		app.PluginsMux.Lock()
-		app.Plugins[plugin.Name] = script
-		app.PluginsMux.Unlock()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, stream); err != nil {
+		return "", err
 	}
+	return buf.String(), nil
 }
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// storedFileResponses are the mocked replies to reading one plugin source
+// from GridFS: its file document when it is looked up by version, again when
+// it is opened, then its single chunk. A version of 0 stands for a file
+// uploaded before files recorded their version.
+func storedFileResponses(name, source string, version int) []bson.D {
+	id := primitive.NewObjectID()
+	file := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "filename", Value: name},
+		{Key: "length", Value: int64(len(source))},
+		{Key: "chunkSize", Value: int32(255 * 1024)},
+		{Key: "uploadDate", Value: time.Now()},
+	}
+	if version > 0 {
+		file = append(file, bson.E{Key: "metadata", Value: bson.D{{Key: "version", Value: version}}})
+	}
+	return []bson.D{
+		mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch, file),
+		mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch, file),
+		mtest.CreateCursorResponse(0, "datasciencehub_test.fs.chunks", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "files_id", Value: id},
+			{Key: "n", Value: int32(0)},
+			{Key: "data", Value: primitive.Binary{Data: []byte(source)}},
+		}),
+	}
+}
+
+func TestReloadPluginsMissingSource(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("metadata without a file", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		app.Config.StartupTimeout = time.Second
+		// One worker reads the plugins in the order they are listed
+		app.Config.MaxParallel = 1
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "scale "}, {Key: "version", Value: 3}, {Key: "enabled", Value: true}},
+			bson.D{{Key: "name", Value: "orphan"}, {Key: "version", Value: 1}, {Key: "enabled", Value: true}},
+		))
+		mt.AddMockResponses(storedFileResponses("scale", "input * 2", 3)...)
+		// Neither a file of the version nor one from before versioning
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch),
+		)
+
+		report, err := app.reloadPlugins("")
+		if err != nil {
+			mt.Fatalf("reloadPlugins: %v", err)
+		}
+		want := pluginLoadReport{Loaded: 1, Failed: map[string]string{"orphan": "no source stored"}}
+		if !reflect.DeepEqual(report, want) {
+			mt.Errorf("report = %+v, want %+v", report, want)
+		}
+		scale, ok := app.Plugins[""]["scale"]
+		if !ok || scale.Version != 3 {
+			mt.Fatalf("cached scale = %+v, want version 3", scale)
+		}
+		if result, err := app.runScript(context.Background(), scale, scriptCall{Input: 2}); err != nil || result.Value != int64(4) {
+			mt.Errorf("scale = %v, %v, want 4", result.Value, err)
+		}
+
+		// The source is looked up by the trimmed name and the version
+		mt.GetStartedEvent() // the plugins
+		files := mt.GetStartedEvent()
+		filter := files.Command.Lookup("filter").Document()
+		if filter.Lookup("filename").StringValue() != "scale" || filter.Lookup("metadata.version").AsInt64() != 3 {
+			mt.Errorf("files query = %s, want version 3 of scale", filter)
+		}
+	})
+}
+
+func TestReloadPluginsHandler(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("changed source", func(mt *mtest.T) {
+		app := newTestApp(mt.T)
+		app.MongoClient = mt.Client
+		app.Config.StartupTimeout = time.Second
+		app.Config.MaxParallel = 1
+		// The source stored before the reload, which a run may still hold
+		before := addTestPlugin(mt.T, app, "scale", "input * 2")
+		router := gin.New()
+		router.POST("/plugins/reload", app.reloadPluginsHandler)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "datasciencehub_test.plugins", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "scale"}, {Key: "version", Value: 2}, {Key: "enabled", Value: true}},
+			bson.D{{Key: "name", Value: "broken"}, {Key: "version", Value: 1}, {Key: "enabled", Value: true}},
+		))
+		mt.AddMockResponses(storedFileResponses("scale", "input * 3", 2)...)
+		mt.AddMockResponses(storedFileResponses("broken", "input +", 1)...)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plugins/reload", nil))
+		var body struct {
+			Loaded int               `json:"loaded"`
+			Failed map[string]string `json:"failed"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			mt.Fatalf("response %d %s", w.Code, w.Body.String())
+		}
+		if _, ok := body.Failed["broken"]; body.Loaded != 1 || len(body.Failed) != 1 || !ok {
+			mt.Errorf("report = %+v, want scale loaded and broken failed", body)
+		}
+
+		after, _ := app.lookupPlugin(context.Background(), "scale")
+		for _, tt := range []struct {
+			plugin *compiledPlugin
+			want   int64
+		}{
+			{after, 6},
+			{before, 4},
+		} {
+			result, err := app.runScript(context.Background(), tt.plugin, scriptCall{Input: 2})
+			if err != nil || result.Value != tt.want {
+				mt.Errorf("version %d = %v, %v, want %d", tt.plugin.Version, result.Value, err, tt.want)
+			}
+		}
+	})
+}
+
+func TestReadPluginSource(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	noFile := mtest.CreateCursorResponse(0, "datasciencehub_test.fs.files", mtest.FirstBatch)
+
+	tests := []struct {
+		name      string
+		version   int
+		responses []bson.D
+		want      string
+		wantErr   error
+	}{
+		{"the version", 2, storedFileResponses("scale", "input * 2", 2), "input * 2", nil},
+		{"newest", 0, storedFileResponses("scale", "input * 3", 3), "input * 3", nil},
+		{
+			// Stored before files recorded their version
+			"unversioned file",
+			2,
+			append([]bson.D{noFile}, storedFileResponses("scale", "input * 2", 0)...),
+			"input * 2",
+			nil,
+		},
+		{
+			// Another upload's file, whose own version is not current yet
+			"only another version",
+			2,
+			[]bson.D{noFile, storedFileResponses("scale", "input * 3", 3)[0]},
+			"",
+			gridfs.ErrFileNotFound,
+		},
+		{"no file", 2, []bson.D{noFile, noFile}, "", gridfs.ErrFileNotFound},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			bucket, err := gridfs.NewBucket(mt.DB)
+			if err != nil {
+				mt.Fatal(err)
+			}
+
+			source, err := readPluginSource(context.Background(), bucket, "scale", tt.version)
+			if source != tt.want || !errors.Is(err, tt.wantErr) {
+				mt.Errorf("source = %q, %v, want %q, %v", source, err, tt.want, tt.wantErr)
+			}
+			filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+			if version, ok := filter.Lookup("metadata.version").AsInt64OK(); tt.version > 0 && (!ok || version != int64(tt.version)) {
+				mt.Errorf("files query = %s, want version %d first", filter, tt.version)
+			}
+		})
+	}
+}
+
+// storedPluginSources returns n stored plugins and their sources; every
+// fifth does not compile.
+func storedPluginSources(n int) ([]Plugin, map[string]string) {
+	stored := make([]Plugin, n)
+	sources := make(map[string]string, n)
+	for i := range stored {
+		name := fmt.Sprintf("plugin%03d", i)
+		stored[i] = Plugin{Name: name, Version: 1, Enabled: true}
+		sources[name] = fmt.Sprintf("input + %d", i)
+		if i%5 == 4 {
+			sources[name] = "input +"
+		}
+	}
+	return stored, sources
+}
+
+// loadFromSources loads plugins from sources after delay, which stands in
+// for reading them from GridFS.
+func loadFromSources(sources map[string]string, delay time.Duration) func(Plugin) (*compiledPlugin, error) {
+	return func(plugin Plugin) (*compiledPlugin, error) {
+		time.Sleep(delay)
+		source, ok := sources[plugin.Name]
+		if !ok {
+			return nil, errors.New("no source stored")
+		}
+		return compilePlugin(plugin.Name, source)
+	}
+}
+
+func TestLoadStoredPlugins(t *testing.T) {
+	const workers = 4
+	stored, sources := storedPluginSources(60)
+	// Stored with padding, and without a source
+	stored = append(stored, Plugin{Name: " padded ", Version: 1}, Plugin{Name: "orphan", Version: 1})
+	sources[" padded "] = "input * 2"
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	load := loadFromSources(sources, time.Millisecond)
+	plugins, report := loadStoredPlugins(stored, workers, func(plugin Plugin) (*compiledPlugin, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		return load(plugin)
+	})
+
+	wantFailed := []string{"orphan"}
+	for i := 4; i < 60; i += 5 {
+		wantFailed = append(wantFailed, fmt.Sprintf("plugin%03d", i))
+	}
+	failed := slices.Sorted(maps.Keys(report.Failed))
+	slices.Sort(wantFailed)
+	if !slices.Equal(failed, wantFailed) {
+		t.Errorf("failed = %v, want %v", failed, wantFailed)
+	}
+	if report.Loaded != 49 || len(plugins) != 49 {
+		t.Errorf("loaded %d, %d plugins, want 49", report.Loaded, len(plugins))
+	}
+
+	app := newTestApp(t)
+	for i, plugin := range stored[:60] {
+		if i%5 == 4 {
+			continue
+		}
+		script, ok := plugins[plugin.Name]
+		if !ok {
+			t.Errorf("%s was not loaded", plugin.Name)
+			continue
+		}
+		if result, err := app.runScript(context.Background(), script, scriptCall{Input: 1}); err != nil || result.Value != int64(1+i) {
+			t.Errorf("%s = %v, %v, want %d", plugin.Name, result.Value, err, 1+i)
+		}
+	}
+	if _, ok := plugins["padded"]; !ok {
+		t.Error("padded was not loaded by its trimmed name")
+	}
+	if peak < 2 || peak > workers {
+		t.Errorf("%d plugins loaded at once, want between 2 and %d", peak, workers)
+	}
+}
+
+// BenchmarkReloadPlugins compares loading plugins one at a time with the
+// worker pool reloadPlugins uses, for reads taking about a millisecond.
+func BenchmarkReloadPlugins(b *testing.B) {
+	stored, sources := storedPluginSources(100)
+	for _, workers := range []int{1, 10} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			load := loadFromSources(sources, time.Millisecond)
+			for i := 0; i < b.N; i++ {
+				if _, report := loadStoredPlugins(stored, workers, load); report.Loaded != 80 {
+					b.Fatalf("loaded %d plugins, want 80", report.Loaded)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/dop251/goja"
+)
+
+// installRandom binds uuid() and random(). They draw from vm.random when the
+// run was seeded and from the system sources otherwise: crypto/rand for
+// uuid, math/rand for random.
+func installRandom(vm *ScriptVM) {
+	vm.Set("uuid", func() string {
+		var b [16]byte
+		if vm.random != nil {
+			for i := range b {
+				b[i] = byte(vm.random.Uint32())
+			}
+		} else if _, err := cryptorand.Read(b[:]); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		b[6] = b[6]&0x0f | 0x40 // version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	})
+	vm.Set("random", func() float64 {
+		if vm.random != nil {
+			return vm.random.Float64()
+		}
+		return rand.Float64()
+	})
+}
+
+// seedRandom makes uuid(), random() and Math.random repeat the same sequence
+// for runs with the same integer params.seed. Without a seed they are
+// unpredictable.
+func (vm *ScriptVM) seedRandom(params map[string]interface{}) {
+	seed, ok := randomSeed(params["seed"])
+	if !ok {
+		vm.random = nil
+		vm.SetRandSource(rand.Float64)
+		return
+	}
+	vm.random = rand.New(rand.NewPCG(seed, seed))
+	vm.SetRandSource(goja.RandSource(vm.random.Float64))
+}
+
+func randomSeed(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), true
+	case int64:
+		return uint64(v), true
+	case float64:
+		if v == float64(int64(v)) {
+			return uint64(int64(v)), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUID(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "ids", "var ids = []; for (var i = 0; i < 1000; i++) ids.push(uuid()); ids")
+
+	seen := make(map[string]bool)
+	for run := 0; run < 2; run++ {
+		result, err := app.runScript(context.Background(), plugin, scriptCall{})
+		if err != nil {
+			t.Fatalf("runScript: %v", err)
+		}
+		for _, id := range normalizeJSON(result.Value).([]interface{}) {
+			id := id.(string)
+			if !uuidPattern.MatchString(id) {
+				t.Fatalf("uuid() = %q, want a version 4 UUID", id)
+			}
+			if seen[id] {
+				t.Fatalf("uuid() repeated %s", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestSeededRandom(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "draw", "[uuid(), random(), Math.random(), random()]")
+	run := func(params map[string]interface{}) []interface{} {
+		t.Helper()
+		result, err := app.runScript(context.Background(), plugin, scriptCall{Params: params})
+		if err != nil {
+			t.Fatalf("runScript: %v", err)
+		}
+		return normalizeJSON(result.Value).([]interface{})
+	}
+
+	tests := []struct {
+		name     string
+		a, b     map[string]interface{}
+		wantSame bool
+	}{
+		{"same seed", map[string]interface{}{"seed": 42}, map[string]interface{}{"seed": 42.0}, true},
+		{"different seeds", map[string]interface{}{"seed": 42}, map[string]interface{}{"seed": 43}, false},
+		{"no seed", nil, nil, false},
+		{"fractional seed ignored", map[string]interface{}{"seed": 0.5}, map[string]interface{}{"seed": 0.5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := run(tt.a), run(tt.b)
+			if !uuidPattern.MatchString(a[0].(string)) {
+				t.Errorf("uuid() = %q, want a version 4 UUID", a[0])
+			}
+			if same := reflect.DeepEqual(a, b); same != tt.wantSame {
+				t.Errorf("runs drew %v and %v, want same = %t", a, b, tt.wantSame)
+			}
+		})
+	}
+}
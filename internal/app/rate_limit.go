@@ -0,0 +1,102 @@
+package app
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Limiters idle for longer than limiterIdleTTL are forgotten; the map is
+// swept at most once per limiterSweepInterval.
+const (
+	limiterIdleTTL       = 10 * time.Minute
+	limiterSweepInterval = time.Minute
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter hands out one token bucket per client.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		clients:   make(map[string]*clientLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+// reserve takes a token for client and returns how long the client has to
+// wait before the request would be allowed; zero means go ahead.
+func (l *rateLimiter) reserve(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > limiterSweepInterval {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// rateLimit limits each API key, or each client IP for requests without a
+// valid key, to RateLimit requests per second with bursts of RateBurst.
+// Without a RateBurst the burst is one second's worth of requests.
+func (app *AppContext) rateLimit() gin.HandlerFunc {
+	if app.Config.RateLimit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	burst := app.Config.RateBurst
+	if burst < 1 {
+		burst = int(math.Ceil(app.Config.RateLimit))
+	}
+
+	limiter := newRateLimiter(app.Config.RateLimit, burst)
+	return func(c *gin.Context) {
+		client := "ip:" + c.ClientIP()
+		if apiKey, ok := app.lookupAPIKey(requestAPIKey(c)); ok {
+			client = "key:" + apiKey.Key
+		}
+
+		if delay := limiter.reserve(client); delay > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := newRateLimiter(1, 2)
+
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve("a"); delay != 0 {
+			t.Fatalf("request %d within the burst delayed %s", i+1, delay)
+		}
+	}
+	first := l.reserve("a")
+	if first <= 0 || first > time.Second {
+		t.Fatalf("request over the burst delayed %s, want up to 1s", first)
+	}
+	// Refused requests take no token, so the wait does not grow
+	if again := l.reserve("a"); again <= 0 || again > first {
+		t.Errorf("refused request retried after %s, want up to %s", again, first)
+	}
+
+	if delay := l.reserve("b"); delay != 0 {
+		t.Errorf("another client delayed %s", delay)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		limit     float64
+		burst     int
+		requests  []string
+		wantCodes []int
+	}{
+		{"disabled", 0, 0, []string{"", "", "", ""}, []int{200, 200, 200, 200}},
+		{"burst then refused", 1, 2, []string{"", "", ""}, []int{200, 200, 429}},
+		{"burst defaults to the rate", 2, 0, []string{"", "", ""}, []int{200, 200, 429}},
+		{"keys limited apart from the IP", 1, 1, []string{"", "", "k1", "k1", "k2"}, []int{200, 429, 200, 429, 200}},
+		{"unknown keys limited by IP", 1, 1, []string{"", "bogus"}, []int{200, 429}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{
+				RateLimit: tt.limit,
+				RateBurst: tt.burst,
+				APIKeys:   []APIKey{{Key: "k1", Role: RoleReader}, {Key: "k2", Role: RoleReader}},
+			}}
+			router := gin.New()
+			router.Use(app.rateLimit())
+			router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i, key := range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+				if key != "" {
+					req.Header.Set("X-API-Key", key)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != tt.wantCodes[i] {
+					t.Fatalf("request %d: status %d, want %d", i+1, w.Code, tt.wantCodes[i])
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+					t.Errorf("request %d: Retry-After %q, want 1", i+1, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxRequestIDLength = 128
+
+// requestID tags every request with an ID, taken from the caller's
+// X-Request-ID header when it sends a usable one and generated otherwise.
+// The ID is echoed in the X-Request-ID response header and stored in the
+// context as request_id.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			var b [16]byte
+			if _, err := cryptorand.Read(b[:]); err == nil {
+				id = hex.EncodeToString(b[:])
+			} else {
+				id = ""
+			}
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts short IDs made of printable ASCII, so that a
+// caller's ID can go into logs and headers as it is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// errInternal is reported in place of a recovered panic.
+var errInternal = errors.New("internal error")
+
+// recoverAsError, deferred directly, turns a panic into *err, logging the
+// panic value and stack under label. Work outside a request, such as task
+// steps and async jobs, uses it so one bad input cannot crash the server.
+func recoverAsError(label string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("panic in %s: %v\n%s", label, r, debug.Stack())
+	*err = errInternal
+}
+
+// recoverPanics turns a panicking handler into a JSON 500. The panic value
+// and stack are logged with the request ID; the client only gets the ID, to
+// quote when reporting the failure.
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// net/http's way of dropping a connection; let it through
+				panic(r)
+			}
+
+			id := c.GetString("request_id")
+			log.Printf("panic serving %s %s (request %s): %v\n%s", c.Request.Method, c.Request.URL.Path, id, r, debug.Stack())
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal server error",
+				"code":       "internal_error",
+				"request_id": id,
+			})
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestID(), recoverPanics())
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	router.GET("/partial", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+	router.GET("/ok", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	tests := []struct {
+		path      string
+		requestID string
+		wantCode  int
+		wantBody  string
+	}{
+		{"/panic", "req-1", http.StatusInternalServerError, ""},
+		{"/panic", "", http.StatusInternalServerError, ""},
+		{"/partial", "req-2", http.StatusOK, "partial"},
+		{"/ok", "req-3", http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			id := w.Header().Get("X-Request-ID")
+			if tt.requestID != "" && id != tt.requestID {
+				t.Errorf("X-Request-ID = %q, want %q", id, tt.requestID)
+			}
+			if tt.wantBody != "" {
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+				}
+				return
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if body["code"] != "internal_error" || body["request_id"] != id || id == "" {
+				t.Errorf("body = %v, want internal_error with request ID %q", body, id)
+			}
+			if strings.Contains(w.Body.String(), "boom") {
+				t.Errorf("body %q leaks the panic value", w.Body)
+			}
+		})
+	}
+}
+
+func TestRecoverPanicsAbortHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(recoverPanics())
+	router.GET("/abort", func(c *gin.Context) { panic(http.ErrAbortHandler) })
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", r)
+		}
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+}
+
+func TestRecoverAsError(t *testing.T) {
+	run := func() (err error) {
+		defer recoverAsError("test", &err)
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	}
+	if err := run(); !errors.Is(err, errInternal) {
+		t.Errorf("err = %v, want %v", err, errInternal)
+	}
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// resultCache keeps the most recently used plugin results in memory for a
+// limited time.
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedResult struct {
+	key     string
+	result  scriptResult
+	expires time.Time
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (rc *resultCache) get(key string) (scriptResult, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, ok := rc.entries[key]
+	if !ok {
+		return scriptResult{}, false
+	}
+	entry := elem.Value.(*cachedResult)
+	if time.Now().After(entry.expires) {
+		rc.order.Remove(elem)
+		delete(rc.entries, key)
+		return scriptResult{}, false
+	}
+	rc.order.MoveToFront(elem)
+	return entry.result, true
+}
+
+// put stores a result, evicting the least recently used one when full.
+func (rc *resultCache) put(key string, result scriptResult) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	expires := time.Now().Add(rc.ttl)
+	if elem, ok := rc.entries[key]; ok {
+		entry := elem.Value.(*cachedResult)
+		entry.result, entry.expires = result, expires
+		rc.order.MoveToFront(elem)
+		return
+	}
+
+	rc.entries[key] = rc.order.PushFront(&cachedResult{key: key, result: result, expires: expires})
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cachedResult).key)
+	}
+}
+
+// resultCacheKey hashes everything an execution's result depends on: the
+// plugin's tenant, the plugin and dependency versions, the input and the
+// params. JSON encoding
+// sorts object keys, so equal inputs hash alike.
+func (app *AppContext) resultCacheKey(plugin *compiledPlugin, input interface{}, params map[string]interface{}) (string, error) {
+	deps, err := app.pluginDependencies(plugin)
+	if err != nil {
+		return "", err
+	}
+	versions := make([]string, len(deps))
+	for i, dep := range deps {
+		versions[i] = fmt.Sprintf("%s@%d", dep.Name, dep.Version)
+	}
+
+	data, err := json.Marshal([]interface{}{plugin.Tenant, plugin.Name, plugin.Version, versions, input, params})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
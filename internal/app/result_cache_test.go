@@ -0,0 +1,78 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	cache := newResultCache(2, time.Hour)
+	cache.put("a", scriptResult{Value: 1})
+	cache.put("b", scriptResult{Value: 2})
+
+	// Reading a makes b the least recently used
+	if got, ok := cache.get("a"); !ok || got.Value != 1 {
+		t.Fatalf("get a = %v, %v", got.Value, ok)
+	}
+	cache.put("c", scriptResult{Value: 3})
+	if _, ok := cache.get("b"); ok {
+		t.Error("b survived eviction")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := cache.get(key); !ok || got.Value != want {
+			t.Errorf("get %s = %v, %v, want %d", key, got.Value, ok, want)
+		}
+	}
+
+	cache.put("a", scriptResult{Value: 10})
+	if got, _ := cache.get("a"); got.Value != 10 {
+		t.Errorf("get a = %v after replacing it, want 10", got.Value)
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	cache := newResultCache(10, 20*time.Millisecond)
+	cache.put("a", scriptResult{Value: 1})
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := cache.get("a"); ok {
+		t.Error("expired result still served")
+	}
+	if len(cache.entries) != 0 || cache.order.Len() != 0 {
+		t.Error("expired result still held")
+	}
+}
+
+func TestResultCacheKey(t *testing.T) {
+	app := NewAppContext()
+	plugin := &compiledPlugin{Name: "scale", Version: 1}
+	key := func(p *compiledPlugin, input interface{}, params map[string]interface{}) string {
+		t.Helper()
+		k, err := app.resultCacheKey(p, input, params)
+		if err != nil {
+			t.Fatalf("resultCacheKey: %v", err)
+		}
+		return k
+	}
+
+	base := key(plugin, map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"factor": 2})
+	if same := key(plugin, map[string]interface{}{"b": 2, "a": 1}, map[string]interface{}{"factor": 2}); same != base {
+		t.Error("equal inputs hash differently")
+	}
+
+	tests := []struct {
+		name   string
+		plugin *compiledPlugin
+		input  interface{}
+		params map[string]interface{}
+	}{
+		{"other input", plugin, map[string]interface{}{"a": 1, "b": 3}, map[string]interface{}{"factor": 2}},
+		{"other params", plugin, map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"factor": 3}},
+		{"other version", &compiledPlugin{Name: "scale", Version: 2}, map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"factor": 2}},
+		{"other tenant", &compiledPlugin{Name: "scale", Version: 1, Tenant: "acme"}, map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"factor": 2}},
+	}
+	for _, tt := range tests {
+		if key(tt.plugin, tt.input, tt.params) == base {
+			t.Errorf("%s: same key as the original run", tt.name)
+		}
+	}
+}
@@ -7,26 +7,73 @@ import (
 )
 
 func (app *AppContext) initRouter() {
-	app.Router = gin.Default()
+	app.Router = gin.New()
+	app.Router.Use(requestID(), app.traceRequests(), gin.Logger(), recoverPanics())
 	app.Router.Use(func(c *gin.Context) {
 		c.Set("start", time.Now())
 		c.Next()
 	})
+	app.Router.Use(app.limitRequestBody())
 
-	api := app.Router.Group("/api/v1")
+	// Probes stay outside /api/v1 and never require an API key
+	app.Router.GET("/health", app.health)
+	app.Router.GET("/ready", app.ready)
+
+	api := app.Router.Group("/api/v1", app.rateLimit())
 	{
+		reader := app.requireRole(RoleReader)
+		executor := app.requireRole(RoleExecutor)
+		admin := app.requireRole(RoleAdmin)
+
+		api.GET("/version", reader, app.getVersion)
+		api.GET("/stats", reader, app.getStats)
+
 		// Data Jobs
-		api.POST("/data/upload", app.uploadData)
-		api.POST("/data/process", app.processData)
-		api.GET("/data/jobs", app.listJobs)
-		api.GET("/data/jobs/:id", app.getJob)
-		api.POST("/data/process/yaml", app.processYamlTask)
+		api.POST("/data/upload", executor, app.uploadData)
+		api.POST("/data/upload/stream", executor, app.uploadDataStream)
+		api.POST("/data/blobs", executor, app.uploadBlob)
+		api.POST("/data/process", executor, app.processData)
+		api.GET("/data/jobs", reader, app.listJobs)
+		api.GET("/data/jobs/compare", reader, app.compareJobs)
+		api.GET("/data/jobs/search", reader, app.searchJobs)
+		api.GET("/data/jobs/:id", reader, app.getJob)
+		api.GET("/data/jobs/:id/results.csv", reader, app.exportResultsCSV)
+		api.GET("/data/jobs/:id/input", reader, app.previewJobInput)
+		api.GET("/data/jobs/:id/events", reader, app.streamJobEvents)
+		api.POST("/data/jobs/:id/cancel", executor, app.cancelJob)
+		api.POST("/data/process/yaml", executor, app.processYamlTask)
+		api.POST("/data/process/yaml/validate", executor, app.validateYamlTask)
+		api.POST("/data/process/task", executor, app.processTask)
+
+		// Tasks
+		api.GET("/tasks", reader, app.listTasks)
+		api.GET("/tasks/scheduled", reader, app.listScheduledTasks)
+		api.GET("/tasks/:name", reader, app.getTask)
+		api.POST("/tasks/:name/run", executor, app.runStoredTask)
+
+		// Audit
+		api.GET("/executions", admin, app.listExecutions)
+
+		// Secrets
+		api.GET("/secrets", admin, app.listSecrets)
+		api.PUT("/secrets/:name", admin, app.putSecret)
+		api.DELETE("/secrets/:name", admin, app.deleteSecret)
 
 		// Plugins
-		api.POST("/plugins", app.uploadPlugin)
-		api.GET("/plugins", app.listPlugins)
-		api.GET("/plugins/:name", app.getPlugin)
-		api.DELETE("/plugins/:name", app.deletePlugin)
-		api.POST("/plugins/:name/execute", app.executePlugin)
+		api.POST("/plugins", admin, app.uploadPlugin)
+		api.POST("/plugins/reload", admin, app.reloadPluginsHandler)
+		api.POST("/plugins/import", admin, app.importPlugins)
+		api.GET("/plugins", reader, app.listPlugins)
+		api.GET("/plugins/export", reader, app.exportPlugins)
+		api.GET("/plugins/:name", reader, app.getPlugin)
+		api.GET("/plugins/:name/metadata", reader, app.getPluginMetadata)
+		api.GET("/plugins/:name/versions", reader, app.listPluginVersions)
+		api.PATCH("/plugins/:name", admin, app.updatePlugin)
+		api.DELETE("/plugins/:name", admin, app.deletePlugin)
+		api.POST("/plugins/:name/execute", executor, app.executePlugin)
+		api.POST("/plugins/:name/execute-batch", executor, app.executePluginBatch)
+		api.POST("/plugins/:name/test", executor, app.testPlugin)
+		api.POST("/plugins/:name/benchmark", executor, app.benchmarkPlugin)
+		api.POST("/plugins/:name/lint", executor, app.lintStoredPlugin)
 	}
 }
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+)
+
+// disabledGlobals are removed from every runtime unless a deployment lists
+// them in sandbox_allow_globals. goja has no timers of its own; they are
+// listed so that a host binding one cannot slip past the sandbox.
+var disabledGlobals = []string{
+	"eval",
+	"Function",
+	"setTimeout",
+	"setInterval",
+	"setImmediate",
+	"clearTimeout",
+	"clearInterval",
+	"clearImmediate",
+}
+
+// hardenRuntime removes the disabled globals that are not in allowed. When
+// Function is removed, the constructor reachable through every kind of
+// function's prototype is replaced as well, so that
+// (function(){}).constructor("...") cannot compile code either.
+func hardenRuntime(vm *goja.Runtime, allowed map[string]bool) {
+	global := vm.GlobalObject()
+	for _, name := range disabledGlobals {
+		if allowed[name] {
+			continue
+		}
+		if name == "Function" {
+			disableFunctionConstructors(vm)
+		}
+		global.Delete(name)
+	}
+}
+
+func disableFunctionConstructors(vm *goja.Runtime) {
+	blocked := vm.ToValue(func(goja.FunctionCall) goja.Value {
+		panic(vm.NewTypeError("the Function constructor is not available in the plugin sandbox"))
+	})
+
+	prototypes, err := vm.RunString(`[
+		Object.getPrototypeOf(function () {}),
+		Object.getPrototypeOf(async function () {}),
+		Object.getPrototypeOf(function* () {}),
+	]`)
+	if err != nil {
+		panic(fmt.Sprintf("sandbox: reading function prototypes: %v", err))
+	}
+	list := prototypes.ToObject(vm)
+	for _, key := range list.Keys() {
+		proto := list.Get(key).ToObject(vm)
+		proto.DefineDataProperty("constructor", blocked, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	}
+}
+
+// validateSandboxAllow checks that every name in sandbox_allow_globals is one
+// the sandbox disables.
+func validateSandboxAllow(names []string) error {
+	for _, name := range names {
+		known := false
+		for _, disabled := range disabledGlobals {
+			if name == disabled {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("sandbox_allow_globals: %q is not a disabled global", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func TestHardenRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		source  string
+		want    interface{}
+		wantErr string
+	}{
+		{"eval removed", nil, "typeof eval", "undefined", ""},
+		{"Function removed", nil, "typeof Function", "undefined", ""},
+		{"timers removed", nil, "typeof setTimeout + typeof setInterval", "undefinedundefined", ""},
+		{"function constructor", nil, `(function () {}).constructor("return 1")()`, nil, "not available in the plugin sandbox"},
+		{"async function constructor", nil, `(async function () {}).constructor("return 1")`, nil, "not available in the plugin sandbox"},
+		{"generator constructor", nil, `(function* () {}).constructor("yield 1")`, nil, "not available in the plugin sandbox"},
+		{"constructor not writable", nil, `var f = function () {}; Object.getPrototypeOf(f).constructor = null; typeof f.constructor`, "function", ""},
+		{"JSON and Math kept", nil, `JSON.stringify({v: Math.max(1, 2)})`, `{"v":2}`, ""},
+		{"eval allowed", []string{"eval"}, `eval("1 + 1")`, int64(2), ""},
+		{"Function allowed", []string{"Function"}, `(function () {}).constructor("return 3")()`, int64(3), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := make(map[string]bool)
+			for _, name := range tt.allowed {
+				allowed[name] = true
+			}
+			vm := goja.New()
+			hardenRuntime(vm, allowed)
+
+			value, err := vm.RunString(tt.source)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got := value.Export(); got != tt.want {
+				t.Errorf("result = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSandboxAllow(t *testing.T) {
+	if err := validateSandboxAllow([]string{"eval", "setTimeout"}); err != nil {
+		t.Errorf("disabled globals: %v", err)
+	}
+	if err := validateSandboxAllow([]string{"eval", "require"}); err == nil || !strings.Contains(err.Error(), `"require"`) {
+		t.Errorf("err = %v, want require refused", err)
+	}
+}
@@ -0,0 +1,328 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// schedulerTick is how often the scheduler looks for due tasks, and so how
+// late a scheduled run may start.
+const schedulerTick = 10 * time.Second
+
+// scheduledRunsCollection holds a claim for every scheduled run started, so
+// that each run happens once however many instances share the database.
+// Claims expire after scheduleClaimTTL.
+const (
+	scheduledRunsCollection = "scheduled_runs"
+	scheduleClaimTTL        = 7 * 24 * time.Hour
+)
+
+// schedule parses the task's cron schedule; nil when it has none.
+func (task TaskDefinition) schedule() (*cronSchedule, error) {
+	if task.Schedule == "" {
+		return nil, nil
+	}
+	schedule, err := parseCron(task.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", task.Schedule)
+	}
+	return schedule, nil
+}
+
+// scheduledRun is the state of one scheduled task, as listed by
+// /tasks/scheduled.
+type scheduledRun struct {
+	Task      string      `json:"task"`
+	Schedule  string      `json:"schedule"`
+	NextRun   time.Time   `json:"next_run"`
+	LastRun   *time.Time  `json:"last_run,omitempty"`
+	LastJobID interface{} `json:"last_job_id,omitempty"`
+	LastError string      `json:"last_error,omitempty"`
+	Running   bool        `json:"running"`
+}
+
+// taskScheduler runs stored tasks whose latest definition has a schedule,
+// each time it comes due, through runTaskJob. Every tenant's tasks are
+// scheduled, each run working on its own tenant's database.
+type taskScheduler struct {
+	app *AppContext
+	// now is the scheduler's clock; tests replace it to step through time.
+	now func() time.Time
+
+	mu sync.Mutex
+	// runs is keyed by scheduledRunKey.
+	runs map[string]*scheduledRun
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newTaskScheduler(app *AppContext) *taskScheduler {
+	return &taskScheduler{
+		app:  app,
+		now:  time.Now,
+		runs: make(map[string]*scheduledRun),
+	}
+}
+
+// startScheduler starts checking for due tasks every schedulerTick until
+// Close is called.
+func (app *AppContext) startScheduler() {
+	s := newTaskScheduler(app)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			s.tick(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	app.Scheduler = s
+}
+
+// stopScheduler stops the scheduler, interrupting the scheduled runs in
+// progress, and waits for them to return. It does nothing when the
+// scheduler is disabled.
+func (app *AppContext) stopScheduler() {
+	if app.Scheduler == nil {
+		return
+	}
+	app.Scheduler.cancel()
+	app.Scheduler.wg.Wait()
+}
+
+func scheduledRunKey(tenant, name string) string {
+	return tenant + "/" + name
+}
+
+// tick starts every scheduled task of every tenant that is due.
+func (s *taskScheduler) tick(ctx context.Context) {
+	for _, tenant := range s.app.Config.tenants() {
+		s.tickTenant(withTenant(ctx, tenant))
+	}
+}
+
+// tickTenant starts the scheduled tasks of ctx's tenant that are due.
+func (s *taskScheduler) tickTenant(ctx context.Context) {
+	tenant := tenantOf(ctx)
+	queryCtx, cancel := context.WithTimeout(ctx, s.app.Config.DBTimeout)
+	defer cancel()
+	tasks, err := s.app.scheduledTasks(queryCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Scheduler: failed to load scheduled tasks%s: %v", tenantSuffix(tenant), err)
+		}
+		return
+	}
+
+	for _, run := range s.dueRuns(tenant, tasks) {
+		s.wg.Add(1)
+		go s.execute(ctx, run.task, run.due)
+	}
+}
+
+// dueRun is a scheduled task to run now, and the time it was due at.
+type dueRun struct {
+	task TaskDefinition
+	due  time.Time
+}
+
+// dueRuns brings the state of tenant's scheduled tasks up to the scheduler's
+// clock and returns the runs that are due, marking their tasks running. A
+// task seen for the first time, or whose schedule changed, waits for its
+// next due time; runs missed while the server was down are not caught up.
+// Tasks no longer scheduled are forgotten once they are not running.
+func (s *taskScheduler) dueRuns(tenant string, tasks []TaskDefinition) []dueRun {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []dueRun
+	current := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		schedule, err := task.schedule()
+		if err != nil {
+			log.Printf("Scheduler: task %s%s: %v", task.Name, tenantSuffix(tenant), err)
+			continue
+		}
+		key := scheduledRunKey(tenant, task.Name)
+		current[key] = true
+
+		run, ok := s.runs[key]
+		if !ok {
+			run = &scheduledRun{Task: task.Name}
+			s.runs[key] = run
+		}
+		if !ok || run.Schedule != task.Schedule {
+			run.Schedule = task.Schedule
+			run.NextRun = schedule.next(now)
+			continue
+		}
+		if now.Before(run.NextRun) {
+			continue
+		}
+
+		dueAt := run.NextRun
+		run.NextRun = schedule.next(now)
+		if run.Running {
+			log.Printf("Scheduler: skipping task %s%s, its previous run is still in progress", task.Name, tenantSuffix(tenant))
+			continue
+		}
+		run.Running = true
+		due = append(due, dueRun{task: task, due: dueAt})
+	}
+
+	prefix := scheduledRunKey(tenant, "")
+	for key, run := range s.runs {
+		if strings.HasPrefix(key, prefix) && !current[key] && !run.Running {
+			delete(s.runs, key)
+		}
+	}
+	return due
+}
+
+// execute runs the scheduled task of ctx's tenant due at due and records the
+// outcome, unless another instance claimed that run first.
+func (s *taskScheduler) execute(ctx context.Context, task TaskDefinition, due time.Time) {
+	defer s.wg.Done()
+	tenant := tenantOf(ctx)
+
+	claimed, err := s.app.claimScheduledRun(ctx, task.Name, due)
+	if !claimed {
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Scheduler: failed to claim task %s%s: %v", task.Name, tenantSuffix(tenant), err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if run, ok := s.runs[scheduledRunKey(tenant, task.Name)]; ok {
+			run.Running = false
+		}
+		return
+	}
+
+	started := s.now()
+	result, err := func() (result taskRun, err error) {
+		defer recoverAsError("scheduled task "+task.Name, &err)
+		return s.app.runTaskJob(ctx, task)
+	}()
+	if err != nil {
+		log.Printf("Scheduler: task %s%s failed: %v", task.Name, tenantSuffix(tenant), err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[scheduledRunKey(tenant, task.Name)]
+	if !ok {
+		return
+	}
+	run.Running = false
+	run.LastRun = &started
+	run.LastJobID = result.JobID
+	run.LastError = ""
+	if err != nil {
+		run.LastError = err.Error()
+	}
+}
+
+// claimScheduledRun claims the run of a task of ctx's tenant due at due. It
+// returns false when another instance already claimed it.
+func (app *AppContext) claimScheduledRun(ctx context.Context, task string, due time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.Config.DBTimeout)
+	defer cancel()
+
+	claim := bson.M{"task": task, "run_at": due, "claimed_at": time.Now()}
+	_, err := app.database(ctx).Collection(scheduledRunsCollection).InsertOne(ctx, claim)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lookup returns a copy of the scheduler's state for a tenant's task.
+func (s *taskScheduler) lookup(tenant, name string) (scheduledRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[scheduledRunKey(tenant, name)]
+	if !ok {
+		return scheduledRun{}, false
+	}
+	return *run, true
+}
+
+// scheduledTasks loads the stored tasks whose latest definition has a
+// schedule. Submitting a task again without one unschedules it.
+func (app *AppContext) scheduledTasks(ctx context.Context) ([]TaskDefinition, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$name", "task": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$task"}}},
+		{{Key: "$match", Value: bson.M{"schedule": bson.M{"$nin": bson.A{nil, ""}}}}},
+	}
+	collection := app.database(ctx).Collection("tasks")
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]TaskDefinition, 0)
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		tasks[i].normalize()
+	}
+	return tasks, nil
+}
+
+// listScheduledTasks lists the caller's scheduled tasks by their next run. The last
+// run is only known when the scheduler runs in this process.
+func (app *AppContext) listScheduledTasks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	tasks, err := app.scheduledTasks(ctx)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	runs := make([]scheduledRun, 0, len(tasks))
+	for _, task := range tasks {
+		schedule, err := task.schedule()
+		if err != nil {
+			continue
+		}
+		run := scheduledRun{Task: task.Name, Schedule: task.Schedule, NextRun: schedule.next(now)}
+		if app.Scheduler != nil {
+			if known, ok := app.Scheduler.lookup(tenantOf(ctx), task.Name); ok && known.Schedule == task.Schedule {
+				run = known
+			}
+		}
+		runs = append(runs, run)
+	}
+	slices.SortFunc(runs, func(a, b scheduledRun) int { return a.NextRun.Compare(b.NextRun) })
+
+	c.JSON(200, gin.H{"scheduled": runs, "enabled": app.Scheduler != nil})
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDueRuns(t *testing.T) {
+	s := newTaskScheduler(&AppContext{})
+	var now time.Time
+	s.now = func() time.Time { return now }
+
+	hourly := []TaskDefinition{{Name: "report", Schedule: "0 * * * *"}}
+	daily := []TaskDefinition{{Name: "report", Schedule: "@daily"}}
+	base := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	steps := []struct {
+		name    string
+		at      time.Duration
+		tasks   []TaskDefinition
+		finish  bool
+		wantDue []time.Duration
+		wantRun time.Duration
+	}{
+		{name: "first seen waits", at: 0, tasks: hourly, wantRun: 30 * time.Minute},
+		{name: "not yet due", at: 29 * time.Minute, tasks: hourly, wantRun: 30 * time.Minute},
+		{name: "due", at: 30*time.Minute + 5*time.Second, tasks: hourly, wantDue: []time.Duration{30 * time.Minute}, wantRun: 90 * time.Minute},
+		{name: "skipped while running", at: 90*time.Minute + 5*time.Second, tasks: hourly, wantRun: 150 * time.Minute},
+		{name: "missed runs are not caught up", at: 5 * time.Hour, tasks: hourly, finish: true, wantDue: []time.Duration{150 * time.Minute}, wantRun: 330 * time.Minute},
+		{name: "changed schedule waits", at: 6 * time.Hour, tasks: daily, finish: true, wantRun: 13*time.Hour + 30*time.Minute},
+	}
+	for _, step := range steps {
+		now = base.Add(step.at)
+		if step.finish {
+			s.runs[scheduledRunKey("", "report")].Running = false
+		}
+		due := s.dueRuns("", step.tasks)
+		if len(due) != len(step.wantDue) {
+			t.Fatalf("%s: %d runs due, want %d", step.name, len(due), len(step.wantDue))
+		}
+		for i, run := range due {
+			if want := base.Add(step.wantDue[i]); !run.due.Equal(want) || run.task.Name != "report" {
+				t.Errorf("%s: run of %s due at %s, want report at %s", step.name, run.task.Name, run.due, want)
+			}
+		}
+		run, ok := s.lookup("", "report")
+		if !ok {
+			t.Fatalf("%s: task not tracked", step.name)
+		}
+		if want := base.Add(step.wantRun); !run.NextRun.Equal(want) {
+			t.Errorf("%s: next run %s, want %s", step.name, run.NextRun, want)
+		}
+	}
+
+	// A task no longer scheduled is forgotten once it is not running
+	s.runs[scheduledRunKey("", "report")].Running = true
+	s.dueRuns("", nil)
+	if _, ok := s.lookup("", "report"); !ok {
+		t.Fatal("running task forgotten")
+	}
+	s.runs[scheduledRunKey("", "report")].Running = false
+	s.dueRuns("", nil)
+	if _, ok := s.lookup("", "report"); ok {
+		t.Fatal("unscheduled task still tracked")
+	}
+}
+
+func TestSchedulerDueRunsPerTenant(t *testing.T) {
+	s := newTaskScheduler(&AppContext{})
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	tasks := []TaskDefinition{{Name: "report", Schedule: "0 * * * *"}}
+	s.dueRuns("acme", tasks)
+	s.dueRuns("globex", tasks)
+
+	// Dropping the task of one tenant leaves the other's alone
+	s.dueRuns("acme", nil)
+	if _, ok := s.lookup("acme", "report"); ok {
+		t.Error("acme's task still tracked")
+	}
+	if _, ok := s.lookup("globex", "report"); !ok {
+		t.Error("globex's task forgotten")
+	}
+
+	now = now.Add(time.Hour)
+	if due := s.dueRuns("globex", tasks); len(due) != 1 {
+		t.Errorf("%d runs due for globex, want 1", len(due))
+	}
+}
+
+func TestSchedulerEveryAgreesAcrossInstances(t *testing.T) {
+	// Two instances first see the task 40 minutes apart; runs are claimed by
+	// task and due time, so they must compute the same due times to share
+	// the claim of each run
+	tasks := []TaskDefinition{{Name: "sync", Schedule: "@every 1h"}}
+	start := time.Date(2024, 1, 1, 10, 7, 13, 0, time.UTC)
+	offsets := []time.Duration{0, 40 * time.Minute}
+
+	dueAt := make([][]time.Time, len(offsets))
+	for i, offset := range offsets {
+		s := newTaskScheduler(&AppContext{})
+		now := start.Add(offset)
+		s.now = func() time.Time { return now }
+		s.dueRuns("", tasks)
+
+		for now = now.Add(schedulerTick); now.Before(start.Add(4 * time.Hour)); now = now.Add(schedulerTick) {
+			for _, run := range s.dueRuns("", tasks) {
+				dueAt[i] = append(dueAt[i], run.due)
+				s.runs[scheduledRunKey("", "sync")].Running = false
+			}
+		}
+	}
+
+	want := []time.Time{
+		time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+	}
+	for i, got := range dueAt {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("instance started at +%s ran at %v, want %v", offsets[i], got, want)
+		}
+	}
+}
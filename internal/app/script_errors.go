@@ -0,0 +1,56 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dop251/goja"
+)
+
+// scriptException describes an exception thrown by a plugin: the thrown
+// value, where it was thrown from and the JavaScript call stack, innermost
+// frame first. File is the plugin, or the dependency, whose source Line and
+// Column point into.
+type scriptException struct {
+	Message string   `json:"message" bson:"message"`
+	File    string   `json:"file,omitempty" bson:"file,omitempty"`
+	Line    int      `json:"line,omitempty" bson:"line,omitempty"`
+	Column  int      `json:"column,omitempty" bson:"column,omitempty"`
+	Stack   []string `json:"stack,omitempty" bson:"stack,omitempty"`
+}
+
+// exceptionOf returns the details of the JavaScript exception behind err,
+// or nil when err is not one, such as a timeout.
+func exceptionOf(err error) *scriptException {
+	var ex *goja.Exception
+	if !errors.As(err, &ex) {
+		return nil
+	}
+
+	details := &scriptException{Message: ex.Error()}
+	if v := ex.Value(); v != nil {
+		details.Message = v.String()
+	}
+	for _, frame := range ex.Stack() {
+		var b bytes.Buffer
+		frame.Write(&b)
+		details.Stack = append(details.Stack, b.String())
+
+		if pos := frame.Position(); details.Line == 0 && pos.Line > 0 {
+			details.File = frame.SrcName()
+			details.Line = pos.Line
+			details.Column = pos.Column
+		}
+	}
+	return details
+}
+
+// scriptFailure is the error body of a failed plugin run, with the
+// exception's details when the plugin threw.
+func scriptFailure(err error) map[string]interface{} {
+	body := map[string]interface{}{"error": err.Error()}
+	if ex := exceptionOf(err); ex != nil {
+		body["exception"] = ex
+	}
+	return body
+}
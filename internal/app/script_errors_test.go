@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExceptionOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      scriptException
+		wantStack int
+	}{
+		{
+			"thrown error",
+			"var x = 1\nthrow new Error(\"boom\")",
+			scriptException{Message: "Error: boom", File: "main", Line: 2, Column: 7},
+			1,
+		},
+		{
+			"thrown value",
+			"throw {code: 42}",
+			scriptException{Message: "[object Object]", File: "main", Line: 1, Column: 1},
+			1,
+		},
+		{
+			"from a function",
+			"function check(v) {\n  if (v < 0) throw new RangeError(\"negative\")\n}\ncheck(input)",
+			scriptException{Message: "RangeError: negative", File: "main", Line: 2, Column: 20},
+			2,
+		},
+		{
+			"in a dependency",
+			"fail(input)",
+			scriptException{Message: "TypeError: bad input", File: "checks", Line: 1, Column: 26},
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			addTestPlugin(t, app, "checks", "function fail(v) { throw new TypeError(\"bad input\") }")
+			main := addTestPlugin(t, app, "main", tt.source)
+			main.Dependencies = []string{"checks"}
+
+			_, err := app.runScript(context.Background(), main, scriptCall{Input: -1})
+			ex := exceptionOf(err)
+			if ex == nil {
+				t.Fatalf("exceptionOf(%v) = nil", err)
+			}
+			if len(ex.Stack) != tt.wantStack {
+				t.Errorf("stack = %q, want %d frames", ex.Stack, tt.wantStack)
+			}
+			ex.Stack = nil
+			if !reflect.DeepEqual(*ex, tt.want) {
+				t.Errorf("exception = %+v, want %+v", *ex, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptFailure(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.JSTimeout = 20 * time.Millisecond
+	spin := addTestPlugin(t, app, "spin", "while (true) {}")
+	throw := addTestPlugin(t, app, "throw", `throw new Error("boom")`)
+
+	// Errors other than exceptions carry no details
+	_, err := app.runScript(context.Background(), spin, scriptCall{})
+	if body := scriptFailure(err); len(body) != 1 || !strings.Contains(body["error"].(string), "timed out") {
+		t.Errorf("timeout failure = %v, want only its error", body)
+	}
+	if exceptionOf(errors.New("boom")) != nil {
+		t.Error("exceptionOf reported details of a plain error")
+	}
+
+	_, err = app.runScript(context.Background(), throw, scriptCall{})
+	body := scriptFailure(err)
+	if ex, ok := body["exception"].(*scriptException); !ok || ex.Message != "Error: boom" {
+		t.Errorf("exception failure = %v, want its details", body)
+	}
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const secretsCollection = "secrets"
+
+// secretNamePattern keeps secret names usable as secrets.<name> in a script.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	errSecretsDisabled = errors.New("secrets need secrets_key to be configured")
+	errSecretNotFound  = errors.New("secret not found")
+)
+
+// storedSecret is a secret as kept in the secrets collection: its value
+// sealed with AES-256-GCM under secrets_key, with the name as additional
+// data so a sealed value cannot be moved to another name. Only the name and
+// timestamps are ever shown.
+type storedSecret struct {
+	Name       string    `json:"name" bson:"name"`
+	Nonce      []byte    `json:"-" bson:"nonce"`
+	Ciphertext []byte    `json:"-" bson:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// secretsCipher returns the AEAD sealing secret values, keyed with the
+// base64-encoded 32 bytes of secrets_key.
+func (cfg ServerConfig) secretsCipher() (cipher.AEAD, error) {
+	if cfg.SecretsKey == "" {
+		return nil, errSecretsDisabled
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.SecretsKey)
+	if err != nil {
+		return nil, fmt.Errorf("secrets_key must be base64: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets_key must decode to 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkSecretNames validates the secret names a plugin declares.
+func checkSecretNames(names []string) error {
+	for _, name := range names {
+		if !secretNamePattern.MatchString(name) {
+			return fmt.Errorf("secret name %q may only contain letters, digits and _, and must not start with a digit", name)
+		}
+	}
+	return nil
+}
+
+// putSecret creates or replaces a secret of the caller's tenant.
+func (app *AppContext) putSecret(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if err := checkSecretNames([]string{name}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var input struct {
+		Value string `json:"value" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	aead, err := app.Config.secretsCipher()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to seal secret"})
+		return
+	}
+	sealed := aead.Seal(nil, nonce, []byte(input.Value), []byte(name))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{
+		"$set":         bson.M{"nonce": nonce, "ciphertext": sealed, "updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var secret storedSecret
+	collection := app.database(ctx).Collection(secretsCollection)
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"name": name}, update, opts).Decode(&secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, secret)
+}
+
+// listSecrets lists the names of the caller's secrets, never their values.
+func (app *AppContext) listSecrets(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetProjection(bson.M{"nonce": 0, "ciphertext": 0})
+	cursor, err := app.database(ctx).Collection(secretsCollection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	secrets := make([]storedSecret, 0)
+	if err := cursor.All(ctx, &secrets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secrets": secrets})
+}
+
+func (app *AppContext) deleteSecret(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), app.Config.DBTimeout)
+	defer cancel()
+
+	result, err := app.database(ctx).Collection(secretsCollection).DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "secret not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "secret deleted"})
+}
+
+// loadSecrets reads and opens the named secrets of ctx's tenant. Every name
+// must be stored.
+func (app *AppContext) loadSecrets(ctx context.Context, names []string) (map[string]string, error) {
+	aead, err := app.Config.secretsCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := app.database(ctx).Collection(secretsCollection).Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	var stored []storedSecret
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	values := make(map[string]string, len(stored))
+	for _, secret := range stored {
+		value, err := aead.Open(nil, secret.Nonce, secret.Ciphertext, []byte(secret.Name))
+		if err != nil {
+			return nil, fmt.Errorf("secret %s cannot be opened with secrets_key", secret.Name)
+		}
+		values[secret.Name] = string(value)
+	}
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", errSecretNotFound, name)
+		}
+	}
+	return values, nil
+}
+
+// bindSecrets sets the secrets global to an object holding values. Its
+// properties cannot be changed or deleted, and it has no prototype, so the
+// names a plugin declared are all it reaches.
+func (vm *ScriptVM) bindSecrets(values map[string]string) {
+	secrets := vm.NewObject()
+	secrets.SetPrototype(nil)
+	for name, value := range values {
+		secrets.DefineDataProperty(name, vm.ToValue(value), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	vm.Set("secrets", secrets)
+}
+
+// redactSecrets masks secret values in a run's console output. Longer
+// values are masked first, so one containing another is masked whole.
+func redactSecrets(logs []LogEntry, values map[string]string) []LogEntry {
+	if len(values) == 0 {
+		return logs
+	}
+	masked := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			masked = append(masked, value)
+		}
+	}
+	sort.Slice(masked, func(i, j int) bool { return len(masked[i]) > len(masked[j]) })
+	pairs := make([]string, 0, 2*len(masked))
+	for _, value := range masked {
+		pairs = append(pairs, value, "[secret]")
+	}
+	replacer := strings.NewReplacer(pairs...)
+	for i := range logs {
+		logs[i].Message = replacer.Replace(logs[i].Message)
+	}
+	return logs
+}
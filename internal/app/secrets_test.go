@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretsCipher(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr string
+	}{
+		{"not configured", "", errSecretsDisabled.Error()},
+		{"not base64", "not base64!", "must be base64"},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), "got 16"},
+		{"32 bytes", base64.StdEncoding.EncodeToString(make([]byte, 32)), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aead, err := ServerConfig{SecretsKey: tt.key}.secretsCipher()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("secretsCipher: %v", err)
+			}
+
+			// A sealed value only opens under the name it was stored as
+			nonce := make([]byte, aead.NonceSize())
+			sealed := aead.Seal(nil, nonce, []byte("s3cret"), []byte("TOKEN"))
+			if value, err := aead.Open(nil, nonce, sealed, []byte("TOKEN")); err != nil || string(value) != "s3cret" {
+				t.Errorf("open = %q, %v", value, err)
+			}
+			if _, err := aead.Open(nil, nonce, sealed, []byte("OTHER")); err == nil {
+				t.Error("the value opened under another name")
+			}
+		})
+	}
+}
+
+func TestCheckSecretNames(t *testing.T) {
+	tests := []struct {
+		names   []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"TOKEN", "api_key", "_x2"}, false},
+		{[]string{"TOKEN", "2fa"}, true},
+		{[]string{"api-key"}, true},
+		{[]string{"a.b"}, true},
+		{[]string{""}, true},
+	}
+	for _, tt := range tests {
+		if err := checkSecretNames(tt.names); (err != nil) != tt.wantErr {
+			t.Errorf("checkSecretNames(%q) = %v, want error %v", tt.names, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBindSecrets(t *testing.T) {
+	tests := []struct {
+		script string
+		want   interface{}
+	}{
+		{"secrets.TOKEN", "s3cret"},
+		{"typeof secrets.OTHER", "undefined"},
+		{"Object.keys(secrets).join()", "TOKEN"},
+		{"secrets.TOKEN = 'changed'; secrets.TOKEN", "s3cret"},
+		{"delete secrets.TOKEN; secrets.TOKEN", "s3cret"},
+		{"Object.getPrototypeOf(secrets) === null", true},
+		{"typeof secrets.constructor", "undefined"},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		vm := app.VMFactory()
+		vm.bindSecrets(map[string]string{"TOKEN": "s3cret"})
+		value, err := vm.RunString(tt.script)
+		if err != nil {
+			t.Errorf("%s: %v", tt.script, err)
+			continue
+		}
+		if got := value.Export(); got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestRunScriptSecrets(t *testing.T) {
+	app := newTestApp(t)
+	undeclared := addTestPlugin(t, app, "undeclared", "typeof secrets")
+	declared := addTestPlugin(t, app, "declared", "secrets.TOKEN")
+	declared.Secrets = []string{"TOKEN"}
+
+	// A plugin that declares no secrets never gets the object
+	result, err := app.runScript(context.Background(), undeclared, scriptCall{})
+	if err != nil || result.Value != "undefined" {
+		t.Errorf("undeclared = %v, %v, want no secrets object", result.Value, err)
+	}
+	if _, err := app.runScript(context.Background(), declared, scriptCall{}); !errors.Is(err, errSecretsDisabled) {
+		t.Errorf("err = %v, want %v", err, errSecretsDisabled)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		values  map[string]string
+		want    string
+	}{
+		{"no secrets", "token abc", nil, "token abc"},
+		{"every occurrence", "abc and abc", map[string]string{"A": "abc"}, "[secret] and [secret]"},
+		{"longer first", "key abcdef", map[string]string{"A": "abc", "B": "abcdef"}, "key [secret]"},
+		{"empty value", "nothing here", map[string]string{"A": ""}, "nothing here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := redactSecrets([]LogEntry{{Level: "log", Message: tt.message}}, tt.values)
+			if want := []LogEntry{{Level: "log", Message: tt.want}}; !reflect.DeepEqual(logs, want) {
+				t.Errorf("logs = %v, want %v", logs, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dop251/goja"
+)
+
+// installStats binds the stats helper object. Every function takes an array
+// of numbers and returns NaN when the array is empty.
+func installStats(vm *goja.Runtime) {
+	stats := vm.NewObject()
+	stats.Set("sum", statsSum)
+	stats.Set("mean", statsMean)
+	stats.Set("median", statsMedian)
+	stats.Set("stddev", statsStddev)
+	stats.Set("min", statsMin)
+	stats.Set("max", statsMax)
+	vm.Set("stats", stats)
+}
+
+func statsSum(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func statsMean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	return statsSum(values) / float64(len(values))
+}
+
+func statsMedian(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// statsStddev returns the population standard deviation.
+func statsStddev(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	mean := statsMean(values)
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq / float64(len(values)))
+}
+
+func statsMin(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	min := values[0]
+	for _, v := range values[1:] {
+		min = math.Min(min, v)
+	}
+	return min
+}
+
+func statsMax(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	max := values[0]
+	for _, v := range values[1:] {
+		max = math.Max(max, v)
+	}
+	return max
+}
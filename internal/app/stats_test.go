@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{`stats.sum([1, 2, 3.5])`, 6.5},
+		{`stats.sum([])`, 0.0},
+		{`stats.mean([1, 2, 3, 4])`, 2.5},
+		{`stats.median([5, 1, 3])`, 3.0},
+		{`stats.median([4, 1, 3, 2])`, 2.5},
+		{`stats.stddev([2, 4, 4, 4, 5, 5, 7, 9])`, 2.0},
+		{`stats.min([3, -1, 2])`, -1.0},
+		{`stats.max([3, -1, 2])`, 3.0},
+		{`isNaN(stats.mean([]))`, true},
+		{`isNaN(stats.median([]))`, true},
+		{`isNaN(stats.stddev([]))`, true},
+		{`isNaN(stats.min([]))`, true},
+		{`isNaN(stats.max([]))`, true},
+		{`var values = [3, 1, 2]; stats.median(values); values`, []interface{}{3.0, 1.0, 2.0}},
+		{`JSON.parse(JSON.stringify({a: [1, "b"]})).a[1]`, "b"},
+		{`Math.round(Math.sqrt(16) * Math.PI)`, 13.0},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			plugin := addTestPlugin(t, app, "stats", tt.source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if got := normalizeJSON(result.Value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Reductions an aggregate step can compute.
+const (
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// aggregation computes one output field of an aggregate step.
+type aggregation struct {
+	Output string
+	Op     string
+	// Field is the dotted path of the input field reduced; count without a
+	// field counts rows.
+	Field string
+}
+
+// aggregateSpec reads an aggregate step's group_by keys and aggregations.
+// group_by may be a single field or a list, and may be left out to reduce
+// all rows into one.
+func aggregateSpec(step map[string]interface{}) ([]string, []aggregation, error) {
+	var groupBy []string
+	switch v := step["group_by"].(type) {
+	case nil:
+	case string:
+		groupBy = []string{v}
+	case []interface{}:
+		for _, key := range v {
+			field, ok := key.(string)
+			if !ok || field == "" {
+				return nil, nil, fmt.Errorf("group_by must list field names")
+			}
+			groupBy = append(groupBy, field)
+		}
+	default:
+		return nil, nil, fmt.Errorf("group_by must be a field name or a list of them")
+	}
+
+	raw, ok := step["aggregations"].(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, nil, fmt.Errorf("aggregate step needs aggregations mapping output fields to an op and a field")
+	}
+	aggs := make([]aggregation, 0, len(raw))
+	for out, spec := range raw {
+		fields, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("aggregation %s must be a mapping with op and field", out)
+		}
+		agg := aggregation{Output: out}
+		agg.Op, _ = fields["op"].(string)
+		agg.Field, _ = fields["field"].(string)
+		switch agg.Op {
+		case AggregateCount:
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+			if agg.Field == "" {
+				return nil, nil, fmt.Errorf("aggregation %s: %s needs a field", out, agg.Op)
+			}
+		default:
+			return nil, nil, fmt.Errorf("aggregation %s: unknown op %q (use sum, count, avg, min or max)", out, agg.Op)
+		}
+		aggs = append(aggs, agg)
+	}
+	sort.Slice(aggs, func(i, j int) bool { return aggs[i].Output < aggs[j].Output })
+	return groupBy, aggs, nil
+}
+
+// aggregateGroup accumulates the rows of one group.
+type aggregateGroup struct {
+	keys   map[string]interface{}
+	counts []int
+	sums   []float64
+	mins   []float64
+	maxs   []float64
+}
+
+// aggregateData groups an array of objects by the group_by fields and
+// reduces each group. It returns one object per group, in the order the
+// groups first appear, holding the group_by fields and the aggregations.
+// Missing and null fields are left out of every aggregation, and sum, avg,
+// min and max also skip values that are not numbers; avg, min and max are
+// null for a group with none.
+func aggregateData(data interface{}, groupBy []string, aggs []aggregation) (interface{}, error) {
+	rows, ok := normalizeJSON(data).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("aggregate: input must be an array of objects")
+	}
+
+	groups := make(map[string]*aggregateGroup)
+	order := make([]string, 0)
+	for i, item := range rows {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("aggregate: item %d is not an object", i)
+		}
+
+		keys := make(map[string]interface{}, len(groupBy))
+		tuple := make([]interface{}, len(groupBy))
+		for k, field := range groupBy {
+			tuple[k], _ = lookupPath(row, field)
+			keys[field] = tuple[k]
+		}
+		encoded, err := json.Marshal(tuple)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate: item %d: %v", i, err)
+		}
+
+		group, ok := groups[string(encoded)]
+		if !ok {
+			group = &aggregateGroup{
+				keys:   keys,
+				counts: make([]int, len(aggs)),
+				sums:   make([]float64, len(aggs)),
+				mins:   make([]float64, len(aggs)),
+				maxs:   make([]float64, len(aggs)),
+			}
+			groups[string(encoded)] = group
+			order = append(order, string(encoded))
+		}
+
+		for a, agg := range aggs {
+			if agg.Field == "" {
+				group.counts[a]++
+				continue
+			}
+			value, ok := lookupPath(row, agg.Field)
+			if !ok || value == nil {
+				continue
+			}
+			if agg.Op == AggregateCount {
+				group.counts[a]++
+				continue
+			}
+			n, ok := value.(float64)
+			if !ok {
+				continue
+			}
+			if group.counts[a] == 0 || n < group.mins[a] {
+				group.mins[a] = n
+			}
+			if group.counts[a] == 0 || n > group.maxs[a] {
+				group.maxs[a] = n
+			}
+			group.sums[a] += n
+			group.counts[a]++
+		}
+	}
+
+	out := make([]interface{}, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		result := make(map[string]interface{}, len(groupBy)+len(aggs))
+		for field, value := range group.keys {
+			result[field] = value
+		}
+		for a, agg := range aggs {
+			result[agg.Output] = group.result(a, agg.Op)
+		}
+		out = append(out, result)
+	}
+	return out, nil
+}
+
+func (g *aggregateGroup) result(a int, op string) interface{} {
+	switch op {
+	case AggregateCount:
+		return g.counts[a]
+	case AggregateSum:
+		return g.sums[a]
+	}
+	if g.counts[a] == 0 {
+		return nil
+	}
+	switch op {
+	case AggregateAvg:
+		return g.sums[a] / float64(g.counts[a])
+	case AggregateMin:
+		return g.mins[a]
+	default:
+		return g.maxs[a]
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateData(t *testing.T) {
+	rows := []interface{}{
+		map[string]interface{}{"site": "north", "kind": "a", "reading": map[string]interface{}{"value": 4}},
+		map[string]interface{}{"site": "south", "kind": "a", "reading": map[string]interface{}{"value": 1}},
+		map[string]interface{}{"site": "north", "kind": "b", "reading": map[string]interface{}{"value": 2}},
+		map[string]interface{}{"site": "north", "kind": "a", "reading": map[string]interface{}{"value": "n/a"}},
+		map[string]interface{}{"site": "south", "kind": "a", "reading": map[string]interface{}{"value": nil}},
+		map[string]interface{}{"kind": "a"},
+	}
+	stats := []aggregation{
+		{Output: "avg", Op: AggregateAvg, Field: "reading.value"},
+		{Output: "max", Op: AggregateMax, Field: "reading.value"},
+		{Output: "min", Op: AggregateMin, Field: "reading.value"},
+		{Output: "n", Op: AggregateCount, Field: "reading.value"},
+		{Output: "rows", Op: AggregateCount},
+		{Output: "total", Op: AggregateSum, Field: "reading.value"},
+	}
+	group := func(keys map[string]interface{}, avg, max, min interface{}, n, rows int, total float64) map[string]interface{} {
+		out := map[string]interface{}{"avg": avg, "max": max, "min": min, "n": n, "rows": rows, "total": total}
+		for k, v := range keys {
+			out[k] = v
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		data    interface{}
+		groupBy []string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			"all rows",
+			rows, nil,
+			[]interface{}{group(nil, 7.0/3, 4.0, 1.0, 4, 6, 7)},
+			false,
+		},
+		{
+			"by site, in order of appearance",
+			rows, []string{"site"},
+			[]interface{}{
+				group(map[string]interface{}{"site": "north"}, 3.0, 4.0, 2.0, 3, 3, 6),
+				group(map[string]interface{}{"site": "south"}, 1.0, 1.0, 1.0, 1, 2, 1),
+				group(map[string]interface{}{"site": nil}, nil, nil, nil, 0, 1, 0),
+			},
+			false,
+		},
+		{
+			"by two keys",
+			rows[:3], []string{"site", "kind"},
+			[]interface{}{
+				group(map[string]interface{}{"site": "north", "kind": "a"}, 4.0, 4.0, 4.0, 1, 1, 4),
+				group(map[string]interface{}{"site": "south", "kind": "a"}, 1.0, 1.0, 1.0, 1, 1, 1),
+				group(map[string]interface{}{"site": "north", "kind": "b"}, 2.0, 2.0, 2.0, 1, 1, 2),
+			},
+			false,
+		},
+		{"empty", []interface{}{}, []string{"site"}, []interface{}{}, false},
+		{"not an array", map[string]interface{}{}, nil, nil, true},
+		{"item not an object", []interface{}{1}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aggregateData(tt.data, tt.groupBy, stats)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("aggregateData = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aggregateData = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
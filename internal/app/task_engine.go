@@ -0,0 +1,327 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// taskStepsError reports the steps of a task that failed. Their errors are
+// recorded in the task results.
+type taskStepsError struct {
+	Steps []string
+}
+
+func (e *taskStepsError) Error() string {
+	return "steps failed: " + strings.Join(e.Steps, ", ")
+}
+
+// runTask runs the steps of a task on inputData and returns each step's
+// output, or {"error": ...} for steps that failed, by step name. Sequential
+// tasks feed each step the previous step's output. Parallel tasks run up to
+// MaxParallel steps at once; a step waits for the steps in its depends_on
+// list and runs on their outputs, or on inputData when it has none. When any
+// step fails the results are returned along with a *taskStepsError.
+func (app *AppContext) runTask(ctx context.Context, task TaskDefinition, inputData interface{}) (map[string]interface{}, error) {
+	onError, err := task.errorPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]interface{})
+	failedSteps := make(map[string]bool)
+	halted := false
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+
+	// taskCtx is cancelled to abort running steps under the fail_fast policy.
+	taskCtx, cancelTask := context.WithCancel(ctx)
+	defer cancelTask()
+
+	sem := make(chan struct{}, app.Config.MaxParallel)
+
+	// stepOutput returns the output of an earlier step.
+	stepOutput := func(from string) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failedSteps[from] {
+			return nil, fmt.Errorf("referenced step %s failed", from)
+		}
+		output, ran := results[from]
+		if !ran {
+			return nil, fmt.Errorf("referenced step %s has not run", from)
+		}
+		return output, nil
+	}
+
+	// stepInput resolves `input: {from_step: name}` to the output of an
+	// earlier step; steps without a reference run on data.
+	stepInput := func(step map[string]interface{}, data interface{}) (interface{}, error) {
+		_, from, err := stepInputRef(step)
+		if err != nil || from == "" {
+			return data, err
+		}
+		return stepOutput(from)
+	}
+
+	// stepVarParams returns the step's params with the task's vars expanded.
+	stepVarParams := func(step map[string]interface{}) (map[string]interface{}, error) {
+		params, err := stepParams(step)
+		if err != nil {
+			return nil, err
+		}
+		expanded, err := expandVars(params, task.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("params: %w", err)
+		}
+		params, _ = expanded.(map[string]interface{})
+		return params, nil
+	}
+
+	processStep := func(_ int, step map[string]interface{}, data interface{}) (interface{}, error) {
+		data, err := stepInput(step, data)
+		if err != nil {
+			return nil, err
+		}
+
+		kind, err := stepType(step)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case StepTypeTransform:
+			mapping, err := transformMapping(step)
+			if err != nil {
+				return nil, err
+			}
+			return transformData(data, mapping)
+		case StepTypeFilter:
+			predicate, err := filterPredicate(step)
+			if err != nil {
+				return nil, err
+			}
+			params, err := stepVarParams(step)
+			if err != nil {
+				return nil, err
+			}
+			timeout, err := stepTimeout(step)
+			if err != nil {
+				return nil, err
+			}
+			return app.filterData(taskCtx, data, predicate, params, timeout)
+		case StepTypeAggregate:
+			groupBy, aggs, err := aggregateSpec(step)
+			if err != nil {
+				return nil, err
+			}
+			return aggregateData(data, groupBy, aggs)
+		case StepTypeMerge:
+			sources, err := mergeSources(step)
+			if err != nil {
+				return nil, err
+			}
+			outputs := make([]interface{}, len(sources))
+			for i, from := range sources {
+				if outputs[i], err = stepOutput(from); err != nil {
+					return nil, err
+				}
+			}
+			return mergeData(sources, outputs)
+		}
+
+		pluginName, err := stepPlugin(step)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := stepVarParams(step)
+		if err != nil {
+			return nil, err
+		}
+
+		script, exists := app.lookupPlugin(ctx, pluginName)
+
+		if !exists {
+			if app.pluginDisabled(ctx, pluginName) {
+				return nil, fmt.Errorf("plugin %s is disabled", pluginName)
+			}
+			return nil, fmt.Errorf("plugin %s not found", pluginName)
+		}
+
+		timeout, err := stepTimeout(step)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		output, err := app.runScript(taskCtx, script, scriptCall{Input: data, Params: params, Timeout: timeout})
+		record := executionRecord(script, ExecutionSourceTask, data, time.Since(start), err)
+		record.Task = task.Name
+		app.recordExecution(ctx, record)
+		if err != nil {
+			return nil, err
+		}
+		return output.Value, nil
+	}
+
+	// tryStep runs one attempt of a step. A panic fails the attempt instead
+	// of the server; its details are only logged.
+	tryStep := func(stepNum int, step map[string]interface{}, data interface{}) (result interface{}, err error) {
+		defer recoverAsError(fmt.Sprintf("task %s step %s", task.Name, taskStepName(stepNum, step)), &err)
+		return processStep(stepNum, step, data)
+	}
+
+	// runStep retries a failing step according to its retries and
+	// retry_delay fields before giving up.
+	runStep := func(stepNum int, step map[string]interface{}, data interface{}) (interface{}, error) {
+		retries, delay, err := stepRetryPolicy(step)
+		if err != nil {
+			return nil, err
+		}
+
+		for attempt := 0; ; attempt++ {
+			result, err := tryStep(stepNum, step, data)
+			if err == nil {
+				return result, nil
+			}
+			if attempt >= retries {
+				if retries > 0 {
+					return nil, fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+				}
+				return nil, err
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-taskCtx.Done():
+				return nil, taskCtx.Err()
+			}
+		}
+	}
+
+	currentData := inputData
+	if task.Parallel {
+		deps, err := taskDependencies(task)
+		if err != nil {
+			return nil, err
+		}
+
+		// done[i] is closed once step i has finished or been skipped.
+		done := make([]chan struct{}, len(task.Steps))
+		for i := range done {
+			done[i] = make(chan struct{})
+		}
+
+		for i, step := range task.Steps {
+			wg.Add(1)
+			go func(stepNum int, step map[string]interface{}) {
+				defer wg.Done()
+				defer close(done[stepNum])
+
+				for _, dep := range deps[stepNum] {
+					select {
+					case <-done[dep]:
+					case <-taskCtx.Done():
+						return
+					}
+				}
+
+				select {
+				case sem <- struct{}{}:
+				case <-taskCtx.Done():
+					return
+				}
+				defer func() { <-sem }()
+
+				mutex.Lock()
+				skip := halted
+				mutex.Unlock()
+				if skip {
+					return
+				}
+
+				stepName := taskStepName(stepNum, step)
+
+				// Steps without dependencies run on inputData, steps with one
+				// on its output and steps with several on an object holding
+				// each output under its step name.
+				data := inputData
+				var err error
+				switch len(deps[stepNum]) {
+				case 0:
+				case 1:
+					data, err = stepOutput(taskStepName(deps[stepNum][0], task.Steps[deps[stepNum][0]]))
+				default:
+					outputs := make(map[string]interface{}, len(deps[stepNum]))
+					for _, dep := range deps[stepNum] {
+						depName := taskStepName(dep, task.Steps[dep])
+						if outputs[depName], err = stepOutput(depName); err != nil {
+							break
+						}
+					}
+					data = outputs
+				}
+
+				var result interface{}
+				if err == nil {
+					result, err = runStep(stepNum, step, data)
+				}
+				if err != nil {
+					mutex.Lock()
+					if errors.Is(err, context.Canceled) && halted {
+						err = fmt.Errorf("cancelled after another step failed")
+					}
+					results[stepName] = scriptFailure(err)
+					failedSteps[stepName] = true
+					if onError != OnErrorContinue {
+						halted = true
+					}
+					mutex.Unlock()
+					if onError == OnErrorFailFast {
+						cancelTask()
+					}
+					return
+				}
+
+				mutex.Lock()
+				results[stepName] = result
+				mutex.Unlock()
+			}(i, step)
+		}
+		wg.Wait()
+	} else {
+		for i, step := range task.Steps {
+			stepName := taskStepName(i, step)
+
+			result, err := runStep(i, step, currentData)
+			mutex.Lock()
+			if err != nil {
+				results[stepName] = scriptFailure(err)
+				failedSteps[stepName] = true
+				mutex.Unlock()
+				if onError == OnErrorContinue {
+					continue
+				}
+				break
+			}
+
+			results[stepName] = result
+			mutex.Unlock()
+			currentData = result
+		}
+	}
+
+	if len(failedSteps) > 0 {
+		failed := make([]string, 0, len(failedSteps))
+		for name := range failedSteps {
+			failed = append(failed, name)
+		}
+		sort.Strings(failed)
+		return results, &taskStepsError{Steps: failed}
+	}
+	return results, nil
+}
@@ -0,0 +1,592 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failed marks a step expected to fail with an error containing the text.
+type failed string
+
+// taskStep builds a step named name that runs plugin, with further fields
+// given as name, value pairs.
+func taskStep(name, plugin string, fields ...interface{}) map[string]interface{} {
+	step := map[string]interface{}{"name": name}
+	if plugin != "" {
+		step["plugin"] = plugin
+	}
+	for i := 0; i < len(fields); i += 2 {
+		step[fields[i].(string)] = fields[i+1]
+	}
+	return step
+}
+
+// newTaskTestApp returns a test app with the plugins the task tests run.
+func newTaskTestApp(t *testing.T) *AppContext {
+	t.Helper()
+	app := newTestApp(t)
+	addTestPlugin(t, app, "inc", "input + 1")
+	addTestPlugin(t, app, "double", "({double: input * 2})")
+	addTestPlugin(t, app, "plus10", "({plus10: input + 10})")
+	addTestPlugin(t, app, "sum", "input.double + input.plus10")
+	addTestPlugin(t, app, "fail", `throw new Error("boom")`)
+	return app
+}
+
+// checkTaskResults compares what runTask returned with want, which maps each
+// step expected in the results to its output or to a failed error text;
+// steps left out must not have run. wantFailed lists the steps the error
+// must report, in order.
+func checkTaskResults(t *testing.T, results map[string]interface{}, err error, want map[string]interface{}, wantFailed []string) {
+	t.Helper()
+	var stepsErr *taskStepsError
+	switch {
+	case len(wantFailed) == 0 && err != nil:
+		t.Fatalf("runTask: %v", err)
+	case len(wantFailed) > 0 && !errors.As(err, &stepsErr):
+		t.Fatalf("err = %v, want a taskStepsError", err)
+	case stepsErr != nil && !reflect.DeepEqual(stepsErr.Steps, wantFailed):
+		t.Errorf("failed steps = %v, want %v", stepsErr.Steps, wantFailed)
+	}
+
+	if len(results) != len(want) {
+		t.Errorf("results = %v, want %d steps", results, len(want))
+	}
+	for name, want := range want {
+		got, ok := results[name]
+		if !ok {
+			t.Errorf("step %s did not run", name)
+			continue
+		}
+		if text, ok := want.(failed); ok {
+			failure, _ := got.(map[string]interface{})
+			message, _ := failure["error"].(string)
+			if !strings.Contains(message, string(text)) {
+				t.Errorf("step %s = %v, want an error containing %q", name, got, text)
+			}
+			continue
+		}
+		if got := normalizeJSON(got); !reflect.DeepEqual(got, want) {
+			t.Errorf("step %s = %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	tests := []struct {
+		name string
+		task TaskDefinition
+		want map[string]interface{}
+	}{
+		{"no steps", TaskDefinition{}, map[string]interface{}{}},
+		{
+			"sequential steps chain their outputs",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc"), taskStep("b", "inc"), taskStep("c", "double"),
+			}},
+			map[string]interface{}{"a": 2.0, "b": 3.0, "c": map[string]interface{}{"double": 6.0}},
+		},
+		{
+			"parallel steps share the input",
+			TaskDefinition{Parallel: true, Steps: []map[string]interface{}{
+				taskStep("a", "inc"), taskStep("b", "double"), taskStep("c", "plus10"),
+			}},
+			map[string]interface{}{"a": 2.0, "b": map[string]interface{}{"double": 2.0}, "c": map[string]interface{}{"plus10": 11.0}},
+		},
+		{
+			"unnamed steps",
+			TaskDefinition{Steps: []map[string]interface{}{
+				{"plugin": "inc"}, {"plugin": "inc"},
+			}},
+			map[string]interface{}{"step_0": 2.0, "step_1": 3.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			results, err := app.runTask(context.Background(), tt.task, 1)
+			checkTaskResults(t, results, err, tt.want, nil)
+		})
+	}
+}
+
+func TestRunTaskParallelLimit(t *testing.T) {
+	app := newTaskTestApp(t)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	newVM := app.VMFactory
+	app.VMFactory = func() *ScriptVM {
+		vm := newVM()
+		vm.Set("enter", func() {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+		vm.baseline["enter"] = true
+		return vm
+	}
+	addTestPlugin(t, app, "busy", "enter(); input")
+	task := TaskDefinition{Parallel: true}
+	for i := 0; i < 6; i++ {
+		task.Steps = append(task.Steps, taskStep(fmt.Sprintf("s%d", i), "busy"))
+	}
+
+	// newTestApp allows MaxParallel steps at once
+	if _, err := app.runTask(context.Background(), task, 1); err != nil {
+		t.Fatalf("runTask: %v", err)
+	}
+	if peak != app.Config.MaxParallel {
+		t.Errorf("%d steps ran at once, want %d", peak, app.Config.MaxParallel)
+	}
+}
+
+func TestRunTaskStepReferences(t *testing.T) {
+	from := func(step string) map[string]interface{} {
+		return map[string]interface{}{"from_step": step}
+	}
+
+	tests := []struct {
+		name       string
+		task       TaskDefinition
+		want       map[string]interface{}
+		wantFailed []string
+	}{
+		{
+			// a feeds both b and c, which d joins again
+			name: "diamond",
+			task: TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc"),
+				taskStep("b", "double", "input", from("a")),
+				taskStep("c", "plus10", "input", from("a")),
+				taskStep("d", "", "type", StepTypeMerge, "steps", []interface{}{"b", "c"}),
+				taskStep("e", "sum", "input", from("d")),
+			}},
+			want: map[string]interface{}{
+				"a": 2.0,
+				"b": map[string]interface{}{"double": 4.0},
+				"c": map[string]interface{}{"plus10": 12.0},
+				"d": map[string]interface{}{"double": 4.0, "plus10": 12.0},
+				"e": 16.0,
+			},
+		},
+		{
+			name: "failed step",
+			task: TaskDefinition{OnError: OnErrorContinue, Steps: []map[string]interface{}{
+				taskStep("a", "fail"),
+				taskStep("b", "inc", "input", from("a")),
+			}},
+			want:       map[string]interface{}{"a": failed("boom"), "b": failed("referenced step a failed")},
+			wantFailed: []string{"a", "b"},
+		},
+		{
+			name: "step not run yet",
+			task: TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "input", from("b")),
+				taskStep("b", "inc"),
+			}},
+			want:       map[string]interface{}{"a": failed("referenced step b has not run")},
+			wantFailed: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			results, err := app.runTask(context.Background(), tt.task, 1)
+			checkTaskResults(t, results, err, tt.want, tt.wantFailed)
+		})
+	}
+}
+
+// countAttempts binds attempt() into the app's runtimes, which returns how
+// many times it has been called, starting at 1.
+func countAttempts(app *AppContext) *atomic.Int64 {
+	var attempts atomic.Int64
+	newVM := app.VMFactory
+	app.VMFactory = func() *ScriptVM {
+		vm := newVM()
+		vm.Set("attempt", func() int64 { return attempts.Add(1) })
+		vm.baseline["attempt"] = true
+		return vm
+	}
+	return &attempts
+}
+
+func TestRunTaskRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retries      int
+		want         interface{}
+		wantAttempts int64
+	}{
+		{"fails twice then succeeds", 2, 3, 2.0, 3},
+		{"retries exhausted", 5, 2, failed("(after 3 attempts)"), 3},
+		{"retries not needed", 0, 3, 2.0, 1},
+		{"no retries", 1, 0, failed("boom"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			attempts := countAttempts(app)
+			addTestPlugin(t, app, "flaky", `if (attempt() <= params.failures) throw new Error("boom"); input + 1`)
+			task := TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "flaky", "retries", tt.retries, "retry_delay", "1ms",
+					"params", map[string]interface{}{"failures": tt.failures}),
+			}}
+
+			results, err := app.runTask(context.Background(), task, 1)
+			var wantFailed []string
+			if _, ok := tt.want.(failed); ok {
+				wantFailed = []string{"a"}
+			}
+			checkTaskResults(t, results, err, map[string]interface{}{"a": tt.want}, wantFailed)
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("flaky ran %d times, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRunTaskRetryDelayCancelled(t *testing.T) {
+	app := newTaskTestApp(t)
+	task := TaskDefinition{Steps: []map[string]interface{}{
+		taskStep("a", "fail", "retries", 3, "retry_delay", "1h"),
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results, err := app.runTask(ctx, task, nil)
+	if err == nil {
+		t.Fatal("runTask succeeded")
+	}
+	failure, _ := results["a"].(map[string]interface{})
+	if message, _ := failure["error"].(string); !strings.Contains(message, context.DeadlineExceeded.Error()) {
+		t.Errorf("step a = %v, want it to end with the task's context", results["a"])
+	}
+}
+
+func TestRunTaskStepTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    interface{}
+		maxTimeout time.Duration
+		want       interface{}
+	}{
+		{"duration string", "50ms", time.Minute, failed("execution timed out after 50ms")},
+		{"seconds", 0.05, time.Minute, failed("execution timed out after 50ms")},
+		{"capped by max_js_timeout", "1h", 50 * time.Millisecond, failed("execution timed out after 50ms")},
+		{"invalid", "soon", time.Minute, failed("invalid timeout")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			app.Config.MaxJSTimeout = tt.maxTimeout
+			addTestPlugin(t, app, "spin", "while (true) {}")
+			task := TaskDefinition{OnError: OnErrorContinue, Steps: []map[string]interface{}{
+				taskStep("slow", "spin", "timeout", tt.timeout),
+				taskStep("next", "inc"),
+			}}
+
+			// The slow step fails alone; on_error decides what follows
+			results, err := app.runTask(context.Background(), task, 1)
+			checkTaskResults(t, results, err, map[string]interface{}{"slow": tt.want, "next": 2.0}, []string{"slow"})
+		})
+	}
+}
+
+func TestRunTaskMalformedSteps(t *testing.T) {
+	tests := []struct {
+		name string
+		step map[string]interface{}
+		want failed
+	}{
+		{"no plugin", taskStep("bad", ""), "plugin name not specified"},
+		{"plugin not a name", taskStep("bad", "", "plugin", 42), "plugin must be a plugin name"},
+		{"params not a mapping", taskStep("bad", "inc", "params", []interface{}{1}), "params must be a mapping"},
+		{"input not a mapping", taskStep("bad", "inc", "input", "a"), "input must be a mapping"},
+		{"from_step not a name", taskStep("bad", "inc", "input", map[string]interface{}{"from_step": 1}), "input.from_step must be a step name"},
+		{"retries not a number", taskStep("bad", "inc", "retries", "twice"), "retries must be a number"},
+		{"too many retries", taskStep("bad", "inc", "retries", 100), "retries must be between 0 and 10"},
+		{"negative retry_delay", taskStep("bad", "inc", "retries", 1, "retry_delay", -1), "retry_delay must not be negative"},
+		{"plugin panics", taskStep("bad", "explode"), failed(errInternal.Error())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			newVM := app.VMFactory
+			app.VMFactory = func() *ScriptVM {
+				vm := newVM()
+				vm.Set("explode", func() { panic("bad step") })
+				vm.baseline["explode"] = true
+				return vm
+			}
+			addTestPlugin(t, app, "explode", "explode()")
+			task := TaskDefinition{OnError: OnErrorContinue, Steps: []map[string]interface{}{
+				tt.step,
+				taskStep("next", "inc"),
+			}}
+
+			// The malformed step fails alone instead of the task or the server
+			results, err := app.runTask(context.Background(), task, 1)
+			checkTaskResults(t, results, err, map[string]interface{}{"bad": tt.want, "next": 2.0}, []string{"bad"})
+		})
+	}
+}
+
+func TestRunTaskErrorPolicies(t *testing.T) {
+	after := func(names ...interface{}) []interface{} { return names }
+
+	tests := []struct {
+		name       string
+		task       TaskDefinition
+		want       map[string]interface{}
+		wantFailed []string
+	}{
+		{
+			name: "sequential stops by default",
+			task: TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc"), taskStep("b", "fail"), taskStep("c", "inc"),
+			}},
+			want:       map[string]interface{}{"a": 2.0, "b": failed("boom")},
+			wantFailed: []string{"b"},
+		},
+		{
+			name: "sequential continue",
+			task: TaskDefinition{OnError: OnErrorContinue, Steps: []map[string]interface{}{
+				taskStep("a", "inc"), taskStep("b", "fail"), taskStep("c", "inc"),
+			}},
+			// c runs on the output of the last step that succeeded
+			want:       map[string]interface{}{"a": 2.0, "b": failed("boom"), "c": 3.0},
+			wantFailed: []string{"b"},
+		},
+		{
+			name: "sequential fail_fast",
+			task: TaskDefinition{OnError: OnErrorFailFast, Steps: []map[string]interface{}{
+				taskStep("a", "fail"), taskStep("b", "inc"),
+			}},
+			want:       map[string]interface{}{"a": failed("boom")},
+			wantFailed: []string{"a"},
+		},
+		{
+			name: "parallel runs every step by default",
+			task: TaskDefinition{Parallel: true, Steps: []map[string]interface{}{
+				taskStep("a", "fail"),
+				taskStep("b", "inc"),
+			}},
+			want:       map[string]interface{}{"a": failed("boom"), "b": 2.0},
+			wantFailed: []string{"a"},
+		},
+		{
+			name: "parallel stop skips steps not started",
+			task: TaskDefinition{Parallel: true, OnError: OnErrorStop, Steps: []map[string]interface{}{
+				taskStep("a", "fail"),
+				taskStep("b", "inc", "depends_on", after("a")),
+			}},
+			want:       map[string]interface{}{"a": failed("boom")},
+			wantFailed: []string{"a"},
+		},
+		{
+			name: "parallel continue",
+			task: TaskDefinition{Parallel: true, OnError: OnErrorContinue, Steps: []map[string]interface{}{
+				taskStep("a", "fail"),
+				taskStep("b", "inc"),
+				taskStep("c", "inc", "depends_on", after("a")),
+				taskStep("d", "inc", "depends_on", after("b")),
+			}},
+			want: map[string]interface{}{
+				"a": failed("boom"),
+				"b": 2.0,
+				"c": failed("referenced step a failed"),
+				"d": 3.0,
+			},
+			wantFailed: []string{"a", "c"},
+		},
+		{
+			name: "parallel fail_fast cancels running steps",
+			task: TaskDefinition{Parallel: true, OnError: OnErrorFailFast, Steps: []map[string]interface{}{
+				taskStep("a", "slow_fail"),
+				taskStep("b", "spin"),
+			}},
+			want: map[string]interface{}{
+				"a": failed("boom"),
+				"b": failed("cancelled after another step failed"),
+			},
+			wantFailed: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			addTestPlugin(t, app, "slow_fail", `var start = Date.now(); while (Date.now() - start < 100) {} throw new Error("boom")`)
+			addTestPlugin(t, app, "spin", "while (true) {}")
+			tt.task.Name = "policies"
+
+			results, err := app.runTask(context.Background(), tt.task, 1)
+			checkTaskResults(t, results, err, tt.want, tt.wantFailed)
+		})
+	}
+}
+
+func TestRunTaskInvalidPolicy(t *testing.T) {
+	app := newTestApp(t)
+	_, err := app.runTask(context.Background(), TaskDefinition{OnError: "retry"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "on_error") {
+		t.Fatalf("err = %v, want an on_error error", err)
+	}
+}
+
+func TestRunTaskDependencies(t *testing.T) {
+	after := func(names ...interface{}) []interface{} { return names }
+
+	tests := []struct {
+		name       string
+		steps      []map[string]interface{}
+		want       map[string]interface{}
+		wantFailed []string
+	}{
+		{
+			name: "independent branches",
+			steps: []map[string]interface{}{
+				taskStep("a", "inc"),
+				taskStep("b", "double", "depends_on", after("a")),
+				taskStep("c", "inc"),
+				taskStep("d", "plus10", "depends_on", after("c")),
+			},
+			want: map[string]interface{}{
+				"a": 2.0,
+				"b": map[string]interface{}{"double": 4.0},
+				"c": 2.0,
+				"d": map[string]interface{}{"plus10": 12.0},
+			},
+		},
+		{
+			// d joins b and c, which both run on a
+			name: "join",
+			steps: []map[string]interface{}{
+				taskStep("a", "inc"),
+				taskStep("b", "double", "depends_on", after("a")),
+				taskStep("c", "plus10", "depends_on", after("a")),
+				taskStep("d", "join", "depends_on", after("b", "c")),
+			},
+			want: map[string]interface{}{
+				"a": 2.0,
+				"b": map[string]interface{}{"double": 4.0},
+				"c": map[string]interface{}{"plus10": 12.0},
+				"d": 16.0,
+			},
+		},
+		{
+			name: "join with a failed dependency",
+			steps: []map[string]interface{}{
+				taskStep("a", "inc"),
+				taskStep("b", "fail"),
+				taskStep("c", "join", "depends_on", after("a", "b")),
+			},
+			want: map[string]interface{}{
+				"a": 2.0,
+				"b": failed("boom"),
+				"c": failed("referenced step b failed"),
+			},
+			wantFailed: []string{"b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			addTestPlugin(t, app, "join", "input.b.double + input.c.plus10")
+			task := TaskDefinition{Parallel: true, OnError: OnErrorContinue, Steps: tt.steps}
+
+			results, err := app.runTask(context.Background(), task, 1)
+			checkTaskResults(t, results, err, tt.want, tt.wantFailed)
+		})
+	}
+}
+
+func TestRunTaskBranchesRunConcurrently(t *testing.T) {
+	app := newTaskTestApp(t)
+
+	// meet() returns once both branches have called it, so the task only
+	// finishes when they run at the same time
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	newVM := app.VMFactory
+	app.VMFactory = func() *ScriptVM {
+		vm := newVM()
+		vm.Set("meet", func() bool {
+			arrived.Done()
+			met := make(chan struct{})
+			go func() { arrived.Wait(); close(met) }()
+			select {
+			case <-met:
+				return true
+			case <-time.After(time.Second):
+				return false
+			}
+		})
+		vm.baseline["meet"] = true
+		return vm
+	}
+	addTestPlugin(t, app, "meet", "meet()")
+
+	task := TaskDefinition{Parallel: true, Steps: []map[string]interface{}{
+		taskStep("a", "inc"),
+		taskStep("b", "meet", "depends_on", []interface{}{"a"}),
+		taskStep("c", "meet"),
+	}}
+	results, err := app.runTask(context.Background(), task, 1)
+	checkTaskResults(t, results, err, map[string]interface{}{"a": 2.0, "b": true, "c": true}, nil)
+}
+
+func TestRunTaskUnknownDependency(t *testing.T) {
+	app := newTaskTestApp(t)
+	task := TaskDefinition{Parallel: true, Steps: []map[string]interface{}{
+		taskStep("a", "inc", "depends_on", []interface{}{"b"}),
+		taskStep("b", "inc"),
+	}}
+	_, err := app.runTask(context.Background(), task, 1)
+	if err == nil || !strings.Contains(err.Error(), "does not name an earlier step") {
+		t.Fatalf("err = %v, want a depends_on error", err)
+	}
+}
+
+func TestRunTaskStepsShareUnchangedInput(t *testing.T) {
+	app := newTaskTestApp(t)
+	addTestPlugin(t, app, "mutate", `input.values[0] = 99; input.label = "changed"; input`)
+	addTestPlugin(t, app, "echo", `input`)
+	input := map[string]interface{}{"label": "raw", "values": []interface{}{1.0, 2.0}}
+
+	for _, parallel := range []bool{false, true} {
+		task := TaskDefinition{Parallel: parallel, Steps: []map[string]interface{}{
+			taskStep("a", "mutate"),
+			taskStep("b", "echo", "input", map[string]interface{}{"from_step": "a"}),
+		}}
+		if parallel {
+			// Both steps run on the task's input at the same time
+			task.Steps[1] = taskStep("b", "echo")
+		}
+		results, err := app.runTask(context.Background(), task, input)
+		if err != nil {
+			t.Fatalf("parallel %t: runTask: %v", parallel, err)
+		}
+		if parallel {
+			if got := normalizeJSON(results["b"]); !reflect.DeepEqual(got, input) {
+				t.Errorf("parallel: step b saw %v, want %v", got, input)
+			}
+		}
+		if input["label"] != "raw" || input["values"].([]interface{})[0] != 1.0 {
+			t.Fatalf("parallel %t: the task's input changed to %v", parallel, input)
+		}
+	}
+}
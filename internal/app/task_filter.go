@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// filterPredicate reads a filter step's where expression and compiles it
+// once for all the elements it is evaluated on.
+func filterPredicate(step map[string]interface{}) (*goja.Program, error) {
+	expr, ok := step["where"].(string)
+	if !ok || strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("filter step needs a where expression")
+	}
+	program, err := goja.Compile("where", expr, false)
+	if err != nil {
+		return nil, fmt.Errorf("where: %w", err)
+	}
+	return program, nil
+}
+
+// filterData keeps the elements of an array for which the predicate is
+// truthy. The predicate is evaluated once per element, with the element as
+// item and its position as index, in a single sandboxed runtime that also
+// holds params; all evaluations together are held to the step's time limit
+// like a plugin run.
+func (app *AppContext) filterData(ctx context.Context, data interface{}, predicate *goja.Program, params map[string]interface{}, timeout time.Duration) (interface{}, error) {
+	rows, ok := normalizeJSON(data).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("filter: input must be an array")
+	}
+
+	release, err := app.acquireExecSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tenant := tenantOf(ctx)
+	vm := app.acquireVM(tenant, true)
+	vm.Set("params", isolate(params))
+
+	limit := app.scriptTimeout(timeout)
+	guard := &interruptGuard{vm: vm.Runtime}
+	stopCancel := context.AfterFunc(ctx, func() {
+		guard.interrupt(ctx.Err())
+	})
+	defer stopCancel()
+	timer := time.AfterFunc(limit, func() {
+		guard.interrupt(fmt.Errorf("%w after %s", errExecutionTimeout, limit))
+	})
+	defer timer.Stop()
+
+	kept, err := func() ([]interface{}, error) {
+		kept := make([]interface{}, 0)
+		for i, row := range rows {
+			vm.Set("item", isolate(row))
+			vm.Set("index", i)
+			match, err := vm.RunProgram(predicate)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if match.ToBoolean() {
+				kept = append(kept, row)
+			}
+		}
+		return kept, nil
+	}()
+	interrupted := guard.finish()
+	app.releaseVM(tenant, true, vm, err == nil && !interrupted)
+
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	return kept, nil
+}
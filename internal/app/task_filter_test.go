@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterData(t *testing.T) {
+	rows := []interface{}{
+		map[string]interface{}{"site": "north", "temp": 12.5},
+		map[string]interface{}{"site": "south", "temp": 31.0},
+		map[string]interface{}{"site": "north-east", "temp": 25},
+		map[string]interface{}{"site": "west"},
+	}
+	row := func(i int) interface{} { return normalizeJSON(rows[i]) }
+
+	tests := []struct {
+		name    string
+		data    interface{}
+		where   string
+		params  map[string]interface{}
+		want    []interface{}
+		wantErr string
+	}{
+		{"numeric field", rows, "item.temp > 20", nil, []interface{}{row(1), row(2)}, ""},
+		{"string field", rows, `item.site.startsWith("north")`, nil, []interface{}{row(0), row(2)}, ""},
+		{"missing field", rows, "item.temp === undefined", nil, []interface{}{row(3)}, ""},
+		{"params", rows, "item.temp >= params.min", map[string]interface{}{"min": 25}, []interface{}{row(1), row(2)}, ""},
+		{"index", rows, "index % 2 == 1", nil, []interface{}{row(1), row(3)}, ""},
+		{"truthy values", []interface{}{0, 1, "", "x", nil}, "item", nil, []interface{}{1.0, "x"}, ""},
+		{"nothing kept", rows, "false", nil, []interface{}{}, ""},
+		{"mutating item", rows, "item.temp = 0; true", nil, []interface{}{row(0), row(1), row(2), row(3)}, ""},
+		{"not an array", map[string]interface{}{"a": 1}, "true", nil, nil, "input must be an array"},
+		{"predicate throws", rows, "item.site.length > item.temp.toFixed(0)", nil, nil, "item 3"},
+	}
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predicate, err := filterPredicate(map[string]interface{}{"where": tt.where})
+			if err != nil {
+				t.Fatalf("filterPredicate: %v", err)
+			}
+			got, err := app.filterData(context.Background(), tt.data, predicate, tt.params, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filterData: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterData = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPredicate(t *testing.T) {
+	for _, step := range []map[string]interface{}{
+		{},
+		{"where": "  "},
+		{"where": 3},
+		{"where": "item.temp >"},
+	} {
+		if _, err := filterPredicate(step); err == nil {
+			t.Errorf("filterPredicate(%v) succeeded", step)
+		}
+	}
+}
+
+func TestFilterDataTimeout(t *testing.T) {
+	app := newTestApp(t)
+	predicate, err := filterPredicate(map[string]interface{}{"where": "while (true) {}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.filterData(context.Background(), []interface{}{1}, predicate, nil, 50*time.Millisecond)
+	if !errors.Is(err, errExecutionTimeout) {
+		t.Fatalf("err = %v, want %v", err, errExecutionTimeout)
+	}
+}
+
+func TestRunTaskFilterStep(t *testing.T) {
+	app := newTaskTestApp(t)
+	addTestPlugin(t, app, "rows", `[{v: 1}, {v: 5}, {v: 10}]`)
+	task := TaskDefinition{Steps: []map[string]interface{}{
+		taskStep("a", "rows"),
+		taskStep("b", "", "type", StepTypeFilter, "where", "item.v > params.min", "params", map[string]interface{}{"min": 3}),
+	}}
+	results, err := app.runTask(context.Background(), task, nil)
+	want := map[string]interface{}{
+		"a": []interface{}{map[string]interface{}{"v": 1.0}, map[string]interface{}{"v": 5.0}, map[string]interface{}{"v": 10.0}},
+		"b": []interface{}{map[string]interface{}{"v": 5.0}, map[string]interface{}{"v": 10.0}},
+	}
+	checkTaskResults(t, results, err, want, nil)
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+const maxStepRetries = 10
+
+// taskStepName returns the step's name, or step_<index> when it has none.
+func taskStepName(index int, step map[string]interface{}) string {
+	if name, ok := step["name"].(string); ok {
+		return name
+	}
+	return fmt.Sprintf("step_%d", index)
+}
+
+// stepPlugin reads the plugin name of a plugin step.
+func stepPlugin(step map[string]interface{}) (string, error) {
+	raw, ok := step["plugin"]
+	if !ok || raw == nil {
+		return "", fmt.Errorf("plugin name not specified")
+	}
+	name, ok := raw.(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("plugin must be a plugin name")
+	}
+	return name, nil
+}
+
+// stepParams reads the optional params mapping of a task step.
+func stepParams(step map[string]interface{}) (map[string]interface{}, error) {
+	switch v := step["params"].(type) {
+	case nil:
+		return make(map[string]interface{}), nil
+	case map[string]interface{}:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("params must be a mapping")
+	}
+}
+
+// stepInputRef reads the optional input reference of a task step: the job
+// the task reads its input from, or an earlier step whose output the step
+// runs on. Either may be empty.
+func stepInputRef(step map[string]interface{}) (jobID, fromStep string, err error) {
+	var ref map[string]interface{}
+	switch v := step["input"].(type) {
+	case nil:
+		return "", "", nil
+	case map[string]interface{}:
+		ref = v
+	default:
+		return "", "", fmt.Errorf("input must be a mapping")
+	}
+
+	if raw, ok := ref["job_id"]; ok && raw != nil {
+		if jobID, ok = raw.(string); !ok {
+			return "", "", fmt.Errorf("input.job_id must be a string")
+		}
+	}
+	if raw, ok := ref["from_step"]; ok && raw != nil {
+		if fromStep, ok = raw.(string); !ok || fromStep == "" {
+			return "", "", fmt.Errorf("input.from_step must be a step name")
+		}
+	}
+	return jobID, fromStep, nil
+}
+
+// stepRetryPolicy reads the optional retries and retry_delay fields of a task
+// step. retry_delay is a Go duration string ("500ms", "2s") or a number of
+// seconds.
+func stepRetryPolicy(step map[string]interface{}) (retries int, delay time.Duration, err error) {
+	switch v := step["retries"].(type) {
+	case nil:
+	case int:
+		retries = v
+	case float64:
+		retries = int(v)
+	default:
+		return 0, 0, fmt.Errorf("retries must be a number")
+	}
+	if retries < 0 || retries > maxStepRetries {
+		return 0, 0, fmt.Errorf("retries must be between 0 and %d", maxStepRetries)
+	}
+
+	delay, err = durationValue("retry_delay", step["retry_delay"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return retries, delay, nil
+}
+
+// stepTimeout reads the optional timeout field of a task step, in the same
+// formats as retry_delay. Zero means the server default.
+func stepTimeout(step map[string]interface{}) (time.Duration, error) {
+	return durationValue("timeout", step["timeout"])
+}
+
+// durationValue converts a Go duration string or a number of seconds, as
+// decoded from YAML or JSON, into a non-negative duration. A missing value is
+// zero.
+func durationValue(field string, v interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch v := v.(type) {
+	case nil:
+	case string:
+		var err error
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", field, err)
+		}
+	case int:
+		d = time.Duration(v) * time.Second
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	default:
+		return 0, fmt.Errorf("%s must be a duration", field)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", field)
+	}
+	return d, nil
+}
+
+// stepDependencies reads the optional depends_on list of a task step.
+func stepDependencies(step map[string]interface{}) ([]string, error) {
+	switch v := step["depends_on"].(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		names := make([]string, len(v))
+		for i, dep := range v {
+			name, ok := dep.(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("depends_on must list step names")
+			}
+			names[i] = name
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("depends_on must be a list of step names")
+	}
+}
+
+// taskDependencies returns, for every step of a task, the indexes of the
+// steps it depends on. Dependencies must name earlier steps, which rules out
+// cycles.
+func taskDependencies(task TaskDefinition) ([][]int, error) {
+	deps := make([][]int, len(task.Steps))
+	index := make(map[string]int)
+	for i, step := range task.Steps {
+		name := taskStepName(i, step)
+		names, err := stepDependencies(step)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", name, err)
+		}
+		for _, dep := range names {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("step %s: depends_on %s does not name an earlier step", name, dep)
+			}
+			deps[i] = append(deps[i], j)
+		}
+		index[name] = i
+	}
+	return deps, nil
+}
+
+// Error policies for TaskDefinition.OnError.
+const (
+	OnErrorStop     = "stop"
+	OnErrorContinue = "continue"
+	OnErrorFailFast = "fail_fast"
+)
+
+// errorPolicy returns the task's on_error policy. When unset, sequential
+// tasks stop at the first failure and parallel tasks run every step.
+func (task TaskDefinition) errorPolicy() (string, error) {
+	switch task.OnError {
+	case "":
+		if task.Parallel {
+			return OnErrorContinue, nil
+		}
+		return OnErrorStop, nil
+	case OnErrorStop, OnErrorContinue, OnErrorFailFast:
+		return task.OnError, nil
+	default:
+		return "", fmt.Errorf("on_error must be one of %s, %s or %s", OnErrorStop, OnErrorContinue, OnErrorFailFast)
+	}
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Built-in step types. Steps without a type run a plugin.
+const (
+	StepTypePlugin    = "plugin"
+	StepTypeTransform = "transform"
+	StepTypeMerge     = "merge"
+	StepTypeAggregate = "aggregate"
+	StepTypeFilter    = "filter"
+)
+
+// stepType returns the step's type, defaulting to a plugin step.
+func stepType(step map[string]interface{}) (string, error) {
+	switch v := step["type"].(type) {
+	case nil:
+		return StepTypePlugin, nil
+	case string:
+		switch v {
+		case StepTypePlugin, StepTypeTransform, StepTypeMerge, StepTypeAggregate, StepTypeFilter:
+			return v, nil
+		}
+		return "", fmt.Errorf("unknown step type %q", v)
+	default:
+		return "", fmt.Errorf("step type must be a string")
+	}
+}
+
+// transformMapping reads a transform step's mapping of output field to
+// input field.
+func transformMapping(step map[string]interface{}) (map[string]string, error) {
+	raw, ok := step["mapping"].(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("transform step needs a mapping of output field to input field")
+	}
+	mapping := make(map[string]string, len(raw))
+	for out, in := range raw {
+		field, ok := in.(string)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("mapping for %s must name an input field", out)
+		}
+		mapping[out] = field
+	}
+	return mapping, nil
+}
+
+// transformData builds a new object for data, or for every object in an
+// array, holding only the mapped fields under their new names. Input fields
+// may be dotted paths into nested objects; missing fields are left out.
+func transformData(data interface{}, mapping map[string]string) (interface{}, error) {
+	switch v := normalizeJSON(data).(type) {
+	case map[string]interface{}:
+		return transformObject(v, mapping), nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("transform: item %d is not an object", i)
+			}
+			out[i] = transformObject(obj, mapping)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("transform: input must be an object or an array of objects")
+	}
+}
+
+func transformObject(obj map[string]interface{}, mapping map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(mapping))
+	for field, path := range mapping {
+		if value, ok := lookupPath(obj, path); ok {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+func lookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = obj
+	for _, key := range strings.Split(path, ".") {
+		current, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = current[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// mergeSources reads the names of the earlier steps a merge step combines.
+func mergeSources(step map[string]interface{}) ([]string, error) {
+	raw, ok := step["steps"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("merge step needs a list of steps to merge")
+	}
+	names := make([]string, len(raw))
+	for i, v := range raw {
+		name, ok := v.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("merge steps must be step names")
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// mergeData combines the outputs of several steps. Objects are merged into
+// one, with later steps overriding fields of earlier ones; arrays are
+// concatenated in order. Mixing objects and arrays is an error.
+func mergeData(names []string, outputs []interface{}) (interface{}, error) {
+	var merged interface{}
+	for i, output := range outputs {
+		switch v := normalizeJSON(output).(type) {
+		case map[string]interface{}:
+			obj, ok := merged.(map[string]interface{})
+			if merged == nil {
+				obj, ok = make(map[string]interface{}), true
+			}
+			if !ok {
+				return nil, fmt.Errorf("merge: step %s returned an object but %s returned an array", names[i], names[0])
+			}
+			for key, value := range v {
+				obj[key] = value
+			}
+			merged = obj
+		case []interface{}:
+			arr, ok := merged.([]interface{})
+			if merged == nil {
+				arr, ok = make([]interface{}, 0, len(v)), true
+			}
+			if !ok {
+				return nil, fmt.Errorf("merge: step %s returned an array but %s returned an object", names[i], names[0])
+			}
+			merged = append(arr, v...)
+		default:
+			return nil, fmt.Errorf("merge: step %s did not return an object or an array", names[i])
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransformData(t *testing.T) {
+	mapping := map[string]string{"id": "sample_id", "temp": "reading.celsius"}
+	tests := []struct {
+		name    string
+		data    interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			"object",
+			map[string]interface{}{"sample_id": "a", "reading": map[string]interface{}{"celsius": 21.5}, "extra": true},
+			map[string]interface{}{"id": "a", "temp": 21.5},
+			false,
+		},
+		{
+			"array with missing fields",
+			[]interface{}{
+				map[string]interface{}{"sample_id": "a", "reading": map[string]interface{}{"celsius": 1}},
+				map[string]interface{}{"sample_id": "b", "reading": "broken"},
+				map[string]interface{}{},
+			},
+			[]interface{}{
+				map[string]interface{}{"id": "a", "temp": 1.0},
+				map[string]interface{}{"id": "b"},
+				map[string]interface{}{},
+			},
+			false,
+		},
+		{"array item not an object", []interface{}{map[string]interface{}{}, 3}, nil, true},
+		{"scalar", "text", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transformData(tt.data, mapping)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("transformData = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transformData = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			"objects, later steps win",
+			[]interface{}{
+				map[string]interface{}{"a": 1, "b": 1},
+				map[string]interface{}{"b": 2, "c": 2},
+			},
+			map[string]interface{}{"a": 1.0, "b": 2.0, "c": 2.0},
+			false,
+		},
+		{
+			"arrays concatenated in order",
+			[]interface{}{[]interface{}{1, 2}, []interface{}{}, []interface{}{3}},
+			[]interface{}{1.0, 2.0, 3.0},
+			false,
+		},
+		{"object then array", []interface{}{map[string]interface{}{}, []interface{}{1}}, nil, true},
+		{"array then object", []interface{}{[]interface{}{1}, map[string]interface{}{}}, nil, true},
+		{"scalar", []interface{}{map[string]interface{}{}, 5}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make([]string, len(tt.outputs))
+			for i := range names {
+				names[i] = taskStepName(i, nil)
+			}
+			got, err := mergeData(names, tt.outputs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mergeData = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeData = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
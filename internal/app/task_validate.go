@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validateTask checks a task definition without running it and returns a
+// description of every problem found.
+func (app *AppContext) validateTask(ctx context.Context, task TaskDefinition) []string {
+	problems := make([]string, 0)
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(task.Steps) == 0 {
+		addProblem("task has no steps")
+	}
+	if _, err := task.errorPolicy(); err != nil {
+		addProblem("%v", err)
+	}
+	if _, err := task.schedule(); err != nil {
+		addProblem("%v", err)
+	}
+	if task.CallbackURL != "" {
+		if err := app.checkCallbackURL(task.CallbackURL); err != nil {
+			addProblem("%v", err)
+		}
+	}
+	if err := checkLabels(task.Labels); err != nil {
+		addProblem("%v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, step := range task.Steps {
+		name := taskStepName(i, step)
+		if seen[name] {
+			addProblem("step %s: duplicate step name", name)
+		}
+
+		kind, err := stepType(step)
+		switch {
+		case err != nil:
+			addProblem("step %s: %v", name, err)
+		case kind == StepTypeTransform:
+			if _, err := transformMapping(step); err != nil {
+				addProblem("step %s: %v", name, err)
+			}
+		case kind == StepTypeFilter:
+			if _, err := filterPredicate(step); err != nil {
+				addProblem("step %s: %v", name, err)
+			}
+		case kind == StepTypeAggregate:
+			if _, _, err := aggregateSpec(step); err != nil {
+				addProblem("step %s: %v", name, err)
+			}
+		case kind == StepTypeMerge:
+			sources, err := mergeSources(step)
+			if err != nil {
+				addProblem("step %s: %v", name, err)
+			}
+			for _, from := range sources {
+				if !seen[from] {
+					addProblem("step %s: merged step %s does not name an earlier step", name, from)
+				}
+			}
+		default:
+			pluginName, err := stepPlugin(step)
+			if err != nil {
+				addProblem("step %s: %v", name, err)
+			} else {
+				_, exists := app.lookupPlugin(ctx, pluginName)
+				switch {
+				case exists:
+				case app.pluginDisabled(ctx, pluginName):
+					addProblem("step %s: plugin %s is disabled", name, pluginName)
+				default:
+					addProblem("step %s: plugin %s not found", name, pluginName)
+				}
+			}
+		}
+
+		if params, err := stepParams(step); err != nil {
+			addProblem("step %s: %v", name, err)
+		} else if _, err := expandVars(params, task.Vars); err != nil {
+			addProblem("step %s: params: %v", name, err)
+		}
+
+		jobID, from, err := stepInputRef(step)
+		if err != nil {
+			addProblem("step %s: %v", name, err)
+		}
+		if jobID != "" {
+			if i != 0 {
+				addProblem("step %s: input.job_id is only read from the first step", name)
+			} else if _, err := primitive.ObjectIDFromHex(jobID); err != nil {
+				addProblem("step %s: invalid job ID in input reference", name)
+			}
+		}
+		if from != "" && !seen[from] {
+			addProblem("step %s: from_step %s does not name an earlier step", name, from)
+		}
+
+		deps, err := stepDependencies(step)
+		if err != nil {
+			addProblem("step %s: %v", name, err)
+		}
+		if len(deps) > 0 && !task.Parallel {
+			addProblem("step %s: depends_on only applies to parallel tasks", name)
+		}
+		for _, dep := range deps {
+			if !seen[dep] {
+				addProblem("step %s: depends_on %s does not name an earlier step", name, dep)
+			}
+		}
+
+		if _, _, err := stepRetryPolicy(step); err != nil {
+			addProblem("step %s: %v", name, err)
+		}
+		if _, err := stepTimeout(step); err != nil {
+			addProblem("step %s: %v", name, err)
+		}
+
+		seen[name] = true
+	}
+
+	return problems
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTask(t *testing.T) {
+	tests := []struct {
+		name string
+		task TaskDefinition
+		want []string
+	}{
+		{
+			"valid",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "params", map[string]interface{}{"n": "${var.n}"}),
+				taskStep("b", "double", "input", map[string]interface{}{"from_step": "a"}, "retries", 2),
+			}, Vars: map[string]interface{}{"n": 1}},
+			[]string{},
+		},
+		{"no steps", TaskDefinition{}, []string{"task has no steps"}},
+		{
+			"unknown on_error",
+			TaskDefinition{OnError: "ignore", Steps: []map[string]interface{}{taskStep("a", "inc")}},
+			[]string{"on_error must be one of stop, continue or fail_fast"},
+		},
+		{
+			"missing plugins",
+			TaskDefinition{Steps: []map[string]interface{}{taskStep("a", ""), taskStep("b", "nope")}},
+			[]string{"step a: plugin name not specified", "step b: plugin nope not found"},
+		},
+		{
+			"duplicate step name",
+			TaskDefinition{Steps: []map[string]interface{}{taskStep("a", "inc"), taskStep("a", "inc")}},
+			[]string{"step a: duplicate step name"},
+		},
+		{
+			"later from_step",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "input", map[string]interface{}{"from_step": "b"}),
+				taskStep("b", "inc"),
+			}},
+			[]string{"step a: from_step b does not name an earlier step"},
+		},
+		{
+			"bad job reference",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "input", map[string]interface{}{"job_id": "abc"}),
+				taskStep("b", "inc", "input", map[string]interface{}{"job_id": "65f000000000000000000000"}),
+			}},
+			[]string{"step a: invalid job ID in input reference", "step b: input.job_id is only read from the first step"},
+		},
+		{
+			"bad fields",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "params", []interface{}{1}, "retries", 11, "timeout", "soon"),
+			}},
+			[]string{
+				"step a: params must be a mapping",
+				"step a: retries must be between 0 and 10",
+				`step a: invalid timeout: time: invalid duration "soon"`,
+			},
+		},
+		{
+			"unset var",
+			TaskDefinition{Steps: []map[string]interface{}{
+				taskStep("a", "inc", "params", map[string]interface{}{"n": "${var.missing}"}),
+			}},
+			[]string{`step a: params: undefined variable "missing"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTaskTestApp(t)
+			if got := app.validateTask(context.Background(), tt.task); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateTask = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var varPattern = regexp.MustCompile(`\$\{var\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVars replaces ${var.name} placeholders in value with entries from
+// vars, walking nested maps and arrays. A string that consists of a single
+// placeholder takes the variable's value as-is, so numbers and objects keep
+// their type; placeholders embedded in longer strings are formatted as text.
+func expandVars(value interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expandString(v, vars)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out, err := expandVars(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			expanded[key] = out
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			out, err := expandVars(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = out
+		}
+		return expanded, nil
+	default:
+		return value, nil
+	}
+}
+
+func expandString(s string, vars map[string]interface{}) (interface{}, error) {
+	if m := varPattern.FindStringSubmatchIndex(s); m != nil && m[0] == 0 && m[1] == len(s) {
+		name := s[m[2]:m[3]]
+		val, ok := vars[name]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable %q", name)
+		}
+		return val, nil
+	}
+
+	var missing string
+	out := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := varPattern.FindStringSubmatch(match)[1]
+		val, ok := vars[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return match
+		}
+		return fmt.Sprint(val)
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("undefined variable %q", missing)
+	}
+	return out, nil
+}
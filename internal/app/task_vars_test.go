@@ -0,0 +1,53 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]interface{}{
+		"factor": 2.5,
+		"region": "eu",
+		"limits": map[string]interface{}{"max": 10},
+	}
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"whole string keeps the type", "${var.factor}", 2.5, false},
+		{"object value", "${var.limits}", map[string]interface{}{"max": 10}, false},
+		{"embedded", "data-${var.region}-${var.factor}", "data-eu-2.5", false},
+		{"no placeholders", "plain", "plain", false},
+		{"not a placeholder", "${factor} and ${var.}", "${factor} and ${var.}", false},
+		{"other types untouched", 3.0, 3.0, false},
+		{
+			"nested",
+			map[string]interface{}{"scale": "${var.factor}", "tags": []interface{}{"${var.region}", true}},
+			map[string]interface{}{"scale": 2.5, "tags": []interface{}{"eu", true}},
+			false,
+		},
+		{"undefined", "${var.missing}", nil, true},
+		{"undefined embedded", "x-${var.region}-${var.missing}", nil, true},
+		{"undefined nested", []interface{}{map[string]interface{}{"a": "${var.missing}"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVars(tt.value, vars)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expandVars = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandVars = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
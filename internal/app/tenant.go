@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantPattern limits tenant names to characters MongoDB allows in a
+// database name.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type tenantContextKey struct{}
+
+// withTenant returns a context whose database calls go to tenant's
+// database. requireRole sets it from the caller's API key; background work
+// such as scheduled runs sets it directly.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// tenantOf returns the tenant ctx belongs to, "" for the default one.
+func tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// tenantDatabaseName returns the database holding a tenant's data:
+// database_name itself for the default tenant, and database_name_<tenant>
+// for the others.
+func (cfg ServerConfig) tenantDatabaseName(tenant string) string {
+	if tenant == "" {
+		return cfg.DatabaseName
+	}
+	return cfg.DatabaseName + "_" + tenant
+}
+
+// tenants returns the default tenant and every tenant named by an API key.
+func (cfg ServerConfig) tenants() []string {
+	tenants := []string{""}
+	for _, k := range cfg.APIKeys {
+		if !slices.Contains(tenants, k.Tenant) {
+			tenants = append(tenants, k.Tenant)
+		}
+	}
+	return tenants
+}
+
+// validateTenant checks that a tenant name makes a valid database name.
+func (cfg ServerConfig) validateTenant(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	if !tenantPattern.MatchString(tenant) {
+		return fmt.Errorf("tenant %q may only contain letters, digits, _ and -", tenant)
+	}
+	// MongoDB database names are limited to 63 bytes
+	if name := cfg.tenantDatabaseName(tenant); len(name) > 63 {
+		return fmt.Errorf("tenant %q makes database name %s longer than 63 bytes", tenant, name)
+	}
+	return nil
+}
+
+// database returns the database of the tenant ctx belongs to.
+func (app *AppContext) database(ctx context.Context) *mongo.Database {
+	return app.tenantDatabase(tenantOf(ctx))
+}
+
+func (app *AppContext) tenantDatabase(tenant string) *mongo.Database {
+	return app.MongoClient.Database(app.Config.tenantDatabaseName(tenant))
+}
+
+// databaseTenant returns the tenant whose data a database holds, if any.
+func (app *AppContext) databaseTenant(database string) (string, bool) {
+	for _, tenant := range app.Config.tenants() {
+		if app.Config.tenantDatabaseName(tenant) == database {
+			return tenant, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTenantDatabaseName(t *testing.T) {
+	cfg := ServerConfig{DatabaseName: "dsh", APIKeys: []APIKey{
+		{Key: "a", Tenant: "acme"},
+		{Key: "b"},
+		{Key: "c", Tenant: "acme"},
+		{Key: "d", Tenant: "lab-2"},
+	}}
+	if got, want := cfg.tenants(), []string{"", "acme", "lab-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tenants = %q, want %q", got, want)
+	}
+
+	app := &AppContext{Config: cfg}
+	tests := []struct {
+		tenant string
+		want   string
+	}{
+		{"", "dsh"},
+		{"acme", "dsh_acme"},
+		{"lab-2", "dsh_lab-2"},
+	}
+	for _, tt := range tests {
+		name := cfg.tenantDatabaseName(tt.tenant)
+		if name != tt.want {
+			t.Errorf("tenantDatabaseName(%q) = %s, want %s", tt.tenant, name, tt.want)
+		}
+		if tenant, ok := app.databaseTenant(name); !ok || tenant != tt.tenant {
+			t.Errorf("databaseTenant(%s) = %q, %v, want %q", name, tenant, ok, tt.tenant)
+		}
+	}
+	if tenant, ok := app.databaseTenant("dsh_other"); ok {
+		t.Errorf("databaseTenant(dsh_other) = %q, want no tenant", tenant)
+	}
+}
+
+func TestValidateTenant(t *testing.T) {
+	tests := []struct {
+		tenant  string
+		wantErr string
+	}{
+		{"", ""},
+		{"acme", ""},
+		{"Lab_2-b", ""},
+		{"a/b", "may only contain"},
+		{"a.b", "may only contain"},
+		{"a b", "may only contain"},
+		{strings.Repeat("x", 60), "longer than 63 bytes"},
+	}
+	cfg := ServerConfig{DatabaseName: "dsh"}
+	for _, tt := range tests {
+		err := cfg.validateTenant(tt.tenant)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateTenant(%q): %v", tt.tenant, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateTenant(%q) = %v, want it to mention %q", tt.tenant, err, tt.wantErr)
+		}
+	}
+}
+
+// addTenantPlugin compiles a JavaScript plugin into a tenant's cache.
+func addTenantPlugin(t *testing.T, app *AppContext, tenant, name, source string) *compiledPlugin {
+	t.Helper()
+	plugin, err := compilePlugin(name, source)
+	if err != nil {
+		t.Fatalf("compile %s: %v", name, err)
+	}
+	plugin.Tenant = tenant
+	app.cachePlugin(plugin)
+	return plugin
+}
+
+func TestTenantPlugins(t *testing.T) {
+	app := newTestApp(t)
+	addTestPlugin(t, app, "shared", "input")
+	addTenantPlugin(t, app, "acme", "shared", "input * 2")
+	addTenantPlugin(t, app, "acme", "private", "input")
+
+	calls := []pluginCall{{Name: "shared"}, {Name: "private"}}
+	if got := app.missingPlugins(context.Background(), calls); !reflect.DeepEqual(got, []string{"private"}) {
+		t.Errorf("missing for the default tenant = %v, want [private]", got)
+	}
+	if got := app.missingPlugins(withTenant(context.Background(), "acme"), calls); len(got) != 0 {
+		t.Errorf("missing for acme = %v, want none", got)
+	}
+}
+
+func TestTenantRuntimesNotShared(t *testing.T) {
+	app := newTestApp(t)
+	tamper := addTenantPlugin(t, app, "acme", "tamper", "Array.prototype.leaked = true; 1")
+	check := addTestPlugin(t, app, "check", "typeof [].leaked")
+
+	// A prototype change survives reset, so it must stay in acme's pool
+	for i := 0; i < 3; i++ {
+		if _, err := app.runScript(context.Background(), tamper, scriptCall{}); err != nil {
+			t.Fatalf("tamper: %v", err)
+		}
+		result, err := app.runScript(context.Background(), check, scriptCall{})
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		if result.Value != "undefined" {
+			t.Fatalf("default tenant sees [].leaked as %v", result.Value)
+		}
+	}
+}
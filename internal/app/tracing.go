@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"datasciencehub/internal/version"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	tracerName  = "datasciencehub"
+	serviceName = "datasciencehub"
+)
+
+// tracePropagator reads and writes W3C traceparent and baggage headers.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// noopTracer is the tracer used until initTracing sets up an exporter.
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// initTracing exports spans over OTLP/HTTP to otlp_endpoint. Without an
+// endpoint spans are not recorded, though incoming trace context is still
+// passed on.
+func (app *AppContext) initTracing() {
+	if app.Config.OTLPEndpoint == "" {
+		return
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(app.Config.OTLPEndpoint)}
+	if app.Config.OTLPInsecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		log.Fatalf("Failed to create OTLP exporter: %v", err)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version.Version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	app.tracer = provider.Tracer(tracerName)
+	app.stopTracing = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Error flushing spans: %v", err)
+		}
+	}
+}
+
+// traceRequests runs every request in a server span, continuing the trace of
+// the caller's traceparent header when it sends one.
+func (app *AppContext) traceRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracePropagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := app.tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				attribute.String("request_id", c.GetString("request_id")),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
+	}
+}
+
+// startPluginSpan starts the span of one plugin execution. end records the
+// execution's duration and error, if any.
+func (app *AppContext) startPluginSpan(ctx context.Context, plugin *compiledPlugin) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := app.tracer.Start(ctx, "plugin.run", trace.WithAttributes(
+		attribute.String("plugin.name", plugin.Name),
+		attribute.Int("plugin.version", plugin.Version),
+	))
+	return ctx, func(err error) {
+		span.SetAttributes(attribute.Float64("plugin.duration_ms", float64(time.Since(start).Microseconds())/1000))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
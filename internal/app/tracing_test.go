@@ -0,0 +1,70 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceSpans(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name       string
+		plugin     string
+		wantStatus codes.Code
+	}{
+		{"plugin succeeds", "echo", codes.Unset},
+		{"plugin throws", "fail", codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			exporter := tracetest.NewInMemoryExporter()
+			app.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer(tracerName)
+			addTestPlugin(t, app, "echo", "input")
+			addTestPlugin(t, app, "fail", `throw new Error("boom")`)
+			router := gin.New()
+			router.Use(requestID(), app.traceRequests())
+			router.POST("/plugins/:name/execute", app.executePlugin)
+
+			req := httptest.NewRequest(http.MethodPost, "/plugins/"+tt.plugin+"/execute", strings.NewReader(`{"data": 1}`))
+			req.Header.Set("traceparent", traceparent)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			// The plugin span ends first, inside the request's span
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("%d spans, want the plugin's and the request's", len(spans))
+			}
+			run, request := spans[0], spans[1]
+			if request.Name != "POST /plugins/:name/execute" || request.Parent.SpanID().String() != "00f067aa0ba902b7" {
+				t.Errorf("request span %q with parent %s, want it to continue the caller's trace", request.Name, request.Parent.SpanID())
+			}
+			if run.Name != "plugin.run" || run.Parent.SpanID() != request.SpanContext.SpanID() {
+				t.Errorf("plugin span %q with parent %s, want a child of the request span", run.Name, run.Parent.SpanID())
+			}
+			if run.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("plugin span in trace %s, want the caller's", run.SpanContext.TraceID())
+			}
+
+			attrs := attribute.NewSet(run.Attributes...)
+			if name, _ := attrs.Value("plugin.name"); name.AsString() != tt.plugin {
+				t.Errorf("plugin.name = %q, want %q", name.AsString(), tt.plugin)
+			}
+			if _, ok := attrs.Value("plugin.duration_ms"); !ok {
+				t.Error("plugin span has no plugin.duration_ms")
+			}
+			if run.Status.Code != tt.wantStatus {
+				t.Errorf("plugin span status %v, want %v", run.Status.Code, tt.wantStatus)
+			}
+		})
+	}
+}
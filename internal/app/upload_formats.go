@@ -0,0 +1,137 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readUpload decodes an uploadData request body according to its content
+// type: JSON, NDJSON or CSV. It returns the decoded input together with its JSON encoding, which
+// decides whether the input is stored inline or in GridFS.
+func readUpload(c *gin.Context) ([]byte, interface{}, error) {
+	switch c.ContentType() {
+	case "text/csv":
+		return readCSVUpload(c, c.Request.Body)
+	case "application/x-ndjson":
+		records, err := parseNDJSON(c.Request.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw, err := json.Marshal(records)
+		if err != nil {
+			return nil, nil, err
+		}
+		return raw, records, nil
+	case "multipart/form-data":
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		return readCSVUpload(c, f)
+	default:
+		raw, err := c.GetRawData()
+		if err != nil {
+			return nil, nil, err
+		}
+		var data interface{}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, nil, err
+		}
+		return raw, data, nil
+	}
+}
+
+func readCSVUpload(c *gin.Context, r io.Reader) ([]byte, interface{}, error) {
+	delimiter := ','
+	switch d := c.DefaultQuery("delimiter", ","); {
+	case d == "tab" || d == `\t`:
+		delimiter = '\t'
+	case utf8.RuneCountInString(d) == 1:
+		delimiter, _ = utf8.DecodeRuneInString(d)
+	default:
+		return nil, nil, fmt.Errorf("delimiter must be a single character or \"tab\"")
+	}
+
+	header, err := strconv.ParseBool(c.DefaultQuery("header", "true"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("header must be true or false")
+	}
+
+	rows, err := parseCSV(r, delimiter, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, rows, nil
+}
+
+// parseCSV turns CSV records into row objects keyed by the header row. Without
+// a header, columns are named column_1, column_2, ...
+func parseCSV(r io.Reader, delimiter rune, header bool) ([]interface{}, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = 0
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	var columns []string
+	if header && len(records) > 0 {
+		columns, records = records[0], records[1:]
+	} else if len(records) > 0 {
+		for i := range records[0] {
+			columns = append(columns, fmt.Sprintf("column_%d", i+1))
+		}
+	}
+
+	rows := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseNDJSON decodes newline-delimited JSON into an array with one element
+// per line. Blank lines are skipped; errors name the offending line.
+func parseNDJSON(r io.Reader) ([]interface{}, error) {
+	reader := bufio.NewReader(r)
+	records := make([]interface{}, 0)
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(text); len(trimmed) > 0 {
+			var record interface{}
+			if jsonErr := json.Unmarshal(trimmed, &record); jsonErr != nil {
+				return nil, fmt.Errorf("invalid NDJSON on line %d: %w", line, jsonErr)
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+	}
+}
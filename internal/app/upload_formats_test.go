@@ -0,0 +1,126 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadCSVUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		body    string
+		want    []interface{}
+		wantErr string
+	}{
+		{
+			"header row",
+			"",
+			"name,value\nph,7.1\ntemp,\"21,5\"\n",
+			[]interface{}{
+				map[string]interface{}{"name": "ph", "value": "7.1"},
+				map[string]interface{}{"name": "temp", "value": "21,5"},
+			},
+			"",
+		},
+		{
+			"no header",
+			"?header=false",
+			"ph,7.1\n",
+			[]interface{}{map[string]interface{}{"column_1": "ph", "column_2": "7.1"}},
+			"",
+		},
+		{"semicolons", "?delimiter=%3B", "a;b\n1;2\n", []interface{}{map[string]interface{}{"a": "1", "b": "2"}}, ""},
+		{"tabs", "?delimiter=tab", "a\tb\n1\t2\n", []interface{}{map[string]interface{}{"a": "1", "b": "2"}}, ""},
+		{"header only", "", "a,b\n", []interface{}{}, ""},
+		{"empty", "", "", []interface{}{}, ""},
+		{"ragged rows", "", "a,b\n1\n", nil, "invalid CSV"},
+		{"long delimiter", "?delimiter=%3B%3B", "a;;b\n", nil, "delimiter"},
+		{"bad header flag", "?header=maybe", "a\n", nil, "header must be true or false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/data"+tt.query, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "text/csv")
+
+			_, data, err := readUpload(c)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readUpload: %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("readUpload = %#v, want %#v", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []interface{}
+		wantErr string
+	}{
+		{
+			"records",
+			"{\"id\": 1}\n{\"id\": 2, \"tags\": [\"a\"]}\n",
+			[]interface{}{
+				map[string]interface{}{"id": 1.0},
+				map[string]interface{}{"id": 2.0, "tags": []interface{}{"a"}},
+			},
+			"",
+		},
+		{"no trailing newline", `{"id": 1}` + "\n" + `[2]`, []interface{}{map[string]interface{}{"id": 1.0}, []interface{}{2.0}}, ""},
+		{"blank lines and CRLF", "\r\n{\"id\": 1}\r\n\n  \n3\r\n", []interface{}{map[string]interface{}{"id": 1.0}, 3.0}, ""},
+		{"empty", "", []interface{}{}, ""},
+		{"malformed line", "{\"id\": 1}\n\n{\"id\": }\n{\"id\": 3}\n", nil, "line 3"},
+		{"two values on a line", `{"id": 1} {"id": 2}`, nil, "line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNDJSON(strings.NewReader(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to name %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNDJSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNDJSON = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUploadNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/data", strings.NewReader("{\"id\": 1}\n{\"id\": 2}\n"))
+	c.Request.Header.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+
+	raw, data, err := readUpload(c)
+	if err != nil {
+		t.Fatalf("readUpload: %v", err)
+	}
+	if string(raw) != `[{"id":1},{"id":2}]` {
+		t.Errorf("raw = %s", raw)
+	}
+	if records, ok := data.([]interface{}); !ok || len(records) != 2 {
+		t.Errorf("data = %#v, want two records", data)
+	}
+}
@@ -1,18 +1,406 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+
 	"github.com/dop251/goja"
 )
 
-func (app *AppContext) runScript(program *goja.Program, input interface{}, params map[string]interface{}) (interface{}, error) {
-	vm := app.VMFactory()
-	vm.Set("input", input)
-	vm.Set("params", params)
+const (
+	maxCallStackSize    = 1024
+	memoryCheckInterval = 10 * time.Millisecond
+	heapMetric          = "/memory/classes/heap/objects:bytes"
+)
+
+var (
+	errExecutionTimeout = errors.New("execution timed out")
+	errMemoryLimit      = errors.New("memory limit exceeded")
+	errCallStackLimit   = errors.New("maximum call stack size exceeded")
+	errOutputTooLarge   = errors.New("output too large")
+	errExecutionBusy    = errors.New("too many plugin executions in progress, try again later")
+)
+
+// scriptCall is what one plugin execution runs on.
+type scriptCall struct {
+	Input  interface{}
+	Params map[string]interface{}
+	// Timeout overrides JSTimeout for this run (see scriptTimeout).
+	Timeout time.Duration
+	// Globals are extra values bound into the runtime by name.
+	Globals map[string]interface{}
+	// Blobs, when not nil, are bound as the blobs object of ArrayBuffers.
+	Blobs map[string][]byte
+}
+
+type scriptResult struct {
+	Value interface{}
+	Logs  []LogEntry
+}
+
+// runScript executes a compiled plugin on call.Input and call.Params, after
+// the scripts of its dependencies, and then its process function when it
+// declares one. The script is interrupted when ctx is done
+// or its time limit passes. Console output is returned even when the script
+// fails.
+//
+// The script gets copies of the input, params and globals: it may change
+// them freely, but other steps and later runs sharing them see the
+// originals. The secrets the plugin declares are bound as the secrets
+// object, and masked in its console output. Each run is traced in a span of
+// its own. Wasm plugins are run by runWasm.
+func (app *AppContext) runScript(ctx context.Context, plugin *compiledPlugin, call scriptCall) (result scriptResult, err error) {
+	ctx, endSpan := app.startPluginSpan(ctx, plugin)
+	defer func() { endSpan(err) }()
+
+	if plugin.Runtime == RuntimeWasm {
+		return app.runWasm(ctx, plugin, call)
+	}
 
-	value, err := vm.RunProgram(program)
+	deps, err := app.pluginDependencies(plugin)
 	if err != nil {
-		return nil, err
+		return scriptResult{}, err
+	}
+
+	var secrets map[string]string
+	if len(plugin.Secrets) > 0 {
+		if secrets, err = app.loadSecrets(ctx, plugin.Secrets); err != nil {
+			return scriptResult{}, err
+		}
+	}
+
+	release, err := app.acquireExecSlot(ctx)
+	if err != nil {
+		return scriptResult{}, err
+	}
+	defer release()
+	// A runtime that held secrets is never pooled: the values may linger in
+	// closures or prototypes a script left behind, which reset cannot clear
+	reusable := plugin.Reusable && len(plugin.Secrets) == 0
+	for _, dep := range deps {
+		reusable = reusable && dep.Reusable
+	}
+
+	vm := app.acquireVM(plugin.Tenant, reusable)
+	vm.Set("input", isolate(call.Input))
+	params := plugin.withDefaultParams(call.Params)
+	vm.Set("params", isolate(params))
+	vm.seedRandom(params)
+	for name, value := range call.Globals {
+		vm.Set(name, isolate(value))
+	}
+	if call.Blobs != nil {
+		blobs := vm.NewObject()
+		for name, data := range call.Blobs {
+			blobs.Set(name, vm.NewArrayBuffer(data))
+		}
+		vm.Set("blobs", blobs)
+	}
+	if secrets != nil {
+		vm.bindSecrets(secrets)
+	}
+
+	limit := app.scriptTimeout(call.Timeout)
+	runCtx, cancelRun := context.WithTimeout(ctx, limit)
+	defer cancelRun()
+	vm.ctx = runCtx
+	defer func() { vm.ctx = nil }()
+
+	guard := &interruptGuard{vm: vm.Runtime}
+
+	stopCancel := context.AfterFunc(ctx, func() {
+		guard.interrupt(ctx.Err())
+	})
+	defer stopCancel()
+
+	// Interrupt halts the running program at the next instruction boundary,
+	// so a runaway script cannot outlive its caller.
+	timer := time.AfterFunc(limit, func() {
+		guard.interrupt(fmt.Errorf("%w after %s", errExecutionTimeout, limit))
+	})
+	defer timer.Stop()
+
+	if app.Config.MaxHeapMB > 0 {
+		stop := watchHeap(guard.interrupt, uint64(app.Config.MaxHeapMB)<<20)
+		defer stop()
+	}
+
+	var value goja.Value
+	for _, dep := range deps {
+		if _, err = vm.RunProgram(dep.Program); err != nil {
+			err = fmt.Errorf("dependency %s: %w", dep.Name, err)
+			break
+		}
+	}
+	if err == nil {
+		value, err = vm.RunProgram(plugin.Program)
+	}
+	if err == nil && plugin.Entrypoint {
+		value, err = vm.callEntrypoint()
+	}
+	interrupted := guard.finish()
+	app.recordRun(plugin, errors.Is(scriptError(err), errExecutionTimeout))
+
+	result = scriptResult{Logs: redactSecrets(vm.Logs.Entries(), secrets)}
+	if err == nil {
+		result.Value = value.Export()
+	}
+	app.releaseVM(plugin.Tenant, reusable, vm, err == nil && !interrupted)
+
+	if err != nil {
+		return result, scriptError(err)
+	}
+	if err := checkOutputSize(result.Value, app.Config.MaxOutputBytes); err != nil {
+		result.Value = nil
+		return result, err
+	}
+	return result, nil
+}
+
+// isolate returns a deep copy of the maps and slices in v. goja binds Go
+// maps and slices by reference, so without it a script assigning to its
+// input would change the caller's value. Other values are immutable in the
+// runtime and are shared.
+func isolate(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			out[key] = isolate(elem)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = isolate(elem)
+		}
+		return out
+	}
+
+	// Other map and slice types, such as gin.H or a typed array's export
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			out.SetMapIndex(iter.Key(), isolateValue(iter.Value(), rv.Type().Elem()))
+		}
+		return out.Interface()
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out.Index(i).Set(isolateValue(rv.Index(i), rv.Type().Elem()))
+		}
+		return out.Interface()
+	}
+	return v
+}
+
+// isolateValue copies elem, an element of a map or slice of type typ.
+func isolateValue(elem reflect.Value, typ reflect.Type) reflect.Value {
+	copied := isolate(elem.Interface())
+	if copied == nil {
+		return reflect.Zero(typ)
 	}
+	return reflect.ValueOf(copied)
+}
 
-	return value.Export(), nil
+// checkOutputSize fails when value encodes to more than limit bytes of JSON.
+// Objects and arrays are measured element by element, so a huge result is
+// rejected without encoding all of it. A limit of 0 disables the check.
+func checkOutputSize(value interface{}, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if _, ok := jsonSize(value, limit); !ok {
+		return fmt.Errorf("%w (max_output_bytes is %d)", errOutputTooLarge, limit)
+	}
+	return nil
+}
+
+// jsonSize returns the encoded size of v, or false once it exceeds budget.
+func jsonSize(v interface{}, budget int64) (int64, bool) {
+	var size int64
+	switch v := v.(type) {
+	case map[string]interface{}:
+		size = 2 + max(int64(len(v))-1, 0) // braces and commas
+		for key, elem := range v {
+			keyBytes, _ := json.Marshal(key)
+			elemSize, ok := jsonSize(elem, budget-size)
+			if !ok {
+				return 0, false
+			}
+			size += int64(len(keyBytes)) + 1 + elemSize // key and colon
+			if size > budget {
+				return 0, false
+			}
+		}
+	case []interface{}:
+		size = 2 + max(int64(len(v))-1, 0) // brackets and commas
+		for _, elem := range v {
+			elemSize, ok := jsonSize(elem, budget-size)
+			if !ok {
+				return 0, false
+			}
+			size += elemSize
+			if size > budget {
+				return 0, false
+			}
+		}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return 0, true
+		}
+		size = int64(len(data))
+	}
+	return size, size <= budget
+}
+
+// acquireExecSlot waits for one of the MaxParallel execution slots shared by
+// every plugin run in the process. It gives up with errExecutionBusy after
+// QueueTimeout, or straight away when QueueTimeout is 0.
+func (app *AppContext) acquireExecSlot(ctx context.Context) (release func(), err error) {
+	if app.ExecSlots == nil {
+		return func() {}, nil
+	}
+	release = func() { <-app.ExecSlots }
+
+	select {
+	case app.ExecSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if app.Config.QueueTimeout <= 0 {
+		return nil, errExecutionBusy
+	}
+
+	timer := time.NewTimer(app.Config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case app.ExecSlots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errExecutionBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// scriptErrorStatus is the HTTP status for a failed plugin run: 503 when no
+// execution slot freed up in time, 500 otherwise.
+func scriptErrorStatus(err error) int {
+	if errors.Is(err, errExecutionBusy) {
+		return 503
+	}
+	return 500
+}
+
+// interruptGuard stops interrupts from reaching a runtime once its execution
+// has finished, and records whether one was delivered before that.
+type interruptGuard struct {
+	mu       sync.Mutex
+	vm       *goja.Runtime
+	finished bool
+	fired    bool
+}
+
+func (g *interruptGuard) interrupt(v interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.finished {
+		g.fired = true
+		g.vm.Interrupt(v)
+	}
+}
+
+// finish ends the execution and reports whether it was interrupted.
+func (g *interruptGuard) finish() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.finished = true
+	return g.fired
+}
+
+// scriptTimeout returns the time limit for one execution: JSTimeout when no
+// override was requested, otherwise the override clamped to MaxJSTimeout.
+func (app *AppContext) scriptTimeout(requested time.Duration) time.Duration {
+	if requested <= 0 {
+		return app.Config.JSTimeout
+	}
+	if app.Config.MaxJSTimeout > 0 && requested > app.Config.MaxJSTimeout {
+		return app.Config.MaxJSTimeout
+	}
+	return requested
+}
+
+// watchHeap calls interrupt once the Go heap has grown by more than limit
+// bytes since the call. Crossing the limit forces a collection first, so
+// garbage not yet collected is not held against the script. goja has no
+// per-runtime accounting, so this is a process-level guard rather than a
+// per-run quota: memory allocated by anything else in the process while the
+// script runs counts against it, which is why max_heap_mb is off by default.
+func watchHeap(interrupt func(v interface{}), limit uint64) (stop func()) {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	baseline := sample[0].Value.Uint64()
+	over := func() bool {
+		metrics.Read(sample)
+		used := sample[0].Value.Uint64()
+		return used > baseline && used-baseline > limit
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !over() {
+					continue
+				}
+				runtime.GC()
+				if over() {
+					interrupt(errMemoryLimit)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// scriptError unwraps interrupts raised by runScript back to the sentinel
+// error that caused them.
+func scriptError(err error) error {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if cause, ok := interrupted.Value().(error); ok {
+			return cause
+		}
+	}
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
+		return errCallStackLimit
+	}
+	return err
 }
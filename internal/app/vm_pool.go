@@ -0,0 +1,57 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// vmPool returns the pool of reusable runtimes of a tenant.
+func (app *AppContext) vmPool(tenant string) *sync.Pool {
+	app.VMPoolsMux.Lock()
+	defer app.VMPoolsMux.Unlock()
+	pool, ok := app.VMPools[tenant]
+	if !ok {
+		pool = &sync.Pool{New: func() interface{} { return app.VMFactory() }}
+		app.VMPools[tenant] = pool
+	}
+	return pool
+}
+
+// acquireVM returns a runtime for one execution on behalf of tenant. Scripts
+// that declare top-level let, const or class bindings cannot run twice in
+// the same runtime, so they always get a fresh one.
+func (app *AppContext) acquireVM(tenant string, reusable bool) *ScriptVM {
+	if !reusable {
+		return app.VMFactory()
+	}
+	return app.vmPool(tenant).Get().(*ScriptVM)
+}
+
+// releaseVM returns a runtime to its tenant's pool after a clean run.
+// Runtimes that failed or were interrupted may hold a pending interrupt or
+// half-updated state and are dropped instead.
+func (app *AppContext) releaseVM(tenant string, reusable bool, vm *ScriptVM, clean bool) {
+	if !reusable || !clean {
+		return
+	}
+	vm.reset()
+	app.vmPool(tenant).Put(vm)
+}
+
+// reset removes the globals left behind by the last execution and reinstalls
+// the helpers. Global var and function declarations cannot be deleted, so
+// they are set to undefined instead. Changes to built-in prototypes are not
+// undone, which is why runtimes are pooled per tenant.
+func (vm *ScriptVM) reset() {
+	global := vm.GlobalObject()
+	for _, key := range global.Keys() {
+		if vm.baseline[key] {
+			continue
+		}
+		if err := global.Delete(key); err != nil {
+			global.Set(key, goja.Undefined())
+		}
+	}
+	vm.installGlobals()
+}
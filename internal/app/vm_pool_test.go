@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVMPoolResetsGlobals(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.MaxParallel = 1
+	set := addTestPlugin(t, app, "set", "var leaked = 1; globalThis.other = 2; console = null; input")
+	get := addTestPlugin(t, app, "get", "[typeof leaked, typeof other, typeof console.log]")
+
+	if _, err := app.runScript(context.Background(), set, scriptCall{Input: 1}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := app.runScript(context.Background(), get, scriptCall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"undefined", "undefined", "function"}
+	got, _ := result.Value.([]interface{})
+	if len(got) != len(want) {
+		t.Fatalf("result = %#v, want %#v", result.Value, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result = %#v, want %#v", got, want)
+			break
+		}
+	}
+}
+
+func TestAcquireVMUnreusable(t *testing.T) {
+	app := newTestApp(t)
+	vm := app.acquireVM("", true)
+	app.releaseVM("", true, vm, true)
+
+	// Scripts that cannot run twice in a runtime never get a pooled one
+	if fresh := app.acquireVM("", false); fresh == vm {
+		t.Error("unreusable plugin got a pooled runtime")
+	}
+	// Runtimes released after a failed run are dropped
+	failedVM := app.acquireVM("", true)
+	app.releaseVM("", true, failedVM, false)
+	if next := app.acquireVM("", true); next == failedVM {
+		t.Error("runtime of a failed run was pooled")
+	}
+}
+
+// BenchmarkRunScript compares runs on pooled runtimes with runs that each
+// create their own, as plugins declaring top-level let or const do.
+func BenchmarkRunScript(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		pooled bool
+	}{
+		{"pooled", true},
+		{"fresh", false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			app := newTestApp(b)
+			plugin := addTestPlugin(b, app, "sum", "input.reduce(function (a, b) { return a + b }, 0)")
+			plugin.Reusable = bench.pooled
+			input := []interface{}{1, 2, 3, 4, 5}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := app.runScript(context.Background(), plugin, scriptCall{Input: input}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  interface{}
+		want   interface{}
+	}{
+		{"integer", "input + 1", 41, int64(42)},
+		{"float", "input / 4", 10, 2.5},
+		{"string", "'hello ' + input", "world", "hello world"},
+		{"boolean", "input > 1", 2, true},
+		{"undefined", "undefined", nil, nil},
+		{"null", "null", nil, nil},
+		{"array", "[input, input * 2]", 3, []interface{}{int64(3), int64(6)}},
+		{"object", "({sum: input.a + input.b, keys: Object.keys(input).sort()})", map[string]interface{}{"a": 1.0, "b": 2.0},
+			map[string]interface{}{"sum": int64(3), "keys": []interface{}{"a", "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			plugin := addTestPlugin(t, app, "plugin", tt.source)
+			result, err := app.runScript(context.Background(), plugin, scriptCall{Input: tt.input})
+			if err != nil {
+				t.Fatalf("runScript: %v", err)
+			}
+			if !reflect.DeepEqual(result.Value, tt.want) {
+				t.Errorf("result = %#v, want %#v", result.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompilePluginSyntaxError(t *testing.T) {
+	if _, err := compilePlugin("broken", "input +"); err == nil {
+		t.Fatal("compilePlugin accepted invalid JavaScript")
+	}
+}
+
+func TestRunScriptTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		jsTimeout  time.Duration
+		maxTimeout time.Duration
+		timeout    time.Duration
+	}{
+		{"js_timeout", "while (true) {}", 50 * time.Millisecond, time.Minute, 0},
+		{"requested timeout", "while (true) {}", time.Minute, time.Minute, 50 * time.Millisecond},
+		{"capped by max_js_timeout", "while (true) {}", time.Minute, 50 * time.Millisecond, time.Hour},
+		{"in process", "function process(input) { for (;;) {} }", 50 * time.Millisecond, time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.Config.JSTimeout = tt.jsTimeout
+			app.Config.MaxJSTimeout = tt.maxTimeout
+			plugin := addTestPlugin(t, app, "spin", tt.source)
+
+			start := time.Now()
+			_, err := app.runScript(context.Background(), plugin, scriptCall{Timeout: tt.timeout})
+			if !errors.Is(err, errExecutionTimeout) {
+				t.Fatalf("err = %v, want %v", err, errExecutionTimeout)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("interrupted after %s", elapsed)
+			}
+
+			// The interrupted runtime is not pooled, so the next run is clean
+			echo := addTestPlugin(t, app, "echo", "input")
+			result, err := app.runScript(context.Background(), echo, scriptCall{Input: 42})
+			if err != nil || result.Value != int64(42) {
+				t.Fatalf("next run = %v, %v", result.Value, err)
+			}
+		})
+	}
+}
+
+func TestRunScriptTimeoutLeavesNoGoroutines(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.JSTimeout = 20 * time.Millisecond
+	plugin := addTestPlugin(t, app, "spin", "while (true) {}")
+
+	// A first run starts whatever the runtime keeps for good
+	app.runScript(context.Background(), plugin, scriptCall{})
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		if _, err := app.runScript(context.Background(), plugin, scriptCall{}); !errors.Is(err, errExecutionTimeout) {
+			t.Fatalf("run %d: err = %v, want %v", i, err, errExecutionTimeout)
+		}
+	}
+
+	// The timer and heap watcher of each run end with it
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after the timed out runs, %d before", after, before)
+	}
+}
+
+func TestRunScriptCancelled(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "spin", "while (true) {}")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := app.runScript(ctx, plugin, scriptCall{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRunScriptMemoryLimit(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.MaxHeapMB = 16
+	// Slow builds such as -race must reach the memory check, not the timeout
+	app.Config.JSTimeout = 2 * time.Minute
+	// Far beyond the limit, but bounded should the check never fire
+	hog := addTestPlugin(t, app, "hog", `var chunks = []; while (chunks.length < 512) { chunks.push(new Array(1 << 16).fill(chunks.length)) } chunks.length`)
+
+	result, err := app.runScript(context.Background(), hog, scriptCall{})
+	if !errors.Is(err, errMemoryLimit) {
+		t.Fatalf("hog = %v, %v, want %v", result.Value, err, errMemoryLimit)
+	}
+
+	// Allocating far more than the limit in total is fine while little of it
+	// is live at once
+	churn := addTestPlugin(t, app, "churn", `var n = 0; for (var i = 0; i < 512; i++) { n += new Array(1 << 13).fill(i).length } n`)
+	if result, err := app.runScript(context.Background(), churn, scriptCall{}); err != nil || result.Value != int64(1<<22) {
+		t.Fatalf("churn = %v, %v", result.Value, err)
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	app := &AppContext{Config: ServerConfig{JSTimeout: 5 * time.Second, MaxJSTimeout: time.Minute}}
+	tests := []struct {
+		requested, want time.Duration
+	}{
+		{0, 5 * time.Second},
+		{-time.Second, 5 * time.Second},
+		{10 * time.Second, 10 * time.Second},
+		{time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := app.scriptTimeout(tt.requested); got != tt.want {
+			t.Errorf("scriptTimeout(%s) = %s, want %s", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOutputSize(t *testing.T) {
+	values := []interface{}{
+		nil,
+		"text with \"quotes\" and ü",
+		3.25,
+		[]interface{}{},
+		map[string]interface{}{},
+		[]interface{}{1.0, "two", map[string]interface{}{"k\n": []interface{}{true, nil}}},
+		map[string]interface{}{"a": 1.0, "b": []interface{}{"x", "y"}, "c": map[string]interface{}{}},
+	}
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := int64(len(data))
+		if err := checkOutputSize(value, size); err != nil {
+			t.Errorf("%s rejected at its own size %d: %v", data, size, err)
+		}
+		if err := checkOutputSize(value, size-1); !errors.Is(err, errOutputTooLarge) {
+			t.Errorf("%s accepted under its size: %v", data, err)
+		}
+		if err := checkOutputSize(value, 0); err != nil {
+			t.Errorf("%s rejected with the check disabled: %v", data, err)
+		}
+	}
+}
+
+func TestRunScriptOutputLimit(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.MaxOutputBytes = 1024
+	plugin := addTestPlugin(t, app, "grow", "var out = []; for (var i = 0; i < input; i++) out.push(i); out")
+
+	if _, err := app.runScript(context.Background(), plugin, scriptCall{Input: 10}); err != nil {
+		t.Fatalf("small output: %v", err)
+	}
+	if _, err := app.runScript(context.Background(), plugin, scriptCall{Input: 1000}); !errors.Is(err, errOutputTooLarge) {
+		t.Fatalf("err = %v, want %v", err, errOutputTooLarge)
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		mutate func(copied interface{})
+	}{
+		{"nil", nil, nil},
+		{"scalar", "text", nil},
+		{
+			"nested object",
+			map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1.0, 2.0}}},
+			func(copied interface{}) {
+				inner := copied.(map[string]interface{})["a"].(map[string]interface{})
+				inner["b"].([]interface{})[0] = 9.0
+				inner["c"] = true
+			},
+		},
+		{
+			"array of objects",
+			[]interface{}{map[string]interface{}{"v": 1.0}},
+			func(copied interface{}) { copied.([]interface{})[0].(map[string]interface{})["v"] = 2.0 },
+		},
+		{
+			"typed map",
+			map[string][]float64{"values": {1, 2}},
+			func(copied interface{}) { copied.(map[string][]float64)["values"][1] = 5 },
+		},
+		{
+			"typed slice",
+			[]map[string]interface{}{{"v": 1.0}, {"v": 2.0}},
+			func(copied interface{}) { copied.([]map[string]interface{})[0]["v"] = 2.0 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := normalizeJSON(tt.value)
+			copied := isolate(tt.value)
+			if !reflect.DeepEqual(copied, tt.value) {
+				t.Fatalf("isolate = %#v, want %#v", copied, tt.value)
+			}
+			if tt.mutate == nil {
+				return
+			}
+			tt.mutate(copied)
+			if after := normalizeJSON(tt.value); !reflect.DeepEqual(after, before) {
+				t.Errorf("changing the copy changed the original to %v", after)
+			}
+		})
+	}
+}
+
+func TestRunScriptInputIsolated(t *testing.T) {
+	app := newTestApp(t)
+	plugin := addTestPlugin(t, app, "mutate", `input.rows[0].v = 99; input.rows.push({v: 3}); params.scale = 0; delete input.name; input`)
+	input := map[string]interface{}{"name": "run", "rows": []interface{}{map[string]interface{}{"v": 1.0}}}
+	params := map[string]interface{}{"scale": 2.0}
+
+	if _, err := app.runScript(context.Background(), plugin, scriptCall{Input: input, Params: params}); err != nil {
+		t.Fatalf("runScript: %v", err)
+	}
+	want := map[string]interface{}{"name": "run", "rows": []interface{}{map[string]interface{}{"v": 1.0}}}
+	if !reflect.DeepEqual(input, want) || params["scale"] != 2.0 {
+		t.Errorf("after the run input = %v, params = %v, want them unchanged", input, params)
+	}
+}
+
+func TestAcquireExecSlot(t *testing.T) {
+	tests := []struct {
+		name         string
+		queueTimeout time.Duration
+		freeAfter    time.Duration
+		ctxTimeout   time.Duration
+		wantErr      error
+	}{
+		{"busy without a queue", 0, 0, 0, errExecutionBusy},
+		{"busy after queue_timeout", 50 * time.Millisecond, 0, 0, errExecutionBusy},
+		{"slot freed while queued", time.Second, 20 * time.Millisecond, 0, nil},
+		{"caller gives up", time.Minute, 0, 20 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &AppContext{Config: ServerConfig{QueueTimeout: tt.queueTimeout}, ExecSlots: make(chan struct{}, 1)}
+			held, err := app.acquireExecSlot(context.Background())
+			if err != nil {
+				t.Fatalf("first slot: %v", err)
+			}
+			if tt.freeAfter > 0 {
+				time.AfterFunc(tt.freeAfter, held)
+			}
+			ctx := context.Background()
+			if tt.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+				defer cancel()
+			}
+
+			release, err := app.acquireExecSlot(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			// The slot held first stays taken unless it was freed for this one
+			wantTaken := 1
+			if err == nil {
+				release()
+				wantTaken = 0
+			}
+			if len(app.ExecSlots) != wantTaken {
+				t.Errorf("%d slots taken afterwards, want %d", len(app.ExecSlots), wantTaken)
+			}
+		})
+	}
+}
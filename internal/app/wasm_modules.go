@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// wasmModules shares one compiled module between the plugins built from the
+// same wasm. wazero keeps a single copy of the compiled code of each distinct
+// module, which closing any CompiledModule of it drops, so a module is closed
+// only once no cached plugin holds it and no run is using it.
+type wasmModules struct {
+	mu      sync.Mutex
+	modules map[[sha256.Size]byte]*wasmModule
+}
+
+// wasmModule is a compiled module and the number of plugins and runs holding
+// it.
+type wasmModule struct {
+	compiled wazero.CompiledModule
+	key      [sha256.Size]byte
+	owner    *wasmModules
+	refs     int
+}
+
+func newWasmModules() *wasmModules {
+	return &wasmModules{modules: make(map[[sha256.Size]byte]*wasmModule)}
+}
+
+// compile returns the module compiled from source, holding a reference the
+// caller must release. Compiling happens under the lock, so that a module
+// closing cannot drop the code of one being compiled from the same source.
+func (m *wasmModules) compile(runtime wazero.Runtime, source []byte) (*wasmModule, error) {
+	key := sha256.Sum256(source)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if module, ok := m.modules[key]; ok {
+		module.refs++
+		return module, nil
+	}
+	compiled, err := runtime.CompileModule(context.Background(), source)
+	if err != nil {
+		return nil, err
+	}
+	module := &wasmModule{compiled: compiled, key: key, owner: m, refs: 1}
+	m.modules[key] = module
+	return module, nil
+}
+
+// retain adds a reference for a run. It returns false once the module was
+// closed, after every plugin holding it was replaced.
+func (module *wasmModule) retain() bool {
+	module.owner.mu.Lock()
+	defer module.owner.mu.Unlock()
+	if module.refs == 0 {
+		return false
+	}
+	module.refs++
+	return true
+}
+
+// release drops a reference, closing the module with the last one.
+func (module *wasmModule) release() {
+	module.owner.mu.Lock()
+	defer module.owner.mu.Unlock()
+	module.refs--
+	if module.refs > 0 {
+		return
+	}
+	delete(module.owner.modules, module.key)
+	module.compiled.Close(context.Background())
+}
@@ -0,0 +1,267 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// The exports a wasm plugin provides. The server calls alloc(len) for a
+// buffer, writes the JSON request there and calls process(ptr, len), which
+// returns the address of the JSON result in the high 32 bits and its length
+// in the low 32 bits. A reactor's _initialize is called first.
+const (
+	wasmMemoryExport  = "memory"
+	wasmAllocExport   = "alloc"
+	wasmProcessExport = "process"
+
+	// wasmPageBytes is the size of a WebAssembly memory page.
+	wasmPageBytes = 64 << 10
+)
+
+// wasmMagic starts every WebAssembly module.
+var wasmMagic = []byte("\x00asm")
+
+var (
+	wasmAllocSignature   = wasmSignature{params: []api.ValueType{api.ValueTypeI32}, results: []api.ValueType{api.ValueTypeI32}}
+	wasmProcessSignature = wasmSignature{params: []api.ValueType{api.ValueTypeI32, api.ValueTypeI32}, results: []api.ValueType{api.ValueTypeI64}}
+)
+
+type wasmSignature struct {
+	params, results []api.ValueType
+}
+
+func (s wasmSignature) matches(def api.FunctionDefinition) bool {
+	return slices.Equal(def.ParamTypes(), s.params) && slices.Equal(def.ResultTypes(), s.results)
+}
+
+// wasmRequest is the JSON document a wasm plugin's process receives: the
+// input, the params with the plugin's defaults filled in, and the extra
+// globals of the run, such as a chain's inputs.
+func wasmRequest(call scriptCall, params map[string]interface{}) map[string]interface{} {
+	request := make(map[string]interface{}, len(call.Globals)+2)
+	for name, value := range call.Globals {
+		request[name] = value
+	}
+	request["input"] = call.Input
+	request["params"] = params
+	return request
+}
+
+// initWasmRuntime creates the runtime wasm plugins are compiled and run in.
+// Their memory is capped at max_heap_mb when it is set, and calls stop when
+// their context is done. Modules may import WASI; they get no files,
+// arguments or environment, and clocks and random numbers that are the same
+// every run.
+func (app *AppContext) initWasmRuntime() {
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if pages := app.wasmMemoryLimitPages(); pages > 0 {
+		config = config.WithMemoryLimitPages(pages)
+	}
+	app.WasmRuntime = wazero.NewRuntimeWithConfig(ctx, config)
+	app.wasmModules = newWasmModules()
+	wasi_snapshot_preview1.MustInstantiate(ctx, app.WasmRuntime)
+}
+
+// wasmMemoryLimitPages is max_heap_mb in wasm pages, or 0 for no limit
+// beyond the 4 GiB a module can address.
+func (app *AppContext) wasmMemoryLimitPages() uint32 {
+	if app.Config.MaxHeapMB <= 0 {
+		return 0
+	}
+	return uint32(min(app.Config.MaxHeapMB*(1<<20/wasmPageBytes), 1<<16))
+}
+
+// compileWasmPlugin compiles a wasm module and checks that it exports what a
+// plugin needs. The plugin holds the compiled module until it is released
+// (see compiledPlugin.release).
+func (app *AppContext) compileWasmPlugin(name string, source []byte) (*compiledPlugin, error) {
+	if !bytes.HasPrefix(source, wasmMagic) {
+		return nil, errors.New("not a WebAssembly module")
+	}
+	module, err := app.wasmModules.compile(app.WasmRuntime, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWasmExports(module.compiled); err != nil {
+		module.release()
+		return nil, err
+	}
+
+	return &compiledPlugin{
+		Name:     name,
+		Runtime:  RuntimeWasm,
+		Module:   module,
+		Reusable: true,
+	}, nil
+}
+
+func checkWasmExports(compiled wazero.CompiledModule) error {
+	if _, ok := compiled.ExportedMemories()[wasmMemoryExport]; !ok {
+		return fmt.Errorf("module does not export its %s", wasmMemoryExport)
+	}
+	functions := compiled.ExportedFunctions()
+	for export, signature := range map[string]wasmSignature{
+		wasmAllocExport:   wasmAllocSignature,
+		wasmProcessExport: wasmProcessSignature,
+	} {
+		def, ok := functions[export]
+		if !ok {
+			return fmt.Errorf("module does not export %s", export)
+		}
+		if !signature.matches(def) {
+			return fmt.Errorf("%s must take %v and return %v", export, valueTypeNames(signature.params), valueTypeNames(signature.results))
+		}
+	}
+	return nil
+}
+
+func valueTypeNames(types []api.ValueType) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = api.ValueTypeName(t)
+	}
+	return names
+}
+
+// runWasm runs a wasm plugin on call in a fresh instance of its module, so
+// nothing carries over between runs. It shares the execution slots, time
+// limit and output limit of runScript; memory is limited by the runtime.
+// What the module writes to stdout and stderr is returned as its logs.
+func (app *AppContext) runWasm(ctx context.Context, plugin *compiledPlugin, call scriptCall) (scriptResult, error) {
+	if len(call.Blobs) > 0 {
+		return scriptResult{}, errors.New("blobs are not available to wasm plugins")
+	}
+	params := plugin.withDefaultParams(call.Params)
+	request, err := json.Marshal(normalizeJSON(wasmRequest(call, params)))
+	if err != nil {
+		return scriptResult{}, fmt.Errorf("failed to encode the request: %w", err)
+	}
+
+	release, err := app.acquireExecSlot(ctx)
+	if err != nil {
+		return scriptResult{}, err
+	}
+	defer release()
+
+	// The run holds the module, so that replacing the plugin meanwhile does
+	// not close it under the run
+	if !plugin.Module.retain() {
+		return scriptResult{}, fmt.Errorf("plugin %s was replaced while waiting to run; run it again", plugin.Name)
+	}
+	defer plugin.Module.release()
+
+	limit := app.scriptTimeout(call.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	logs := &logBuffer{}
+	stdout := &logWriter{logs: logs, level: "log"}
+	stderr := &logWriter{logs: logs, level: "error"}
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithStartFunctions("_initialize")
+
+	var output []byte
+	var memorySize uint32
+	err = func() error {
+		instance, err := app.WasmRuntime.InstantiateModule(runCtx, plugin.Module.compiled, config)
+		if err != nil {
+			return err
+		}
+		defer instance.Close(context.Background())
+		memory := instance.Memory()
+		defer func() { memorySize = memory.Size() }()
+
+		results, err := instance.ExportedFunction(wasmAllocExport).Call(runCtx, uint64(len(request)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", wasmAllocExport, err)
+		}
+		ptr := uint32(results[0])
+		if !memory.Write(ptr, request) {
+			return fmt.Errorf("%s returned %d, leaving no room for a %d byte request", wasmAllocExport, ptr, len(request))
+		}
+
+		results, err = instance.ExportedFunction(wasmProcessExport).Call(runCtx, uint64(ptr), uint64(len(request)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", wasmProcessExport, err)
+		}
+		outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+		if limit := app.Config.MaxOutputBytes; limit > 0 && int64(outLen) > limit {
+			return fmt.Errorf("%w (max_output_bytes is %d)", errOutputTooLarge, limit)
+		}
+		data, ok := memory.Read(outPtr, outLen)
+		if !ok {
+			return fmt.Errorf("%s returned %d bytes at %d, outside the module's memory", wasmProcessExport, outLen, outPtr)
+		}
+		output = bytes.Clone(data)
+		return nil
+	}()
+	stdout.flush()
+	stderr.flush()
+
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case runCtx.Err() != nil:
+		err = fmt.Errorf("%w after %s", errExecutionTimeout, limit)
+	case errors.Is(err, errOutputTooLarge):
+	case app.wasmMemoryLimitPages() > 0 && uint64(memorySize) >= uint64(app.wasmMemoryLimitPages())*wasmPageBytes:
+		// A module failing with its memory grown to the limit is taken to
+		// have run out of it
+		err = fmt.Errorf("%w: %w", errMemoryLimit, err)
+	}
+	app.recordRun(plugin, errors.Is(err, errExecutionTimeout))
+
+	result := scriptResult{Logs: logs.Entries()}
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(output, &result.Value); err != nil {
+		return result, fmt.Errorf("%s did not return JSON: %w", wasmProcessExport, err)
+	}
+	return result, nil
+}
+
+// logWriter turns each line written to it into a log entry.
+type logWriter struct {
+	logs    *logBuffer
+	level   string
+	pending []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.logs.append(w.level, string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+	// A line longer than a log message is cut, like console output
+	if len(w.pending) > maxLogMessage {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush logs what is left of an unterminated line.
+func (w *logWriter) flush() {
+	if len(w.pending) > 0 {
+		w.logs.append(w.level, string(w.pending))
+		w.pending = nil
+	}
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wasmSection encodes a module section; the tests' sections are all
+// shorter than 128 bytes.
+func wasmSection(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// testWasmModule assembles a plugin module with a memory of memoryPages
+// pages, a bump allocator as alloc and processBody as process.
+func testWasmModule(memoryPages byte, processBody ...byte) []byte {
+	module := append([]byte{}, wasmMagic...)
+	module = append(module, 1, 0, 0, 0)
+
+	// (i32) -> i32 and (i32, i32) -> i64
+	module = append(module, wasmSection(1, 2, 0x60, 1, 0x7f, 1, 0x7f, 0x60, 2, 0x7f, 0x7f, 1, 0x7e)...)
+	module = append(module, wasmSection(3, 2, 0, 1)...)
+	module = append(module, wasmSection(5, 1, 0, memoryPages)...)
+	// The next free address, starting at 1024
+	module = append(module, wasmSection(6, 1, 0x7f, 1, 0x41, 0x80, 0x08, 0x0b)...)
+
+	exports := []byte{3}
+	exports = append(append(exports, wasmName(wasmMemoryExport)...), 2, 0)
+	exports = append(append(exports, wasmName(wasmAllocExport)...), 0, 0)
+	exports = append(append(exports, wasmName(wasmProcessExport)...), 0, 1)
+	module = append(module, wasmSection(7, exports...)...)
+
+	// alloc returns the next free address and moves it past the buffer
+	alloc := []byte{0, 0x23, 0, 0x23, 0, 0x20, 0, 0x6a, 0x24, 0, 0x0b}
+	code := append([]byte{2, byte(len(alloc))}, alloc...)
+	code = append(append(code, byte(len(processBody))), processBody...)
+	return append(module, wasmSection(10, code...)...)
+}
+
+var (
+	// wasmEcho returns its request: ptr << 32 | len.
+	wasmEcho = []byte{0, 0x20, 0, 0xad, 0x42, 0x20, 0x86, 0x20, 1, 0xad, 0x84, 0x0b}
+	// wasmSpin loops forever.
+	wasmSpin = []byte{0, 0x03, 0x40, 0x0c, 0, 0x0b, 0, 0x0b}
+)
+
+func TestWasmPluginUploadAndRun(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+
+	upload := pluginUpload{Name: " echo ", Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...)}
+	program, warnings, err := app.preparePlugin(ctx, &upload, nil)
+	if err != nil {
+		t.Fatalf("preparePlugin: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	if upload.Name != "echo" || program.Runtime != RuntimeWasm {
+		t.Fatalf("prepared %q with runtime %q", upload.Name, program.Runtime)
+	}
+	program.DefaultParams = map[string]interface{}{"scale": 2}
+	app.cachePlugin(program)
+
+	plugin, ok := app.lookupPlugin(ctx, "echo")
+	if !ok {
+		t.Fatal("plugin not cached")
+	}
+	result, err := app.runScript(ctx, plugin, scriptCall{
+		Input:   []interface{}{1, 2, 3},
+		Params:  map[string]interface{}{"offset": 1},
+		Globals: map[string]interface{}{"inputs": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatalf("runScript: %v", err)
+	}
+	want := map[string]interface{}{
+		"input":  []interface{}{float64(1), float64(2), float64(3)},
+		"params": map[string]interface{}{"offset": float64(1), "scale": float64(2)},
+		"inputs": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(result.Value, want) {
+		t.Errorf("result = %#v, want %#v", result.Value, want)
+	}
+}
+
+func TestWasmPluginTimeout(t *testing.T) {
+	app := newTestApp(t)
+	program, err := app.compileWasmPlugin("spin", testWasmModule(1, wasmSpin...))
+	if err != nil {
+		t.Fatalf("compileWasmPlugin: %v", err)
+	}
+
+	start := time.Now()
+	_, err = app.runScript(context.Background(), program, scriptCall{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, errExecutionTimeout) {
+		t.Fatalf("err = %v, want %v", err, errExecutionTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("interrupted after %s", elapsed)
+	}
+}
+
+func TestCompileUploadWasm(t *testing.T) {
+	app := newTestApp(t)
+	app.WasmRuntime.Close(context.Background())
+	app.Config.MaxHeapMB = 1
+	app.initWasmRuntime()
+
+	tests := []struct {
+		name    string
+		upload  pluginUpload
+		wantErr string
+	}{
+		{"ok", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...)}, ""},
+		{"missing module", pluginUpload{Runtime: RuntimeWasm}, "wasm is required"},
+		{"javascript too", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...), JavaScript: "input"}, "javascript cannot be given"},
+		{"dependencies", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...), Dependencies: []string{"lib"}}, "cannot have dependencies"},
+		{"secrets", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...), Secrets: []string{"TOKEN"}}, "cannot read secrets"},
+		{"not a module", pluginUpload{Runtime: RuntimeWasm, Wasm: []byte("input")}, "not a WebAssembly module"},
+		{"over max_heap_mb", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(17, wasmEcho...)}, "invalid wasm"},
+		{"wasm for javascript", pluginUpload{JavaScript: "input", Wasm: testWasmModule(1, wasmEcho...)}, "only be given for the wasm runtime"},
+		{"no source", pluginUpload{}, "javascript is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.compileUpload(&tt.upload)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWasmModulesClosed(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	source := testWasmModule(1, wasmEcho...)
+	compile := func(name string) *compiledPlugin {
+		t.Helper()
+		program, err := app.compileWasmPlugin(name, source)
+		if err != nil {
+			t.Fatalf("compileWasmPlugin: %v", err)
+		}
+		return program
+	}
+	run := func(plugin *compiledPlugin) error {
+		_, err := app.runScript(ctx, plugin, scriptCall{Input: 1})
+		return err
+	}
+	open := func() int {
+		app.wasmModules.mu.Lock()
+		defer app.wasmModules.mu.Unlock()
+		return len(app.wasmModules.modules)
+	}
+
+	// Plugins built from the same wasm share its module
+	a, b := compile("a"), compile("b")
+	if a.Module != b.Module || open() != 1 {
+		t.Fatalf("two compiles of one module gave %d open modules", open())
+	}
+	app.cachePlugin(a)
+	app.cachePlugin(b)
+
+	// Replacing a closes nothing b still uses
+	replacement := compile("a")
+	app.cachePlugin(replacement)
+	if err := run(b); err != nil {
+		t.Fatalf("b after replacing a: %v", err)
+	}
+
+	// A run in progress keeps the module open after the last plugin goes
+	if !replacement.Module.retain() {
+		t.Fatal("retain failed while cached")
+	}
+	app.uncachePlugin("", "a")
+	app.uncachePlugin("", "b")
+	if open() != 1 {
+		t.Fatal("module closed under a run")
+	}
+	if err := run(replacement); err != nil {
+		t.Fatalf("run alongside the one in progress: %v", err)
+	}
+	replacement.Module.release()
+	if open() != 0 {
+		t.Fatalf("%d modules open after every plugin was released", open())
+	}
+
+	// A run that waited for a slot while the plugin went reports it
+	if err := run(replacement); err == nil || !strings.Contains(err.Error(), "was replaced") {
+		t.Errorf("run of a released plugin = %v, want it replaced", err)
+	}
+}
+
+func TestWasmModuleClosedAfterFailedChecks(t *testing.T) {
+	app := newTestApp(t)
+	tests := []struct {
+		name   string
+		upload pluginUpload
+	}{
+		// Compiles, but exports nothing a plugin needs
+		{"missing exports", pluginUpload{Runtime: RuntimeWasm, Wasm: append(append([]byte{}, wasmMagic...), 1, 0, 0, 0)}},
+		{"invalid input_schema", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...), InputSchema: map[string]interface{}{"type": 3}}},
+		{"invalid secrets", pluginUpload{Runtime: RuntimeWasm, Wasm: testWasmModule(1, wasmEcho...), Secrets: []string{"bad name"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.upload.Name = "checked"
+			if _, _, err := app.preparePlugin(context.Background(), &tt.upload, nil); err == nil {
+				t.Fatal("preparePlugin succeeded")
+			}
+			if n := len(app.wasmModules.modules); n != 0 {
+				t.Errorf("%d modules left open", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookTimeout = 10 * time.Second
+	// webhookBackoff is the wait before the first retry; it doubles for
+	// each retry after that.
+	webhookBackoff = 2 * time.Second
+
+	webhookSignatureHeader = "X-Signature-256"
+)
+
+var (
+	// webhookClient only connects to public addresses.
+	webhookClient = newWebhookClient(false)
+	// privateWebhookClient is used instead with webhook_allow_private set.
+	privateWebhookClient = newWebhookClient(true)
+)
+
+// errCallbackNotPublic is returned for callbacks resolving to a non-public
+// address; they are not retried.
+var errCallbackNotPublic = errors.New("callback address is not public")
+
+// reservedPrefixes are ranges outside those the net/netip predicates cover
+// that no callback should reach: "this network", carrier-grade NAT, IETF
+// protocol assignments, benchmarking, and NAT64 to any of them.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// newWebhookClient returns the client callbacks are posted with. Unless
+// allowPrivate is set, it refuses to connect to loopback, private,
+// link-local and other non-public addresses. The address is checked when
+// connecting, after the name was resolved, so neither a redirect nor a DNS
+// answer can point a callback at the server's own network. Proxies are not
+// used, as they would hide the address.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr) {
+				return fmt.Errorf("%w: %s", errCallbackNotPublic, addr)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// publicAddr reports whether addr may be reached from the internet at large.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookPayload is what a job's callback_url receives once the job has
+// finished.
+type webhookPayload struct {
+	JobID      primitive.ObjectID `json:"job_id"`
+	Name       string             `json:"name"`
+	Status     string             `json:"status"`
+	Summary    resultSummary      `json:"summary"`
+	FinishedAt time.Time          `json:"finished_at"`
+}
+
+// resultSummary describes a job's results without including them.
+type resultSummary struct {
+	Steps  int      `json:"steps"`
+	Failed []string `json:"failed"`
+}
+
+// checkCallbackURL accepts absolute http and https URLs. Unless
+// webhook_allow_private is set, hosts given as a non-public IP address, or
+// as localhost, are refused straight away; names resolving to one are
+// refused when the callback is delivered.
+func (app *AppContext) checkCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("callback_url must be an absolute http or https URL, got %q", raw)
+	}
+	if app.Config.WebhookAllowPrivate {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	addr, err := netip.ParseAddr(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (err == nil && !publicAddr(addr)) {
+		return fmt.Errorf("callback_url must point to a public address, got %q (see webhook_allow_private)", raw)
+	}
+	return nil
+}
+
+// summarizeResults counts the steps of a chain or task result and names the
+// ones that failed, which recorded an error instead of an output.
+func summarizeResults(results interface{}) resultSummary {
+	summary := resultSummary{Failed: make([]string, 0)}
+	steps, ok := normalizeJSON(results).(map[string]interface{})
+	if !ok {
+		return summary
+	}
+	summary.Steps = len(steps)
+	for name, output := range steps {
+		if failure, ok := output.(map[string]interface{}); ok {
+			if _, failed := failure["error"]; failed {
+				summary.Failed = append(summary.Failed, name)
+			}
+		}
+	}
+	sort.Strings(summary.Failed)
+	return summary
+}
+
+// notifyJob posts the finished job to its callback_url, if it has one, in
+// the background. Deliveries that fail are retried webhook_retries times.
+// The job is read from the database of ctx's tenant; ctx being cancelled
+// does not stop the delivery.
+func (app *AppContext) notifyJob(ctx context.Context, jobID primitive.ObjectID) {
+	go func() {
+		defer recoverAsError("webhook for job "+jobID.Hex(), new(error))
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), app.Config.DBTimeout)
+		defer cancel()
+
+		var job DataJob
+		collection := app.database(ctx).Collection("data_jobs")
+		opts := options.FindOne().SetProjection(bson.M{"input_data": 0})
+		if err := collection.FindOne(ctx, bson.M{"_id": jobID}, opts).Decode(&job); err != nil {
+			log.Printf("Webhook: failed to load job %s: %v", jobID.Hex(), err)
+			return
+		}
+		if job.CallbackURL == "" || !jobFinished(job.Status) {
+			return
+		}
+		if err := decodeJobResults(&job); err != nil {
+			log.Printf("Webhook: %v", err)
+			return
+		}
+
+		body, err := json.Marshal(webhookPayload{
+			JobID:      job.ID,
+			Name:       job.Name,
+			Status:     job.Status,
+			Summary:    summarizeResults(job.Results),
+			FinishedAt: job.UpdatedAt,
+		})
+		if err != nil {
+			log.Printf("Webhook: failed to encode job %s: %v", jobID.Hex(), err)
+			return
+		}
+
+		if err := app.deliverWebhook(job.CallbackURL, body); err != nil {
+			log.Printf("Webhook: giving up on job %s: %v", jobID.Hex(), err)
+		}
+	}()
+}
+
+// deliverWebhook posts body to target until it answers with a 2xx status.
+// Network errors, 429 and 5xx answers are retried with backoff; other
+// answers are final.
+func (app *AppContext) deliverWebhook(target string, body []byte) error {
+	backoff := webhookBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = app.postWebhook(target, body)
+		if err == nil || !retry || attempt >= app.Config.WebhookRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (app *AppContext) postWebhook(target string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if app.Config.WebhookSecret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(app.Config.WebhookSecret, body))
+	}
+
+	client := webhookClient
+	if app.Config.WebhookAllowPrivate {
+		client = privateWebhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errCallbackNotPublic), err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("callback answered %s", resp.Status)
+}
+
+// signWebhook returns the X-Signature-256 value for body: "sha256=" and the
+// hex HMAC-SHA256 of the body keyed with secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
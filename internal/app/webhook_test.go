@@ -0,0 +1,138 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// webhookReceiver is a stub callback endpoint that checks signatures the
+// way a receiver holding secret would.
+type webhookReceiver struct {
+	secret   string
+	status   int
+	calls    atomic.Int64
+	verified atomic.Bool
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.calls.Add(1)
+	body, _ := io.ReadAll(req.Body)
+	signature, ok := strings.CutPrefix(req.Header.Get(webhookSignatureHeader), "sha256=")
+	mac := hmac.New(sha256.New, []byte(r.secret))
+	mac.Write(body)
+	got, err := hex.DecodeString(signature)
+	r.verified.Store(ok && err == nil && hmac.Equal(got, mac.Sum(nil)))
+	w.WriteHeader(r.status)
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		secret       string
+		receiverKey  string
+		status       int
+		allowPrivate bool
+		wantErr      string
+		wantCalls    int64
+		wantVerified bool
+	}{
+		{"signed", "s3cret", "s3cret", http.StatusOK, true, "", 1, true},
+		{"signed with another secret", "s3cret", "other", http.StatusNoContent, true, "", 1, false},
+		{"unsigned", "", "s3cret", http.StatusOK, true, "", 1, false},
+		{"client error not retried", "s3cret", "s3cret", http.StatusBadRequest, true, "400 Bad Request", 1, true},
+		{"loopback refused", "s3cret", "s3cret", http.StatusOK, false, errCallbackNotPublic.Error(), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{secret: tt.receiverKey, status: tt.status}
+			srv := httptest.NewServer(receiver)
+			defer srv.Close()
+
+			app := &AppContext{Config: ServerConfig{
+				WebhookSecret:       tt.secret,
+				WebhookAllowPrivate: tt.allowPrivate,
+				WebhookRetries:      3,
+			}}
+			err := app.deliverWebhook(srv.URL, []byte(`{"status":"completed"}`))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("deliverWebhook: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if got := receiver.calls.Load(); got != tt.wantCalls {
+				t.Errorf("receiver called %d times, want %d", got, tt.wantCalls)
+			}
+			if got := receiver.verified.Load(); got != tt.wantVerified {
+				t.Errorf("signature verified = %t, want %t", got, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// HMAC-SHA256 test case 2 of RFC 4231
+	got := signWebhook("Jefe", []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+}
+
+func TestCheckCallbackURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"https://example.com/hook", false, false},
+		{"http://93.184.216.34:8080/hook", false, false},
+		{"ftp://example.com/hook", false, true},
+		{"/hook", false, true},
+		{"http://localhost:8080/hook", false, true},
+		{"http://api.localhost./hook", false, true},
+		{"http://127.0.0.1/hook", false, true},
+		{"http://10.1.2.3/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://169.254.169.254/latest", false, true},
+		{"http://100.64.0.1/hook", false, true},
+		{"http://127.0.0.1/hook", true, false},
+	}
+	for _, tt := range tests {
+		app := &AppContext{Config: ServerConfig{WebhookAllowPrivate: tt.allowPrivate}}
+		if err := app.checkCallbackURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("checkCallbackURL(%q) with allow_private %t = %v, want error %t", tt.url, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::", true},
+		{"127.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"198.18.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("publicAddr(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Package version holds build information injected at link time, e.g.
+//
+//	go build -ldflags "-X datasciencehub/internal/version.Version=v1.2.0" ./cmd/server
+package version
+
+// Set through -ldflags -X; unset values keep these defaults.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)